@@ -0,0 +1,665 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type accessConfig struct {
+	// requestTTL is how long approvers have to decide a request.
+	requestTTL time.Duration
+	// maxGrant caps how long the grant an approved request creates lasts.
+	maxGrant time.Duration
+}
+
+// accessRequestResponse adds the votes cast so far to a request.
+type accessRequestResponse struct {
+	models.AccessRequest
+	Decisions []models.AccessDecision `json:"decisions"`
+}
+
+type accessPolicyResponse struct {
+	models.AccessPolicy
+	Approvers []models.AccessApprover `json:"approvers"`
+}
+
+// SubmitAccessRequestHandler lets a member ask for a role or a single
+// permission in their current organization. The organization's approvers are
+// emailed and the request expires after requestTTL if nobody decides it.
+func (app *application) SubmitAccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if user.OrgID == "" {
+		app.unauthorizedResponse(w, r, errors.New("only organization members can request access"))
+		return
+	}
+
+	var payload dtos.AccessRequestPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if payload.Role != "" && !slices.Contains(GrantableRoles[models.GrantAccountUser], payload.Role) {
+		app.badRequestResponse(w, r, fmt.Errorf("the %s role cannot be requested", payload.Role))
+		return
+	}
+	if payload.Permission != "" && !requestablePermission(payload.Permission) {
+		app.badRequestResponse(w, r, fmt.Errorf("the %s permission cannot be requested", payload.Permission))
+		return
+	}
+	if time.Duration(payload.Minutes)*time.Minute > app.config.access.maxGrant {
+		app.badRequestResponse(w, r, fmt.Errorf("access can be granted for at most %s", app.config.access.maxGrant))
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, uuid.MustParse(user.OrgID))
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	req := &models.AccessRequest{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		RequesterID:    uuid.MustParse(user.UserID),
+		Role:           payload.Role,
+		Permission:     payload.Permission,
+		Justification:  payload.Justification,
+		GrantMinutes:   payload.Minutes,
+		Status:         models.AccessRequestPending,
+		ExpiresAt:      time.Now().Add(app.config.access.requestTTL),
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if req.Role != "" {
+			holdings, err := principalHoldings(ctx, tx, userPrincipal(req.RequesterID, org.ID), time.Now())
+			if err != nil {
+				return err
+			}
+			if broken := brokenRules(append(holdingRoles(holdings, false), req.Role), false); len(broken) > 0 {
+				return sodViolation(broken[0])
+			}
+		}
+		if err := tx.Access.CreateRequest(ctx, req); err != nil {
+			return err
+		}
+		emails, err := approverEmails(ctx, tx, org)
+		if err != nil {
+			return err
+		}
+		for _, email := range emails {
+			if err := app.enqueueAccessRequested(ctx, tx.Outbox, req, email); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("error submitting access request", zap.String("requester", user.UserID), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("access requested",
+		"request", req.ID, "organization", org.ID, "requester", req.RequesterID,
+		"role", req.Role, "permission", req.Permission)
+	app.jsonResponse(w, http.StatusCreated, req, "access request submitted; waiting for approval")
+}
+
+// ListMyAccessRequestsHandler lists the caller's own requests, optionally
+// narrowed by ?status=.
+func (app *application) ListMyAccessRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	filter, ok := app.readAccessRequestFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.RequesterID = uuid.MustParse(user.UserID)
+
+	reqs, err := app.store.Access.ListRequests(ctx, filter)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, reqs, "access requests")
+}
+
+// CancelAccessRequestHandler withdraws the caller's pending request given by
+// ?id=.
+func (app *application) CancelAccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, err := app.store.Access.GetRequest(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isSelf(user, req.RequesterID) {
+		app.unauthorizedResponse(w, r, errors.New("only the requester can cancel an access request"))
+		return
+	}
+
+	if err := app.store.Access.ResolveRequest(ctx, req.ID, models.AccessRequestCancelled, nil, time.Now()); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "access request cancelled")
+}
+
+// ListAccessRequestsHandler lists the requests of ?organizationId= for its
+// approvers and admins, optionally narrowed by ?status=. Super admins can
+// leave out the organization to see every request.
+func (app *application) ListAccessRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	filter, ok := app.readAccessRequestFilter(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("organizationId") != "" {
+		orgID, err := readUUIDParam(r, "organizationId")
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		org, err := app.store.Organization.GetOrganization(ctx, orgID)
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		if !app.canReviewAccess(w, r, user, org) {
+			return
+		}
+		filter.OrganizationID = org.ID
+	} else if !isSuperAdmin(user) {
+		app.badRequestResponse(w, r, errors.New("organizationId is required"))
+		return
+	}
+
+	reqs, err := app.store.Access.ListRequests(ctx, filter)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, reqs, "access requests")
+}
+
+// GetAccessRequestHandler returns the request given by ?id= with its votes.
+// Requesters can always see their own requests.
+func (app *application) GetAccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, err := app.store.Access.GetRequest(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isSelf(user, req.RequesterID) {
+		org, err := app.store.Organization.GetOrganization(ctx, req.OrganizationID)
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		if !app.canReviewAccess(w, r, user, org) {
+			return
+		}
+	}
+
+	decisions, err := app.store.Access.ListDecisions(ctx, req.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, accessRequestResponse{AccessRequest: *req, Decisions: decisions}, "access request")
+}
+
+// ApproveAccessRequestHandler records the caller's approval of the request
+// given by ?id=. Once the organization's quorum is met the request is
+// approved and the grant is created.
+func (app *application) ApproveAccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideAccessRequest(w, r, models.AccessDecisionApprove)
+}
+
+// RejectAccessRequestHandler rejects the request given by ?id=. A single
+// rejection is final.
+func (app *application) RejectAccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideAccessRequest(w, r, models.AccessDecisionReject)
+}
+
+func (app *application) decideAccessRequest(w http.ResponseWriter, r *http.Request, decision string) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.AccessDecisionPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	req, err := app.store.Access.GetRequest(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if isSelf(user, req.RequesterID) {
+		app.unauthorizedResponse(w, r, errors.New("you cannot decide your own access request"))
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, req.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	approver, err := app.isAccessApprover(ctx, user, org)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !approver {
+		app.unauthorizedResponse(w, r, errors.New("you are not an approver for this organization"))
+		return
+	}
+
+	if req.Status != models.AccessRequestPending {
+		app.conflictResponse(w, r, errors.New("access request is already "+req.Status))
+		return
+	}
+	now := time.Now()
+	if now.After(req.ExpiresAt) {
+		if err := app.expireAccessRequest(ctx, req, now); err != nil {
+			app.logger.Error("error expiring access request", zap.String("id", req.ID.String()), zap.Error(err))
+		}
+		app.conflictResponse(w, r, errors.New("access request has expired; ask for a new one"))
+		return
+	}
+
+	policy, err := app.store.Access.GetPolicy(ctx, org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	approverID := uuid.MustParse(user.UserID)
+	approverType := models.GrantAccountAdmin
+	if user.OrgID != "" {
+		approverType = models.GrantAccountUser
+	}
+
+	var resp accessRequestResponse
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		err := tx.Access.RecordDecision(ctx, &models.AccessDecision{
+			RequestID:    req.ID,
+			ApproverID:   approverID,
+			ApproverType: approverType,
+			Decision:     decision,
+			Comment:      payload.Comment,
+		})
+		if err != nil {
+			return err
+		}
+
+		decisions, err := tx.Access.ListDecisions(ctx, req.ID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case decision == models.AccessDecisionReject:
+			err = tx.Access.ResolveRequest(ctx, req.ID, models.AccessRequestRejected, nil, now)
+		case countApprovals(decisions) >= policy.Quorum:
+			grant := &models.RoleGrant{
+				ID:             uuid.New(),
+				AccountType:    models.GrantAccountUser,
+				AccountID:      req.RequesterID,
+				OrganizationID: &req.OrganizationID,
+				Role:           req.Role,
+				Permission:     req.Permission,
+				Kind:           models.GrantKindAssigned,
+				ValidFrom:      now,
+				ValidUntil:     now.Add(time.Duration(req.GrantMinutes) * time.Minute),
+				Justification:  req.Justification,
+				GrantedBy:      approverID,
+			}
+			if err := tx.Grant.CreateGrant(ctx, grant); err != nil {
+				return err
+			}
+			if err := checkStaticSoD(ctx, tx, userPrincipal(req.RequesterID, req.OrganizationID)); err != nil {
+				return err
+			}
+			err = tx.Access.ResolveRequest(ctx, req.ID, models.AccessRequestApproved, &grant.ID, now)
+		}
+		if err != nil {
+			return err
+		}
+
+		updated, err := tx.Access.GetRequest(ctx, req.ID)
+		if err != nil {
+			return err
+		}
+		resp = accessRequestResponse{AccessRequest: *updated, Decisions: decisions}
+		if updated.Status == models.AccessRequestPending {
+			return nil
+		}
+		return app.notifyRequester(ctx, tx, updated)
+	})
+	if err != nil {
+		app.logger.Error("error deciding access request", zap.String("id", req.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("access request decided",
+		"request", req.ID, "approver", approverID, "decision", decision, "status", resp.Status)
+	message := fmt.Sprintf("decision recorded; %d of %d approvals", countApprovals(resp.Decisions), policy.Quorum)
+	if resp.Status != models.AccessRequestPending {
+		message = "access request " + resp.Status
+	}
+	app.jsonResponse(w, http.StatusOK, resp, message)
+}
+
+// GetAccessPolicyHandler returns the quorum and approvers of the
+// organization given by ?id=.
+func (app *application) GetAccessPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := app.loadOrganization(w, r, PermOrgView, "view")
+	if !ok {
+		return
+	}
+
+	policy, err := app.store.Access.GetPolicy(ctx, org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	approvers, err := app.store.Access.ListApprovers(ctx, org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, accessPolicyResponse{AccessPolicy: *policy, Approvers: approvers}, "access policy")
+}
+
+// SetAccessPolicyHandler replaces the quorum and approvers of the
+// organization given by ?id=. Approvers must be admins or members of the
+// organization, and there must be enough of them to meet the quorum.
+func (app *application) SetAccessPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := app.loadOrganization(w, r, PermSettingsOrg, "configure")
+	if !ok {
+		return
+	}
+
+	var payload dtos.AccessPolicyPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if len(payload.Approvers) > 0 && payload.Quorum > len(payload.Approvers) {
+		app.badRequestResponse(w, r, errors.New("quorum cannot exceed the number of approvers"))
+		return
+	}
+
+	approvers := make([]models.AccessApprover, 0, len(payload.Approvers))
+	for _, a := range payload.Approvers {
+		var err error
+		if a.AccountType == models.GrantAccountAdmin {
+			_, err = app.store.Admin.GetAdmin(ctx, a.AccountID)
+		} else {
+			_, err = app.store.Membership.GetMembership(ctx, a.AccountID, org.ID)
+		}
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		approvers = append(approvers, models.AccessApprover{
+			OrganizationID: org.ID,
+			AccountID:      a.AccountID,
+			AccountType:    a.AccountType,
+		})
+	}
+
+	user, _ := GetUserFromContext(ctx)
+	policy := &models.AccessPolicy{
+		OrganizationID: org.ID,
+		Quorum:         payload.Quorum,
+		UpdatedBy:      uuid.MustParse(user.UserID),
+	}
+	if err := app.store.Access.SetPolicy(ctx, policy, approvers); err != nil {
+		app.logger.Error("error saving access policy", zap.String("organization", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, accessPolicyResponse{AccessPolicy: *policy, Approvers: approvers}, "access policy updated")
+}
+
+// readAccessRequestFilter reads ?status=. It writes the error response
+// itself.
+func (app *application) readAccessRequestFilter(w http.ResponseWriter, r *http.Request) (store.AccessRequestFilter, bool) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.AccessRequestPending, models.AccessRequestApproved, models.AccessRequestRejected,
+		models.AccessRequestExpired, models.AccessRequestCancelled:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid access request status"))
+		return store.AccessRequestFilter{}, false
+	}
+	return store.AccessRequestFilter{Status: status}, true
+}
+
+// requestablePermission reports whether perm comes with one of the roles
+// members can be granted.
+func requestablePermission(perm string) bool {
+	for _, role := range GrantableRoles[models.GrantAccountUser] {
+		if slices.Contains(RolePermissions[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccessApprover reports whether the caller decides access requests in
+// org: one of its designated approvers or, when it has none, one of its
+// admins.
+func (app *application) isAccessApprover(ctx context.Context, user UserClaims, org *models.Organization) (bool, error) {
+	approvers, err := app.store.Access.ListApprovers(ctx, org.ID)
+	if err != nil {
+		return false, err
+	}
+	if len(approvers) == 0 {
+		return app.isOrgAdminOrSuper(ctx, user, org), nil
+	}
+	for _, approver := range approvers {
+		if !isSelf(user, approver.AccountID) {
+			continue
+		}
+		// a member only approves while acting in the organization
+		if approver.AccountType == models.GrantAccountAdmin && user.OrgID == "" ||
+			approver.AccountType == models.GrantAccountUser && user.OrgID == org.ID.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// canReviewAccess checks that the caller can see the access requests of org:
+// its admins and its approvers can. It writes the error response itself.
+func (app *application) canReviewAccess(w http.ResponseWriter, r *http.Request, user UserClaims, org *models.Organization) bool {
+	if app.isOrgAdminOrSuper(r.Context(), user, org) {
+		return true
+	}
+	approver, err := app.isAccessApprover(r.Context(), user, org)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return false
+	}
+	if !approver {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view access requests of this organization"))
+		return false
+	}
+	return true
+}
+
+// approverEmails returns where new requests in org are announced: its
+// designated approvers, or its owner when it has none. Approvers whose
+// account is gone are skipped.
+func approverEmails(ctx context.Context, tx store.TxStorage, org *models.Organization) ([]string, error) {
+	approvers, err := tx.Access.ListApprovers(ctx, org.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(approvers) == 0 {
+		approvers = []models.AccessApprover{{AccountID: org.AdminID, AccountType: models.GrantAccountAdmin}}
+	}
+
+	emails := make([]string, 0, len(approvers))
+	for _, approver := range approvers {
+		email, err := accountEmail(ctx, tx, approver.AccountType, approver.AccountID)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// accountEmail looks up the email of an admin or user account.
+func accountEmail(ctx context.Context, tx store.TxStorage, accountType string, id uuid.UUID) (string, error) {
+	if accountType == models.GrantAccountAdmin {
+		admin, err := tx.Admin.GetAdmin(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return admin.Email, nil
+	}
+	user, err := tx.User.GetUser(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// notifyRequester emails the requester how req was resolved.
+func (app *application) notifyRequester(ctx context.Context, tx store.TxStorage, req *models.AccessRequest) error {
+	email, err := accountEmail(ctx, tx, models.GrantAccountUser, req.RequesterID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return app.enqueueAccessResolved(ctx, tx.Outbox, req, email)
+}
+
+// expireAccessRequest marks req expired and tells the requester. A request
+// resolved in the meantime is left alone.
+func (app *application) expireAccessRequest(ctx context.Context, req *models.AccessRequest, now time.Time) error {
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Access.ResolveRequest(ctx, req.ID, models.AccessRequestExpired, nil, now); err != nil {
+			return err
+		}
+		expired := *req
+		expired.Status = models.AccessRequestExpired
+		return app.notifyRequester(ctx, tx, &expired)
+	})
+	if errors.Is(err, store.ErrAccessRequestNotPending) {
+		return nil
+	}
+	return err
+}
+
+// sweepAccessRequests expires the requests nobody decided in time.
+func (app *application) sweepAccessRequests(ctx context.Context, now time.Time) {
+	reqs, err := app.store.Access.ListExpiredRequests(ctx, now)
+	if err != nil {
+		app.logger.Error("error listing expired access requests", zap.Error(err))
+		return
+	}
+	for i := range reqs {
+		if err := app.expireAccessRequest(ctx, &reqs[i], now); err != nil {
+			app.logger.Error("error expiring access request", zap.String("id", reqs[i].ID.String()), zap.Error(err))
+		}
+	}
+}
+
+func countApprovals(decisions []models.AccessDecision) int {
+	approvals := 0
+	for _, d := range decisions {
+		if d.Decision == models.AccessDecisionApprove {
+			approvals++
+		}
+	}
+	return approvals
+}
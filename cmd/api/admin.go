@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
@@ -15,6 +16,9 @@ import (
 
 func (app *application) AdminLoginHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditAdminLogin, auditResourceAdmin)
+	defer audit.commit()
+
 	var payload dtos.LoginPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
 		return
@@ -25,12 +29,18 @@ func (app *application) AdminLoginHandler(w http.ResponseWriter, r *http.Request
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	audit.actor(models.GrantAccountAdmin, admin.ID, admin.Role)
+	audit.resource(admin.ID)
 	if admin.Status == helpers.StatusPending {
 		app.badRequestResponse(w, r, errors.New("Account yet to be activated, activate thy account"))
 		return
 	}
+	if admin.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errAccountSuspended)
+		return
+	}
 
-	token, err := GenerateJWT(admin.ID, admin.Email, admin.Name, string(admin.Role))
+	token, err := GenerateJWT(admin.ID, admin.Email, admin.Name, string(admin.Role), uuid.Nil)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		app.logger.Error("error generating jwt token", zap.Error(err))
@@ -45,13 +55,15 @@ func (app *application) AdminLoginHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditUserCreate, auditResourceUser)
+	defer audit.commit()
 
 	user, err := GetUserFromContext(ctx)
 	if err != nil {
 		app.unauthorizedResponse(w, r, err)
 		return
 	}
-	if !app.HasPermission(user.Role, PermUsersCreate) {
+	if !app.HasPermission(user, PermUsersCreate) {
 		app.unauthorizedResponse(w, r, errors.New("you do not have permission to create users"))
 		return
 	}
@@ -61,76 +73,135 @@ func (app *application) CreateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	inviteToken, err := app.GenerateInviteToken()
-	if err != nil {
-		app.internalServerError(w, r, err)
-		app.logger.Error("error generating invite token", zap.Error(err))
-
-		return
-	}
-	hashedToken := HashToken(inviteToken)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		app.logger.Error("error hashing invite token", zap.Error(err))
-		return
-	}
-
 	// Check if the organization exists
 	org, err := app.store.Organization.GetOrganization(ctx, payload.OrganizationID)
 
 	if err != nil {
-		app.badRequestResponse(w, r, errors.New("organization does not exist"))
+		if errors.Is(err, store.ErrNotFound) {
+			app.badRequestResponse(w, r, errors.New("organization does not exist"))
+			return
+		}
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	if !app.isOrgAdminOrSuper(user, org) {
+	audit.organization(org.ID)
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to add users to this organization"))
 		return
 	}
 
+	// an existing account just joins the organization; it already has a
+	// password, so no invite is sent
+	existing, err := app.store.User.GetUserByEmail(ctx, payload.Email)
+	switch {
+	case err == nil:
+		membership := &models.Membership{
+			ID:             uuid.New(),
+			UserID:         existing.ID,
+			OrganizationID: org.ID,
+			Role:           RoleUser,
+			Status:         helpers.StatusActive,
+		}
+		audit.retarget(auditMembershipCreate, auditResourceMembership)
+		audit.resource(membership.ID)
+		audit.change(nil, membership)
+		err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+			if err := tx.Membership.CreateMembership(ctx, membership); err != nil {
+				return err
+			}
+			return app.publishWebhook(ctx, tx, org, models.WebhookEventUserInvited, webhookUser{
+				UserID: existing.ID, Email: existing.Email, Role: membership.Role, Status: existing.Status,
+			})
+		})
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		app.jsonResponse(w, http.StatusCreated, nil, "User added to organization")
+		return
+	case !errors.Is(err, store.ErrNotFound):
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
 	newUser := &models.User{
-		ID:             uuid.New(),
-		Name:           payload.Email,
-		Email:          payload.Email,
-		Role:           RoleUser,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
-		Status:         helpers.StatusPending,
-		OrganizationID: org.ID,
+		ID:        uuid.New(),
+		Name:      payload.Email,
+		Email:     payload.Email,
+		Role:      RoleUser,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Status:    helpers.StatusPending,
 	}
+	audit.resource(newUser.ID)
+	audit.change(nil, newUser)
 
 	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
-		if err = tx.User.AddUserToOrganization(ctx, newUser); err != nil {
-			return err
-		}
-
-		if err = tx.UserInvite.CreateUserInvites(ctx, &models.UserInvites{
-			ID:        uuid.New(),
-			UserId:    newUser.ID,
-			TokenHash: hashedToken,
-			ExpiresAt: time.Now().Add(24 * time.Hour),
-			CreatedAt: time.Now(),
-		}); err != nil {
-			return err
-		}
-		return nil
+		return app.inviteUser(ctx, tx, org, newUser, &models.Membership{
+			ID:             uuid.New(),
+			UserID:         newUser.ID,
+			OrganizationID: org.ID,
+			Role:           RoleUser,
+			Status:         helpers.StatusActive,
+		})
 	})
 
 	if err != nil {
 		app.logger.Info("error creating user", zap.Error(err))
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	// TODO: user invites
+	app.jsonResponse(w, http.StatusCreated, nil, "Invite sent successfully")
 
-	app.sendAdminInviteAsync(user.Email, inviteToken)
+}
 
-	app.jsonResponse(w, http.StatusCreated, nil, "Invite sent successfully")
+// inviteUser creates user as a pending account in org through membership
+// and queues the invite they activate the account with. Call it inside the
+// transaction that makes the change.
+func (app *application) inviteUser(
+	ctx context.Context,
+	tx store.TxStorage,
+	org *models.Organization,
+	user *models.User,
+	membership *models.Membership,
+) error {
+	inviteToken, err := app.GenerateInviteToken()
+	if err != nil {
+		return err
+	}
+
+	if err = tx.User.CreateUser(ctx, user); err != nil {
+		return err
+	}
+
+	if err = tx.Membership.CreateMembership(ctx, membership); err != nil {
+		return err
+	}
+
+	if err = tx.UserInvite.CreateUserInvites(ctx, &models.UserInvites{
+		ID:        uuid.New(),
+		UserId:    user.ID,
+		TokenHash: HashToken(inviteToken),
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
 
+	if err = app.enqueueUserInvite(ctx, tx.Outbox, user.ID, user.Email); err != nil {
+		return err
+	}
+
+	return app.publishWebhook(ctx, tx, org, models.WebhookEventUserInvited, webhookUser{
+		UserID: user.ID, Email: user.Email, Role: membership.Role, Status: user.Status,
+	})
 }
 func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditAdminCreate, auditResourceAdmin)
+	defer audit.commit()
 
 	var payload dtos.CreateAdminPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
@@ -142,7 +213,7 @@ func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Reques
 		app.unauthorizedResponse(w, r, err)
 		return
 	}
-	if !app.HasPermission(user.Role, PermAdminCreate) {
+	if !app.HasPermission(user, PermAdminCreate) {
 		app.unauthorizedResponse(w, r, errors.New("you do not have permission to create admin"))
 		return
 	}
@@ -154,12 +225,6 @@ func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Reques
 
 		return
 	}
-	hashedToken := HashToken(inviteToken)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		app.logger.Error("error hashing invite token", zap.Error(err))
-		return
-	}
 
 	// use transaction; it enables that ensures operation fails or succeed together so there are no orphaned records
 
@@ -174,6 +239,8 @@ func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Reques
 		Status:    helpers.StatusPending,
 		CreatedBy: uuid.MustParse(user.UserID),
 	}
+	audit.resource(admin.ID)
+	audit.change(nil, admin)
 
 	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
 		if err = tx.Admin.CreateAdmin(ctx, admin); err != nil {
@@ -182,7 +249,7 @@ func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Reques
 		invite := &models.AdminInvites{
 			ID:        uuid.New(),
 			AdminId:   admin.ID,
-			TokenHash: hashedToken,
+			TokenHash: HashToken(inviteToken),
 			ExpiresAt: time.Now().Add(24 * time.Hour),
 			CreatedAt: time.Now(),
 		}
@@ -190,23 +257,23 @@ func (app *application) CreateAdminHandler(w http.ResponseWriter, r *http.Reques
 			return err
 		}
 
-		return nil
+		return app.enqueueAdminInvite(ctx, tx.Outbox, admin.ID, admin.Email)
 	})
 
 	if err != nil {
 		app.logger.Info("error creating admin", zap.Error(err))
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	app.sendAdminInviteAsync(admin.Email, inviteToken)
-
-	app.jsonResponse(w, http.StatusCreated, nil, "Invite resent successfully")
+	app.jsonResponse(w, http.StatusCreated, nil, "Admin invited successfully")
 
 }
 
 func (app *application) ActivateAdmin(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditAdminActivate, auditResourceAdmin)
+	defer audit.commit()
 
 	var payload dtos.ActivateAdminPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
@@ -216,9 +283,7 @@ func (app *application) ActivateAdmin(w http.ResponseWriter, r *http.Request) {
 		app.badRequestResponse(w, r, errors.New("passwords do not match"))
 		return
 	}
-	// tokenHash := HashToken(payload.Token)
-
-	invite, err := app.store.AdminInvites.ValidateToken(ctx, payload.Token)
+	invite, err := app.store.AdminInvites.ValidateToken(ctx, HashToken(payload.Token))
 	if err != nil || !invite.UsedAt.IsZero() || time.Now().After(invite.ExpiresAt) {
 		app.badRequestResponse(w, r, errors.New("invalid or expired invite"))
 		return
@@ -231,7 +296,14 @@ func (app *application) ActivateAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.resource(invite.AdminId)
 	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		before, err := tx.Admin.GetAdmin(ctx, invite.AdminId)
+		if err != nil {
+			return err
+		}
+		audit.actor(models.GrantAccountAdmin, before.ID, before.Role)
+
 		if err = tx.Admin.UpdateAdmin(ctx, invite.AdminId, map[string]interface{}{
 			"password": hashedPassword,
 			"status":   helpers.StatusActive,
@@ -245,21 +317,25 @@ func (app *application) ActivateAdmin(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		after, err := tx.Admin.GetAdmin(ctx, invite.AdminId)
+		audit.change(before, after)
 		return err
 	})
 
 	if err != nil {
 		app.logger.Error("error activating admin", zap.Error(err))
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	app.jsonResponse(w, http.StatusOK, nil, "Invite resent successfully")
+	app.jsonResponse(w, http.StatusOK, nil, "Admin has been activated successfully")
 
 }
 
 func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditUserActivate, auditResourceUser)
+	defer audit.commit()
 
 	var payload dtos.ActivateUserPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
@@ -269,9 +345,7 @@ func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
 		app.badRequestResponse(w, r, errors.New("passwords do not match"))
 		return
 	}
-	// tokenHash := HashToken(payload.Token)
-
-	invite, err := app.store.UserInvite.ValidateUserToken(ctx, payload.Token)
+	invite, err := app.store.UserInvite.ValidateUserToken(ctx, HashToken(payload.Token))
 	if err != nil || !invite.UsedAt.IsZero() || time.Now().After(invite.ExpiresAt) {
 		app.badRequestResponse(w, r, errors.New("invalid or expired invite"))
 		return
@@ -284,8 +358,15 @@ func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.actor(models.GrantAccountUser, invite.UserId, "")
+	audit.resource(invite.UserId)
 	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
-		if err = tx.User.UpdateUser(ctx, invite.ID, map[string]interface{}{
+		before, err := tx.User.GetUser(ctx, invite.UserId)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.User.UpdateUser(ctx, invite.UserId, map[string]interface{}{
 			"password": hashedPassword,
 			"status":   helpers.StatusActive,
 		}); err != nil {
@@ -298,12 +379,17 @@ func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		return err
+		after, err := tx.User.GetUser(ctx, invite.UserId)
+		if err != nil {
+			return err
+		}
+		audit.change(before, after)
+		return app.publishUserWebhook(ctx, tx, after, models.WebhookEventUserActivated)
 	})
 
 	if err != nil {
 		app.logger.Error("error activating user", zap.Error(err))
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
@@ -313,6 +399,8 @@ func (app *application) ActivateUser(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) ResendUserVerificationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditAdminInviteResend, auditResourceAdmin)
+	defer audit.commit()
 
 	var payload dtos.ResendVerificationPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
@@ -322,9 +410,10 @@ func (app *application) ResendUserVerificationTokenHandler(w http.ResponseWriter
 
 	admin, err := app.store.Admin.GetAdminByEmail(ctx, payload.Email)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
+	audit.resource(admin.ID)
 
 	rawToken, err := app.GenerateInviteToken()
 	if err != nil {
@@ -340,29 +429,30 @@ func (app *application) ResendUserVerificationTokenHandler(w http.ResponseWriter
 		if err2 != nil {
 			return err2
 		}
-		if err != nil {
-			return err
-		}
 
-		return tx.AdminInvites.UpdateInvite(ctx, invite.ID, map[string]interface{}{
+		if err = tx.AdminInvites.UpdateInvite(ctx, invite.ID, map[string]interface{}{
 			"token_hash": tokenHash,
 			"expires_at": expiresAt,
 			"used_at":    nil,
-		})
+		}); err != nil {
+			return err
+		}
+
+		return app.enqueueAdminInvite(ctx, tx.Outbox, admin.ID, admin.Email)
 	})
 
 	if err != nil {
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	app.sendAdminInviteAsync(admin.Email, rawToken)
-
 	app.jsonResponse(w, http.StatusOK, nil, "Invite resent successfully")
 }
 
 func (app *application) CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditOrganizationCreate, auditResourceOrganization)
+	defer audit.commit()
 
 	var payload dtos.CreateOrganizationPayload
 	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
@@ -376,27 +466,48 @@ func (app *application) CreateOrganizationHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	if !app.HasPermission(user.Role, PermOrgCreate) {
+	if !app.HasPermission(user, PermOrgCreate) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to create organization"))
 		return
 	}
 
+	if payload.ParentID != nil && !app.canAdministerOrg(w, r, user, *payload.ParentID, "create organizations under") {
+		return
+	}
+
 	org := &models.Organization{
-		ID:          uuid.New(),
-		Name:        payload.Name,
-		Email:       payload.Email,
-		Description: payload.Description,
-		Website:     payload.Website,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		AdminID:     uuid.MustParse(user.UserID),
+		ID:                 uuid.New(),
+		Name:               payload.Name,
+		Email:              payload.Email,
+		Description:        payload.Description,
+		Website:            payload.Website,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+		AdminID:            uuid.MustParse(user.UserID),
+		Status:             helpers.StatusActive,
+		InheritPermissions: payload.InheritPermissions == nil || *payload.InheritPermissions,
 	}
 
-	if err := app.store.Organization.CreateOrganization(ctx, org); err != nil {
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Organization.CreateOrganization(ctx, org); err != nil {
+			return err
+		}
+		if payload.ParentID != nil {
+			if err := tx.Organization.MoveOrganization(ctx, org.ID, payload.ParentID, app.config.orgMaxDepth); err != nil {
+				return err
+			}
+			org.ParentID = payload.ParentID
+		}
+		return app.publishWebhook(ctx, tx, org, models.WebhookEventOrgCreated, org)
+	})
+	if err != nil {
 		app.logger.Error("error creating organization", zap.Error(err))
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
+	audit.resource(org.ID)
+	audit.organization(org.ID)
+	audit.change(nil, org)
 
 	app.jsonResponse(w, http.StatusCreated, org, "Organization created successfully")
 
@@ -411,30 +522,24 @@ func (app *application) GetOrganizationHandler(w http.ResponseWriter, r *http.Re
 		app.unauthorizedResponse(w, r, err)
 		return
 	}
-	if !app.HasPermission(user.Role, PermOrgView) {
+	if !app.HasPermission(user, PermOrgView) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to view organization"))
 		return
 	}
 
-	orgId := r.URL.Query().Get("id")
-	if orgId == "" {
-		app.badRequestResponse(w, r, errors.New("Id is required"))
-		return
-	}
-	parsedId, err := uuid.Parse(orgId)
+	parsedId, err := readIDParam(r)
 	if err != nil {
-		app.internalServerError(w, r, err)
-		app.logger.Error("unable to parse id in delete org")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	org, err := app.store.Organization.GetOrganization(ctx, parsedId)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	if !app.isOrgAdminOrSuper(user, org) {
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to access this organization"))
 		return
 	}
@@ -446,46 +551,99 @@ func (app *application) GetOrganizationHandler(w http.ResponseWriter, r *http.Re
 func (app *application) DeleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditOrganizationDelete, auditResourceOrganization)
+	defer audit.commit()
 
 	user, err := GetUserFromContext(ctx)
 	if err != nil {
 		app.unauthorizedResponse(w, r, err)
 		return
 	}
-	if !app.HasPermission(user.Role, PermOrgDelete) {
+	if !app.HasPermission(user, PermOrgDelete) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to delete organization"))
 		return
 	}
 
-	orgId := r.URL.Query().Get("id")
-	if orgId == "" {
-		app.badRequestResponse(w, r, errors.New("Id is required"))
-		return
-	}
-	parsedId, err := uuid.Parse(orgId)
+	parsedId, err := readIDParam(r)
 	if err != nil {
-		app.internalServerError(w, r, err)
-		app.logger.Error("unable to parse id in delete org")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	org, err := app.store.Organization.GetOrganization(ctx, parsedId)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
-	if !app.isOrgAdminOrSuper(user, org) {
+	audit.resource(org.ID)
+	audit.organization(org.ID)
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
 		app.unauthorizedResponse(w, r, errors.New("unauthorized to delete this organization"))
 		return
 	}
 
-	err = app.store.Organization.DeleteOrganization(ctx, parsedId)
+	// subscribers of the organization itself still hear about its deletion
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := app.publishWebhook(ctx, tx, org, models.WebhookEventOrgDeleted, org); err != nil {
+			return err
+		}
+		return tx.Organization.DeleteOrganization(ctx, parsedId)
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	audit.change(org, nil)
+
+	restoreBy := app.restoreDeadline(time.Now())
+	app.jsonResponse(w, http.StatusOK, map[string]time.Time{"restoreBy": restoreBy},
+		"organization deleted successfully, it can be restored until "+restoreBy.Format(time.RFC3339))
+
+}
+
+func (app *application) RestoreOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w, audit := app.beginAudit(w, r, auditOrganizationRestore, auditResourceOrganization)
+	defer audit.commit()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOrgDelete) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to restore organization"))
+		return
+	}
+
+	parsedId, err := readIDParam(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	app.jsonResponse(w, http.StatusOK, nil, "organization deleted successfully")
+	org, err := app.store.Organization.GetDeletedOrganization(ctx, parsedId)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	audit.resource(org.ID)
+	audit.organization(org.ID)
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to restore this organization"))
+		return
+	}
+
+	deletedSince := time.Now().Add(-app.config.softDelete.restoreWindow)
+	if err := app.store.Organization.RestoreOrganization(ctx, parsedId, deletedSince); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if restored, err := app.store.Organization.GetOrganization(ctx, parsedId); err == nil {
+		audit.change(org, restored)
+	}
 
+	app.jsonResponse(w, http.StatusOK, nil, "organization restored successfully")
 }
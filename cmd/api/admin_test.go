@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+func TestActivateUser(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+
+	if err := app.store.Webhook.CreateSubscription(ctx, &models.WebhookSubscription{
+		ID:             uuid.New(),
+		OrganizationID: &org.ID,
+		URL:            "https://hooks.example.com/rbac",
+		Secret:         "secret",
+		Active:         true,
+		EventTypes:     []string{models.WebhookEventUserActivated},
+		CreatedBy:      owner.ID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{
+		ID:     uuid.New(),
+		Name:   "Invited",
+		Email:  "invited@example.com",
+		Role:   RoleUser,
+		Status: helpers.StatusPending,
+	}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		return app.inviteUser(ctx, tx, org, user, &models.Membership{
+			ID:             uuid.New(),
+			UserID:         user.ID,
+			OrganizationID: org.ID,
+			Role:           RoleUser,
+			Status:         helpers.StatusActive,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := queuedEmails(t, app)
+	if len(emails) != 1 || emails[0].Token == nil {
+		t.Fatalf("queued %+v, want one invite", emails)
+	}
+	token, err := app.mintEmailToken(ctx, emails[0].Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"token":           token,
+		"password":        testPassword,
+		"confirmPassword": testPassword,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ActivateUser(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("activating answered %d: %s", rec.Code, rec.Body)
+	}
+
+	activated, err := app.store.User.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activated.Status != helpers.StatusActive {
+		t.Errorf("the user is %q, want %q", activated.Status, helpers.StatusActive)
+	}
+	var hooks int
+	for _, msg := range claimOutbox(t, app) {
+		if msg.Kind == models.OutboxKindWebhook {
+			hooks++
+		}
+	}
+	if hooks != 1 {
+		t.Errorf("queued %d webhooks, want 1", hooks)
+	}
+}
+
+func TestInviteAndActivateAdmin(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/admin/auth/create", loginAdmin(t, srv, seedAdmin(t, app, RoleSuperAdmin)), map[string]string{
+		"name":  "Invited Admin",
+		"email": "invited-admin@example.com",
+	})
+	if status != http.StatusCreated || res.Message != "Admin invited successfully" {
+		t.Fatalf("inviting an admin answered %d (%s): %s", status, res.Message, res.Error)
+	}
+	emails := queuedEmails(t, app)
+	if len(emails) != 1 || emails[0].Token == nil || emails[0].Token.Kind != emailTokenAdminInvite {
+		t.Fatalf("queued %+v, want one admin invite", emails)
+	}
+	token, err := app.mintEmailToken(ctx, emails[0].Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, res = doJSON(t, srv, http.MethodPatch, "/v1/admin/auth/activate", "", map[string]string{
+		"token":           token,
+		"password":        testPassword,
+		"confirmPassword": testPassword,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("activating answered %d: %s", status, res.Error)
+	}
+	admin, err := app.store.Admin.GetAdmin(ctx, emails[0].Token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Status != helpers.StatusActive {
+		t.Errorf("the admin is %q, want %q", admin.Status, helpers.StatusActive)
+	}
+	loginAdmin(t, srv, admin)
+}
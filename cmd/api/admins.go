@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+func (app *application) GetAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view admins"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	admin, err := app.store.Admin.GetAdmin(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, admin, "admin")
+}
+
+func (app *application) UpdateAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminUpdate) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to update admins"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.UpdateAdminPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.Name != nil {
+		updates["name"] = *payload.Name
+	}
+	if payload.Role != nil {
+		if isSelf(user, id) {
+			app.badRequestResponse(w, r, errors.New("you cannot change your own role"))
+			return
+		}
+		updates["role"] = *payload.Role
+	}
+	if len(updates) == 0 {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+
+	admin, err := app.updateAdmin(r, id, updates)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, admin, "admin updated successfully")
+}
+
+func (app *application) SuspendAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAdminStatus(w, r, helpers.StatusSuspended)
+}
+
+func (app *application) ReactivateAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAdminStatus(w, r, helpers.StatusActive)
+}
+
+// setAdminStatus moves an admin between active and suspended. Pending admins
+// are left alone, so reactivation can't skip setting a password.
+func (app *application) setAdminStatus(w http.ResponseWriter, r *http.Request, status string) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminUpdate) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to update admins"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if isSelf(user, id) {
+		app.badRequestResponse(w, r, errors.New("you cannot change your own status"))
+		return
+	}
+
+	admin, err := app.store.Admin.GetAdmin(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	switch {
+	case admin.Status == status:
+		app.conflictResponse(w, r, errors.New("admin is already "+status))
+		return
+	case status == helpers.StatusSuspended && admin.Status != helpers.StatusActive:
+		app.conflictResponse(w, r, errors.New("only active admins can be suspended"))
+		return
+	case status == helpers.StatusActive && admin.Status != helpers.StatusSuspended:
+		app.conflictResponse(w, r, errors.New("only suspended admins can be reactivated"))
+		return
+	}
+
+	admin, err = app.updateAdmin(r, id, map[string]interface{}{"status": status})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, admin, "admin is now "+status)
+}
+
+// DeleteAdminHandler soft-deletes an admin. An admin who still owns
+// organizations can only be deleted with ?reassignTo=<adminId>, which hands
+// them over in the same transaction.
+func (app *application) DeleteAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminDelete) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to delete admins"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if isSelf(user, id) {
+		app.badRequestResponse(w, r, errors.New("you cannot delete yourself"))
+		return
+	}
+
+	var reassignTo uuid.UUID
+	if raw := r.URL.Query().Get("reassignTo"); raw != "" {
+		if reassignTo, err = uuid.Parse(raw); err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid reassignTo"))
+			return
+		}
+		if reassignTo == id {
+			app.badRequestResponse(w, r, errors.New("cannot reassign organizations to the admin being deleted"))
+			return
+		}
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if reassignTo != uuid.Nil {
+			if err := app.reassignOrganizations(r, tx, id, reassignTo); err != nil {
+				return err
+			}
+		}
+		return tx.Admin.DeleteAdmin(ctx, id)
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	restoreBy := app.restoreDeadline(time.Now())
+	app.jsonResponse(w, http.StatusOK, map[string]time.Time{"restoreBy": restoreBy},
+		"admin deleted successfully, it can be restored until "+restoreBy.Format(time.RFC3339))
+}
+
+func (app *application) RestoreAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminDelete) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to restore admins"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	deletedSince := time.Now().Add(-app.config.softDelete.restoreWindow)
+	if err := app.store.Admin.RestoreAdmin(ctx, id, deletedSince); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "admin restored successfully")
+}
+
+func (app *application) ReassignOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminUpdate) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to reassign organizations"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.ReassignOrganizationsPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if payload.ToAdminID == id {
+		app.badRequestResponse(w, r, errors.New("organizations are already owned by this admin"))
+		return
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		return app.reassignOrganizations(r, tx, id, payload.ToAdminID)
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "organizations reassigned successfully")
+}
+
+// reassignOrganizations moves every organization of from to to.
+func (app *application) reassignOrganizations(r *http.Request, tx store.TxStorage, from, to uuid.UUID) error {
+	ctx := r.Context()
+
+	if _, err := tx.Admin.GetAdmin(ctx, from); err != nil {
+		return err
+	}
+
+	moved, err := tx.Organization.ReassignOrganizations(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	app.logger.Infow("reassigned organizations", "from", from, "to", to, "count", moved)
+	return nil
+}
+
+// updateAdmin applies updates and returns the admin as stored afterwards.
+func (app *application) updateAdmin(r *http.Request, id uuid.UUID, updates map[string]interface{}) (*models.Admin, error) {
+	ctx := r.Context()
+
+	var admin *models.Admin
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if _, err := tx.Admin.GetAdmin(ctx, id); err != nil {
+			return err
+		}
+		if err := tx.Admin.UpdateAdmin(ctx, id, updates); err != nil {
+			return err
+		}
+
+		var err error
+		admin, err = tx.Admin.GetAdmin(ctx, id)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error updating admin", zap.String("id", id.String()), zap.Error(err))
+		return nil, err
+	}
+	return admin, nil
+}
+
+func isSelf(user UserClaims, id uuid.UUID) bool {
+	return user.UserID == id.String()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -21,6 +22,7 @@ type application struct {
 	logger     *zap.SugaredLogger
 	middleWare middleWareConfig
 	ctx        context.Context
+	decisions  *decisionLog
 }
 
 type config struct {
@@ -28,9 +30,31 @@ type config struct {
 	apiUrl     string
 	db         dbConfig
 	env        string
+	store      string
 	mailDomain string
 	mailApiKey string
 	payStackSK string
+	outbox     outboxConfig
+	softDelete softDeleteConfig
+	// orgMaxDepth is how many levels an organization tree may have.
+	orgMaxDepth int
+	// transferTTL is how long a receiving admin has to accept an
+	// organization transfer.
+	transferTTL time.Duration
+	grants      grantConfig
+	access      accessConfig
+	decisionLog decisionLogConfig
+	webhooks    webhookConfig
+	sso         ssoConfig
+	oauth       oauthConfig
+	saml        samlConfig
+	magicLink   magicLinkConfig
+	// trustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Real-IP headers are believed. Other requests are taken to come from
+	// the address they were received from.
+	trustedProxies []netip.Prefix
+	// metricsToken, when set, is the bearer token /metrics requires.
+	metricsToken string
 }
 
 type dbConfig struct {
@@ -38,6 +62,8 @@ type dbConfig struct {
 	maxOpenConns int
 	maxIdleTime  string
 	maxIdleConns int
+
+	migrateOnStart bool
 }
 type redisDbConfig struct {
 	username string
@@ -56,7 +82,7 @@ func (app *application) mount() http.Handler {
 
 	// Public middleware
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.RealIPMiddleware())
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
@@ -69,6 +95,8 @@ func (app *application) mount() http.Handler {
 		app.badRequestResponse(w, r, errors.New("method not allowed"))
 	})
 
+	r.Get("/metrics", app.MetricsHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 		// admin routes
 		r.Route("/admin", func(r chi.Router) {
@@ -87,14 +115,122 @@ func (app *application) mount() http.Handler {
 				r.Post("/auth/user", app.CreateUserHandler)
 				r.Patch("/auth/user/activate", app.CreateUserHandler)
 				r.Post("/auth/create", app.CreateAdminHandler)
+				r.Get("/admin", app.GetAdminHandler)
+				r.Patch("/admin", app.UpdateAdminHandler)
+				r.Delete("/admin", app.DeleteAdminHandler)
+				r.Post("/admin/suspend", app.SuspendAdminHandler)
+				r.Post("/admin/reactivate", app.ReactivateAdminHandler)
+				r.Post("/admin/restore", app.RestoreAdminHandler)
+				r.Post("/admin/reassign", app.ReassignOrganizationsHandler)
 				r.Post("/org", app.CreateOrganizationHandler)
 				r.Get("/org", app.GetOrganizationHandler)
 				r.Delete("/org", app.DeleteOrganizationHandler)
+				r.Patch("/org", app.UpdateOrganizationHandler)
+				r.Post("/org/restore", app.RestoreOrganizationHandler)
+				r.Post("/org/suspend", app.SuspendOrganizationHandler)
+				r.Post("/org/unsuspend", app.UnsuspendOrganizationHandler)
+				r.Get("/org/suspensions", app.ListOrganizationSuspensionsHandler)
+				r.Get("/org/tree", app.OrganizationTreeHandler)
+				r.Post("/org/move", app.MoveOrganizationHandler)
+				r.Post("/org/transfer", app.StartTransferHandler)
+				r.Post("/org/transfer/accept", app.AcceptTransferHandler)
+				r.Post("/org/transfer/cancel", app.CancelTransferHandler)
+				r.Get("/org/transfers", app.ListTransfersHandler)
+				r.Get("/org/members", app.ListMembersHandler)
+				r.Get("/member", app.GetMemberHandler)
+				r.Patch("/member", app.UpdateMemberHandler)
+				r.Delete("/member", app.RemoveMemberHandler)
+				r.Post("/member/suspend", app.SuspendMemberHandler)
+				r.Post("/member/reactivate", app.ReactivateMemberHandler)
+				r.Post("/member/restore", app.RestoreMemberHandler)
+				r.Post("/group", app.CreateGroupHandler)
+				r.Get("/groups", app.ListGroupsHandler)
+				r.Get("/group", app.GetGroupHandler)
+				r.Patch("/group", app.UpdateGroupHandler)
+				r.Delete("/group", app.DeleteGroupHandler)
+				r.Get("/group/members", app.ListGroupMembersHandler)
+				r.Post("/group/members", app.AddGroupMemberHandler)
+				r.Delete("/group/members", app.RemoveGroupMemberHandler)
+				r.Post("/group/roles", app.AddGroupRoleHandler)
+				r.Delete("/group/roles", app.RemoveGroupRoleHandler)
+
+				r.Post("/grant", app.CreateGrantHandler)
+				r.Get("/grant", app.GetGrantHandler)
+				r.Get("/grants", app.ListGrantsHandler)
+				r.Post("/grant/revoke", app.RevokeGrantHandler)
+				r.Post("/grant/elevate", app.RequestElevationHandler)
+
+				r.Get("/access-policy", app.GetAccessPolicyHandler)
+				r.Put("/access-policy", app.SetAccessPolicyHandler)
+				r.Get("/magic-link-policy", app.GetMagicLinkPolicyHandler)
+				r.Put("/magic-link-policy", app.SetMagicLinkPolicyHandler)
+				r.Get("/access-requests", app.ListAccessRequestsHandler)
+				r.Get("/access-request", app.GetAccessRequestHandler)
+				r.Post("/access-request/approve", app.ApproveAccessRequestHandler)
+				r.Post("/access-request/reject", app.RejectAccessRequestHandler)
+
+				r.Post("/review", app.StartReviewHandler)
+				r.Get("/review", app.GetReviewHandler)
+				r.Get("/reviews", app.ListReviewsHandler)
+				r.Get("/review/items", app.ListReviewItemsHandler)
+				r.Post("/review/item", app.DecideReviewItemHandler)
+				r.Post("/review/close", app.CloseReviewHandler)
+				r.Get("/review/export", app.ExportReviewHandler)
+
+				r.Get("/sod/rules", app.ListSoDRulesHandler)
+				r.Get("/sod/violations", app.ListSoDViolationsHandler)
+
+				r.Get("/audit", app.ListAuditEventsHandler)
+				r.Get("/audit/verify", app.VerifyAuditChainHandler)
+				r.Get("/authz/decisions", app.ListAuthzDecisionsHandler)
+
+				r.Get("/orgs", app.ListOrganizationsHandler)
+				r.Get("/admins", app.ListAdminsHandler)
+				r.Get("/users", app.ListUsersHandler)
+				r.Get("/invites/admins", app.ListAdminInvitesHandler)
+				r.Get("/invites/users", app.ListUserInvitesHandler)
+
+				r.Post("/webhook", app.CreateWebhookHandler)
+				r.Get("/webhooks", app.ListWebhooksHandler)
+				r.Get("/webhook", app.GetWebhookHandler)
+				r.Patch("/webhook", app.UpdateWebhookHandler)
+				r.Delete("/webhook", app.DeleteWebhookHandler)
+				r.Post("/webhook/ping", app.PingWebhookHandler)
+				r.Get("/webhook/deliveries", app.ListWebhookDeliveriesHandler)
+
+				r.Post("/scim/token", app.CreateScimTokenHandler)
+				r.Get("/scim/tokens", app.ListScimTokensHandler)
+				r.Post("/scim/token/revoke", app.RevokeScimTokenHandler)
+
+				r.Put("/sso/oidc", app.SaveOIDCProviderHandler)
+				r.Get("/sso/oidc", app.GetOIDCProviderHandler)
+				r.Delete("/sso/oidc", app.DeleteOIDCProviderHandler)
+				r.Put("/sso/saml", app.SaveSAMLProviderHandler)
+				r.Get("/sso/saml", app.GetSAMLProviderHandler)
+				r.Delete("/sso/saml", app.DeleteSAMLProviderHandler)
+
+				r.Post("/oauth/client", app.CreateOAuthClientHandler)
+				r.Get("/oauth/clients", app.ListOAuthClientsHandler)
+				r.Get("/oauth/client", app.GetOAuthClientHandler)
+				r.Patch("/oauth/client", app.UpdateOAuthClientHandler)
+				r.Delete("/oauth/client", app.DeleteOAuthClientHandler)
+				r.Post("/oauth/client/secret", app.RotateOAuthClientSecretHandler)
+
+				r.Get("/outbox", app.ListOutboxMessagesHandler)
+				r.Get("/outbox/message", app.GetOutboxMessageHandler)
+				r.Post("/outbox/replay", app.ReplayOutboxMessageHandler)
 			})
 		})
 		// users routes
 		r.Route("/users", func(r chi.Router) {
 			r.Post("/auth/login", app.LoginUserHandler)
+			r.Post("/auth/magic-link", app.RequestMagicLinkHandler)
+			r.Post("/auth/magic-link/verify", app.MagicLinkLoginHandler)
+			r.Get("/sso/oidc/login", app.OIDCLoginHandler)
+			r.Get("/sso/oidc/callback", app.OIDCCallbackHandler)
+			r.Get("/sso/saml/metadata", app.SAMLMetadataHandler)
+			r.Get("/sso/saml/login", app.SAMLLoginHandler)
+			r.Post("/sso/saml/acs", app.SAMLACSHandler)
 			r.Group(func(r chi.Router) {
 				r.Use(
 					app.AuthMiddleware(secret),
@@ -102,12 +238,61 @@ func (app *application) mount() http.Handler {
 					app.RateLimitMiddleware(),
 				)
 				// Add more protected routes here
-
+				r.Post("/switch-org", app.SwitchOrganizationHandler)
+				r.Post("/elevate", app.RequestElevationHandler)
+				r.Get("/grants", app.ListGrantsHandler)
+				r.Post("/access-request", app.SubmitAccessRequestHandler)
+				r.Get("/access-requests", app.ListMyAccessRequestsHandler)
+				r.Post("/access-request/cancel", app.CancelAccessRequestHandler)
 			})
 		})
 
 	})
 
+	// OAuth 2.0 and OpenID Connect provider for other applications
+	r.Get("/.well-known/openid-configuration", app.OAuthDiscoveryHandler)
+	r.Route("/oauth2", func(r chi.Router) {
+		r.Get("/authorize", app.OAuthAuthorizeHandler)
+		r.Post("/token", app.OAuthTokenHandler)
+		r.Get("/jwks", app.OAuthJWKSHandler)
+		r.Get("/userinfo", app.OAuthUserInfoHandler)
+		r.Post("/userinfo", app.OAuthUserInfoHandler)
+		r.Post("/introspect", app.OAuthIntrospectHandler)
+		r.Post("/revoke", app.OAuthRevokeHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(
+				app.AuthMiddleware(secret),
+				app.ConcurrencyMiddleware(),
+				app.RateLimitMiddleware(),
+			)
+			r.Post("/authorize", app.OAuthApproveHandler)
+		})
+	})
+
+	// SCIM provisioning, authenticated by an organization's SCIM token
+	r.Route("/scim/v2", func(r chi.Router) {
+		r.Use(app.ScimAuthMiddleware())
+
+		r.Get("/ServiceProviderConfig", app.ScimServiceProviderConfigHandler)
+		r.Get("/ResourceTypes", app.ScimResourceTypesHandler)
+
+		r.Get("/Users", app.ScimListUsersHandler)
+		r.Post("/Users", app.ScimCreateUserHandler)
+		r.Get("/Users/{id}", app.ScimGetUserHandler)
+		r.Put("/Users/{id}", app.ScimReplaceUserHandler)
+		r.Patch("/Users/{id}", app.ScimPatchUserHandler)
+		r.Delete("/Users/{id}", app.ScimDeleteUserHandler)
+
+		r.Get("/Groups", app.ScimListGroupsHandler)
+		r.Post("/Groups", app.ScimCreateGroupHandler)
+		r.Get("/Groups/{id}", app.ScimGetGroupHandler)
+		r.Put("/Groups/{id}", app.ScimReplaceGroupHandler)
+		r.Patch("/Groups/{id}", app.ScimPatchGroupHandler)
+		r.Delete("/Groups/{id}", app.ScimDeleteGroupHandler)
+
+		r.Post("/Bulk", app.ScimBulkHandler)
+	})
+
 	return r
 }
 
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+const (
+	auditAdminLogin          = "admin.login"
+	auditAdminCreate         = "admin.create"
+	auditAdminActivate       = "admin.activate"
+	auditAdminInviteResend   = "admin.invite.resend"
+	auditUserCreate          = "user.create"
+	auditUserActivate        = "user.activate"
+	auditMembershipCreate    = "membership.create"
+	auditOrganizationCreate  = "organization.create"
+	auditOrganizationDelete  = "organization.delete"
+	auditOrganizationRestore = "organization.restore"
+
+	auditResourceAdmin        = "admin"
+	auditResourceUser         = "user"
+	auditResourceMembership   = "membership"
+	auditResourceOrganization = "organization"
+)
+
+// auditVerifyBatch is how many events VerifyAuditChainHandler reads at once.
+const auditVerifyBatch = 500
+
+// auditRecord collects the audit event of one request while its handler
+// runs.
+type auditRecord struct {
+	app    *application
+	r      *http.Request
+	w      middleware.WrapResponseWriter
+	event  models.AuditEvent
+	before any
+	after  any
+}
+
+// beginAudit starts the audit event of a mutating handler. The handler must
+// write its response through the returned writer and defer commit, which
+// records the event with the outcome its status code shows. The caller, if
+// signed in, is the actor.
+func (app *application) beginAudit(w http.ResponseWriter, r *http.Request, action, resourceType string) (http.ResponseWriter, *auditRecord) {
+	rec := &auditRecord{
+		app: app,
+		r:   r,
+		w:   middleware.NewWrapResponseWriter(w, r.ProtoMajor),
+		event: models.AuditEvent{
+			Action:       action,
+			ResourceType: resourceType,
+			IP:           clientIP(r),
+			RequestID:    middleware.GetReqID(r.Context()),
+		},
+	}
+	if user, err := GetUserFromContext(r.Context()); err == nil {
+		accountType := models.GrantAccountAdmin
+		if user.OrgID != "" {
+			accountType = models.GrantAccountUser
+		}
+		rec.actor(accountType, uuid.MustParse(user.UserID), user.Role)
+	}
+	return rec.w, rec
+}
+
+// actor names who acted, for handlers that run before anyone is signed in.
+func (rec *auditRecord) actor(accountType string, id uuid.UUID, role string) {
+	rec.event.ActorType, rec.event.ActorID, rec.event.ActorRole = accountType, &id, role
+}
+
+// retarget changes what the event is about, for handlers whose action
+// depends on the request.
+func (rec *auditRecord) retarget(action, resourceType string) {
+	rec.event.Action, rec.event.ResourceType = action, resourceType
+}
+
+func (rec *auditRecord) resource(id uuid.UUID) {
+	rec.event.ResourceID = &id
+}
+
+func (rec *auditRecord) organization(id uuid.UUID) {
+	rec.event.OrganizationID = &id
+}
+
+// change sets the resource as it was and as it is now. Either is nil when the
+// resource is created or deleted; only the fields that differ are kept.
+func (rec *auditRecord) change(before, after any) {
+	rec.before, rec.after = before, after
+}
+
+func (rec *auditRecord) commit() {
+	status := rec.w.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rec.event.Status = status
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		rec.event.Outcome = models.AuditOutcomeDenied
+	case status >= http.StatusBadRequest:
+		rec.event.Outcome = models.AuditOutcomeFailure
+	default:
+		rec.event.Outcome = models.AuditOutcomeSuccess
+	}
+
+	var err error
+	rec.event.Before, rec.event.After, err = auditDiff(rec.before, rec.after)
+	if err == nil {
+		// the response is already out, so the event outlives a cancelled request
+		err = rec.app.store.Audit.Append(context.WithoutCancel(rec.r.Context()), &rec.event)
+	}
+	if err != nil {
+		rec.app.logger.Errorw("error recording audit event",
+			"action", rec.event.Action, "requestId", rec.event.RequestID, "error", err)
+	}
+}
+
+// clientIP is the address RealIPMiddleware left on the request, without
+// the port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// auditDiff reduces before and after to the JSON fields that differ between
+// them. Fields hidden from JSON, such as password hashes, never show up.
+func auditDiff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b != nil && a != nil {
+		for key, value := range b {
+			if other, ok := a[key]; ok && reflect.DeepEqual(value, other) {
+				delete(b, key)
+				delete(a, key)
+			}
+		}
+	}
+
+	encode := func(fields map[string]any) (json.RawMessage, error) {
+		if len(fields) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(fields)
+	}
+	beforeJSON, err := encode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := encode(a)
+	return beforeJSON, afterJSON, err
+}
+
+func auditFields(v any) (map[string]any, error) {
+	if rv := reflect.ValueOf(v); !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "updatedAt")
+	return fields, nil
+}
+
+// authorizeOrgRecords lets the caller read the records of the organization
+// orgID: its admins and anyone signed in to it. Without an organization only
+// super admins pass. It writes the error response itself.
+func (app *application) authorizeOrgRecords(w http.ResponseWriter, r *http.Request, user UserClaims, orgID uuid.UUID) bool {
+	if orgID == uuid.Nil {
+		if isSuperAdmin(user) {
+			return true
+		}
+		app.badRequestResponse(w, r, errors.New("organizationId is required"))
+		return false
+	}
+
+	org, err := app.store.Organization.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return false
+	}
+	if user.OrgID != org.ID.String() && !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to access this organization"))
+		return false
+	}
+	return true
+}
+
+// ListAuditEventsHandler pages through audit events, filtered by ?actorId=,
+// ?resourceId=, ?organizationId=, ?action=, ?resourceType=, ?outcome=,
+// ?createdFrom= and ?createdTo=. Only super admins may leave out the
+// organization.
+func (app *application) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermLogsView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view audit events"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		OrganizationID: params.OrganizationID,
+		Action:         query.Get("action"),
+		ResourceType:   query.Get("resourceType"),
+		Outcome:        query.Get("outcome"),
+	}
+	switch filter.Outcome {
+	case "", models.AuditOutcomeSuccess, models.AuditOutcomeDenied, models.AuditOutcomeFailure:
+	default:
+		app.badRequestResponse(w, r, errors.New("outcome must be one of [success denied failure]"))
+		return
+	}
+	for key, dst := range map[string]*uuid.UUID{
+		"actorId":    &filter.ActorID,
+		"resourceId": &filter.ResourceID,
+	} {
+		if value := query.Get(key); value != "" {
+			if *dst, err = uuid.Parse(value); err != nil {
+				app.badRequestResponse(w, r, fmt.Errorf("%s must be a valid uuid", key))
+				return
+			}
+		}
+	}
+
+	if !app.authorizeOrgRecords(w, r, user, filter.OrganizationID) {
+		return
+	}
+
+	events, page, err := app.store.Audit.ListEvents(ctx, filter, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, events, page, "audit events")
+}
+
+// auditVerification is the result of walking the audit chain. Head is the
+// hash of the newest event; keeping it elsewhere also shows if events are
+// later cut off the end of the chain.
+type auditVerification struct {
+	Valid    bool   `json:"valid"`
+	Events   int64  `json:"events"`
+	HeadSeq  int64  `json:"headSeq"`
+	HeadHash string `json:"headHash"`
+	BrokenAt *int64 `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyAuditChainHandler recomputes the hash chain from the first event and
+// reports the first event that does not fit.
+func (app *application) VerifyAuditChainHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermLogsView) || !isSuperAdmin(user) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to verify the audit log"))
+		return
+	}
+
+	result := auditVerification{Valid: true}
+	var prev models.AuditEvent
+	for result.Valid {
+		events, err := app.store.Audit.ChainEvents(ctx, prev.Seq, auditVerifyBatch)
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			if reason := auditChainBreak(prev, event); reason != "" {
+				result.Valid, result.BrokenAt, result.Reason = false, &event.Seq, reason
+				break
+			}
+			result.Events++
+			prev = event
+		}
+	}
+	result.HeadSeq, result.HeadHash = prev.Seq, prev.Hash
+
+	app.jsonResponse(w, http.StatusOK, result, "audit chain checked")
+}
+
+// auditChainBreak says why event cannot follow prev, or returns "".
+func auditChainBreak(prev, event models.AuditEvent) string {
+	if event.Seq != prev.Seq+1 {
+		return fmt.Sprintf("events %d to %d are missing", prev.Seq+1, event.Seq-1)
+	}
+	if event.PrevHash != prev.Hash {
+		return "previous hash does not match"
+	}
+	hash, err := store.AuditHash(event)
+	if err != nil {
+		return err.Error()
+	}
+	if hash != event.Hash {
+		return "event has been modified"
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+// seedAuditChain appends n events and returns the whole chain, oldest first.
+func seedAuditChain(t *testing.T, app *application, n int) []models.AuditEvent {
+	t.Helper()
+	ctx := context.Background()
+
+	for range n {
+		id := uuid.New()
+		after, err := json.Marshal(map[string]string{"name": "Test Organization"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.store.Audit.Append(ctx, &models.AuditEvent{
+			ActorType:    models.GrantAccountAdmin,
+			Action:       auditOrganizationCreate,
+			ResourceType: auditResourceOrganization,
+			ResourceID:   &id,
+			After:        after,
+			Outcome:      models.AuditOutcomeSuccess,
+			Status:       http.StatusCreated,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := app.store.Audit.ChainEvents(ctx, 0, auditVerifyBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// verifyChain walks events the way VerifyAuditChainHandler does and returns
+// where the chain breaks and why, or "" when it holds.
+func verifyChain(events []models.AuditEvent) (int64, string) {
+	var prev models.AuditEvent
+	for _, event := range events {
+		if reason := auditChainBreak(prev, event); reason != "" {
+			return event.Seq, reason
+		}
+		prev = event
+	}
+	return 0, ""
+}
+
+func TestAuditChainBreak(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func([]models.AuditEvent) []models.AuditEvent
+		brokenAt   int64
+		wantReason string
+	}{
+		{
+			name:   "intact",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent { return events },
+		},
+		{
+			name: "field modified",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[1].Outcome = models.AuditOutcomeDenied
+				return events
+			},
+			brokenAt:   2,
+			wantReason: "event has been modified",
+		},
+		{
+			name: "middle event deleted",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			brokenAt:   3,
+			wantReason: "events 2 to 2 are missing",
+		},
+		{
+			name: "previous hash edited and the event rehashed",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[2].PrevHash = events[0].Hash
+				events[2].Hash, _ = store.AuditHash(events[2])
+				return events
+			},
+			brokenAt:   3,
+			wantReason: "previous hash does not match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := seedAuditChain(t, newTestApp(t), 4)
+			brokenAt, reason := verifyChain(tt.tamper(events))
+			if brokenAt != tt.brokenAt || reason != tt.wantReason {
+				t.Errorf("the chain broke at %d (%q), want %d (%q)", brokenAt, reason, tt.brokenAt, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditChainHandler(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+
+	token := loginAdmin(t, srv, seedAdmin(t, app, RoleSuperAdmin))
+	events := seedAuditChain(t, app, 3)
+
+	status, res := doJSON(t, srv, http.MethodGet, "/v1/admin/audit/verify", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("verifying answered %d: %s", status, res.Error)
+	}
+	var result auditVerification
+	if err := json.Unmarshal(res.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	head := events[len(events)-1]
+	if !result.Valid || result.Events != int64(len(events)) || result.HeadSeq != head.Seq || result.HeadHash != head.Hash {
+		t.Errorf("verified %+v, want all %d events up to %d", result, len(events), head.Seq)
+	}
+}
+
+func TestAuditCommitOutcome(t *testing.T) {
+	tests := []struct {
+		status  int
+		outcome string
+	}{
+		{0, models.AuditOutcomeSuccess},
+		{http.StatusCreated, models.AuditOutcomeSuccess},
+		{http.StatusBadRequest, models.AuditOutcomeFailure},
+		{http.StatusUnauthorized, models.AuditOutcomeDenied},
+		{http.StatusForbidden, models.AuditOutcomeDenied},
+		{http.StatusConflict, models.AuditOutcomeFailure},
+		{http.StatusInternalServerError, models.AuditOutcomeFailure},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			app := newTestApp(t)
+
+			w, audit := app.beginAudit(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil),
+				auditOrganizationCreate, auditResourceOrganization)
+			if tt.status != 0 {
+				w.WriteHeader(tt.status)
+			}
+			audit.commit()
+
+			events, err := app.store.Audit.ChainEvents(context.Background(), 0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("recorded %d events, want 1", len(events))
+			}
+			want := tt.status
+			if want == 0 {
+				want = http.StatusOK
+			}
+			if events[0].Outcome != tt.outcome || events[0].Status != want {
+				t.Errorf("recorded %q with status %d, want %q with %d", events[0].Outcome, events[0].Status, tt.outcome, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	decisionSinkRing     = "ring"
+	decisionSinkFile     = "file"
+	decisionSinkPostgres = "postgres"
+	decisionSinkOff      = "off"
+)
+
+// decisionPurgeInterval is how often decisions past retention are deleted
+// from sinks that keep them.
+const decisionPurgeInterval = time.Hour
+
+type decisionLogConfig struct {
+	// sink is where sampled decisions are written: ring, file, postgres or
+	// off.
+	sink string
+	// allowSample and denySample are the shares of allowed and denied
+	// decisions written to the sink, from 0 to 1. Metrics count every
+	// decision either way.
+	allowSample float64
+	denySample  float64
+	// queueSize bounds the decisions waiting to be written. Decisions that
+	// do not fit are dropped rather than slowing the request down.
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	ringSize      int
+	file          string
+	retention     time.Duration
+}
+
+// decisionSink stores sampled decisions a batch at a time.
+type decisionSink interface {
+	write(ctx context.Context, decisions []models.AuthzDecision) error
+}
+
+// decisionReader is a sink that can be queried back.
+type decisionReader interface {
+	recent(ctx context.Context, f store.AuthzFilter, limit int) ([]models.AuthzDecision, error)
+}
+
+// decisionLog counts every authorization decision and hands a sample of them
+// to a background writer.
+type decisionLog struct {
+	cfg     decisionLogConfig
+	sink    decisionSink
+	queue   chan models.AuthzDecision
+	metrics decisionMetrics
+	logger  *zap.SugaredLogger
+}
+
+func (app *application) newDecisionLog(cfg decisionLogConfig) (*decisionLog, error) {
+	l := &decisionLog{
+		cfg:     cfg,
+		queue:   make(chan models.AuthzDecision, max(cfg.queueSize, 1)),
+		metrics: decisionMetrics{counts: map[decisionKey]*decisionCount{}},
+		logger:  app.logger,
+	}
+	switch cfg.sink {
+	case decisionSinkRing:
+		l.sink = &ringSink{buf: make([]models.AuthzDecision, max(cfg.ringSize, 1))}
+	case decisionSinkFile:
+		f, err := os.OpenFile(cfg.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		l.sink = &fileSink{f: f}
+	case decisionSinkPostgres:
+		l.sink = &storeSink{authz: app.store.Authz}
+	case decisionSinkOff:
+	default:
+		return nil, fmt.Errorf("unknown decision log sink %q", cfg.sink)
+	}
+	return l, nil
+}
+
+// record counts d and queues it for the sink if it is sampled. It never
+// blocks. A nil log records nothing, so checks work without one.
+func (l *decisionLog) record(d models.AuthzDecision) {
+	if l == nil {
+		return
+	}
+	l.metrics.observe(d)
+	if l.sink == nil {
+		return
+	}
+
+	rate := l.cfg.allowSample
+	if d.Outcome == models.AuthzOutcomeDeny {
+		rate = l.cfg.denySample
+	}
+	if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return
+	}
+
+	d.ID = uuid.New()
+	select {
+	case l.queue <- d:
+	default:
+		l.metrics.add(&l.metrics.dropped, 1)
+	}
+}
+
+// run writes queued decisions in batches until ctx is cancelled, then
+// flushes what is left.
+func (l *decisionLog) run(ctx context.Context) {
+	if l.sink == nil {
+		return
+	}
+	flushTicker := time.NewTicker(l.cfg.flushInterval)
+	defer flushTicker.Stop()
+	purgeTicker := time.NewTicker(decisionPurgeInterval)
+	defer purgeTicker.Stop()
+
+	batch := make([]models.AuthzDecision, 0, l.cfg.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// a cancelled ctx still gets its last batch written
+		if err := l.sink.write(context.WithoutCancel(ctx), batch); err != nil {
+			l.metrics.add(&l.metrics.failed, int64(len(batch)))
+			l.logger.Errorw("error writing authorization decisions", "sink", l.cfg.sink, "count", len(batch), "error", err)
+		} else {
+			l.metrics.add(&l.metrics.written, int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case d := <-l.queue:
+			batch = append(batch, d)
+			if len(batch) >= l.cfg.batchSize {
+				flush()
+			}
+		case <-flushTicker.C:
+			flush()
+		case <-purgeTicker.C:
+			l.purge(ctx)
+		case <-ctx.Done():
+			for len(l.queue) > 0 {
+				batch = append(batch, <-l.queue)
+			}
+			flush()
+			if f, ok := l.sink.(*fileSink); ok {
+				f.close()
+			}
+			return
+		}
+	}
+}
+
+func (l *decisionLog) purge(ctx context.Context) {
+	s, ok := l.sink.(*storeSink)
+	if !ok {
+		return
+	}
+	n, err := s.authz.PurgeDecisions(ctx, time.Now().Add(-l.cfg.retention))
+	if err != nil {
+		l.logger.Errorw("error purging authorization decisions", "error", err)
+		return
+	}
+	if n > 0 {
+		l.logger.Infow("purged authorization decisions", "count", n)
+	}
+}
+
+// ringSink keeps the newest decisions in memory. It is lost on restart.
+type ringSink struct {
+	mu   sync.Mutex
+	buf  []models.AuthzDecision
+	next int
+	full bool
+}
+
+func (s *ringSink) write(_ context.Context, decisions []models.AuthzDecision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range decisions {
+		s.buf[s.next] = d
+		s.next = (s.next + 1) % len(s.buf)
+		s.full = s.full || s.next == 0
+	}
+	return nil
+}
+
+func (s *ringSink) recent(_ context.Context, f store.AuthzFilter, limit int) ([]models.AuthzDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.next
+	if s.full {
+		n = len(s.buf)
+	}
+	decisions := []models.AuthzDecision{}
+	for i := 1; i <= n && len(decisions) < limit; i++ {
+		d := s.buf[(s.next-i+len(s.buf))%len(s.buf)]
+		if store.AuthzMatches(d, f) {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions, nil
+}
+
+// fileSink appends decisions to a file as JSON lines.
+type fileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (s *fileSink) write(_ context.Context, decisions []models.AuthzDecision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := bufio.NewWriter(s.f)
+	enc := json.NewEncoder(w)
+	for _, d := range decisions {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func (s *fileSink) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.f.Close()
+}
+
+// storeSink writes decisions to the authz_decisions table.
+type storeSink struct {
+	authz store.AuthzStoreInterface
+}
+
+func (s *storeSink) write(ctx context.Context, decisions []models.AuthzDecision) error {
+	return s.authz.AppendDecisions(ctx, decisions)
+}
+
+func (s *storeSink) recent(ctx context.Context, f store.AuthzFilter, limit int) ([]models.AuthzDecision, error) {
+	return s.authz.ListDecisions(ctx, f, limit)
+}
+
+type decisionKey struct {
+	check, permission, outcome string
+}
+
+type decisionCount struct {
+	count   int64
+	latency time.Duration
+}
+
+// decisionMetrics are running totals since the process started.
+type decisionMetrics struct {
+	mu      sync.Mutex
+	counts  map[decisionKey]*decisionCount
+	written int64
+	dropped int64
+	failed  int64
+}
+
+func (m *decisionMetrics) observe(d models.AuthzDecision) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := decisionKey{d.Check, d.Permission, d.Outcome}
+	c, ok := m.counts[key]
+	if !ok {
+		c = &decisionCount{}
+		m.counts[key] = c
+	}
+	c.count++
+	c.latency += time.Duration(d.LatencyNs)
+}
+
+func (m *decisionMetrics) add(counter *int64, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*counter += n
+}
+
+// writeMetrics writes the metrics in the Prometheus text format.
+func (l *decisionLog) writeMetrics(w *bufio.Writer) {
+	m := &l.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]decisionKey, 0, len(m.counts))
+	for key := range m.counts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b decisionKey) int {
+		return strings.Compare(a.check+"\x00"+a.permission+"\x00"+a.outcome, b.check+"\x00"+b.permission+"\x00"+b.outcome)
+	})
+	labels := func(key decisionKey) string {
+		return fmt.Sprintf("{check=%s,permission=%s,outcome=%s}",
+			strconv.Quote(key.check), strconv.Quote(key.permission), strconv.Quote(key.outcome))
+	}
+
+	fmt.Fprintln(w, "# HELP authz_decisions_total Authorization decisions by check, permission and outcome.")
+	fmt.Fprintln(w, "# TYPE authz_decisions_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "authz_decisions_total%s %d\n", labels(key), m.counts[key].count)
+	}
+	fmt.Fprintln(w, "# HELP authz_decision_seconds_total Time spent on authorization decisions.")
+	fmt.Fprintln(w, "# TYPE authz_decision_seconds_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "authz_decision_seconds_total%s %g\n", labels(key), m.counts[key].latency.Seconds())
+	}
+
+	for _, metric := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"authz_decision_log_written_total", "Sampled decisions written to the sink.", m.written},
+		{"authz_decision_log_dropped_total", "Sampled decisions dropped because the queue was full.", m.dropped},
+		{"authz_decision_log_failed_total", "Sampled decisions the sink failed to write.", m.failed},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", metric.name, metric.help, metric.name, metric.name, metric.value)
+	}
+	fmt.Fprintf(w, "# HELP authz_decision_log_queue Sampled decisions waiting to be written.\n# TYPE authz_decision_log_queue gauge\nauthz_decision_log_queue %d\n", len(l.queue))
+}
+
+// requestResource names what a request is for: its method, path and, for
+// the resources addressed by ?id=, the id.
+func requestResource(r *http.Request) string {
+	resource := r.Method + " " + r.URL.Path
+	if id := r.URL.Query().Get("id"); id != "" {
+		resource += "?id=" + id
+	}
+	return resource
+}
+
+// withRequest ties the claims to r so that decisions made on them are
+// logged against it.
+func (user UserClaims) withRequest(r *http.Request) UserClaims {
+	user.resource = requestResource(r)
+	user.requestID = middleware.GetReqID(r.Context())
+	return user
+}
+
+// decide records the outcome of a check made on behalf of user.
+func (app *application) decide(user UserClaims, check, permission, resource string, allowed bool, latency time.Duration) {
+	d := models.AuthzDecision{
+		SubjectRole: user.Role,
+		Check:       check,
+		Permission:  permission,
+		Resource:    resource,
+		Outcome:     models.AuthzOutcomeDeny,
+		LatencyNs:   latency.Nanoseconds(),
+		RequestID:   user.requestID,
+		CreatedAt:   time.Now(),
+	}
+	if allowed {
+		d.Outcome = models.AuthzOutcomeAllow
+	}
+	if id, err := uuid.Parse(user.UserID); err == nil {
+		d.SubjectID, d.SubjectType = &id, models.GrantAccountAdmin
+		if orgID, err := uuid.Parse(user.OrgID); err == nil {
+			d.SubjectType, d.OrganizationID = models.GrantAccountUser, &orgID
+		}
+	}
+	app.decisions.record(d)
+}
+
+// checkPermission is HasPermission for a given kind of check.
+func (app *application) checkPermission(user UserClaims, permission, check string) bool {
+	start := time.Now()
+	allowed := slices.Contains(user.Perms, permission)
+	app.decide(user, check, permission, user.resource, allowed, time.Since(start))
+	return allowed
+}
+
+// MetricsHandler serves the decision counters for Prometheus. When
+// METRICS_TOKEN is set, scrapers must send it as a bearer token.
+func (app *application) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if token := app.config.metricsToken; token != "" {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			app.unauthorizedResponse(w, r, errors.New("invalid metrics token"))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	if app.decisions != nil {
+		app.decisions.writeMetrics(bw)
+	}
+	bw.Flush()
+}
+
+// ListAuthzDecisionsHandler returns the newest sampled decisions, filtered by
+// ?subjectId=, ?organizationId=, ?check=, ?permission= and ?outcome=. Only
+// the ring and postgres sinks can be read back.
+func (app *application) ListAuthzDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermLogsView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view authorization decisions"))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.AuthzFilter{
+		Check:      query.Get("check"),
+		Permission: query.Get("permission"),
+		Outcome:    query.Get("outcome"),
+	}
+	switch filter.Outcome {
+	case "", models.AuthzOutcomeAllow, models.AuthzOutcomeDeny:
+	default:
+		app.badRequestResponse(w, r, errors.New("outcome must be one of [allow deny]"))
+		return
+	}
+	for key, dst := range map[string]*uuid.UUID{
+		"subjectId":      &filter.SubjectID,
+		"organizationId": &filter.OrganizationID,
+	} {
+		if value := query.Get(key); value != "" {
+			if *dst, err = uuid.Parse(value); err != nil {
+				app.badRequestResponse(w, r, fmt.Errorf("%s must be a valid uuid", key))
+				return
+			}
+		}
+	}
+	limit, err := readIntParam(r, "limit", 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.authorizeOrgRecords(w, r, user, filter.OrganizationID) {
+		return
+	}
+
+	var reader decisionReader
+	if app.decisions != nil {
+		reader, _ = app.decisions.sink.(decisionReader)
+	}
+	if reader == nil {
+		app.badRequestResponse(w, r, errors.New("the decision log cannot be read back from this sink"))
+		return
+	}
+
+	decisions, err := reader.recent(ctx, filter, limit)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, decisions, "authorization decisions")
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/mightyfzeus/rbac/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -33,3 +36,31 @@ func (app *application) tooManyRequests(w http.ResponseWriter, r *http.Request,
 	app.logger.Errorf("Too many requests", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 	writeJSONError(w, http.StatusTooManyRequests, "Too many requests")
 }
+
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Service unavailable", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	w.Header().Set("Retry-After", "1")
+	writeJSONError(w, http.StatusServiceUnavailable, "the request conflicted with a concurrent update, please retry")
+}
+
+// storeErrorResponse maps the typed errors returned by the store layer onto
+// HTTP statuses. Anything unrecognised is an internal server error.
+func (app *application) storeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, store.ErrUniqueViolation), errors.Is(err, store.ErrForeignKeyViolation),
+		errors.Is(err, store.ErrRestoreExpired), errors.Is(err, store.ErrTransferNotPending),
+		errors.Is(err, store.ErrGrantEnded), errors.Is(err, store.ErrAccessRequestNotPending),
+		errors.Is(err, store.ErrReviewClosed), errors.Is(err, store.ErrOutboxMessageNotDead),
+		errors.Is(err, errSoDViolation):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, store.ErrCheckViolation), errors.Is(err, store.ErrNotNullViolation),
+		errors.Is(err, store.ErrInvalidListParams):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, store.ErrSerialization):
+		app.serviceUnavailableResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type grantConfig struct {
+	// sweepInterval is how often expired grants are stamped and expiry
+	// notices are sent.
+	sweepInterval time.Duration
+	// expiryNotice is how long before a grant ends its holder is emailed.
+	expiryNotice time.Duration
+	// maxElevation caps how long a self-service elevation can last.
+	maxElevation time.Duration
+}
+
+// grantResponse adds the status of a grant at the time of the response.
+type grantResponse struct {
+	models.RoleGrant
+	Status string `json:"status"`
+}
+
+func newGrantResponse(grant models.RoleGrant, at time.Time) grantResponse {
+	return grantResponse{RoleGrant: grant, Status: store.GrantStatus(grant, at)}
+}
+
+// CreateGrantHandler gives an account a role for a limited time. Assigned
+// grants take effect at validFrom; eligible grants only let the account
+// elevate itself through RequestElevationHandler.
+func (app *application) CreateGrantHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.CreateGrantPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if !slices.Contains(GrantableRoles[payload.AccountType], payload.Role) {
+		app.badRequestResponse(w, r, fmt.Errorf("the %s role cannot be granted to %s accounts", payload.Role, payload.AccountType))
+		return
+	}
+	if isSelf(user, payload.AccountID) {
+		app.badRequestResponse(w, r, errors.New("you cannot grant roles to yourself"))
+		return
+	}
+
+	now := time.Now()
+	validFrom := now
+	if payload.ValidFrom != nil {
+		validFrom = *payload.ValidFrom
+	}
+	if !payload.ValidUntil.After(now) {
+		app.badRequestResponse(w, r, errors.New("validUntil must be in the future"))
+		return
+	}
+	kind := payload.Kind
+	if kind == "" {
+		kind = models.GrantKindAssigned
+	}
+
+	if !app.canManageGrant(w, r, user, payload.AccountType, payload.OrganizationID) {
+		return
+	}
+	if payload.AccountType == models.GrantAccountAdmin {
+		_, err = app.store.Admin.GetAdmin(ctx, payload.AccountID)
+	} else {
+		_, err = app.store.Membership.GetMembership(ctx, payload.AccountID, *payload.OrganizationID)
+	}
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	grant := &models.RoleGrant{
+		ID:             uuid.New(),
+		AccountType:    payload.AccountType,
+		AccountID:      payload.AccountID,
+		OrganizationID: payload.OrganizationID,
+		Role:           payload.Role,
+		Kind:           kind,
+		ValidFrom:      validFrom,
+		ValidUntil:     payload.ValidUntil,
+		Justification:  payload.Justification,
+		GrantedBy:      uuid.MustParse(user.UserID),
+	}
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Grant.CreateGrant(ctx, grant); err != nil {
+			return err
+		}
+		return checkStaticSoD(ctx, tx, sodPrincipal{
+			AccountType: grant.AccountType, AccountID: grant.AccountID, OrganizationID: grant.OrganizationID,
+		})
+	})
+	if err != nil {
+		app.logger.Error("error creating role grant", zap.String("account", grant.AccountID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("role granted",
+		"grant", grant.ID, "account", grant.AccountID, "role", grant.Role, "kind", grant.Kind,
+		"validFrom", grant.ValidFrom, "validUntil", grant.ValidUntil, "by", user.UserID)
+	app.jsonResponse(w, http.StatusCreated, newGrantResponse(*grant, now), "role granted successfully")
+}
+
+func (app *application) GetGrantHandler(w http.ResponseWriter, r *http.Request) {
+	grant, ok := app.loadGrant(w, r)
+	if !ok {
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, newGrantResponse(*grant, time.Now()), "role grant")
+}
+
+// ListGrantsHandler lists grants filtered by ?accountId=, ?organizationId=,
+// ?kind= and ?status=. Without a filter callers see their own grants, and
+// super admins see every grant.
+func (app *application) ListGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.GrantFilter{Kind: query.Get("kind"), Status: query.Get("status")}
+	switch filter.Kind {
+	case "", models.GrantKindAssigned, models.GrantKindEligible, models.GrantKindElevated:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid grant kind"))
+		return
+	}
+	switch filter.Status {
+	case "", models.GrantStatusScheduled, models.GrantStatusActive, models.GrantStatusExpired, models.GrantStatusRevoked:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid grant status"))
+		return
+	}
+	if query.Get("accountId") != "" {
+		if filter.AccountID, err = readUUIDParam(r, "accountId"); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if query.Get("organizationId") != "" {
+		if filter.OrganizationID, err = readUUIDParam(r, "organizationId"); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	switch {
+	case filter.OrganizationID != uuid.Nil:
+		if !app.canManageGrant(w, r, user, models.GrantAccountUser, &filter.OrganizationID) {
+			return
+		}
+	case filter.AccountID == uuid.Nil && !isSuperAdmin(user):
+		filter.AccountID = uuid.MustParse(user.UserID)
+	case filter.AccountID != uuid.Nil && !isSelf(user, filter.AccountID) && !isSuperAdmin(user):
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view another account's grants"))
+		return
+	}
+
+	grants, err := app.store.Grant.ListGrants(ctx, filter)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	out := make([]grantResponse, 0, len(grants))
+	for _, grant := range grants {
+		out = append(out, newGrantResponse(grant, now))
+	}
+	app.jsonResponse(w, http.StatusOK, out, "role grants")
+}
+
+// RevokeGrantHandler ends the grant given by ?id= early. Holders can give up
+// their own grants.
+func (app *application) RevokeGrantHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	grant, ok := app.loadGrant(w, r)
+	if !ok {
+		return
+	}
+
+	user, _ := GetUserFromContext(ctx)
+	now := time.Now()
+	if err := app.store.Grant.RevokeGrant(ctx, grant.ID, uuid.MustParse(user.UserID), now); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("role grant revoked", "grant", grant.ID, "account", grant.AccountID, "role", grant.Role, "by", user.UserID)
+	app.jsonResponse(w, http.StatusOK, nil, "role grant revoked")
+}
+
+// RequestElevationHandler lets the caller take on a role they are eligible
+// for, for at most maxElevation and never past the end of the eligibility.
+// The justification is kept on the grant.
+func (app *application) RequestElevationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.ElevationPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	duration := time.Duration(payload.Minutes) * time.Minute
+	if duration > app.config.grants.maxElevation {
+		app.badRequestResponse(w, r, fmt.Errorf("elevations can last at most %s", app.config.grants.maxElevation))
+		return
+	}
+
+	accountID := uuid.MustParse(user.UserID)
+	accountType := models.GrantAccountAdmin
+	var orgID *uuid.UUID
+	if user.OrgID != "" {
+		id := uuid.MustParse(user.OrgID)
+		accountType, orgID = models.GrantAccountUser, &id
+	}
+
+	eligible, err := app.store.Grant.ListGrants(ctx, store.GrantFilter{
+		AccountID: accountID,
+		Kind:      models.GrantKindEligible,
+		Status:    models.GrantStatusActive,
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	idx := slices.IndexFunc(eligible, func(g models.RoleGrant) bool {
+		if g.Role != payload.Role || (g.OrganizationID == nil) != (orgID == nil) {
+			return false
+		}
+		return orgID == nil || *g.OrganizationID == *orgID
+	})
+	if idx < 0 {
+		app.unauthorizedResponse(w, r, errors.New("you are not eligible to elevate to this role"))
+		return
+	}
+	if rule, broken := breaksRule(slices.Concat([]string{user.Role}, user.GroupRoles, user.GrantRoles), payload.Role); broken {
+		app.conflictResponse(w, r, sodViolation(rule))
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(duration)
+	if until.After(eligible[idx].ValidUntil) {
+		until = eligible[idx].ValidUntil
+	}
+
+	grant := &models.RoleGrant{
+		ID:             uuid.New(),
+		AccountType:    accountType,
+		AccountID:      accountID,
+		OrganizationID: orgID,
+		Role:           payload.Role,
+		Kind:           models.GrantKindElevated,
+		ValidFrom:      now,
+		ValidUntil:     until,
+		Justification:  payload.Justification,
+		GrantedBy:      accountID,
+	}
+	if err := app.store.Grant.CreateGrant(ctx, grant); err != nil {
+		app.logger.Error("error creating elevation", zap.String("account", accountID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("role elevated",
+		"grant", grant.ID, "account", accountID, "role", grant.Role,
+		"until", grant.ValidUntil, "justification", grant.Justification)
+	app.jsonResponse(w, http.StatusCreated, newGrantResponse(*grant, now), "elevated until "+until.Format(time.RFC3339))
+}
+
+// loadGrant resolves the grant given by ?id=. Holders can always see their
+// own grants; anyone else must be able to manage it. It writes the error
+// response itself.
+func (app *application) loadGrant(w http.ResponseWriter, r *http.Request) (*models.RoleGrant, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	grant, err := app.store.Grant.GetGrant(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !isSelf(user, grant.AccountID) && !app.canManageGrant(w, r, user, grant.AccountType, grant.OrganizationID) {
+		return nil, false
+	}
+
+	return grant, true
+}
+
+// canManageGrant checks that the caller may grant and revoke roles for
+// accounts of accountType in orgID. Grants cannot be handed out on the
+// strength of another grant, so the caller's own role must allow it. It
+// writes the error response itself.
+func (app *application) canManageGrant(
+	w http.ResponseWriter,
+	r *http.Request,
+	user UserClaims,
+	accountType string,
+	orgID *uuid.UUID,
+) bool {
+	if !slices.Contains(RolePermissions[user.Role], PermRolesAssign) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage role grants"))
+		return false
+	}
+	if accountType == models.GrantAccountAdmin {
+		if user.Role != RoleSuperAdmin {
+			app.unauthorizedResponse(w, r, errors.New("only super admins can manage grants for admins"))
+			return false
+		}
+		return true
+	}
+	if orgID == nil {
+		app.storeErrorResponse(w, r, store.ErrGrantScope)
+		return false
+	}
+	return app.canAdministerOrg(w, r, user, *orgID, "manage role grants in")
+}
+
+// runGrantJob expires grants and warns holders of coming expiries until ctx
+// is cancelled.
+func (app *application) runGrantJob(ctx context.Context) {
+	ticker := time.NewTicker(app.config.grants.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sweepGrants(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sweepGrants(ctx context.Context) {
+	now := time.Now()
+
+	expired, err := app.store.Grant.ExpireGrants(ctx, now)
+	if err != nil {
+		app.logger.Error("error expiring role grants", zap.Error(err))
+	} else if expired > 0 {
+		app.logger.Infow("expired role grants", "count", expired)
+	}
+
+	app.sweepAccessRequests(ctx, now)
+
+	expiring, err := app.store.Grant.ListExpiringGrants(ctx, now.Add(app.config.grants.expiryNotice))
+	if err != nil {
+		app.logger.Error("error listing expiring role grants", zap.Error(err))
+		return
+	}
+	for i := range expiring {
+		if err := app.notifyGrantExpiry(ctx, &expiring[i]); err != nil {
+			app.logger.Error("error sending grant expiry notice", zap.String("grant", expiring[i].ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// notifyGrantExpiry emails the holder of grant once. Grants whose account is
+// gone are marked without an email.
+func (app *application) notifyGrantExpiry(ctx context.Context, grant *models.RoleGrant) error {
+	return app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		marked, err := tx.Grant.MarkGrantNotified(ctx, grant.ID, time.Now())
+		if err != nil || !marked {
+			return err
+		}
+
+		var email string
+		if grant.AccountType == models.GrantAccountAdmin {
+			var admin *models.Admin
+			if admin, err = tx.Admin.GetAdmin(ctx, grant.AccountID); err == nil {
+				email = admin.Email
+			}
+		} else {
+			var user *models.User
+			if user, err = tx.User.GetUser(ctx, grant.AccountID); err == nil {
+				email = user.Email
+			}
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueGrantExpiry(ctx, tx.Outbox, grant, email)
+	})
+}
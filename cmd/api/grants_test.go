@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+// A grant that breaks a static separation-of-duties rule is written inside
+// the transaction and then rolled back by the check that follows it.
+func TestCreateGrantRollsBackOnSoDViolation(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	auditor := seedMember(t, app, org, "auditor@example.com", RoleAuditor)
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/admin/grant", loginAdmin(t, srv, owner), map[string]any{
+		"accountType":    models.GrantAccountUser,
+		"accountId":      auditor.ID,
+		"organizationId": org.ID,
+		"role":           RoleAdmin,
+		"validUntil":     time.Now().Add(time.Hour),
+	})
+	if status != http.StatusConflict {
+		t.Fatalf("granting admin to an auditor answered %d (%s), want %d", status, res.Error, http.StatusConflict)
+	}
+
+	grants, err := app.store.Grant.ListGrants(context.Background(), store.GrantFilter{AccountID: auditor.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grants) != 0 {
+		t.Errorf("the rejected grant was kept: %+v", grants)
+	}
+}
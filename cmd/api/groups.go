@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// groupResponse is a group with the roles bound to it.
+type groupResponse struct {
+	*models.Group
+	Roles []models.GroupRole `json:"roles"`
+}
+
+func (app *application) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermGroupsCreate) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to create groups"))
+		return
+	}
+
+	var payload dtos.CreateGroupPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, payload.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to create groups in this organization"))
+		return
+	}
+
+	group := &models.Group{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		ParentID:       payload.ParentID,
+		Name:           payload.Name,
+		Description:    payload.Description,
+	}
+	if err := app.store.Group.CreateGroup(ctx, group); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, group, "group created successfully")
+}
+
+// ListGroupsHandler lists the groups of the organization given by
+// ?organizationId=.
+func (app *application) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermGroupsView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view groups"))
+		return
+	}
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.authorizeOrgList(w, r, user, orgID) {
+		return
+	}
+
+	groups, err := app.store.Group.ListGroups(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, groups, "groups")
+}
+
+func (app *application) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.loadGroup(w, r, PermGroupsView, "view")
+	if !ok {
+		return
+	}
+
+	roles, err := app.store.Group.ListRoles(r.Context(), group.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, groupResponse{Group: group, Roles: roles}, "group")
+}
+
+func (app *application) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	group, ok := app.loadGroup(w, r, PermGroupsUpdate, "update")
+	if !ok {
+		return
+	}
+
+	var payload dtos.UpdateGroupPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.Name != nil {
+		updates["name"] = *payload.Name
+	}
+	if payload.Description != nil {
+		updates["description"] = *payload.Description
+	}
+	if payload.ParentID != nil {
+		if *payload.ParentID == uuid.Nil {
+			updates["parent_id"] = nil
+		} else {
+			updates["parent_id"] = *payload.ParentID
+		}
+	}
+	if len(updates) == 0 {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+
+	var updated *models.Group
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Group.UpdateGroup(ctx, group.ID, updates); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = tx.Group.GetGroup(ctx, group.ID)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error updating group", zap.String("id", group.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, updated, "group updated successfully")
+}
+
+// DeleteGroupHandler deletes a group for good. Its members lose the roles it
+// granted and its subgroups move up to the top level.
+func (app *application) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.loadGroup(w, r, PermGroupsDelete, "delete")
+	if !ok {
+		return
+	}
+
+	if err := app.store.Group.DeleteGroup(r.Context(), group.ID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "group deleted successfully")
+}
+
+func (app *application) ListGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.loadGroup(w, r, PermGroupsView, "view")
+	if !ok {
+		return
+	}
+
+	members, err := app.store.Group.ListMembers(r.Context(), group.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, members, "group members")
+}
+
+// AddGroupMemberHandler puts a member of the group's organization into the
+// group.
+func (app *application) AddGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	group, ok := app.loadGroup(w, r, PermGroupsMembers, "manage")
+	if !ok {
+		return
+	}
+
+	var payload dtos.GroupMemberPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	if _, err := app.store.Membership.GetMembership(ctx, payload.UserID, group.OrganizationID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.badRequestResponse(w, r, errors.New("user is not a member of the group's organization"))
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	member := &models.GroupMember{GroupID: group.ID, UserID: payload.UserID}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Group.AddMember(ctx, member); err != nil {
+			return err
+		}
+		return checkStaticSoD(ctx, tx, userPrincipal(member.UserID, group.OrganizationID))
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, member, "user added to group")
+}
+
+// RemoveGroupMemberHandler takes the user given by ?userId= out of the group.
+func (app *application) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.loadGroup(w, r, PermGroupsMembers, "manage")
+	if !ok {
+		return
+	}
+
+	userID, err := readUUIDParam(r, "userId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Group.RemoveMember(r.Context(), group.ID, userID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "user removed from group")
+}
+
+// AddGroupRoleHandler binds a member role to the group, granting it to every
+// member of the group and of its subgroups. The binding is refused if it
+// would give any of them conflicting roles.
+func (app *application) AddGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	group, ok := app.loadGroup(w, r, PermGroupsUpdate, "update")
+	if !ok {
+		return
+	}
+
+	var payload dtos.GroupRolePayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if !slices.Contains(MemberRoles, payload.Role) {
+		app.badRequestResponse(w, r, errors.New("role must be one of ["+strings.Join(MemberRoles, " ")+"]"))
+		return
+	}
+
+	binding := &models.GroupRole{GroupID: group.ID, Role: payload.Role}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Group.AddRole(ctx, binding); err != nil {
+			return err
+		}
+		holders, err := tx.Group.RoleHolders(ctx, group.OrganizationID, []string{binding.Role})
+		if err != nil {
+			return err
+		}
+		for _, holder := range holders {
+			if err := checkStaticSoD(ctx, tx, userPrincipal(holder.UserID, holder.OrganizationID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, binding, "role bound to group")
+}
+
+// RemoveGroupRoleHandler unbinds the role given by ?role= from the group.
+func (app *application) RemoveGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.loadGroup(w, r, PermGroupsUpdate, "update")
+	if !ok {
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	if role == "" {
+		app.badRequestResponse(w, r, errors.New("role is required"))
+		return
+	}
+
+	if err := app.store.Group.RemoveRole(r.Context(), group.ID, role); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "role unbound from group")
+}
+
+// loadGroup resolves the group given by ?id= and checks that the caller has
+// perm and administers the group's organization. It writes the error
+// response itself.
+func (app *application) loadGroup(
+	w http.ResponseWriter,
+	r *http.Request,
+	perm string,
+	action string,
+) (*models.Group, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+	if !app.HasPermission(user, perm) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" groups"))
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	group, err := app.store.Group.GetGroup(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	org, err := app.store.Organization.GetOrganization(ctx, group.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" this group"))
+		return nil, false
+	}
+
+	return group, true
+}
@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +23,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/env"
 	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -31,17 +36,33 @@ type UserClaims struct {
 	Email  string `json:"email"`
 	Name   string `json:"name"`
 	Role   string `json:"role"`
-	Perms  []string
+	// OrgID is the organization a user token is scoped to. Admin tokens
+	// leave it empty.
+	OrgID string `json:"orgId,omitempty"`
+	// GroupRoles are the roles a user holds through groups in OrgID. They
+	// are resolved on every request, never read from the token.
+	GroupRoles []string `json:"-"`
+	// GrantRoles are the roles the account holds through time-bound grants
+	// right now. Like GroupRoles they are resolved on every request.
+	GrantRoles []string `json:"-"`
+	// GrantPerms are single permissions granted the same way.
+	GrantPerms []string `json:"-"`
+	// Perms is the union of the permissions of Role, GroupRoles and
+	// GrantRoles, plus GrantPerms.
+	Perms []string
 	jwt.RegisteredClaims
-}
 
-func (app *application) HasPermission(userRole, permission string) bool {
-	perms, ok := RolePermissions[userRole]
-	if !ok {
-		return false
-	}
-	return slices.Contains(perms, permission)
+	// resource and requestID name the request the claims were loaded for,
+	// so the decisions made on them can be logged against it.
+	resource  string
+	requestID string
+}
 
+// HasPermission checks the caller's effective permissions: those of their
+// role and, for users, of the roles they hold through groups. Every check is
+// recorded in the decision log.
+func (app *application) HasPermission(user UserClaims, permission string) bool {
+	return app.checkPermission(user, permission, models.AuthzCheckPermission)
 }
 
 func (app *application) ValidatePayload(w http.ResponseWriter, r *http.Request, err error) error {
@@ -101,7 +122,9 @@ func (app *application) DecodeAndValidate(
 	return nil
 }
 
-func GenerateJWT(userID uuid.UUID, email, name string, role string) (string, error) {
+// GenerateJWT signs a token for the account. orgID scopes a user token to one
+// of their organizations; admins pass uuid.Nil.
+func GenerateJWT(userID uuid.UUID, email, name string, role string, orgID uuid.UUID) (string, error) {
 	secretKey := env.GetString("SECRET_KEY", "")
 
 	jwtSecret := []byte(secretKey)
@@ -112,6 +135,9 @@ func GenerateJWT(userID uuid.UUID, email, name string, role string) (string, err
 		"role":   role,
 		"exp":    time.Now().Add(24 * time.Hour).Unix(),
 	}
+	if orgID != uuid.Nil {
+		claims["orgId"] = orgID
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
@@ -147,9 +173,194 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func (app *application) isOrgAdminOrSuper(user UserClaims, org *models.Organization) bool {
-	if user.Role == RoleSuperAdmin {
+// isSuperAdmin reports whether the caller is a super admin, permanently or
+// through a grant.
+func isSuperAdmin(user UserClaims) bool {
+	return user.Role == RoleSuperAdmin || slices.Contains(user.GrantRoles, RoleSuperAdmin)
+}
+
+// isOrgAdminOrSuper reports whether the caller administers org: super admins
+// always do, admins do for organizations they own and, while inheritance is
+// on, for everything below those organizations. Every check is recorded in
+// the decision log.
+func (app *application) isOrgAdminOrSuper(ctx context.Context, user UserClaims, org *models.Organization) bool {
+	start := time.Now()
+	allowed := app.administersOrg(ctx, user, org)
+	app.decide(user, models.AuthzCheckOrgAdmin, "", "organization:"+org.ID.String(), allowed, time.Since(start))
+	return allowed
+}
+
+func (app *application) administersOrg(ctx context.Context, user UserClaims, org *models.Organization) bool {
+	if isSuperAdmin(user) {
+		return true
+	}
+	// a user granted the admin role administers the organization the
+	// grant applies to
+	if user.OrgID == org.ID.String() && slices.Contains(user.GrantRoles, RoleAdmin) {
+		return true
+	}
+	adminID := uuid.MustParse(user.UserID)
+	if org.AdminID == adminID {
 		return true
 	}
-	return org.AdminID == uuid.MustParse(user.UserID)
+	if !org.InheritPermissions || org.ParentID == nil {
+		return false
+	}
+
+	ancestors, err := app.store.Organization.ListAncestors(ctx, org.ID)
+	if err != nil {
+		app.logger.Errorw("error loading organization ancestors", "id", org.ID, "error", err)
+		return false
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.AdminID == adminID {
+			return true
+		}
+		if !ancestor.InheritPermissions {
+			return false
+		}
+	}
+	return false
+}
+
+// readIDParam parses the ?id= query parameter used to address a resource.
+func readIDParam(r *http.Request) (uuid.UUID, error) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		return uuid.Nil, errors.New("Id is required")
+	}
+	parsedId, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, errors.New("Id must be a valid uuid")
+	}
+	return parsedId, nil
+}
+
+// readUUIDParam reads a required uuid query parameter other than ?id=.
+func readUUIDParam(r *http.Request, key string) (uuid.UUID, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return uuid.Nil, errors.New(key + " is required")
+	}
+	parsed, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, errors.New(key + " must be a valid uuid")
+	}
+	return parsed, nil
+}
+
+func readIntParam(r *http.Request, key string, fallback int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return n, nil
+}
+
+// listSortColumns maps the camelCase sort names used by the API to columns.
+var listSortColumns = map[string]string{
+	"createdAt": "created_at",
+	"expiresAt": "expires_at",
+	"name":      "name",
+	"email":     "email",
+}
+
+// readListParams parses the query parameters shared by every list endpoint:
+// limit, cursor, sort, order, q, status, role, createdFrom and createdTo.
+// Lists default to newest first.
+func readListParams(r *http.Request) (store.ListParams, error) {
+	query := r.URL.Query()
+
+	limit, err := readIntParam(r, "limit", store.DefaultPageLimit)
+	if err != nil {
+		return store.ListParams{}, err
+	}
+
+	p := store.ListParams{
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+		Search: query.Get("q"),
+		Status: query.Get("status"),
+		Role:   query.Get("role"),
+		Desc:   true,
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		column, ok := listSortColumns[sort]
+		if !ok {
+			return store.ListParams{}, fmt.Errorf("sort %q is not supported", sort)
+		}
+		p.Sort = column
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		p.Desc = false
+	default:
+		return store.ListParams{}, errors.New("order must be one of [asc desc]")
+	}
+
+	for key, dst := range map[string]**time.Time{
+		"createdFrom": &p.CreatedFrom,
+		"createdTo":   &p.CreatedTo,
+	} {
+		if value := query.Get(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return store.ListParams{}, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+			}
+			*dst = &t
+		}
+	}
+
+	for key, dst := range map[string]*uuid.UUID{
+		"organizationId": &p.OrganizationID,
+		"adminId":        &p.AdminID,
+	} {
+		if value := query.Get(key); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return store.ListParams{}, fmt.Errorf("%s must be a valid uuid", key)
+			}
+			*dst = id
+		}
+	}
+
+	return p, nil
+}
+
+// loadRSAKey parses a PEM RSA private key. Environment files often hold it
+// on one line with escaped newlines.
+func loadRSAKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(data, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("not a PEM key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// loadCertificate parses a PEM certificate, which may be on one line like
+// the keys loadRSAKey reads.
+func loadCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(data, `\n`, "\n")))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("not a PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
 }
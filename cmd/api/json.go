@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mightyfzeus/rbac/internal/store"
 )
 
 var Validate *validator.Validate
@@ -45,3 +46,15 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 
 	return writeJSON(w, status, &envelope{Data: data, Message: message})
 }
+
+// pageResponse writes one page of a list. It mirrors jsonResponse with an
+// extra page object describing how to fetch the next page.
+func (app *application) pageResponse(w http.ResponseWriter, status int, data any, page store.PageInfo, message string) error {
+	type envelope struct {
+		Data    any            `json:"data"`
+		Page    store.PageInfo `json:"page"`
+		Message string         `json:"message"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, Page: page, Message: message})
+}
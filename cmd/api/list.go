@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (app *application) ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOrgView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view organizations"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// admins only ever see the organizations they own
+	if !isSuperAdmin(user) {
+		params.AdminID = uuid.MustParse(user.UserID)
+	}
+
+	orgs, page, err := app.store.Organization.ListOrganizations(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, orgs, page, "organizations")
+}
+
+func (app *application) ListAdminsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view admins"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	admins, page, err := app.store.Admin.ListAdmins(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, admins, page, "admins")
+}
+
+func (app *application) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermUsersView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view users"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.authorizeOrgList(w, r, user, params.OrganizationID) {
+		return
+	}
+
+	users, page, err := app.store.User.ListUsers(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, users, page, "users")
+}
+
+func (app *application) ListAdminInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermAdminView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view admin invites"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	invites, page, err := app.store.AdminInvites.ListAdminInvites(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, invites, page, "admin invites")
+}
+
+func (app *application) ListUserInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermUsersView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view user invites"))
+		return
+	}
+
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.authorizeOrgList(w, r, user, params.OrganizationID) {
+		return
+	}
+
+	invites, page, err := app.store.UserInvite.ListUserInvites(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, invites, page, "user invites")
+}
+
+// authorizeOrgList checks access to a list scoped by ?organizationId=. Super
+// admins may list across organizations; everyone else must name an
+// organization they administer. It writes the error response itself.
+func (app *application) authorizeOrgList(w http.ResponseWriter, r *http.Request, user UserClaims, orgID uuid.UUID) bool {
+	if orgID == uuid.Nil {
+		if isSuperAdmin(user) {
+			return true
+		}
+		app.badRequestResponse(w, r, errors.New("organizationId is required"))
+		return false
+	}
+
+	org, err := app.store.Organization.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return false
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to access this organization"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type magicLinkConfig struct {
+	// url is the page links point to. It receives the token as ?token= and
+	// redeems it with POST /v1/users/auth/magic-link/verify.
+	url string
+	ttl time.Duration
+	// rateLimit is how many links one email is sent per rateWindow at most.
+	rateLimit  int
+	rateWindow time.Duration
+}
+
+var (
+	errMagicLinkDisabled = errors.New("this organization does not allow signing in with a link")
+	errMagicLinkInvalid  = errors.New("this link is invalid, has expired or was already used")
+)
+
+// GetMagicLinkPolicyHandler returns the magic link policy of the
+// organization given by ?id=.
+func (app *application) GetMagicLinkPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.loadOrganization(w, r, PermOrgView, "view")
+	if !ok {
+		return
+	}
+
+	policy, err := app.store.MagicLink.GetPolicy(r.Context(), org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, policy, "magic link policy")
+}
+
+// SetMagicLinkPolicyHandler turns signing in with a link on or off for the
+// organization given by ?id=, and says what links are bound to.
+func (app *application) SetMagicLinkPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.loadOrganization(w, r, PermSettingsOrg, "configure")
+	if !ok {
+		return
+	}
+
+	var payload dtos.MagicLinkPolicyPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	user, _ := GetUserFromContext(r.Context())
+	policy := &models.MagicLinkPolicy{
+		OrganizationID: org.ID,
+		Enabled:        payload.Enabled,
+		BindIP:         payload.BindIP,
+		BindDevice:     payload.BindDevice,
+		UpdatedBy:      uuid.MustParse(user.UserID),
+	}
+	if err := app.store.MagicLink.SetPolicy(r.Context(), policy); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, policy, "magic link policy updated")
+}
+
+// RequestMagicLinkHandler emails a sign-in link to the member of the
+// organization with the email. The answer is the same whether or not the
+// email belongs to a member, so it cannot be used to find out. When the
+// organization binds links to the device, the answer carries the device
+// token the link must be redeemed with.
+func (app *application) RequestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload dtos.RequestMagicLinkPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, payload.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if org.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errOrgSuspended)
+		return
+	}
+	policy, err := app.store.MagicLink.GetPolicy(ctx, org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !policy.Enabled {
+		app.unauthorizedResponse(w, r, errMagicLinkDisabled)
+		return
+	}
+	if required, err := app.ssoRequired(ctx, org.ID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	} else if required {
+		app.unauthorizedResponse(w, r, errSSORequired)
+		return
+	}
+
+	var data map[string]string
+	var deviceToken string
+	if policy.BindDevice {
+		if deviceToken, err = app.GenerateInviteToken(); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		data = map[string]string{"deviceToken": deviceToken}
+	}
+
+	if err := app.sendMagicLink(ctx, r, policy, payload.Email, deviceToken); err != nil {
+		app.logger.Error("error sending magic link", zap.String("organization", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusAccepted, data, "if this email belongs to a member, a sign-in link is on its way")
+}
+
+// sendMagicLink queues a link for the active member with the email. Emails
+// of nobody, and emails that were sent their share of links already, are
+// quietly skipped.
+func (app *application) sendMagicLink(
+	ctx context.Context,
+	r *http.Request,
+	policy *models.MagicLinkPolicy,
+	email, deviceToken string,
+) error {
+	user, err := app.store.User.GetUserByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.Status != helpers.StatusActive {
+		return nil
+	}
+	membership, err := app.store.Membership.GetMembership(ctx, user.ID, policy.OrganizationID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if membership.Status == helpers.StatusSuspended {
+		return nil
+	}
+
+	now := time.Now()
+	since := now.Add(-app.config.magicLink.rateWindow)
+	if _, err := app.store.MagicLink.DeleteExpired(ctx, since); err != nil {
+		app.logger.Error("error deleting expired magic links", zap.Error(err))
+	}
+
+	token, err := app.GenerateInviteToken()
+	if err != nil {
+		return err
+	}
+	link := &models.MagicLink{
+		ID:             uuid.New(),
+		TokenHash:      HashToken(token),
+		UserID:         user.ID,
+		OrganizationID: policy.OrganizationID,
+		Email:          email,
+		ExpiresAt:      now.Add(app.config.magicLink.ttl),
+	}
+	if policy.BindIP {
+		link.IPAddress = clientIP(r)
+	}
+	if deviceToken != "" {
+		link.DeviceHash = HashToken(deviceToken)
+	}
+
+	return app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		// counting locks the email until the link is created, so concurrent
+		// requests cannot all get in under the limit
+		sent, err := tx.MagicLink.CountLinks(ctx, email, since)
+		if err != nil {
+			return err
+		}
+		if sent >= int64(app.config.magicLink.rateLimit) {
+			app.logger.Warnw("magic link rate limit reached", "user", user.ID, "organization", policy.OrganizationID)
+			return nil
+		}
+		if err := tx.MagicLink.CreateLink(ctx, link); err != nil {
+			return err
+		}
+		return app.enqueueMagicLink(ctx, tx.Outbox, link)
+	})
+}
+
+// MagicLinkLoginHandler signs the member in with the token of a link,
+// answering like LoginUserHandler with a token scoped to the link's
+// organization. A link works once, and only from where it was asked for if
+// the organization binds it.
+func (app *application) MagicLinkLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload dtos.MagicLinkLoginPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	now := time.Now()
+	link, err := app.store.MagicLink.GetLink(ctx, HashToken(payload.Token), now)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidToken) {
+			app.unauthorizedResponse(w, r, errMagicLinkInvalid)
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if link.IPAddress != "" && link.IPAddress != clientIP(r) {
+		app.unauthorizedResponse(w, r, errors.New("this link must be opened from the network it was asked for from"))
+		return
+	}
+	if link.DeviceHash != "" &&
+		subtle.ConstantTimeCompare([]byte(HashToken(payload.DeviceToken)), []byte(link.DeviceHash)) != 1 {
+		app.unauthorizedResponse(w, r, errors.New("this link must be opened on the device it was asked for on"))
+		return
+	}
+
+	// the organization may have changed its mind since the link was sent
+	policy, err := app.store.MagicLink.GetPolicy(ctx, link.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !policy.Enabled {
+		app.unauthorizedResponse(w, r, errMagicLinkDisabled)
+		return
+	}
+	if required, err := app.ssoRequired(ctx, link.OrganizationID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	} else if required {
+		app.unauthorizedResponse(w, r, errSSORequired)
+		return
+	}
+
+	user, err := app.store.User.GetUser(ctx, link.UserID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if user.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errAccountSuspended)
+		return
+	}
+	membership, err := app.store.Membership.GetMembership(ctx, user.ID, link.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if err := app.checkMembershipActive(ctx, membership); err != nil {
+		if errors.Is(err, errMembershipSuspended) || errors.Is(err, errOrgSuspended) {
+			app.unauthorizedResponse(w, r, err)
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.MagicLink.UseLink(ctx, link.ID, now); err != nil {
+		if errors.Is(err, store.ErrInvalidToken) {
+			app.unauthorizedResponse(w, r, errMagicLinkInvalid)
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := GenerateJWT(user.ID, user.Email, user.Name, membership.Role, membership.OrganizationID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"token":          token,
+		"data":           user,
+		"organizationId": membership.OrganizationID,
+		"role":           membership.Role,
+	}, "login successful")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// setUpMagicLink returns an application serving on srv whose organization
+// lets its member sign in with a link, under policy.
+func setUpMagicLink(t *testing.T, policy models.MagicLinkPolicy) (*application, *httptest.Server, *models.Organization, *models.User) {
+	t.Helper()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	member := seedMember(t, app, org, "member@example.com", RoleUser)
+
+	policy.OrganizationID = org.ID
+	policy.Enabled = true
+	policy.UpdatedBy = owner.ID
+	if err := app.store.MagicLink.SetPolicy(context.Background(), &policy); err != nil {
+		t.Fatal(err)
+	}
+	return app, srv, org, member
+}
+
+// requestMagicLink asks for a link for email, failing unless it is accepted.
+func requestMagicLink(t *testing.T, srv *httptest.Server, org *models.Organization, email string) {
+	t.Helper()
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/users/auth/magic-link", "", map[string]any{
+		"email":          email,
+		"organizationId": org.ID,
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("asking for a link answered %d: %s", status, res.Error)
+	}
+}
+
+// queuedLinks returns what the queued sign-in emails carry a token for.
+func queuedLinks(t *testing.T, app *application) []*emailToken {
+	t.Helper()
+
+	var refs []*emailToken
+	for _, email := range queuedEmails(t, app) {
+		if email.Token == nil || email.Token.Kind != emailTokenMagicLink {
+			continue
+		}
+		if !strings.HasSuffix(email.Body, "?token="+emailTokenPlaceholder) {
+			t.Fatalf("the link was queued with its token: %q", email.Body)
+		}
+		refs = append(refs, email.Token)
+	}
+	return refs
+}
+
+func TestMagicLinkTokenIsMintedWhenSent(t *testing.T) {
+	app, srv, org, member := setUpMagicLink(t, models.MagicLinkPolicy{})
+
+	requestMagicLink(t, srv, org, member.Email)
+	refs := queuedLinks(t, app)
+	if len(refs) != 1 {
+		t.Fatalf("queued %d links, want 1", len(refs))
+	}
+	token, err := app.mintEmailToken(context.Background(), refs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/users/auth/magic-link/verify", "", map[string]string{
+		"token": token,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("signing in with the link answered %d: %s", status, res.Error)
+	}
+	status, _ = doJSON(t, srv, http.MethodPost, "/v1/users/auth/magic-link/verify", "", map[string]string{
+		"token": token,
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("using the link again answered %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// a used link is not worth sending again
+	if _, err := app.mintEmailToken(context.Background(), refs[0]); !errors.Is(err, errEmailTokenStale) {
+		t.Errorf("minted a token for a used link: %v", err)
+	}
+}
+
+// A link bound to an address cannot be asked for, or used, from another
+// address by claiming to be forwarded from it.
+func TestMagicLinkBindIP(t *testing.T) {
+	app, srv, org, member := setUpMagicLink(t, models.MagicLinkPolicy{BindIP: true})
+	ctx := context.Background()
+
+	post := func(path, forwardedFor string, body any) int {
+		t.Helper()
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// link asks for a link forwarded for forwardedFor and returns its token
+	// and the address it is bound to.
+	link := func(forwardedFor string) (string, string) {
+		t.Helper()
+		status := post("/v1/users/auth/magic-link", forwardedFor, map[string]any{
+			"email":          member.Email,
+			"organizationId": org.ID,
+		})
+		if status != http.StatusAccepted {
+			t.Fatalf("asking for a link answered %d", status)
+		}
+		refs := queuedLinks(t, app)
+		if len(refs) != 1 {
+			t.Fatalf("queued %d links, want 1", len(refs))
+		}
+		token, err := app.mintEmailToken(ctx, refs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bound, err := app.store.MagicLink.GetLink(ctx, HashToken(token), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, bound.IPAddress
+	}
+
+	// without trusted proxies the header is ignored
+	token, bound := link("203.0.113.9")
+	if bound != "127.0.0.1" {
+		t.Fatalf("the link is bound to %q, want the peer address", bound)
+	}
+	if status := post("/v1/users/auth/magic-link/verify", "127.0.0.1", map[string]string{"token": token}); status != http.StatusOK {
+		t.Errorf("using the link from the peer address answered %d", status)
+	}
+
+	// behind a trusted proxy the forwarded address counts
+	proxies, err := parseTrustedProxies("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config.trustedProxies = proxies
+	token, bound = link("198.18.0.1, 203.0.113.9")
+	if bound != "203.0.113.9" {
+		t.Fatalf("the link is bound to %q, want the address the proxy saw", bound)
+	}
+	if status := post("/v1/users/auth/magic-link/verify", "203.0.113.10", map[string]string{"token": token}); status != http.StatusUnauthorized {
+		t.Errorf("using the link from another address answered %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := post("/v1/users/auth/magic-link/verify", "203.0.113.9", map[string]string{"token": token}); status != http.StatusOK {
+		t.Errorf("using the link from its address answered %d", status)
+	}
+}
+
+// Requests racing each other still send no more links than the limit.
+func TestMagicLinkRateLimit(t *testing.T) {
+	app, srv, org, member := setUpMagicLink(t, models.MagicLinkPolicy{})
+	limit := app.config.magicLink.rateLimit
+
+	body, err := json.Marshal(map[string]any{"email": member.Email, "organizationId": org.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	statuses := make(chan int, 4*limit)
+	for range 4 * limit {
+		wg.Go(func() {
+			res, err := srv.Client().Post(srv.URL+"/v1/users/auth/magic-link", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+			statuses <- res.StatusCode
+		})
+	}
+	wg.Wait()
+	close(statuses)
+
+	for status := range statuses {
+		if status != http.StatusAccepted {
+			t.Errorf("asking for a link answered %d, want %d", status, http.StatusAccepted)
+		}
+	}
+	if sent := len(queuedLinks(t, app)); sent != limit {
+		t.Errorf("sent %d links, want the limit of %d", sent, limit)
+	}
+}
@@ -1,13 +1,49 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/smtp"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/env"
-	"go.uber.org/zap"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
 )
 
+// emailMessage is the outbox payload for models.OutboxKindEmail.
+type emailMessage struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	// Token, when set, names what the email carries a token for. The token
+	// is minted as the email is sent and replaces emailTokenPlaceholder in
+	// Body, so the outbox never holds one that could be redeemed.
+	Token *emailToken `json:"token,omitempty"`
+}
+
+const emailTokenPlaceholder = "{{token}}"
+
+const (
+	emailTokenAdminInvite = "admin_invite"
+	emailTokenUserInvite  = "user_invite"
+	emailTokenTransfer    = "organization_transfer"
+	emailTokenMagicLink   = "magic_link"
+)
+
+type emailToken struct {
+	Kind string    `json:"kind"`
+	ID   uuid.UUID `json:"id"`
+}
+
+// errEmailTokenStale means what an email's token was for can no longer be
+// redeemed, so the email is not worth sending.
+var errEmailTokenStale = errors.New("the token of the email is no longer redeemable")
+
 func (app *application) SendMail(recipient, body, subject string) error {
 
 	sender := env.GetString("EMAIL", "")
@@ -32,24 +68,271 @@ func (app *application) SendMail(recipient, body, subject string) error {
 	return nil
 }
 
-func (app *application) sendAdminInviteAsync(email, token string) {
-	go func() {
+// enqueueEmail writes the email to the outbox. Pass the outbox of the
+// transaction that makes the business change so the email is only sent if
+// that change commits.
+func (app *application) enqueueEmail(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	aggregateType string,
+	aggregateID uuid.UUID,
+	msg emailMessage,
+) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return app.enqueueOutbox(ctx, outbox, models.OutboxKindEmail, aggregateType, aggregateID, payload)
+}
+
+// enqueueAdminInvite queues the invite of the admin. Its token is minted
+// when the email is sent, replacing the one the invite was created with.
+func (app *application) enqueueAdminInvite(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	adminID uuid.UUID,
+	email string,
+) error {
+	body := "This is your admin activation token. It expires in 24hrs.\n\n" + emailTokenPlaceholder
+
+	return app.enqueueEmail(ctx, outbox, "admin", adminID, emailMessage{
+		To:      email,
+		Subject: "Admin Invitation",
+		Body:    body,
+		Token:   &emailToken{Kind: emailTokenAdminInvite, ID: adminID},
+	})
+}
+
+// enqueueUserInvite queues the invite of the user. Its token is minted when
+// the email is sent, replacing the one the invite was created with.
+func (app *application) enqueueUserInvite(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	userID uuid.UUID,
+	email string,
+) error {
+	body := "You have been invited to join an organization. Use this token to activate your account. It expires in 24hrs.\n\n" +
+		emailTokenPlaceholder
+
+	return app.enqueueEmail(ctx, outbox, "user", userID, emailMessage{
+		To:      email,
+		Subject: "User Invitation",
+		Body:    body,
+		Token:   &emailToken{Kind: emailTokenUserInvite, ID: userID},
+	})
+}
+
+// enqueueTransferOffer queues the offer of the transfer. Its token is minted
+// when the email is sent, replacing the one the transfer was created with.
+func (app *application) enqueueTransferOffer(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	transfer *models.OrganizationTransfer,
+	org *models.Organization,
+	email string,
+) error {
+	body := fmt.Sprintf(
+		"You have been offered ownership of the organization %s. Use this token to accept it before %s.\n\n%s",
+		org.Name,
+		transfer.ExpiresAt.Format(time.RFC1123),
+		emailTokenPlaceholder,
+	)
+
+	return app.enqueueEmail(ctx, outbox, "organization_transfer", transfer.ID, emailMessage{
+		To:      email,
+		Subject: "Organization Transfer",
+		Body:    body,
+		Token:   &emailToken{Kind: emailTokenTransfer, ID: transfer.ID},
+	})
+}
+
+func (app *application) enqueueGrantExpiry(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	grant *models.RoleGrant,
+	email string,
+) error {
+	body := fmt.Sprintf(
+		"Your %s grant of %s ends at %s. Ask for a new grant if you still need it.",
+		grant.Kind,
+		grantTarget(grant.Role, grant.Permission),
+		grant.ValidUntil.Format(time.RFC1123),
+	)
+
+	return app.enqueueEmail(ctx, outbox, "role_grant", grant.ID, emailMessage{
+		To:      email,
+		Subject: "Role Grant Expiring",
+		Body:    body,
+	})
+}
 
-		body := fmt.Sprintf(
-			"This is your admin activation token. It expires in 24hrs.\n\n%s",
-			token,
-		)
+func (app *application) enqueueAccessRequested(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	req *models.AccessRequest,
+	email string,
+) error {
+	body := fmt.Sprintf(
+		"A member has asked for %s for %d minutes.\n\nJustification: %s\n\nApprove or reject request %s before %s.",
+		grantTarget(req.Role, req.Permission),
+		req.GrantMinutes,
+		req.Justification,
+		req.ID,
+		req.ExpiresAt.Format(time.RFC1123),
+	)
 
-		if err := app.SendMail(email, body, "Admin Invitation"); err != nil {
+	return app.enqueueEmail(ctx, outbox, "access_request", req.ID, emailMessage{
+		To:      email,
+		Subject: "Access Request Awaiting Approval",
+		Body:    body,
+	})
+}
 
-			app.logger.Error(
-				"failed to send admin invite",
-				zap.String("email", email),
-				zap.Error(err),
-			)
+func (app *application) enqueueAccessResolved(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	req *models.AccessRequest,
+	email string,
+) error {
+	body := fmt.Sprintf("Your request for %s was %s.", grantTarget(req.Role, req.Permission), req.Status)
+	if req.Status == models.AccessRequestApproved {
+		body += fmt.Sprintf(" The grant lasts %d minutes.", req.GrantMinutes)
+	}
+
+	return app.enqueueEmail(ctx, outbox, "access_request", req.ID, emailMessage{
+		To:      email,
+		Subject: "Access Request Resolved",
+		Body:    body,
+	})
+}
 
+func (app *application) enqueueReviewAssigned(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	review *models.AccessReview,
+	items int,
+	email string,
+) error {
+	body := fmt.Sprintf(
+		"You are a reviewer of the access review %q (%s %s). Certify or revoke its %d items under review %s.",
+		review.Name,
+		review.ScopeType,
+		review.ScopeValue,
+		items,
+		review.ID,
+	)
+	if review.DueAt != nil {
+		body += " It is due " + review.DueAt.Format(time.RFC1123) + "."
+	}
+
+	return app.enqueueEmail(ctx, outbox, "access_review", review.ID, emailMessage{
+		To:      email,
+		Subject: "Access Review Assigned",
+		Body:    body,
+	})
+}
+
+// grantTarget names what a grant or access request gives in emails.
+func grantTarget(role, permission string) string {
+	if permission != "" {
+		return "the " + permission + " permission"
+	}
+	return "the " + role + " role"
+}
+
+// deliverEmail is the outbox handler for models.OutboxKindEmail.
+func (app *application) deliverEmail(ctx context.Context, msg *models.OutboxMessage) error {
+	var email emailMessage
+	if err := json.Unmarshal(msg.Payload, &email); err != nil {
+		return err
+	}
+
+	if email.Token != nil {
+		token, err := app.mintEmailToken(ctx, email.Token)
+		if errors.Is(err, errEmailTokenStale) {
+			app.logger.Infow("skipping email whose token is no longer redeemable",
+				"message", msg.ID, "kind", email.Token.Kind, "id", email.Token.ID)
+			return nil
+		} else if err != nil {
+			return err
 		}
+		email.Body = strings.ReplaceAll(email.Body, emailTokenPlaceholder, token)
+	}
+
+	return app.SendMail(email.To, email.Body, email.Subject)
+}
+
+// mintEmailToken gives what ref names a new token and returns it. Only its
+// hash is stored, so a token that was sent before stops working: the latest
+// email is the one to use.
+func (app *application) mintEmailToken(ctx context.Context, ref *emailToken) (string, error) {
+	token, err := app.GenerateInviteToken()
+	if err != nil {
+		return "", err
+	}
+	tokenHash := HashToken(token)
+	now := time.Now()
+
+	switch ref.Kind {
+	case emailTokenAdminInvite:
+		invite, err := app.store.AdminInvites.GetInviteByAdminId(ctx, ref.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return "", errEmailTokenStale
+		} else if err != nil {
+			return "", err
+		}
+		if !invite.UsedAt.IsZero() || now.After(invite.ExpiresAt) {
+			return "", errEmailTokenStale
+		}
+		err = app.store.AdminInvites.UpdateInvite(ctx, invite.ID, map[string]interface{}{"token_hash": tokenHash})
+	case emailTokenUserInvite:
+		invite, err := app.store.UserInvite.GetInviteByUserId(ctx, ref.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return "", errEmailTokenStale
+		} else if err != nil {
+			return "", err
+		}
+		if !invite.UsedAt.IsZero() || now.After(invite.ExpiresAt) {
+			return "", errEmailTokenStale
+		}
+		err = app.store.UserInvite.UpdateUserInvite(ctx, invite.ID, map[string]interface{}{"token_hash": tokenHash})
+	case emailTokenTransfer:
+		err = app.store.Organization.RotateTransferToken(ctx, ref.ID, tokenHash)
+		if errors.Is(err, store.ErrTransferNotPending) {
+			return "", errEmailTokenStale
+		}
+	case emailTokenMagicLink:
+		err = app.store.MagicLink.RotateLink(ctx, ref.ID, tokenHash, now)
+		if errors.Is(err, store.ErrInvalidToken) {
+			return "", errEmailTokenStale
+		}
+	default:
+		return "", fmt.Errorf("unknown email token kind %q", ref.Kind)
+	}
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
 
-	}()
+// enqueueMagicLink queues the email with the link. Its token is minted when
+// the email is sent, replacing the one the link was created with.
+func (app *application) enqueueMagicLink(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	link *models.MagicLink,
+) error {
+	body := fmt.Sprintf(
+		"Use this link to sign in. It expires at %s and works once. If you did not ask for it, ignore this email.\n\n%s?token=%s",
+		link.ExpiresAt.Format(time.RFC1123),
+		app.config.magicLink.url,
+		emailTokenPlaceholder,
+	)
 
+	return app.enqueueEmail(ctx, outbox, "user", link.UserID, emailMessage{
+		To:      link.Email,
+		Subject: "Sign-in Link",
+		Body:    body,
+		Token:   &emailToken{Kind: emailTokenMagicLink, ID: link.ID},
+	})
 }
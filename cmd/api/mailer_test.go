@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+// queuedEmails returns the emails waiting in the outbox.
+func queuedEmails(t *testing.T, app *application) []emailMessage {
+	t.Helper()
+
+	var emails []emailMessage
+	for _, msg := range claimOutbox(t, app) {
+		if msg.Kind != models.OutboxKindEmail {
+			continue
+		}
+		var email emailMessage
+		if err := json.Unmarshal(msg.Payload, &email); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+func TestInviteTokenIsMintedWhenSent(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	org := seedOrganization(t, app, seedAdmin(t, app, RoleAdmin))
+
+	user := &models.User{
+		ID:     uuid.New(),
+		Name:   "Invited",
+		Email:  "invited@example.com",
+		Role:   RoleUser,
+		Status: helpers.StatusPending,
+	}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		return app.inviteUser(ctx, tx, org, user, &models.Membership{
+			ID:             uuid.New(),
+			UserID:         user.ID,
+			OrganizationID: org.ID,
+			Role:           RoleUser,
+			Status:         helpers.StatusActive,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := queuedEmails(t, app)
+	if len(emails) != 1 {
+		t.Fatalf("queued %d emails, want 1", len(emails))
+	}
+	email := emails[0]
+	if email.Token == nil || !strings.Contains(email.Body, emailTokenPlaceholder) {
+		t.Fatalf("the invite was queued with its token: %+v", email)
+	}
+
+	first, err := app.mintEmailToken(ctx, email.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := app.mintEmailToken(ctx, email.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.store.UserInvite.ValidateUserToken(ctx, HashToken(first)); !errors.Is(err, store.ErrInvalidToken) {
+		t.Errorf("a token sent before still works: %v", err)
+	}
+	invite, err := app.store.UserInvite.ValidateUserToken(ctx, HashToken(second))
+	if err != nil {
+		t.Fatalf("the token sent last does not work: %v", err)
+	}
+
+	err = app.store.UserInvite.UpdateUserInvite(ctx, invite.ID, map[string]interface{}{"used_at": time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.mintEmailToken(ctx, email.Token); !errors.Is(err, errEmailTokenStale) {
+		t.Errorf("minted a token for a used invite: %v", err)
+	}
+}
+
+func TestReplayOnlyDeadMessages(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	err := app.enqueueEmail(ctx, app.store.Outbox, "user", uuid.New(), emailMessage{
+		To:      "someone@example.com",
+		Subject: "Hello",
+		Body:    "Hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := claimOutbox(t, app)
+	if len(msgs) != 1 {
+		t.Fatalf("queued %d messages, want 1", len(msgs))
+	}
+	id := msgs[0].ID
+
+	if err := app.store.Outbox.Replay(ctx, id, time.Now()); !errors.Is(err, store.ErrOutboxMessageNotDead) {
+		t.Errorf("replayed a pending message: %v", err)
+	}
+
+	if err := app.store.Outbox.MarkFailed(ctx, id, "refused", time.Now(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Outbox.Replay(ctx, id, time.Now()); err != nil {
+		t.Errorf("could not replay a dead message: %v", err)
+	}
+
+	if err := app.store.Outbox.MarkDelivered(ctx, id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Outbox.Replay(ctx, id, time.Now()); !errors.Is(err, store.ErrOutboxMessageNotDead) {
+		t.Errorf("replayed a delivered message: %v", err)
+	}
+
+	if err := app.store.Outbox.Replay(ctx, uuid.New(), time.Now()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("replaying an unknown message: %v, want not found", err)
+	}
+}
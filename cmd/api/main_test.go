@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newTestApp returns an application on a fresh in-memory store, configured
+// like a development instance.
+func newTestApp(t *testing.T) *application {
+	t.Helper()
+	t.Setenv("SECRET_KEY", "test-secret")
+
+	app := &application{
+		config: config{
+			env: "test",
+			outbox: outboxConfig{
+				batchSize:   20,
+				maxAttempts: 3,
+				lease:       time.Minute,
+				baseBackoff: time.Second,
+				maxBackoff:  time.Minute,
+			},
+			softDelete: softDeleteConfig{
+				restoreWindow: 7 * 24 * time.Hour,
+				retention:     30 * 24 * time.Hour,
+			},
+			orgMaxDepth: 5,
+			transferTTL: 72 * time.Hour,
+			grants: grantConfig{
+				expiryNotice: 15 * time.Minute,
+				maxElevation: time.Hour,
+			},
+			access: accessConfig{
+				requestTTL: 7 * 24 * time.Hour,
+				maxGrant:   7 * 24 * time.Hour,
+			},
+			decisionLog: decisionLogConfig{sink: decisionSinkOff},
+			webhooks: webhookConfig{
+				timeout: 5 * time.Second,
+				client:  newWebhookClient(false),
+			},
+			sso: ssoConfig{
+				callbackURL: "http://localhost:8080/v1/users/sso/oidc/callback",
+				stateTTL:    10 * time.Minute,
+				timeout:     5 * time.Second,
+			},
+			saml: samlConfig{
+				baseURL:    "http://localhost:8080",
+				requestTTL: 10 * time.Minute,
+				clockSkew:  2 * time.Minute,
+			},
+			magicLink: magicLinkConfig{
+				url:        "http://localhost:3000/magic-link",
+				ttl:        15 * time.Minute,
+				rateLimit:  5,
+				rateWindow: time.Hour,
+			},
+		},
+		logger: zap.NewNop().Sugar(),
+		middleWare: middleWareConfig{
+			rateLimiters: make(map[string]*rate.Limiter),
+		},
+		store: store.NewMemoryStorage(),
+		ctx:   context.Background(),
+	}
+
+	var err error
+	if app.decisions, err = app.newDecisionLog(app.config.decisionLog); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// seedAdmin creates an active admin with role who signs in with
+// testPassword.
+func seedAdmin(t *testing.T, app *application, role string) *models.Admin {
+	t.Helper()
+
+	password, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &models.Admin{
+		ID:        uuid.New(),
+		Name:      "Test Admin",
+		Email:     uuid.NewString() + "@admins.example.com",
+		Role:      role,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Status:    helpers.StatusActive,
+		Password:  password,
+	}
+	if err := app.store.Admin.CreateAdmin(context.Background(), admin); err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// seedOrganization creates an active organization owned by admin.
+func seedOrganization(t *testing.T, app *application, admin *models.Admin) *models.Organization {
+	t.Helper()
+
+	org := &models.Organization{
+		ID:      uuid.New(),
+		Name:    "Test Organization",
+		Email:   uuid.NewString() + "@orgs.example.com",
+		AdminID: admin.ID,
+	}
+	if err := app.store.Organization.CreateOrganization(context.Background(), org); err != nil {
+		t.Fatal(err)
+	}
+	return org
+}
+
+// seedMember creates an active user who signs in with testPassword and
+// belongs to org with role.
+func seedMember(t *testing.T, app *application, org *models.Organization, email, role string) *models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	password, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{
+		ID:        uuid.New(),
+		Name:      "Test User",
+		Email:     email,
+		Password:  password,
+		Role:      role,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Status:    helpers.StatusActive,
+	}
+	if err := app.store.User.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Membership.CreateMembership(ctx, &models.Membership{
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		OrganizationID: org.ID,
+		Role:           role,
+		Status:         helpers.StatusActive,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// claimOutbox returns the messages waiting in the outbox, leasing them so
+// the caller can deliver them by hand.
+func claimOutbox(t *testing.T, app *application) []models.OutboxMessage {
+	t.Helper()
+
+	msgs, err := app.store.Outbox.ClaimDue(context.Background(), time.Now().Add(time.Minute), 100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+// testResponse is the envelope every handler answers with.
+type testResponse struct {
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+	Error   string          `json:"error"`
+}
+
+// doJSON sends body as JSON to the server, authenticated with token unless
+// it is empty, and decodes the answer.
+func doJSON(t *testing.T, srv *httptest.Server, method, path, token string, body any) (int, testResponse) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var out testResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil && err != io.EOF {
+		t.Fatalf("%s %s: decoding the answer: %v", method, path, err)
+	}
+	return res.StatusCode, out
+}
+
+// loginAdmin signs admin in and returns its token.
+func loginAdmin(t *testing.T, srv *httptest.Server, admin *models.Admin) string {
+	t.Helper()
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/admin/auth/login", "", map[string]string{
+		"email":    admin.Email,
+		"password": testPassword,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("admin login answered %d: %s", status, res.Error)
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Token
+}
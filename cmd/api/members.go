@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// ListMembersHandler lists the users of the organization given by ?id=.
+func (app *application) ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermUsersView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view members"))
+		return
+	}
+
+	orgID, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	params, err := readListParams(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	params.OrganizationID = orgID
+
+	if !app.authorizeOrgList(w, r, user, orgID) {
+		return
+	}
+
+	members, page, err := app.store.User.ListUsers(ctx, params)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.pageResponse(w, http.StatusOK, members, page, "members")
+}
+
+// memberResponse is a user as seen from one of their organizations.
+type memberResponse struct {
+	*models.User
+	Membership *models.Membership `json:"membership"`
+}
+
+func (app *application) GetMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.loadMember(w, r, PermUsersView, "view")
+	if !ok {
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, member, "member")
+}
+
+// UpdateMemberHandler renames the user or changes their role in the
+// organization. The name is shared by every organization the user belongs to.
+func (app *application) UpdateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.loadMember(w, r, PermUsersUpdate, "update")
+	if !ok {
+		return
+	}
+
+	var payload dtos.UpdateMemberPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	userUpdates := map[string]interface{}{}
+	if payload.Name != nil {
+		userUpdates["name"] = *payload.Name
+	}
+	membershipUpdates := map[string]interface{}{}
+	if payload.Role != nil {
+		if !slices.Contains(MemberRoles, *payload.Role) {
+			app.badRequestResponse(w, r, errors.New("role must be one of ["+strings.Join(MemberRoles, " ")+"]"))
+			return
+		}
+		membershipUpdates["role"] = *payload.Role
+	}
+	if len(userUpdates) == 0 && len(membershipUpdates) == 0 {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+
+	member, err := app.updateMember(r, member, userUpdates, membershipUpdates)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, member, "member updated successfully")
+}
+
+func (app *application) SuspendMemberHandler(w http.ResponseWriter, r *http.Request) {
+	app.setMemberStatus(w, r, helpers.StatusSuspended)
+}
+
+func (app *application) ReactivateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	app.setMemberStatus(w, r, helpers.StatusActive)
+}
+
+// setMemberStatus suspends or reactivates a user's membership in one
+// organization, following the same rules as setAdminStatus. Their other
+// memberships are unaffected.
+func (app *application) setMemberStatus(w http.ResponseWriter, r *http.Request, status string) {
+	member, ok := app.loadMember(w, r, PermUsersUpdate, "update")
+	if !ok {
+		return
+	}
+
+	switch current := member.Membership.Status; {
+	case current == status:
+		app.conflictResponse(w, r, errors.New("member is already "+status))
+		return
+	case status == helpers.StatusSuspended && current != helpers.StatusActive:
+		app.conflictResponse(w, r, errors.New("only active members can be suspended"))
+		return
+	case status == helpers.StatusActive && current != helpers.StatusSuspended:
+		app.conflictResponse(w, r, errors.New("only suspended members can be reactivated"))
+		return
+	}
+
+	member, err := app.updateMember(r, member, nil, map[string]interface{}{"status": status})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, member, "member is now "+status)
+}
+
+// RemoveMemberHandler takes the user out of the organization. A user removed
+// from their last organization is deleted altogether.
+func (app *application) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	member, ok := app.loadMember(w, r, PermUsersDelete, "remove")
+	if !ok {
+		return
+	}
+
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		memberships, err := tx.Membership.ListUserMemberships(ctx, member.ID)
+		if err != nil {
+			return err
+		}
+		if len(memberships) == 1 {
+			return tx.User.DeleteUser(ctx, member.ID)
+		}
+		return tx.Membership.DeleteMembership(ctx, member.Membership.ID)
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	restoreBy := app.restoreDeadline(time.Now())
+	app.jsonResponse(w, http.StatusOK, map[string]time.Time{"restoreBy": restoreBy},
+		"member removed successfully, they can be restored until "+restoreBy.Format(time.RFC3339))
+}
+
+func (app *application) RestoreMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermUsersDelete) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to restore members"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to restore this member"))
+		return
+	}
+
+	deletedSince := time.Now().Add(-app.config.softDelete.restoreWindow)
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		// a user removed from their last organization was deleted with it
+		if _, err := tx.User.GetDeletedUser(ctx, id); err == nil {
+			return tx.User.RestoreUser(ctx, id, deletedSince)
+		}
+
+		membership, err := tx.Membership.GetDeletedMembership(ctx, id, orgID)
+		if err != nil {
+			return err
+		}
+		return tx.Membership.RestoreMembership(ctx, membership.ID, deletedSince)
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "member restored successfully")
+}
+
+// loadMember resolves the user given by ?id= and their membership in the
+// organization given by ?organizationId=, and checks that the caller has perm
+// and administers that organization. It writes the error response itself.
+func (app *application) loadMember(
+	w http.ResponseWriter,
+	r *http.Request,
+	perm string,
+	action string,
+) (*memberResponse, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+	if !app.HasPermission(user, perm) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" members"))
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" this member"))
+		return nil, false
+	}
+
+	member, err := app.store.User.GetUser(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	membership, err := app.store.Membership.GetMembership(ctx, id, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return &memberResponse{User: member, Membership: membership}, true
+}
+
+// updateMember applies updates to the user and their membership and returns
+// the member as stored afterwards.
+func (app *application) updateMember(
+	r *http.Request,
+	member *memberResponse,
+	userUpdates map[string]interface{},
+	membershipUpdates map[string]interface{},
+) (*memberResponse, error) {
+	ctx := r.Context()
+	id := member.ID
+
+	updated := &memberResponse{}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if len(userUpdates) > 0 {
+			if err := tx.User.UpdateUser(ctx, id, userUpdates); err != nil {
+				return err
+			}
+		}
+		if len(membershipUpdates) > 0 {
+			if err := tx.Membership.UpdateMembership(ctx, member.Membership.ID, membershipUpdates); err != nil {
+				return err
+			}
+		}
+		if _, ok := membershipUpdates["role"]; ok {
+			if err := checkStaticSoD(ctx, tx, userPrincipal(id, member.Membership.OrganizationID)); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if updated.User, err = tx.User.GetUser(ctx, id); err != nil {
+			return err
+		}
+		if updated.Membership, err = tx.Membership.GetMembership(ctx, id, member.Membership.OrganizationID); err != nil {
+			return err
+		}
+		return app.publishMemberWebhooks(ctx, tx, member.Membership, updated)
+	})
+	if err != nil {
+		app.logger.Error("error updating member", zap.String("id", id.String()), zap.Error(err))
+		return nil, err
+	}
+	return updated, nil
+}
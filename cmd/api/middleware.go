@@ -3,13 +3,19 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
 	"golang.org/x/time/rate"
 )
 
@@ -46,25 +52,48 @@ func (app *application) AuthMiddleware(secret string) func(http.Handler) http.Ha
 				app.unauthorizedResponse(w, r, errors.New("invalid user id"))
 				return
 			}
-			perms, ok := RolePermissions[claims.Role]
-			if !ok {
+
+			err = app.refreshClaims(r.Context(), claims, userID)
+			switch {
+			case errors.Is(err, store.ErrMembershipNotFound):
+				app.unauthorizedResponse(w, r, errors.New("no longer a member of this organization"))
+				return
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedResponse(w, r, errors.New("account no longer exists"))
+				return
+			case errors.Is(err, errAccountSuspended), errors.Is(err, errOrgSuspended),
+				errors.Is(err, errMembershipSuspended):
+				app.unauthorizedResponse(w, r, err)
+				return
+			case err != nil:
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			app.enforceSessionSoD(claims)
+
+			if _, ok := RolePermissions[claims.Role]; !ok {
 				http.Error(w, "invalid role", http.StatusUnauthorized)
 				return
 			}
 
 			user := UserClaims{
-				UserID: userID.String(),
-				Email:  claims.Email,
-				Name:   claims.Name,
-				Role:   claims.Role,
-				Perms:  perms,
+				UserID:     userID.String(),
+				Email:      claims.Email,
+				Name:       claims.Name,
+				Role:       claims.Role,
+				OrgID:      claims.OrgID,
+				GroupRoles: claims.GroupRoles,
+				GrantRoles: claims.GrantRoles,
+				GrantPerms: claims.GrantPerms,
+				Perms:      effectivePermissions(*claims),
 				RegisteredClaims: jwt.RegisteredClaims{
 					ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 					IssuedAt:  jwt.NewNumericDate(time.Now()),
 				},
 			}
 
-			ctx := context.WithValue(r.Context(), userContextKey, user)
+			ctx := context.WithValue(r.Context(), userContextKey, user.withRequest(r))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -102,6 +131,185 @@ func (app *application) ConcurrencyMiddleware() func(http.Handler) http.Handler
 	}
 }
 
+// RealIPMiddleware sets RemoteAddr to the client's address. X-Forwarded-For
+// and X-Real-IP are only believed from trusted proxies, since anyone else
+// can send them: X-Forwarded-For is read from the right, and the first
+// address that is not a trusted proxy is the client.
+func (app *application) RealIPMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := app.forwardedIP(r); ok {
+				r.RemoteAddr = ip.String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP is the client address the trusted proxy in front of r
+// forwarded, if there is one.
+func (app *application) forwardedIP(r *http.Request) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !app.trustedProxy(peer.Addr()) {
+		return netip.Addr{}, false
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client, found := netip.Addr{}, false
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client, found = ip.Unmap(), true
+		if !app.trustedProxy(client) {
+			return client, true
+		}
+	}
+	if found {
+		return client, true
+	}
+
+	if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return ip.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies reads a comma-separated list of addresses and CIDR
+// ranges.
+func parseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if ip, err := netip.ParseAddr(field); err == nil {
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+var (
+	errAccountSuspended    = errors.New("account is suspended")
+	errOrgSuspended        = errors.New("organization is suspended")
+	errMembershipSuspended = errors.New("membership in this organization is suspended")
+)
+
+// refreshClaims re-reads the account behind a token. Accounts can be
+// suspended, deleted or have their role changed while a token is still valid,
+// so the role in the token is only used to tell admins from users. A user's
+// role comes from their membership in the token's organization, which must
+// not be suspended either, and the groups they are in there add theirs.
+// Grants that are active right now add their roles on top.
+func (app *application) refreshClaims(ctx context.Context, claims *UserClaims, id uuid.UUID) error {
+	switch claims.Role {
+	case RoleAdmin, RoleSuperAdmin:
+		admin, err := app.store.Admin.GetAdmin(ctx, id)
+		if err != nil {
+			return err
+		}
+		if admin.Status == helpers.StatusSuspended {
+			return errAccountSuspended
+		}
+		grants, err := app.store.Grant.ActiveGrants(ctx, id, nil, time.Now())
+		if err != nil {
+			return err
+		}
+		claims.Role = admin.Role
+		claims.OrgID = ""
+		claims.GroupRoles = nil
+		claims.GrantRoles, claims.GrantPerms = splitGrants(grants)
+		return nil
+	default:
+		user, err := app.store.User.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user.Status == helpers.StatusSuspended {
+			return errAccountSuspended
+		}
+		membership, err := app.tokenMembership(ctx, claims, id)
+		if err != nil {
+			return err
+		}
+		if err := app.checkMembershipActive(ctx, membership); err != nil {
+			return err
+		}
+		groupRoles, err := app.store.Group.UserRoles(ctx, id, membership.OrganizationID)
+		if err != nil {
+			return err
+		}
+		grants, err := app.store.Grant.ActiveGrants(ctx, id, &membership.OrganizationID, time.Now())
+		if err != nil {
+			return err
+		}
+		claims.Role = membership.Role
+		claims.OrgID = membership.OrganizationID.String()
+		claims.GroupRoles = groupRoles
+		claims.GrantRoles, claims.GrantPerms = splitGrants(grants)
+		return nil
+	}
+}
+
+// splitGrants separates the roles and the single permissions that active
+// grants give.
+func splitGrants(grants []models.RoleGrant) (roles, perms []string) {
+	for _, grant := range grants {
+		if grant.Role != "" && !slices.Contains(roles, grant.Role) {
+			roles = append(roles, grant.Role)
+		}
+		if grant.Permission != "" && !slices.Contains(perms, grant.Permission) {
+			perms = append(perms, grant.Permission)
+		}
+	}
+	return roles, perms
+}
+
+// tokenMembership finds the membership a user token is scoped to. Tokens
+// issued before memberships existed carry no orgId and fall back to the
+// user's oldest membership.
+func (app *application) tokenMembership(ctx context.Context, claims *UserClaims, userID uuid.UUID) (*models.Membership, error) {
+	if claims.OrgID != "" {
+		orgID, err := uuid.Parse(claims.OrgID)
+		if err != nil {
+			return nil, store.ErrMembershipNotFound
+		}
+		return app.store.Membership.GetMembership(ctx, userID, orgID)
+	}
+
+	memberships, err := app.store.Membership.ListUserMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, store.ErrMembershipNotFound
+	}
+	return &memberships[0], nil
+}
+
 // middleware for rate limiting : 	Limits frequency of requests per user
 func (app *application) getRateLimiter(userID string) *rate.Limiter {
 	app.middleWare.rlMu.Lock()
@@ -141,7 +349,11 @@ func (app *application) RequirePermission(perm string) func(http.Handler) http.H
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, err := GetUserFromContext(r.Context())
-			if err != nil || !app.HasPermission(user.Role, perm) {
+			if err != nil {
+				// still logged, as a denial without a subject
+				user = UserClaims{}.withRequest(r)
+			}
+			if !app.checkPermission(user, perm, models.AuthzCheckRoute) {
 				app.unauthorizedResponse(w, r, errors.New("forbidden"))
 				return
 			}
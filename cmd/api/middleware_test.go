@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	var err error
+	if app.config.trustedProxies, err = parseTrustedProxies("10.0.0.0/8, 192.0.2.1, ::ffff:198.51.100.0/120"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.9:4000",
+			forwarded:  []string{"198.18.0.1"},
+			realIP:     "198.18.0.2",
+			want:       "203.0.113.9:4000",
+		},
+		{
+			name:       "trusted peer",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "client spoofing hops in front of the proxy",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"198.18.0.1, 203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "192.0.2.1:4000",
+			forwarded:  []string{"198.18.0.1, 203.0.113.9", "10.9.9.9, 198.51.100.7"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "garbage before the proxy's hop",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"not-an-ip, 203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "X-Real-IP from a trusted peer",
+			remoteAddr: "10.1.2.3:4000",
+			realIP:     "203.0.113.9",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.1.2.3:4000",
+			want:       "10.1.2.3:4000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			app.RealIPMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if proxies, err := parseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Errorf("parseTrustedProxies(\"\") = %v, %v", proxies, err)
+	}
+	for _, raw := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.1,,nope"} {
+		if _, err := parseTrustedProxies(raw); err == nil {
+			t.Errorf("parseTrustedProxies(%q) accepted it", raw)
+		}
+	}
+}
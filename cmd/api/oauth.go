@@ -0,0 +1,900 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// oauthConfig configures us as the OAuth 2.0 authorization server and OpenID
+// Connect provider of other applications.
+type oauthConfig struct {
+	// issuer is our issuer identifier: the public URL /oauth2 and the
+	// discovery document are served under.
+	issuer string
+	// loginURL is the page that signs users in for an authorization
+	// request. It receives the request's query and completes it with
+	// POST /oauth2/authorize.
+	loginURL   string
+	codeTTL    time.Duration
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// signingKey signs ID tokens. Its public half is served as our JWKS.
+	signingKey *rsa.PrivateKey
+}
+
+const (
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantRefreshToken      = "refresh_token"
+	oauthGrantClientCredentials = "client_credentials"
+
+	oauthScopeOpenID        = "openid"
+	oauthScopeProfile       = "profile"
+	oauthScopeEmail         = "email"
+	oauthScopeOfflineAccess = "offline_access"
+)
+
+var oauthGrantTypes = []string{oauthGrantAuthorizationCode, oauthGrantRefreshToken, oauthGrantClientCredentials}
+
+// oauthUserScopes are about the user signing in, so clients acting for
+// themselves cannot ask for them.
+var oauthUserScopes = []string{oauthScopeOpenID, oauthScopeProfile, oauthScopeEmail, oauthScopeOfflineAccess}
+
+// oauthError is an OAuth error response (RFC 6749 section 5.2). Handlers
+// return it to answer with a specific status and error code.
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+var errOAuthInvalidClient = newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+
+// oauthErrorResponse answers with err in the OAuth error format. Anything but
+// an oauthError is a server error.
+func (app *application) oauthErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var oe *oauthError
+	if !errors.As(err, &oe) {
+		app.logger.Errorw("OAuth request failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+		oe = newOAuthError(http.StatusInternalServerError, "server_error", "internal server error")
+	} else {
+		app.logger.Warnw("OAuth request rejected", "method", r.Method, "path", r.URL.Path, "error", oe.Error())
+	}
+
+	switch oe.code {
+	case "invalid_client":
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	case "invalid_token", "insufficient_scope":
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error=%q, error_description=%q`, oe.code, oe.description))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, oe.status, map[string]string{"error": oe.code, "error_description": oe.description})
+}
+
+// oauthPublicJWK is the public signing key as a JWK. Its key id is the
+// key's RFC 7638 thumbprint, so it changes when the key does.
+func (app *application) oauthPublicJWK() map[string]string {
+	key := app.config.oauth.signingKey.PublicKey
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+	// json.Marshal sorts map keys, as the thumbprint requires
+	thumbprint, _ := json.Marshal(map[string]string{"e": e, "kty": "RSA", "n": n})
+	sum := sha256.Sum256(thumbprint)
+	return map[string]string{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": base64.RawURLEncoding.EncodeToString(sum[:]),
+		"n":   n,
+		"e":   e,
+	}
+}
+
+func (app *application) OAuthDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := app.config.oauth.issuer
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"jwks_uri":                              issuer + "/oauth2/jwks",
+		"introspection_endpoint":                issuer + "/oauth2/introspect",
+		"revocation_endpoint":                   issuer + "/oauth2/revoke",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 oauthGrantTypes,
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      oauthUserScopes,
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "name", "email", "email_verified", "role", "perms", "org_id",
+		},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported":  []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":     []string{"client_secret_basic", "client_secret_post", "none"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+func (app *application) OAuthJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{app.oauthPublicJWK()}})
+}
+
+// oauthAuthorizeRequest is a checked authorization request.
+type oauthAuthorizeRequest struct {
+	client        *models.OAuthClient
+	redirectURI   string
+	state         string
+	scope         string
+	nonce         string
+	codeChallenge string
+}
+
+// redirect is where the user goes back to the client with params.
+func (req *oauthAuthorizeRequest) redirect(app *application, params url.Values) string {
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	params.Set("iss", app.config.oauth.issuer)
+	sep := "?"
+	if strings.Contains(req.redirectURI, "?") {
+		sep = "&"
+	}
+	return req.redirectURI + sep + params.Encode()
+}
+
+// errorRedirect sends the user back to the client with err.
+func (req *oauthAuthorizeRequest) errorRedirect(app *application, err *oauthError) string {
+	return req.redirect(app, url.Values{"error": {err.code}, "error_description": {err.description}})
+}
+
+// readAuthorizeRequest checks the authorization request in the query. It
+// returns no request when the client or redirect URI is unknown, as the user
+// must not be sent back to it; with any other problem it returns the request
+// along with the error to send back.
+func (app *application) readAuthorizeRequest(r *http.Request) (*oauthAuthorizeRequest, error) {
+	query := r.URL.Query()
+
+	clientID, err := uuid.Parse(query.Get("client_id"))
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "client_id is not a registered client")
+	}
+	client, err := app.store.OAuth.GetClient(r.Context(), clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "client_id is not a registered client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &oauthAuthorizeRequest{
+		client:        client,
+		redirectURI:   query.Get("redirect_uri"),
+		state:         query.Get("state"),
+		scope:         query.Get("scope"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	if req.redirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.redirectURI) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	switch {
+	case query.Get("response_type") != "code":
+		return req, newOAuthError(http.StatusBadRequest, "unsupported_response_type", "response_type must be code")
+	case !slices.Contains(client.GrantTypes, oauthGrantAuthorizationCode):
+		return req, newOAuthError(http.StatusBadRequest, "unauthorized_client", "the client cannot use the authorization code grant")
+	case req.codeChallenge == "" || query.Get("code_challenge_method") != "S256":
+		return req, newOAuthError(http.StatusBadRequest, "invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	if req.scope == "" {
+		req.scope = client.Scopes
+	}
+	for _, scope := range strings.Fields(req.scope) {
+		if !hasScope(client.Scopes, scope) {
+			return req, newOAuthError(http.StatusBadRequest, "invalid_scope", "the client cannot request scope "+scope)
+		}
+	}
+	return req, nil
+}
+
+// OAuthAuthorizeHandler starts an authorization request. Once the request
+// checks out the user is sent to the login page, which signs them in and
+// completes it with OAuthApproveHandler.
+func (app *application) OAuthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := app.readAuthorizeRequest(r)
+	if req == nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	var oe *oauthError
+	if errors.As(err, &oe) {
+		http.Redirect(w, r, req.errorRedirect(app, oe), http.StatusFound)
+		return
+	}
+
+	sep := "?"
+	if strings.Contains(app.config.oauth.loginURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, app.config.oauth.loginURL+sep+r.URL.RawQuery, http.StatusFound)
+}
+
+// OAuthApproveHandler completes an authorization request for the signed-in
+// account, with the query it was started with. Clients are registered by
+// super admins and trusted, so no consent is asked. It answers with where to
+// send the user: back to the client with a code, or with the error.
+func (app *application) OAuthApproveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	req, err := app.readAuthorizeRequest(r)
+	if req == nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	var oe *oauthError
+	if errors.As(err, &oe) {
+		app.jsonResponse(w, http.StatusBadRequest, map[string]string{"redirectTo": req.errorRedirect(app, oe)}, oe.description)
+		return
+	}
+
+	raw, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	code := &models.OAuthAuthorizationCode{
+		ID:            uuid.New(),
+		CodeHash:      HashToken(raw),
+		ClientID:      req.client.ID,
+		SubjectID:     uuid.MustParse(user.UserID),
+		SubjectRole:   user.Role,
+		RedirectURI:   req.redirectURI,
+		Scope:         req.scope,
+		Nonce:         req.nonce,
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     time.Now().Add(app.config.oauth.codeTTL),
+	}
+	if user.OrgID != "" {
+		orgID := uuid.MustParse(user.OrgID)
+		code.OrganizationID = &orgID
+	}
+	if err := app.store.OAuth.CreateCode(ctx, code); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, map[string]string{"redirectTo": req.redirect(app, url.Values{"code": {raw}})},
+		"authorization granted")
+}
+
+// oauthTokenResponse is a successful token response (RFC 6749 section 5.1).
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// oauthGrant is what a token is issued for: the account and organization,
+// none for clients acting for themselves, and the scope.
+type oauthGrant struct {
+	subjectID   *uuid.UUID
+	subjectRole string
+	orgID       *uuid.UUID
+	scope       string
+	familyID    uuid.UUID
+}
+
+func tokenGrant(token *models.OAuthToken) oauthGrant {
+	return oauthGrant{
+		subjectID:   token.SubjectID,
+		subjectRole: token.SubjectRole,
+		orgID:       token.OrganizationID,
+		scope:       token.Scope,
+		familyID:    token.FamilyID,
+	}
+}
+
+// OAuthTokenHandler is the token endpoint of the authorization code,
+// refresh token and client credentials grants.
+func (app *application) OAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := app.readOAuthClientForm(w, r)
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if !slices.Contains(oauthGrantTypes, grantType) {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type "+grantType+" is not supported"))
+		return
+	}
+	if !slices.Contains(client.GrantTypes, grantType) {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusBadRequest, "unauthorized_client", "the client cannot use the "+grantType+" grant"))
+		return
+	}
+
+	var res *oauthTokenResponse
+	switch grantType {
+	case oauthGrantAuthorizationCode:
+		res, err = app.oauthExchangeCode(r.Context(), client, r.PostForm)
+	case oauthGrantRefreshToken:
+		res, err = app.oauthRefresh(r.Context(), client, r.PostForm)
+	case oauthGrantClientCredentials:
+		res, err = app.oauthClientCredentials(r.Context(), client, r.PostForm)
+	}
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (app *application) oauthExchangeCode(ctx context.Context, client *models.OAuthClient, form url.Values) (*oauthTokenResponse, error) {
+	raw := form.Get("code")
+	if raw == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code is required")
+	}
+
+	// the code is used up even when the request fails
+	code, err := app.store.OAuth.ConsumeCode(ctx, HashToken(raw), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "the authorization code is invalid or has expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code.ClientID != client.ID:
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "the authorization code was issued to another client")
+	case form.Get("redirect_uri") != code.RedirectURI:
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	case !verifyPKCE(form.Get("code_verifier"), code.CodeChallenge):
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	// the subject must still be able to sign in
+	grant := oauthGrant{
+		subjectID:   &code.SubjectID,
+		subjectRole: code.SubjectRole,
+		orgID:       code.OrganizationID,
+		scope:       code.Scope,
+		familyID:    uuid.New(),
+	}
+	user, err := app.oauthUser(ctx, grant)
+	if err != nil {
+		return nil, oauthAccountError(err, "invalid_grant")
+	}
+
+	var res *oauthTokenResponse
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		res, err = app.oauthIssue(ctx, tx, client, grant, &user, code.Nonce)
+		return err
+	})
+	return res, err
+}
+
+// oauthRefresh rotates a refresh token: it is revoked and a new one issued
+// with the access token. A refresh token is only ever used once, so seeing
+// one again means it leaked, and everything issued from the same
+// authorization is revoked.
+func (app *application) oauthRefresh(ctx context.Context, client *models.OAuthClient, form url.Values) (*oauthTokenResponse, error) {
+	invalid := newOAuthError(http.StatusBadRequest, "invalid_grant", "the refresh token is invalid or has expired")
+
+	raw := form.Get("refresh_token")
+	if raw == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+	token, err := app.store.OAuth.GetTokenByHash(ctx, HashToken(raw))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	switch {
+	case token.Kind != models.OAuthTokenRefresh || token.ClientID != client.ID:
+		return nil, invalid
+	case token.RevokedAt != nil:
+		return nil, app.oauthTokenReused(ctx, token, invalid)
+	case !token.ExpiresAt.After(now):
+		return nil, invalid
+	}
+
+	grant := tokenGrant(token)
+	if requested := form.Get("scope"); requested != "" {
+		for _, scope := range strings.Fields(requested) {
+			if !hasScope(token.Scope, scope) {
+				return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope "+scope+" was not granted")
+			}
+		}
+		grant.scope = requested
+	}
+	user, err := app.oauthUser(ctx, grant)
+	if err != nil {
+		return nil, oauthAccountError(err, "invalid_grant")
+	}
+
+	var res *oauthTokenResponse
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.OAuth.RevokeToken(ctx, token.ID, now); err != nil {
+			return err
+		}
+		res, err = app.oauthIssue(ctx, tx, client, grant, &user, "")
+		return err
+	})
+	if errors.Is(err, store.ErrInvalidToken) {
+		// another request used it first
+		return nil, app.oauthTokenReused(ctx, token, invalid)
+	}
+	return res, err
+}
+
+func (app *application) oauthTokenReused(ctx context.Context, token *models.OAuthToken, invalid error) error {
+	app.logger.Warnw("revoked refresh token used again, revoking its authorization",
+		"client", token.ClientID, "family", token.FamilyID)
+	if err := app.store.OAuth.RevokeFamily(ctx, token.FamilyID, time.Now()); err != nil {
+		return err
+	}
+	return invalid
+}
+
+func (app *application) oauthClientCredentials(ctx context.Context, client *models.OAuthClient, form url.Values) (*oauthTokenResponse, error) {
+	var allowed []string
+	for _, scope := range strings.Fields(client.Scopes) {
+		if !slices.Contains(oauthUserScopes, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	scope := form.Get("scope")
+	if scope == "" {
+		scope = strings.Join(allowed, " ")
+	}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(allowed, s) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "the client cannot request scope "+s+" for itself")
+		}
+	}
+
+	var res *oauthTokenResponse
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		var err error
+		res, err = app.oauthIssue(ctx, tx, client, oauthGrant{scope: scope, familyID: uuid.New()}, nil, "")
+		return err
+	})
+	return res, err
+}
+
+// oauthIssue issues an access token for grant and, when it is for user, the
+// ID token and refresh token its scope asks for.
+func (app *application) oauthIssue(
+	ctx context.Context,
+	tx store.TxStorage,
+	client *models.OAuthClient,
+	grant oauthGrant,
+	user *UserClaims,
+	nonce string,
+) (*oauthTokenResponse, error) {
+	now := time.Now()
+
+	access, err := app.oauthCreateToken(ctx, tx, client, grant, models.OAuthTokenAccess, now.Add(app.config.oauth.accessTTL))
+	if err != nil {
+		return nil, err
+	}
+	res := &oauthTokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(app.config.oauth.accessTTL.Seconds()),
+		Scope:       grant.scope,
+	}
+	if user == nil {
+		return res, nil
+	}
+
+	if hasScope(grant.scope, oauthScopeOpenID) {
+		if res.IDToken, err = app.oauthIDToken(client, *user, grant.scope, nonce, now); err != nil {
+			return nil, err
+		}
+	}
+	if hasScope(grant.scope, oauthScopeOfflineAccess) && slices.Contains(client.GrantTypes, oauthGrantRefreshToken) {
+		res.RefreshToken, err = app.oauthCreateToken(ctx, tx, client, grant, models.OAuthTokenRefresh, now.Add(app.config.oauth.refreshTTL))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (app *application) oauthCreateToken(
+	ctx context.Context,
+	tx store.TxStorage,
+	client *models.OAuthClient,
+	grant oauthGrant,
+	kind string,
+	expiresAt time.Time,
+) (string, error) {
+	raw, err := app.GenerateInviteToken()
+	if err != nil {
+		return "", err
+	}
+	err = tx.OAuth.CreateToken(ctx, &models.OAuthToken{
+		ID:             uuid.New(),
+		TokenHash:      HashToken(raw),
+		Kind:           kind,
+		ClientID:       client.ID,
+		SubjectID:      grant.subjectID,
+		SubjectRole:    grant.subjectRole,
+		OrganizationID: grant.orgID,
+		Scope:          grant.scope,
+		FamilyID:       grant.familyID,
+		ExpiresAt:      expiresAt,
+	})
+	return raw, err
+}
+
+// oauthUser loads the account a grant is for the way AuthMiddleware does, so
+// its role and permissions are the ones it has now.
+func (app *application) oauthUser(ctx context.Context, grant oauthGrant) (UserClaims, error) {
+	claims := UserClaims{UserID: grant.subjectID.String(), Role: grant.subjectRole}
+	if grant.orgID != nil {
+		claims.OrgID = grant.orgID.String()
+	}
+	if err := app.refreshClaims(ctx, &claims, *grant.subjectID); err != nil {
+		return UserClaims{}, err
+	}
+	app.enforceSessionSoD(&claims)
+	claims.Perms = effectivePermissions(claims)
+
+	switch claims.Role {
+	case RoleAdmin, RoleSuperAdmin:
+		admin, err := app.store.Admin.GetAdmin(ctx, *grant.subjectID)
+		if err != nil {
+			return UserClaims{}, err
+		}
+		claims.Email, claims.Name = admin.Email, admin.Name
+	default:
+		user, err := app.store.User.GetUser(ctx, *grant.subjectID)
+		if err != nil {
+			return UserClaims{}, err
+		}
+		claims.Email, claims.Name = user.Email, user.Name
+	}
+	return claims, nil
+}
+
+// oauthAccountError turns the errors of an account that can no longer sign
+// in into the OAuth error code.
+func oauthAccountError(err error, code string) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, errAccountSuspended),
+		errors.Is(err, errOrgSuspended), errors.Is(err, errMembershipSuspended):
+		status := http.StatusBadRequest
+		if code == "invalid_token" {
+			status = http.StatusUnauthorized
+		}
+		return newOAuthError(status, code, "the account can no longer sign in: "+err.Error())
+	default:
+		return err
+	}
+}
+
+// oauthUserClaims are the claims about user that scope allows: always the
+// subject, role, permissions and organization, plus the name with profile
+// and the email with email. Accounts only become active once they have
+// proven their email, so it is verified.
+func oauthUserClaims(user UserClaims, scope string) map[string]any {
+	perms := user.Perms
+	if perms == nil {
+		perms = []string{}
+	}
+	claims := map[string]any{
+		"sub":   user.UserID,
+		"role":  user.Role,
+		"perms": perms,
+	}
+	if user.OrgID != "" {
+		claims["org_id"] = user.OrgID
+	}
+	if hasScope(scope, oauthScopeProfile) {
+		claims["name"] = user.Name
+	}
+	if hasScope(scope, oauthScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = true
+	}
+	return claims
+}
+
+func (app *application) oauthIDToken(client *models.OAuthClient, user UserClaims, scope, nonce string, now time.Time) (string, error) {
+	claims := jwt.MapClaims(oauthUserClaims(user, scope))
+	claims["iss"] = app.config.oauth.issuer
+	claims["aud"] = client.ID.String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(app.config.oauth.accessTTL).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = app.oauthPublicJWK()["kid"]
+	return token.SignedString(app.config.oauth.signingKey)
+}
+
+// OAuthUserInfoHandler returns the claims about the account behind a bearer
+// access token with the openid scope.
+func (app *application) OAuthUserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusUnauthorized, "invalid_token", "missing bearer token"))
+		return
+	}
+	token, err := app.activeOAuthToken(ctx, raw)
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	if token == nil || token.Kind != models.OAuthTokenAccess {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusUnauthorized, "invalid_token", "the access token is invalid or has expired"))
+		return
+	}
+	if token.SubjectID == nil || !hasScope(token.Scope, oauthScopeOpenID) {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusForbidden, "insufficient_scope", "the access token lacks the openid scope"))
+		return
+	}
+
+	user, err := app.oauthUser(ctx, tokenGrant(token))
+	if err != nil {
+		app.oauthErrorResponse(w, r, oauthAccountError(err, "invalid_token"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, oauthUserClaims(user, token.Scope))
+}
+
+// OAuthIntrospectHandler tells confidential clients, such as the APIs a
+// token is meant for, whether it is active and who it is for (RFC 7662).
+func (app *application) OAuthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	client, err := app.readOAuthClientForm(w, r)
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	if client.Public {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens"))
+		return
+	}
+	raw := r.PostForm.Get("token")
+	if raw == "" {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	inactive := map[string]any{"active": false}
+
+	token, err := app.activeOAuthToken(ctx, raw)
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	if token == nil {
+		writeJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	res := map[string]any{
+		"active":    true,
+		"scope":     token.Scope,
+		"client_id": token.ClientID.String(),
+		"sub":       token.ClientID.String(),
+		"iss":       app.config.oauth.issuer,
+		"iat":       token.CreatedAt.Unix(),
+		"exp":       token.ExpiresAt.Unix(),
+	}
+	if token.Kind == models.OAuthTokenAccess {
+		res["token_type"] = "Bearer"
+	}
+	if token.SubjectID != nil {
+		user, err := app.oauthUser(ctx, tokenGrant(token))
+		if err := oauthAccountError(err, "invalid_token"); err != nil {
+			var oe *oauthError
+			if errors.As(err, &oe) {
+				writeJSON(w, http.StatusOK, inactive)
+				return
+			}
+			app.oauthErrorResponse(w, r, err)
+			return
+		}
+		for claim, value := range oauthUserClaims(user, token.Scope) {
+			res[claim] = value
+		}
+		res["username"] = user.Email
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// OAuthRevokeHandler revokes a token of the calling client (RFC 7009).
+// Revoking a refresh token revokes everything issued from the same
+// authorization. Unknown tokens and those of other clients are ignored.
+func (app *application) OAuthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	client, err := app.readOAuthClientForm(w, r)
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+	raw := r.PostForm.Get("token")
+	if raw == "" {
+		app.oauthErrorResponse(w, r, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	token, err := app.store.OAuth.GetTokenByHash(ctx, HashToken(raw))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		err = nil
+	case err != nil:
+		app.oauthErrorResponse(w, r, err)
+		return
+	case token.ClientID != client.ID:
+	case token.Kind == models.OAuthTokenRefresh:
+		err = app.store.OAuth.RevokeFamily(ctx, token.FamilyID, time.Now())
+	default:
+		if err = app.store.OAuth.RevokeToken(ctx, token.ID, time.Now()); errors.Is(err, store.ErrInvalidToken) {
+			err = nil
+		}
+	}
+	if err != nil {
+		app.oauthErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// activeOAuthToken returns the token raw stands for, or nil when it is
+// unknown, revoked or expired.
+func (app *application) activeOAuthToken(ctx context.Context, raw string) (*models.OAuthToken, error) {
+	token, err := app.store.OAuth.GetTokenByHash(ctx, HashToken(raw))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return token, nil
+}
+
+// readOAuthClientForm parses a form-encoded request to the token,
+// introspection or revocation endpoint and authenticates its client, by HTTP
+// Basic or by client_id and client_secret in the form. Public clients send
+// only their client_id.
+func (app *application) readOAuthClientForm(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, error) {
+	if r.Method != http.MethodPost {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "the request must be a POST")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 65_536)
+	if err := r.ParseForm(); err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "the request body is not a valid form")
+	}
+
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		if r.PostForm.Has("client_secret") {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "use only one way of authenticating the client")
+		}
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return nil, errOAuthInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, errOAuthInvalidClient
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errOAuthInvalidClient
+	}
+	client, err := app.store.OAuth.GetClient(r.Context(), clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errOAuthInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, errOAuthInvalidClient
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, errOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// verifyPKCE checks verifier against an S256 code challenge (RFC 7636).
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// hasScope reports whether the space-separated scopes include scope.
+func hasScope(scopes, scope string) bool {
+	return slices.Contains(strings.Fields(scopes), scope)
+}
+
+// purgeExpiredOAuth deletes the authorization codes and tokens that have
+// expired. It runs with the purge job.
+func (app *application) purgeExpiredOAuth(ctx context.Context) {
+	n, err := app.store.OAuth.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		app.logger.Error("error deleting expired OAuth tokens", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		app.logger.Infow("deleted expired OAuth tokens", "count", n)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"go.uber.org/zap"
+)
+
+// oauthClientResponse shows the client secret, which is never shown again.
+type oauthClientResponse struct {
+	*models.OAuthClient
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// checkOAuthClient makes sure the client's settings work together: redirect
+// URIs to send codes to, refresh tokens only along with codes, and no
+// client credentials for clients that cannot keep a secret.
+func checkOAuthClient(client *models.OAuthClient) error {
+	if len(client.GrantTypes) == 0 {
+		return errors.New("grantTypes must not be empty")
+	}
+	usesCodes := slices.Contains(client.GrantTypes, oauthGrantAuthorizationCode)
+	switch {
+	case usesCodes && len(client.RedirectURIs) == 0:
+		return errors.New("redirectUris are required for the authorization_code grant")
+	case slices.Contains(client.GrantTypes, oauthGrantRefreshToken) && !usesCodes:
+		return errors.New("the refresh_token grant needs the authorization_code grant")
+	case client.Public && slices.Contains(client.GrantTypes, oauthGrantClientCredentials):
+		return errors.New("public clients cannot use the client_credentials grant")
+	}
+
+	for _, raw := range client.RedirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return fmt.Errorf("redirect URI %q must be an absolute http(s) URL without a fragment", raw)
+		}
+	}
+	for _, scope := range strings.Fields(client.Scopes) {
+		if strings.ContainsAny(scope, `"\`) {
+			return fmt.Errorf("scope %q is not valid", scope)
+		}
+	}
+	return nil
+}
+
+// newOAuthClientSecret returns a new secret and the hash kept of it.
+func (app *application) newOAuthClientSecret() (secret, hash string, err error) {
+	token, err := app.GenerateInviteToken()
+	if err != nil {
+		return "", "", err
+	}
+	secret = "oauth_" + token
+	return secret, HashToken(secret), nil
+}
+
+// CreateOAuthClientHandler registers a client. It uses the authorization
+// code and refresh token grants and every standard scope unless told
+// otherwise. Confidential clients get a secret, shown only now.
+func (app *application) CreateOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOAuthClientsManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage OAuth clients"))
+		return
+	}
+
+	var payload dtos.CreateOAuthClientPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	client := &models.OAuthClient{
+		ID:           uuid.New(),
+		Name:         payload.Name,
+		Public:       payload.Public,
+		RedirectURIs: payload.RedirectURIs,
+		GrantTypes:   payload.GrantTypes,
+		Scopes:       strings.Join(strings.Fields(payload.Scopes), " "),
+		CreatedBy:    uuid.MustParse(user.UserID),
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{oauthGrantAuthorizationCode, oauthGrantRefreshToken}
+	}
+	if client.Scopes == "" {
+		client.Scopes = strings.Join(oauthUserScopes, " ")
+	}
+	if err := checkOAuthClient(client); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var secret string
+	if !client.Public {
+		if secret, client.SecretHash, err = app.newOAuthClientSecret(); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if err := app.store.OAuth.CreateClient(ctx, client); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	message := "OAuth client created successfully"
+	if secret != "" {
+		message += ", store the secret now as it is not shown again"
+	}
+	app.jsonResponse(w, http.StatusCreated, oauthClientResponse{OAuthClient: client, ClientID: client.ID.String(), ClientSecret: secret},
+		message)
+}
+
+func (app *application) ListOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r.Context())
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOAuthClientsManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage OAuth clients"))
+		return
+	}
+
+	clients, err := app.store.OAuth.ListClients(r.Context())
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	res := make([]oauthClientResponse, 0, len(clients))
+	for i := range clients {
+		res = append(res, oauthClientResponse{OAuthClient: &clients[i], ClientID: clients[i].ID.String()})
+	}
+
+	app.jsonResponse(w, http.StatusOK, res, "OAuth clients")
+}
+
+func (app *application) GetOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.loadOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, oauthClientResponse{OAuthClient: client, ClientID: client.ID.String()}, "OAuth client")
+}
+
+// UpdateOAuthClientHandler changes the client's settings. Whether it is
+// public cannot change; register a new client instead.
+func (app *application) UpdateOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.loadOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	var payload dtos.UpdateOAuthClientPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if payload.Name == nil && payload.RedirectURIs == nil && payload.GrantTypes == nil && payload.Scopes == nil {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+	if payload.Name != nil {
+		client.Name = *payload.Name
+	}
+	if payload.RedirectURIs != nil {
+		client.RedirectURIs = *payload.RedirectURIs
+	}
+	if payload.GrantTypes != nil {
+		client.GrantTypes = *payload.GrantTypes
+	}
+	if payload.Scopes != nil {
+		client.Scopes = strings.Join(strings.Fields(*payload.Scopes), " ")
+	}
+	if client.Scopes == "" {
+		app.badRequestResponse(w, r, errors.New("scopes must not be empty"))
+		return
+	}
+	if err := checkOAuthClient(client); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.OAuth.UpdateClient(r.Context(), client); err != nil {
+		app.logger.Error("error updating OAuth client", zap.String("id", client.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, oauthClientResponse{OAuthClient: client, ClientID: client.ID.String()},
+		"OAuth client updated successfully")
+}
+
+// RotateOAuthClientSecretHandler replaces the secret of a confidential
+// client. The old one stops working at once; tokens already issued stay
+// valid.
+func (app *application) RotateOAuthClientSecretHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.loadOAuthClient(w, r)
+	if !ok {
+		return
+	}
+	if client.Public {
+		app.badRequestResponse(w, r, errors.New("public clients have no secret"))
+		return
+	}
+
+	secret, hash, err := app.newOAuthClientSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	client.SecretHash = hash
+	if err := app.store.OAuth.UpdateClient(r.Context(), client); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, oauthClientResponse{OAuthClient: client, ClientID: client.ID.String(), ClientSecret: secret},
+		"client secret rotated, store it now as it is not shown again")
+}
+
+// DeleteOAuthClientHandler deletes the client, revoking every code and token
+// issued to it.
+func (app *application) DeleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := app.loadOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.OAuth.DeleteClient(r.Context(), client.ID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "OAuth client deleted successfully")
+}
+
+func (app *application) loadOAuthClient(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	user, err := GetUserFromContext(r.Context())
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+	if !app.HasPermission(user, PermOAuthClientsManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage OAuth clients"))
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	client, err := app.store.OAuth.GetClient(r.Context(), id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	return client, true
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+const testRedirectURI = "https://client.example.com/callback"
+
+// testOAuthClient is a confidential client registered for every grant.
+type testOAuthClient struct {
+	*models.OAuthClient
+	secret string
+}
+
+// setUpOAuth returns an application serving on srv as an OAuth provider, a
+// client registered with it and the token of a member signed in to org.
+func setUpOAuth(t *testing.T) (*application, *httptest.Server, testOAuthClient, string) {
+	t.Helper()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config.oauth = oauthConfig{
+		issuer:     srv.URL,
+		loginURL:   "https://login.example.com/oauth",
+		codeTTL:    time.Minute,
+		accessTTL:  time.Hour,
+		refreshTTL: 24 * time.Hour,
+		signingKey: key,
+	}
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	member := seedMember(t, app, org, "member@example.com", RoleUser)
+
+	client := testOAuthClient{secret: rand.Text()}
+	client.OAuthClient = &models.OAuthClient{
+		ID:           uuid.New(),
+		Name:         "Reports",
+		SecretHash:   HashToken(client.secret),
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   oauthGrantTypes,
+		Scopes:       "openid profile email offline_access reports:read",
+		CreatedBy:    owner.ID,
+	}
+	if err := app.store.OAuth.CreateClient(context.Background(), client.OAuthClient); err != nil {
+		t.Fatal(err)
+	}
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/users/auth/login", "", map[string]string{
+		"email":    member.Email,
+		"password": testPassword,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("member login answered %d: %s", status, res.Error)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(res.Data, &login); err != nil {
+		t.Fatal(err)
+	}
+	return app, srv, client, login.Token
+}
+
+// authorizeOAuth approves an authorization request of client for the member
+// signed in with token, with the S256 challenge of verifier, and returns the
+// code.
+func authorizeOAuth(t *testing.T, srv *httptest.Server, client testOAuthClient, token, verifier string) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid profile email offline_access"},
+		"state":                 {"state"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	status, res := doJSON(t, srv, http.MethodPost, "/oauth2/authorize?"+query.Encode(), token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("approving the request answered %d: %s", status, res.Error)
+	}
+	var data struct {
+		RedirectTo string `json:"redirectTo"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := url.Parse(data.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := redirect.Query().Get("state"); got != "state" {
+		t.Errorf("the redirect carries state %q", got)
+	}
+	return redirect.Query().Get("code")
+}
+
+// postOAuth posts form to path authenticated as id with secret, and decodes
+// the JSON answer, if any.
+func postOAuth(t *testing.T, srv *httptest.Server, path, id, secret string, form url.Values) (int, map[string]any) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var out map[string]any
+	json.NewDecoder(res.Body).Decode(&out)
+	return res.StatusCode, out
+}
+
+// exchangeCode redeems code with verifier.
+func exchangeCode(t *testing.T, srv *httptest.Server, client testOAuthClient, code, verifier string) (int, map[string]any) {
+	t.Helper()
+
+	return postOAuth(t, srv, "/oauth2/token", client.ID.String(), client.secret, url.Values{
+		"grant_type":    {oauthGrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+// refresh redeems the refresh token raw.
+func refresh(t *testing.T, srv *httptest.Server, client testOAuthClient, raw string) (int, map[string]any) {
+	t.Helper()
+
+	return postOAuth(t, srv, "/oauth2/token", client.ID.String(), client.secret, url.Values{
+		"grant_type":    {oauthGrantRefreshToken},
+		"refresh_token": {raw},
+	})
+}
+
+// introspect reports whether token is active.
+func introspect(t *testing.T, srv *httptest.Server, client testOAuthClient, token string) map[string]any {
+	t.Helper()
+
+	status, res := postOAuth(t, srv, "/oauth2/introspect", client.ID.String(), client.secret, url.Values{"token": {token}})
+	if status != http.StatusOK {
+		t.Fatalf("introspection answered %d: %v", status, res)
+	}
+	return res
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	_, srv, client, token := setUpOAuth(t)
+	verifier := rand.Text() + rand.Text()
+
+	code := authorizeOAuth(t, srv, client, token, verifier)
+	if status, res := exchangeCode(t, srv, client, code, rand.Text()+rand.Text()); status != http.StatusBadRequest || res["error"] != "invalid_grant" {
+		t.Errorf("a wrong code_verifier answered %d: %v", status, res)
+	}
+	// the failed attempt used up the code
+	if status, res := exchangeCode(t, srv, client, code, verifier); status != http.StatusBadRequest || res["error"] != "invalid_grant" {
+		t.Errorf("redeeming the code after a failed attempt answered %d: %v", status, res)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	code = authorizeOAuth(t, srv, client, token, verifier)
+	status, res := exchangeCode(t, srv, client, code, verifier)
+	if status != http.StatusOK {
+		t.Fatalf("redeeming the code answered %d: %v", status, res)
+	}
+	if res["access_token"] == nil || res["id_token"] == nil || res["refresh_token"] == nil {
+		t.Errorf("the token response lacks tokens: %v", res)
+	}
+	if status, res := exchangeCode(t, srv, client, code, verifier); status != http.StatusBadRequest || res["error"] != "invalid_grant" {
+		t.Errorf("redeeming the code twice answered %d: %v", status, res)
+	}
+}
+
+func TestOAuthRefreshRotation(t *testing.T) {
+	_, srv, client, token := setUpOAuth(t)
+	verifier := rand.Text() + rand.Text()
+
+	status, res := exchangeCode(t, srv, client, authorizeOAuth(t, srv, client, token, verifier), verifier)
+	if status != http.StatusOK {
+		t.Fatalf("redeeming the code answered %d: %v", status, res)
+	}
+	first := res["refresh_token"].(string)
+
+	status, res = refresh(t, srv, client, first)
+	if status != http.StatusOK {
+		t.Fatalf("refreshing answered %d: %v", status, res)
+	}
+	second, access := res["refresh_token"].(string), res["access_token"].(string)
+	if second == "" || second == first {
+		t.Fatalf("the refresh token was not rotated: %v", res)
+	}
+
+	// the first token was rotated away, so seeing it again means it leaked
+	if status, res := refresh(t, srv, client, first); status != http.StatusBadRequest || res["error"] != "invalid_grant" {
+		t.Errorf("reusing a refresh token answered %d: %v", status, res)
+	}
+	if status, res := refresh(t, srv, client, second); status != http.StatusBadRequest {
+		t.Errorf("the rotated token survived the reuse, answering %d: %v", status, res)
+	}
+	if res := introspect(t, srv, client, access); res["active"] != false {
+		t.Errorf("an access token of the revoked family is active: %v", res)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	_, srv, client, _ := setUpOAuth(t)
+	form := url.Values{"grant_type": {oauthGrantClientCredentials}}
+
+	status, res := postOAuth(t, srv, "/oauth2/token", client.ID.String(), "wrong secret", form)
+	if status != http.StatusUnauthorized || res["error"] != "invalid_client" {
+		t.Errorf("a wrong secret answered %d: %v", status, res)
+	}
+
+	status, res = postOAuth(t, srv, "/oauth2/token", client.ID.String(), client.secret, form)
+	if status != http.StatusOK {
+		t.Fatalf("client credentials answered %d: %v", status, res)
+	}
+	if res["scope"] != "reports:read" || res["refresh_token"] != nil || res["id_token"] != nil {
+		t.Errorf("the client was issued %v", res)
+	}
+}
+
+func TestOAuthIntrospectAndRevoke(t *testing.T) {
+	app, srv, client, _ := setUpOAuth(t)
+	ctx := context.Background()
+
+	status, res := postOAuth(t, srv, "/oauth2/token", client.ID.String(), client.secret, url.Values{
+		"grant_type": {oauthGrantClientCredentials},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("client credentials answered %d: %v", status, res)
+	}
+	access := res["access_token"].(string)
+	if res := introspect(t, srv, client, access); res["active"] != true {
+		t.Fatalf("a fresh token is inactive: %v", res)
+	}
+
+	for _, raw := range []string{access, access, "not-a-token"} {
+		status, res := postOAuth(t, srv, "/oauth2/revoke", client.ID.String(), client.secret, url.Values{"token": {raw}})
+		if status != http.StatusOK {
+			t.Errorf("revoking %q answered %d: %v", raw, status, res)
+		}
+	}
+	if res := introspect(t, srv, client, access); res["active"] != false {
+		t.Errorf("a revoked token is active: %v", res)
+	}
+
+	expired := rand.Text()
+	if err := app.store.OAuth.CreateToken(ctx, &models.OAuthToken{
+		ID:        uuid.New(),
+		TokenHash: HashToken(expired),
+		Kind:      models.OAuthTokenAccess,
+		ClientID:  client.ID,
+		Scope:     "reports:read",
+		FamilyID:  uuid.New(),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res := introspect(t, srv, client, expired); res["active"] != false {
+		t.Errorf("an expired token is active: %v", res)
+	}
+}
+
+func TestOAuthRoleAndPermsClaims(t *testing.T) {
+	_, srv, client, token := setUpOAuth(t)
+
+	res, err := http.Get(srv.URL + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discovery struct {
+		Issuer          string   `json:"issuer"`
+		ClaimsSupported []string `json:"claims_supported"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&discovery)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovery.Issuer != srv.URL {
+		t.Errorf("the issuer is %q, want %q", discovery.Issuer, srv.URL)
+	}
+	for _, claim := range []string{"role", "perms"} {
+		if !slices.Contains(discovery.ClaimsSupported, claim) {
+			t.Errorf("the discovery document does not list the %s claim", claim)
+		}
+	}
+
+	verifier := rand.Text() + rand.Text()
+	status, tokens := exchangeCode(t, srv, client, authorizeOAuth(t, srv, client, token, verifier), verifier)
+	if status != http.StatusOK {
+		t.Fatalf("redeeming the code answered %d: %v", status, tokens)
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/oauth2/userinfo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	res, err = srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("userinfo answered %d", res.StatusCode)
+	}
+	var claims map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["role"] != RoleUser || claims["email"] != "member@example.com" {
+		t.Errorf("userinfo answered %v", claims)
+	}
+	if perms, ok := claims["perms"].([]any); !ok || len(perms) == 0 {
+		t.Errorf("userinfo has no permissions: %v", claims["perms"])
+	}
+}
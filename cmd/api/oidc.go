@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// oidcDiscovery is the part of a provider's discovery document we use.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+const (
+	// oidcCacheTTL is how long discovery documents and signing keys are
+	// reused before they are fetched again.
+	oidcCacheTTL = time.Hour
+	// oidcKeyRefetch is how often an unknown key id can make us fetch the
+	// signing keys early, in case the provider rotated them.
+	oidcKeyRefetch = time.Minute
+)
+
+var errOIDCProvider = errors.New("identity provider error")
+
+// oidcProviders caches the discovery documents and signing keys of identity
+// providers by issuer.
+var oidcProviders = &oidcCache{entries: map[string]*oidcCacheEntry{}}
+
+type oidcCache struct {
+	mu      sync.Mutex
+	entries map[string]*oidcCacheEntry
+}
+
+type oidcCacheEntry struct {
+	discovery     oidcDiscovery
+	discoveredAt  time.Time
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// oidcDiscover returns the discovery document of issuer, which must name
+// issuer exactly.
+func (app *application) oidcDiscover(ctx context.Context, issuer string) (oidcDiscovery, error) {
+	oidcProviders.mu.Lock()
+	entry, ok := oidcProviders.entries[issuer]
+	oidcProviders.mu.Unlock()
+	if ok && time.Since(entry.discoveredAt) < oidcCacheTTL {
+		return entry.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := app.oidcGet(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return oidcDiscovery{}, err
+	}
+	switch {
+	case discovery.Issuer != issuer:
+		return oidcDiscovery{}, fmt.Errorf("%w: discovery document is for issuer %q", errOIDCProvider, discovery.Issuer)
+	case discovery.AuthorizationEndpoint == "", discovery.TokenEndpoint == "", discovery.JWKSURI == "":
+		return oidcDiscovery{}, fmt.Errorf("%w: discovery document lacks an endpoint", errOIDCProvider)
+	}
+
+	oidcProviders.mu.Lock()
+	oidcProviders.entries[issuer] = &oidcCacheEntry{discovery: discovery, discoveredAt: time.Now()}
+	oidcProviders.mu.Unlock()
+	return discovery, nil
+}
+
+// oidcKey returns the signing key kid of issuer. An empty kid is accepted
+// when the provider has a single key.
+func (app *application) oidcKey(ctx context.Context, issuer string, discovery oidcDiscovery, kid string) (any, error) {
+	lookup := func(keys map[string]any) (any, bool) {
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, true
+			}
+		}
+		key, ok := keys[kid]
+		return key, ok
+	}
+
+	oidcProviders.mu.Lock()
+	entry := oidcProviders.entries[issuer]
+	var keys map[string]any
+	var fetchedAt time.Time
+	if entry != nil {
+		keys, fetchedAt = entry.keys, entry.keysFetchedAt
+	}
+	oidcProviders.mu.Unlock()
+
+	if key, ok := lookup(keys); ok && time.Since(fetchedAt) < oidcCacheTTL {
+		return key, nil
+	}
+	if keys != nil && time.Since(fetchedAt) < oidcKeyRefetch {
+		return nil, fmt.Errorf("%w: unknown signing key %q", errOIDCProvider, kid)
+	}
+
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	if err := app.oidcGet(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys = map[string]any{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// keys we cannot use, such as symmetric ones, are skipped
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	oidcProviders.mu.Lock()
+	if entry := oidcProviders.entries[issuer]; entry != nil {
+		entry.keys, entry.keysFetchedAt = keys, time.Now()
+	}
+	oidcProviders.mu.Unlock()
+
+	key, ok := lookup(keys)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", errOIDCProvider, kid)
+	}
+	return key, nil
+}
+
+// oidcJWK is a public key of a JSON Web Key Set (RFC 7517).
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k oidcJWK) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func (app *application) oidcGet(ctx context.Context, target string, dst any) error {
+	ctx, cancel := context.WithTimeout(ctx, app.config.sso.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return oidcDo(req, dst)
+}
+
+func oidcDo(req *http.Request, dst any) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errOIDCProvider, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errOIDCProvider, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%w: %s: %s", errOIDCProvider, oauthErr.Error, oauthErr.ErrorDescription)
+		}
+		return fmt.Errorf("%w: %s answered %d", errOIDCProvider, req.URL.Redacted(), res.StatusCode)
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("%w: invalid response from %s: %v", errOIDCProvider, req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// oidcPKCE returns a PKCE code verifier and its S256 challenge (RFC 7636).
+func (app *application) oidcPKCE() (verifier, challenge string, err error) {
+	verifier, err = app.GenerateInviteToken()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// oidcAuthorizeURL is where the user is sent to sign in with the provider.
+func (app *application) oidcAuthorizeURL(discovery oidcDiscovery, provider *models.OIDCProvider, state, challenge, nonce string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {app.config.sso.callbackURL},
+		"scope":                 {provider.Scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + query.Encode()
+}
+
+// oidcExchange trades the authorization code for the ID token, proving with
+// verifier that we started the sign-in.
+func (app *application) oidcExchange(ctx context.Context, discovery oidcDiscovery, provider *models.OIDCProvider, code, verifier string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.sso.timeout)
+	defer cancel()
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {app.config.sso.callbackURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := oidcDo(req, &tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", errOIDCProvider)
+	}
+	return tokens.IDToken, nil
+}
+
+// oidcVerifyIDToken checks the signature, issuer, audience, lifetime and
+// nonce of an ID token and returns its claims.
+func (app *application) oidcVerifyIDToken(
+	ctx context.Context,
+	discovery oidcDiscovery,
+	provider *models.OIDCProvider,
+	raw string,
+	nonce string,
+) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return app.oidcKey(ctx, provider.Issuer, discovery, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid ID token: nonce does not match")
+	}
+	// a token for several audiences must have been issued to us
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != provider.ClientID {
+			return nil, errors.New("invalid ID token: not issued to this client")
+		}
+	}
+	return claims, nil
+}
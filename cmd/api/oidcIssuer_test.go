@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuerKeyID = "test-key"
+
+// testIssuer is an OpenID Connect provider for tests. Its authorization
+// endpoint signs the user in right away with Claims, and its token endpoint
+// checks the client, the redirect URI and the PKCE verifier before it hands
+// out the ID token.
+type testIssuer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu sync.Mutex
+	// Claims go in the ID tokens of the sign-ins that start from now on,
+	// next to iss, aud, sub, iat, exp and nonce.
+	Claims jwt.MapClaims
+	key    *rsa.PrivateKey
+	codes  map[string]testIssuerCode
+}
+
+// testIssuerCode is what the provider remembers about an authorization code
+// until it is redeemed.
+type testIssuerCode struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      jwt.MapClaims
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{
+		ClientID:     "rbac-client",
+		ClientSecret: "rbac secret/with+symbols",
+		Claims:       jwt.MapClaims{},
+		key:          key,
+		codes:        map[string]testIssuerCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("GET /authorize", issuer.authorize)
+	mux.HandleFunc("POST /token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// SetClaims replaces the claims of the next sign-ins.
+func (i *testIssuer) SetClaims(claims jwt.MapClaims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Claims = claims
+}
+
+func (i *testIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidcDiscovery{
+		Issuer:                i.URL,
+		AuthorizationEndpoint: i.URL + "/authorize",
+		TokenEndpoint:         i.URL + "/token",
+		JWKSURI:               i.URL + "/jwks",
+	})
+}
+
+func (i *testIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, http.StatusOK, map[string][]oidcJWK{"keys": {{
+		Kty: "RSA",
+		Kid: testIssuerKeyID,
+		Use: "sig",
+		N:   encode(i.key.N.Bytes()),
+		E:   encode(big.NewInt(int64(i.key.E)).Bytes()),
+	}}})
+}
+
+func (i *testIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Get("response_type") != "code", query.Get("client_id") != i.ClientID:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge_method") != "S256", query.Get("code_challenge") == "":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	i.mu.Lock()
+	i.codes[code] = testIssuerCode{
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		claims:      maps.Clone(i.Claims),
+	}
+	i.mu.Unlock()
+
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(status int, code string) {
+		writeJSON(w, status, map[string]string{"error": code})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || id != i.ClientID || secret != i.ClientSecret {
+		tokenError(http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	i.mu.Lock()
+	code, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError(http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"sub":   rand.Text(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": code.nonce,
+	}
+	maps.Copy(claims, code.claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testIssuerKeyID
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		tokenError(http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// follow sends a GET to target without following redirects, returning the
+// response with its body still open.
+func follow(t *testing.T, target string) *http.Response {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// redirectTo returns where res redirects, failing unless it is a redirect.
+func redirectTo(t *testing.T, res *http.Response) *url.URL {
+	t.Helper()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		var body testResponse
+		json.NewDecoder(res.Body).Decode(&body)
+		t.Fatalf("%s answered %d, want a redirect: %s", res.Request.URL, res.StatusCode, body.Error)
+	}
+	location, err := res.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
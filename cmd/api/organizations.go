@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+func (app *application) UpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := app.loadOrganization(w, r, PermOrgUpdate, "update")
+	if !ok {
+		return
+	}
+
+	var payload dtos.UpdateOrganizationPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.Name != nil {
+		updates["name"] = *payload.Name
+	}
+	if payload.Email != nil {
+		updates["email"] = *payload.Email
+	}
+	if payload.Description != nil {
+		updates["description"] = *payload.Description
+	}
+	if payload.Website != nil {
+		updates["website"] = *payload.Website
+	}
+	if payload.InheritPermissions != nil {
+		updates["inherit_permissions"] = *payload.InheritPermissions
+	}
+	if len(updates) == 0 {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+
+	var updated *models.Organization
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Organization.UpdateOrganization(ctx, org.ID, updates); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = tx.Organization.GetOrganization(ctx, org.ID)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error updating organization", zap.String("id", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, updated, "organization updated successfully")
+}
+
+func (app *application) SuspendOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	app.setOrganizationStatus(w, r, models.SuspensionActionSuspend)
+}
+
+func (app *application) UnsuspendOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	app.setOrganizationStatus(w, r, models.SuspensionActionUnsuspend)
+}
+
+// setOrganizationStatus suspends or unsuspends an organization and records
+// who did it and why in the same transaction.
+func (app *application) setOrganizationStatus(w http.ResponseWriter, r *http.Request, action string) {
+	ctx := r.Context()
+
+	org, ok := app.loadOrganization(w, r, PermOrgSuspend, action)
+	if !ok {
+		return
+	}
+
+	var payload dtos.SuspensionPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	user, _ := GetUserFromContext(ctx)
+	now := time.Now()
+
+	updates := map[string]interface{}{
+		"status":            helpers.StatusSuspended,
+		"suspended_at":      now,
+		"suspension_reason": payload.Reason,
+	}
+	if action == models.SuspensionActionUnsuspend {
+		updates = map[string]interface{}{
+			"status":            helpers.StatusActive,
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		}
+	}
+	if org.Status == updates["status"] {
+		app.conflictResponse(w, r, errors.New("organization is already "+org.Status))
+		return
+	}
+
+	var updated *models.Organization
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Organization.UpdateOrganization(ctx, org.ID, updates); err != nil {
+			return err
+		}
+		if err := tx.Organization.RecordSuspension(ctx, &models.OrganizationSuspension{
+			ID:             uuid.New(),
+			OrganizationID: org.ID,
+			Action:         action,
+			Reason:         payload.Reason,
+			ActorID:        uuid.MustParse(user.UserID),
+			ActorRole:      user.Role,
+			CreatedAt:      now,
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = tx.Organization.GetOrganization(ctx, org.ID)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error changing organization status", zap.String("id", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, updated, "organization is now "+updated.Status)
+}
+
+func (app *application) ListOrganizationSuspensionsHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.loadOrganization(w, r, PermOrgView, "view")
+	if !ok {
+		return
+	}
+
+	events, err := app.store.Organization.ListSuspensions(r.Context(), org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, events, "organization suspension history")
+}
+
+// OrganizationTreeHandler lists the organization given by ?id= and every
+// organization below it, with their depth relative to it.
+func (app *application) OrganizationTreeHandler(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.loadOrganization(w, r, PermOrgView, "view")
+	if !ok {
+		return
+	}
+
+	nodes, err := app.store.Organization.ListSubtree(r.Context(), org.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nodes, "organization tree")
+}
+
+// MoveOrganizationHandler hangs an organization, with its subtree, under a
+// new parent or at the top level. The caller must administer the
+// organization and both its current and its new parent.
+func (app *application) MoveOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := app.loadOrganization(w, r, PermOrgUpdate, "move")
+	if !ok {
+		return
+	}
+
+	var payload dtos.MoveOrganizationPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	user, _ := GetUserFromContext(ctx)
+	if org.ParentID != nil && !app.canAdministerOrg(w, r, user, *org.ParentID, "move organizations out of") {
+		return
+	}
+	if payload.ParentID != nil && !app.canAdministerOrg(w, r, user, *payload.ParentID, "move organizations under") {
+		return
+	}
+
+	var updated *models.Organization
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Organization.MoveOrganization(ctx, org.ID, payload.ParentID, app.config.orgMaxDepth); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = tx.Organization.GetOrganization(ctx, org.ID)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error moving organization", zap.String("id", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, updated, "organization moved successfully")
+}
+
+// canAdministerOrg loads the organization id and checks that the caller
+// administers it. It writes the error response itself.
+func (app *application) canAdministerOrg(w http.ResponseWriter, r *http.Request, user UserClaims, id uuid.UUID, action string) bool {
+	org, err := app.store.Organization.GetOrganization(r.Context(), id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return false
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" this organization"))
+		return false
+	}
+	return true
+}
+
+// loadOrganization resolves the organization given by ?id= and checks that
+// the caller has perm and administers it. It writes the error response
+// itself.
+func (app *application) loadOrganization(
+	w http.ResponseWriter,
+	r *http.Request,
+	perm string,
+	action string,
+) (*models.Organization, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+	if !app.HasPermission(user, perm) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" organization"))
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !app.isOrgAdminOrSuper(r.Context(), user, org) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to "+action+" this organization"))
+		return nil, false
+	}
+
+	return org, true
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type outboxConfig struct {
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	lease        time.Duration
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+}
+
+// outboxHandler delivers a single outbox message. A returned error schedules a
+// retry, or dead-letters the message once its attempts are used up.
+type outboxHandler func(ctx context.Context, msg *models.OutboxMessage) error
+
+func (app *application) outboxHandlers() map[string]outboxHandler {
+	return map[string]outboxHandler{
+		models.OutboxKindEmail:   app.deliverEmail,
+		models.OutboxKindWebhook: app.deliverWebhook,
+	}
+}
+
+// enqueueOutbox writes a message of the given kind to the outbox, due now.
+func (app *application) enqueueOutbox(
+	ctx context.Context,
+	outbox store.OutboxStoreInterface,
+	kind string,
+	aggregateType string,
+	aggregateID uuid.UUID,
+	payload []byte,
+) error {
+	now := time.Now()
+	return outbox.Enqueue(ctx, &models.OutboxMessage{
+		ID:            uuid.New(),
+		Kind:          kind,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       payload,
+		Status:        models.OutboxStatusPending,
+		MaxAttempts:   app.config.outbox.maxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+}
+
+// runOutboxDispatcher polls the outbox until ctx is cancelled.
+func (app *application) runOutboxDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.outbox.pollInterval)
+	defer ticker.Stop()
+
+	handlers := app.outboxHandlers()
+	for {
+		app.dispatchOutbox(ctx, handlers)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) dispatchOutbox(ctx context.Context, handlers map[string]outboxHandler) {
+	msgs, err := app.store.Outbox.ClaimDue(
+		ctx,
+		time.Now(),
+		app.config.outbox.batchSize,
+		app.config.outbox.lease,
+	)
+	if err != nil {
+		app.logger.Error("error claiming outbox messages", zap.Error(err))
+		return
+	}
+
+	for i := range msgs {
+		app.deliverOutboxMessage(ctx, handlers, &msgs[i])
+	}
+}
+
+func (app *application) deliverOutboxMessage(
+	ctx context.Context,
+	handlers map[string]outboxHandler,
+	msg *models.OutboxMessage,
+) {
+	handler, ok := handlers[msg.Kind]
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler registered for outbox kind %q", msg.Kind)
+	} else {
+		err = handler(ctx, msg)
+	}
+
+	if err == nil {
+		if err := app.store.Outbox.MarkDelivered(ctx, msg.ID, time.Now()); err != nil {
+			app.logger.Error("error marking outbox message delivered", zap.String("id", msg.ID.String()), zap.Error(err))
+		}
+		return
+	}
+
+	attempt := msg.Attempts + 1
+	dead := attempt >= msg.MaxAttempts
+	next := time.Now().Add(outboxBackoff(attempt, app.config.outbox.baseBackoff, app.config.outbox.maxBackoff))
+
+	app.logger.Warn(
+		"outbox delivery failed",
+		zap.String("id", msg.ID.String()),
+		zap.String("kind", msg.Kind),
+		zap.Int("attempt", attempt),
+		zap.Bool("dead", dead),
+		zap.Error(err),
+	)
+
+	if err := app.store.Outbox.MarkFailed(ctx, msg.ID, err.Error(), next, dead); err != nil {
+		app.logger.Error("error recording outbox failure", zap.String("id", msg.ID.String()), zap.Error(err))
+	}
+}
+
+// outboxBackoff doubles the delay for every attempt, capped at max, with up to
+// 20% jitter so failed messages don't retry in lockstep.
+func outboxBackoff(attempt int, base, max time.Duration) time.Duration {
+	d := base << (attempt - 1)
+	if d <= 0 || d > max {
+		d = max
+	}
+	return d + rand.N(d/5+1)
+}
+
+func (app *application) ListOutboxMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOutboxView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view outbox"))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.OutboxStatusPending, models.OutboxStatusDelivered, models.OutboxStatusDead:
+	default:
+		app.badRequestResponse(w, r, errors.New("status must be one of [pending delivered dead]"))
+		return
+	}
+
+	limit, err := readIntParam(r, "limit", 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	msgs, err := app.store.Outbox.ListMessages(ctx, status, limit)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, msgs, "outbox messages")
+}
+
+func (app *application) GetOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOutboxView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view outbox"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	msg, err := app.store.Outbox.GetMessage(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, msg, "outbox message")
+}
+
+func (app *application) ReplayOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOutboxReplay) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to replay outbox messages"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Outbox.Replay(ctx, id, time.Now()); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "outbox message queued for redelivery")
+}
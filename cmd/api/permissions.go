@@ -1,15 +1,27 @@
 package main
 
+import (
+	"slices"
+
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
 const (
 	RoleSuperAdmin = "super_admin"
 	RoleAdmin      = "admin"
 	RoleUser       = "user"
+	RoleAuditor    = "auditor"
+
+	RolePaymentsInitiator = "payments_initiator"
+	RolePaymentsApprover  = "payments_approver"
 )
 
 const (
 	PermUsersCreate    = "users:create"
+	PermUsersView      = "users:view"
 	PermUsersUpdate    = "users:update"
 	PermAdminCreate    = "admin:create"
+	PermAdminView      = "admin:view"
 	PermAdminUpdate    = "admin:update"
 	PermAdminDelete    = "admin:delete"
 	PermUsersDelete    = "users:delete"
@@ -22,28 +34,115 @@ const (
 	PermPostsUpdate = "posts:update"
 	PermPostsDelete = "posts:delete"
 
-	PermOrgCreate  = "organization:create"
-	PermOrgView    = "organization:view"
-	PermOrgUpdate  = "organization:update"
-	PermOrgDelete  = "organization:delete"
-	PermOrgSuspend = "organization:suspend"
+	PermOrgCreate   = "organization:create"
+	PermOrgView     = "organization:view"
+	PermOrgUpdate   = "organization:update"
+	PermOrgDelete   = "organization:delete"
+	PermOrgSuspend  = "organization:suspend"
+	PermOrgTransfer = "organization:transfer"
+
+	PermOutboxView   = "outbox:view"
+	PermOutboxReplay = "outbox:replay"
+
+	PermGroupsCreate  = "groups:create"
+	PermGroupsView    = "groups:view"
+	PermGroupsUpdate  = "groups:update"
+	PermGroupsDelete  = "groups:delete"
+	PermGroupsMembers = "groups:members"
+
+	PermReviewsManage = "reviews:manage"
+
+	PermWebhooksManage = "webhooks:manage"
+
+	PermScimManage = "scim:manage"
+	PermSSOManage  = "sso:manage"
+
+	PermOAuthClientsManage = "oauth:clients"
+
+	PermPaymentsInitiate = "payments:initiate"
+	PermPaymentsApprove  = "payments:approve"
 )
 
+// MemberRoles are the roles a user inside an organization can be given,
+// directly or through a group.
+var MemberRoles = []string{RoleUser, RoleAuditor, RolePaymentsInitiator}
+
+// GrantableRoles are the roles a time-bound grant can give, by account type.
+// Admins can be raised to super admin, and users to admin or payments
+// approver of the organization the grant applies to. Approving payments is
+// only ever granted.
+var GrantableRoles = map[string][]string{
+	models.GrantAccountAdmin: {RoleSuperAdmin},
+	models.GrantAccountUser:  {RoleAdmin, RolePaymentsApprover},
+}
+
+// SoDRule forbids one principal from holding both of its roles: an account,
+// or for users an account within one organization. Static rules are checked
+// whenever a role is assigned, so the two roles can never be held together.
+// Dynamic rules let both be held but never be in effect in the same session,
+// which suits roles only taken on through elevation.
+type SoDRule struct {
+	Name    string    `json:"name"`
+	Roles   [2]string `json:"roles"`
+	Dynamic bool      `json:"dynamic"`
+	Reason  string    `json:"reason"`
+}
+
+// SoDRules are the separation-of-duties rules between the roles above.
+var SoDRules = []SoDRule{
+	{
+		Name:   "org-admin-auditor",
+		Roles:  [2]string{RoleAdmin, RoleAuditor},
+		Reason: "an organization's auditor cannot administer it",
+	},
+	{
+		Name:    "payments-initiate-approve",
+		Roles:   [2]string{RolePaymentsInitiator, RolePaymentsApprover},
+		Dynamic: true,
+		Reason:  "a member cannot approve payments in the session they initiate them in",
+	},
+}
+
 var RolePermissions = map[string][]string{
 	RoleSuperAdmin: {
 		PermAdminCreate,
+		PermAdminView,
 		PermAdminUpdate,
 		PermAdminDelete,
 		PermUsersDelete,
+		PermUsersView,
 		PermRolesAssign,
 		PermSettingsSystem,
 		PermSettingsOrg,
 		PermLogsView,
 		PermPostsUpdate,
 		PermPostsDelete,
+
+		PermOrgView,
+		PermOrgUpdate,
+		PermOrgSuspend,
+		PermOrgTransfer,
+
+		PermOutboxView,
+		PermOutboxReplay,
+
+		PermGroupsCreate,
+		PermGroupsView,
+		PermGroupsUpdate,
+		PermGroupsDelete,
+		PermGroupsMembers,
+
+		PermReviewsManage,
+
+		PermWebhooksManage,
+		PermScimManage,
+		PermSSOManage,
+
+		PermOAuthClientsManage,
 	},
 	RoleAdmin: {
 		PermUsersCreate,
+		PermUsersView,
 		PermUsersUpdate,
 		PermUsersDelete,
 		PermRolesAssign,
@@ -57,8 +156,66 @@ var RolePermissions = map[string][]string{
 		PermOrgUpdate,
 		PermOrgDelete,
 		PermOrgSuspend,
+		PermOrgTransfer,
+
+		PermGroupsCreate,
+		PermGroupsView,
+		PermGroupsUpdate,
+		PermGroupsDelete,
+		PermGroupsMembers,
+
+		PermWebhooksManage,
+		PermScimManage,
+		PermSSOManage,
 	},
 	RoleUser: {
 		PermPostsCreate, PermPostsUpdate, PermPostsDelete,
 	},
+	RoleAuditor: {
+		PermLogsView,
+	},
+	RolePaymentsInitiator: {
+		PermPaymentsInitiate,
+	},
+	RolePaymentsApprover: {
+		PermPaymentsApprove,
+	},
+}
+
+// rolesWithPermission returns the roles that carry perm.
+func rolesWithPermission(perm string) []string {
+	roles := []string{}
+	for role, perms := range RolePermissions {
+		if slices.Contains(perms, perm) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// withPermissions adds the single permissions in extra to perms.
+func withPermissions(perms []string, extra []string) []string {
+	for _, perm := range extra {
+		if !slices.Contains(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// effectivePermissions are the permissions claims give: those of the role
+// and of the roles held through groups and grants, plus granted permissions.
+func effectivePermissions(claims UserClaims) []string {
+	return withPermissions(permissionsFor(claims.Role, slices.Concat(claims.GroupRoles, claims.GrantRoles)...), claims.GrantPerms)
+}
+
+// permissionsFor unions the permissions of role and of every extra role, such
+// as the ones a user holds through groups. Unknown extra roles grant nothing.
+func permissionsFor(role string, extra ...string) []string {
+	perms := slices.Clone(RolePermissions[role])
+	for _, r := range extra {
+		perms = withPermissions(perms, RolePermissions[r])
+	}
+	return perms
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type softDeleteConfig struct {
+	// restoreWindow is how long a deleted record can still be restored.
+	restoreWindow time.Duration
+	// retention is how long a deleted record is kept before it is purged. It
+	// is never shorter than restoreWindow.
+	retention     time.Duration
+	purgeInterval time.Duration
+}
+
+// restoreDeadline is the last moment a record deleted at deletedAt can be
+// restored.
+func (app *application) restoreDeadline(deletedAt time.Time) time.Time {
+	return deletedAt.Add(app.config.softDelete.restoreWindow)
+}
+
+// runPurgeJob permanently deletes soft-deleted records past retention, and
+// expired OAuth codes and tokens, until ctx is cancelled.
+func (app *application) runPurgeJob(ctx context.Context) {
+	ticker := time.NewTicker(app.config.softDelete.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeDeleted(ctx)
+		app.purgeExpiredOAuth(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeleted removes children before their parents so the foreign keys
+// between users, organizations and admins hold at every step.
+func (app *application) purgeDeleted(ctx context.Context) {
+	before := time.Now().Add(-app.config.softDelete.retention)
+
+	counts := map[string]int64{}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		steps := []struct {
+			table string
+			purge func(context.Context, time.Time) (int64, error)
+		}{
+			{"user_invites", tx.UserInvite.PurgeDeleted},
+			{"memberships", tx.Membership.PurgeDeleted},
+			{"users", tx.User.PurgeDeleted},
+			{"admin_invites", tx.AdminInvites.PurgeDeleted},
+			{"organizations", tx.Organization.PurgeDeleted},
+			{"admins", tx.Admin.PurgeDeleted},
+		}
+		for _, step := range steps {
+			n, err := step.purge(ctx, before)
+			if err != nil {
+				return err
+			}
+			counts[step.table] = n
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("error purging deleted records", zap.Error(err))
+		return
+	}
+
+	for table, n := range counts {
+		if n > 0 {
+			app.logger.Infow("purged deleted records", "table", table, "count", n)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// reviewSummary counts the items of a review by decision.
+type reviewSummary struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Certified int `json:"certified"`
+	Revoked   int `json:"revoked"`
+	Applied   int `json:"applied"`
+}
+
+type reviewResponse struct {
+	models.AccessReview
+	Reviewers []models.AccessReviewer `json:"reviewers"`
+	Summary   reviewSummary           `json:"summary"`
+}
+
+// reviewEvidence is the signed-off record of a review, as exported.
+type reviewEvidence struct {
+	reviewResponse
+	Items       []models.AccessReviewItem `json:"items"`
+	GeneratedAt time.Time                 `json:"generatedAt"`
+}
+
+func summarizeReview(items []models.AccessReviewItem) reviewSummary {
+	summary := reviewSummary{Total: len(items)}
+	for _, item := range items {
+		switch item.Decision {
+		case models.ReviewDecisionPending:
+			summary.Pending++
+		case models.ReviewDecisionCertified:
+			summary.Certified++
+		case models.ReviewDecisionRevoked:
+			summary.Revoked++
+		}
+		if item.AppliedAt != nil {
+			summary.Applied++
+		}
+	}
+	return summary
+}
+
+// StartReviewHandler opens an access review over everyone who holds access in
+// its scope right now. The access is captured when the review starts, so
+// later changes do not move the review.
+func (app *application) StartReviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermReviewsManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to start access reviews"))
+		return
+	}
+
+	var payload dtos.StartReviewPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	now := time.Now()
+	if payload.DueAt != nil && !payload.DueAt.After(now) {
+		app.badRequestResponse(w, r, errors.New("dueAt must be in the future"))
+		return
+	}
+
+	scope, err := app.reviewScope(ctx, payload.ScopeType, payload.ScopeValue)
+	if errors.Is(err, errInvalidReviewScope) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	reviewerIDs := payload.Reviewers
+	if len(reviewerIDs) == 0 {
+		reviewerIDs = []uuid.UUID{uuid.MustParse(user.UserID)}
+	}
+	reviewers := make([]models.AccessReviewer, 0, len(reviewerIDs))
+	emails := make([]string, 0, len(reviewerIDs))
+	for _, id := range reviewerIDs {
+		if slices.ContainsFunc(reviewers, func(rv models.AccessReviewer) bool { return rv.AdminID == id }) {
+			continue
+		}
+		admin, err := app.store.Admin.GetAdmin(ctx, id)
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		if admin.Status != helpers.StatusActive {
+			app.storeErrorResponse(w, r, store.ErrAdminNotActive)
+			return
+		}
+		reviewers = append(reviewers, models.AccessReviewer{AdminID: admin.ID})
+		emails = append(emails, admin.Email)
+	}
+
+	review := &models.AccessReview{
+		ID:         uuid.New(),
+		Name:       payload.Name,
+		ScopeType:  payload.ScopeType,
+		ScopeValue: payload.ScopeValue,
+		Status:     models.ReviewStatusOpen,
+		DueAt:      payload.DueAt,
+		CreatedBy:  uuid.MustParse(user.UserID),
+	}
+
+	var items []models.AccessReviewItem
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		items, err = tx.Review.CollectEntitlements(ctx, scope, now)
+		if err != nil {
+			return err
+		}
+		if err := tx.Review.CreateReview(ctx, review, reviewers, items); err != nil {
+			return err
+		}
+		for _, email := range emails {
+			if err := app.enqueueReviewAssigned(ctx, tx.Outbox, review, len(items), email); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("error starting access review", zap.String("name", review.Name), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("access review started",
+		"review", review.ID, "scopeType", review.ScopeType, "scopeValue", review.ScopeValue,
+		"items", len(items), "by", user.UserID)
+	app.jsonResponse(w, http.StatusCreated, reviewResponse{
+		AccessReview: *review,
+		Reviewers:    reviewers,
+		Summary:      summarizeReview(items),
+	}, "access review started")
+}
+
+// ListReviewsHandler lists reviews, optionally narrowed by ?status=. Review
+// managers see every review and reviewers see the ones they review.
+func (app *application) ListReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	filter := store.ReviewFilter{Status: r.URL.Query().Get("status")}
+	switch filter.Status {
+	case "", models.ReviewStatusOpen, models.ReviewStatusClosed:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid review status"))
+		return
+	}
+	if !app.HasPermission(user, PermReviewsManage) {
+		filter.ReviewerID = uuid.MustParse(user.UserID)
+	}
+
+	reviews, err := app.store.Review.ListReviews(ctx, filter)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, reviews, "access reviews")
+}
+
+func (app *application) GetReviewHandler(w http.ResponseWriter, r *http.Request) {
+	resp, _, ok := app.loadReview(w, r)
+	if !ok {
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, resp, "access review")
+}
+
+// ListReviewItemsHandler lists the items of the review given by ?id=,
+// optionally narrowed by ?decision=.
+func (app *application) ListReviewItemsHandler(w http.ResponseWriter, r *http.Request) {
+	decision := r.URL.Query().Get("decision")
+	switch decision {
+	case "", models.ReviewDecisionPending, models.ReviewDecisionCertified, models.ReviewDecisionRevoked:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid review decision"))
+		return
+	}
+
+	_, items, ok := app.loadReview(w, r)
+	if !ok {
+		return
+	}
+	if decision != "" {
+		items = slices.DeleteFunc(items, func(item models.AccessReviewItem) bool { return item.Decision != decision })
+	}
+
+	app.jsonResponse(w, http.StatusOK, items, "access review items")
+}
+
+// DecideReviewItemHandler certifies or revokes the item given by ?id=.
+// Reviewers can change their mind until the review closes, but nobody
+// reviews their own access.
+func (app *application) DecideReviewItemHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.ReviewDecisionPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	item, err := app.store.Review.GetItem(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	reviewers, err := app.store.Review.ListReviewers(ctx, item.ReviewID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isReviewer(user, reviewers) {
+		app.unauthorizedResponse(w, r, errors.New("you are not a reviewer of this access review"))
+		return
+	}
+	if isSelf(user, item.AccountID) {
+		app.unauthorizedResponse(w, r, errors.New("you cannot review your own access"))
+		return
+	}
+
+	now := time.Now()
+	by := uuid.MustParse(user.UserID)
+	if err := app.store.Review.DecideItem(ctx, item.ID, payload.Decision, payload.Comment, by, now); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	item.Decision, item.Comment, item.ReviewedBy, item.ReviewedAt = payload.Decision, payload.Comment, &by, &now
+	app.jsonResponse(w, http.StatusOK, item, "access "+payload.Decision)
+}
+
+// CloseReviewHandler signs off the review given by ?id= and carries out its
+// revocations in the same transaction. Items nobody decided stay pending in
+// the evidence and are left alone.
+func (app *application) CloseReviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermReviewsManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to close access reviews"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	by := uuid.MustParse(user.UserID)
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Review.CloseReview(ctx, id, by, now); err != nil {
+			return err
+		}
+
+		revoked, err := tx.Review.ListItems(ctx, id, models.ReviewDecisionRevoked)
+		if err != nil {
+			return err
+		}
+		for i := range revoked {
+			note, err := applyRevocation(ctx, tx, &revoked[i], by, now)
+			if err != nil {
+				return err
+			}
+			if err := tx.Review.MarkItemApplied(ctx, revoked[i].ID, note, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("error closing access review", zap.String("id", id.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	resp, _, ok := app.loadReview(w, r)
+	if !ok {
+		return
+	}
+	app.logger.Infow("access review closed",
+		"review", id, "certified", resp.Summary.Certified, "revoked", resp.Summary.Revoked,
+		"pending", resp.Summary.Pending, "by", user.UserID)
+	app.jsonResponse(w, http.StatusOK, resp, "access review closed")
+}
+
+// ExportReviewHandler writes the review given by ?id= with every item and
+// decision as evidence, as JSON or, with ?format=csv, as CSV.
+func (app *application) ExportReviewHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		app.badRequestResponse(w, r, errors.New("format must be json or csv"))
+		return
+	}
+
+	resp, items, ok := app.loadReview(w, r)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("access-review-%s", resp.ID)
+	if format != "csv" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		app.jsonResponse(w, http.StatusOK, reviewEvidence{
+			reviewResponse: resp,
+			Items:          items,
+			GeneratedAt:    time.Now(),
+		}, "access review evidence")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"review_id", "review_name", "review_status", "closed_by", "closed_at",
+		"item_id", "account_type", "account_id", "account_email", "source", "source_id",
+		"organization_id", "role", "permission", "valid_until",
+		"decision", "comment", "reviewed_by", "reviewed_at", "applied_at", "apply_note",
+	})
+	for _, item := range items {
+		cw.Write([]string{
+			resp.ID.String(), resp.Name, resp.Status, optionalUUID(resp.ClosedBy), optionalTime(resp.ClosedAt),
+			item.ID.String(), item.AccountType, item.AccountID.String(), item.AccountEmail, item.Source, item.SourceID.String(),
+			optionalUUID(item.OrganizationID), item.Role, item.Permission, optionalTime(item.ValidUntil),
+			item.Decision, item.Comment, optionalUUID(item.ReviewedBy), optionalTime(item.ReviewedAt),
+			optionalTime(item.AppliedAt), item.ApplyNote,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		app.logger.Error("error writing access review csv", zap.String("id", resp.ID.String()), zap.Error(err))
+	}
+}
+
+// loadReview resolves the review given by ?id= with its reviewers and items.
+// Review managers and the review's reviewers can see it. It writes the error
+// response itself.
+func (app *application) loadReview(w http.ResponseWriter, r *http.Request) (reviewResponse, []models.AccessReviewItem, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return reviewResponse{}, nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return reviewResponse{}, nil, false
+	}
+
+	review, err := app.store.Review.GetReview(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return reviewResponse{}, nil, false
+	}
+	reviewers, err := app.store.Review.ListReviewers(ctx, review.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return reviewResponse{}, nil, false
+	}
+	if !app.HasPermission(user, PermReviewsManage) && !isReviewer(user, reviewers) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view this access review"))
+		return reviewResponse{}, nil, false
+	}
+
+	items, err := app.store.Review.ListItems(ctx, review.ID, "")
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return reviewResponse{}, nil, false
+	}
+
+	return reviewResponse{AccessReview: *review, Reviewers: reviewers, Summary: summarizeReview(items)}, items, true
+}
+
+// reviewScope turns a review's scope into the store query for it.
+func (app *application) reviewScope(ctx context.Context, scopeType, value string) (store.ReviewScope, error) {
+	switch scopeType {
+	case models.ReviewScopeOrganization:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return store.ReviewScope{}, errInvalidReviewScope
+		}
+		org, err := app.store.Organization.GetOrganization(ctx, id)
+		if err != nil {
+			return store.ReviewScope{}, err
+		}
+		return store.ReviewScope{OrganizationID: org.ID}, nil
+	case models.ReviewScopeRole:
+		if _, ok := RolePermissions[value]; !ok {
+			return store.ReviewScope{}, errInvalidReviewScope
+		}
+		return store.ReviewScope{Roles: []string{value}}, nil
+	default:
+		roles := rolesWithPermission(value)
+		if len(roles) == 0 {
+			return store.ReviewScope{}, errInvalidReviewScope
+		}
+		return store.ReviewScope{Roles: roles, Permission: value}, nil
+	}
+}
+
+var errInvalidReviewScope = errors.New("scopeValue must be an organization ID, a role or a permission")
+
+// applyRevocation takes away the access an item describes: grants are
+// revoked, memberships removed and admins suspended, since an admin's role
+// cannot be taken without taking the account. Access that is already gone
+// is noted rather than failing the close.
+func applyRevocation(ctx context.Context, tx store.TxStorage, item *models.AccessReviewItem, by uuid.UUID, at time.Time) (string, error) {
+	var err error
+	switch item.Source {
+	case models.ReviewSourceGrant:
+		err = tx.Grant.RevokeGrant(ctx, item.SourceID, by, at)
+		if errors.Is(err, store.ErrGrantEnded) {
+			return "grant had already ended", nil
+		}
+	case models.ReviewSourceMembership:
+		err = tx.Membership.DeleteMembership(ctx, item.SourceID)
+	case models.ReviewSourceAdmin:
+		var admin *models.Admin
+		if admin, err = tx.Admin.GetAdmin(ctx, item.SourceID); err == nil {
+			if admin.Status == helpers.StatusSuspended {
+				return "admin was already suspended", nil
+			}
+			err = tx.Admin.UpdateAdmin(ctx, admin.ID, map[string]interface{}{"status": helpers.StatusSuspended})
+		}
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return "access no longer existed", nil
+	}
+	return "", err
+}
+
+func isReviewer(user UserClaims, reviewers []models.AccessReviewer) bool {
+	// reviewers are admins, so member tokens never match
+	if user.OrgID != "" {
+		return false
+	}
+	return slices.ContainsFunc(reviewers, func(rv models.AccessReviewer) bool { return isSelf(user, rv.AdminID) })
+}
+
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func optionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
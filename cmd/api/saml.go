@@ -0,0 +1,343 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/saml"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type samlConfig struct {
+	// baseURL is our public URL. Each organization's entity ID and assertion
+	// consumer service are under it.
+	baseURL string
+	// requestTTL is how long a user has to finish signing in at the provider.
+	requestTTL time.Duration
+	// clockSkew is how far the provider's clock may be off from ours.
+	clockSkew time.Duration
+	// key signs our AuthnRequests. certificate carries its public half in
+	// our metadata.
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+// samlServiceProvider is us as the organization's identity provider knows
+// us. The entity ID is the URL of our metadata.
+func (app *application) samlServiceProvider(orgID uuid.UUID) *saml.ServiceProvider {
+	base := app.config.saml.baseURL + "/v1/users/sso/saml"
+	query := "?organizationId=" + orgID.String()
+	return &saml.ServiceProvider{
+		EntityID:    base + "/metadata" + query,
+		ACSURL:      base + "/acs" + query,
+		Key:         app.config.saml.key,
+		Certificate: app.config.saml.certificate,
+	}
+}
+
+func samlIdentityProvider(provider *models.SAMLProvider) *saml.IdentityProvider {
+	return &saml.IdentityProvider{
+		EntityID:     provider.EntityID,
+		SSOURL:       provider.SSOURL,
+		Certificates: provider.Certificates,
+	}
+}
+
+func samlPolicy(provider *models.SAMLProvider) ssoPolicy {
+	return ssoPolicy{
+		organizationID:  provider.OrganizationID,
+		jitProvisioning: provider.JITProvisioning,
+		roleMappings:    provider.RoleMappings,
+		defaultRole:     provider.DefaultRole,
+	}
+}
+
+// SaveSAMLProviderHandler sets up SAML single sign-on for the organization,
+// or replaces its settings, from the identity provider's metadata.
+// Importing the metadata again picks up a new signing certificate.
+func (app *application) SaveSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermSSOManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage single sign-on"))
+		return
+	}
+
+	var payload dtos.SaveSAMLProviderPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if (payload.MetadataXML == "") == (payload.MetadataURL == "") {
+		app.badRequestResponse(w, r, errors.New("one of metadataXml and metadataUrl is required"))
+		return
+	}
+	if !app.canAdministerOrg(w, r, user, payload.OrganizationID, "manage single sign-on of") {
+		return
+	}
+
+	metadata := []byte(payload.MetadataXML)
+	if payload.MetadataURL != "" {
+		if metadata, err = app.samlFetchMetadata(ctx, payload.MetadataURL); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	idp, err := saml.ParseMetadata(metadata)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	provider := &models.SAMLProvider{
+		OrganizationID:  payload.OrganizationID,
+		EntityID:        idp.EntityID,
+		SSOURL:          idp.SSOURL,
+		Certificates:    idp.Certificates,
+		MetadataURL:     payload.MetadataURL,
+		EmailAttribute:  cmp.Or(payload.EmailAttribute, "email"),
+		NameAttribute:   cmp.Or(payload.NameAttribute, "name"),
+		GroupsAttribute: cmp.Or(payload.GroupsAttribute, "groups"),
+		DefaultRole:     cmp.Or(payload.DefaultRole, RoleUser),
+		JITProvisioning: payload.JITProvisioning,
+		SSOOnly:         payload.SSOOnly,
+		UpdatedBy:       uuid.MustParse(user.UserID),
+	}
+	if provider.RoleMappings, err = ssoRoleMappings(payload.RoleMappings, provider.DefaultRole); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.SAML.SaveProvider(ctx, provider); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, provider, "SAML single sign-on saved successfully")
+}
+
+// GetSAMLProviderHandler shows the SAML settings of the organization given
+// by ?organizationId=.
+func (app *application) GetSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := app.loadSSOOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	provider, err := app.store.SAML.GetProvider(r.Context(), orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, provider, "SAML single sign-on")
+}
+
+// DeleteSAMLProviderHandler turns SAML single sign-on off for the
+// organization given by ?organizationId=.
+func (app *application) DeleteSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := app.loadSSOOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.SAML.DeleteProvider(r.Context(), orgID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "SAML single sign-on removed successfully")
+}
+
+func (app *application) samlFetchMetadata(ctx context.Context, target string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.sso.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching metadata: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching metadata: %s answered %d", req.URL.Redacted(), res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// SAMLMetadataHandler serves our metadata for the organization given by
+// ?organizationId=, to be imported by its identity provider. It is there
+// before the provider is set up, as providers usually need it first.
+func (app *application) SAMLMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if _, err := app.store.Organization.GetOrganization(r.Context(), orgID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	metadata, err := app.samlServiceProvider(orgID).Metadata()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SAMLLoginHandler starts signing in to the organization given by
+// ?organizationId= by redirecting to its identity provider with a signed
+// AuthnRequest.
+func (app *application) SAMLLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	provider, err := app.store.SAML.GetProvider(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	org, err := app.store.Organization.GetOrganization(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if org.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errOrgSuspended)
+		return
+	}
+
+	id, err := saml.NewID()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	if _, err := app.store.SAML.DeleteExpired(ctx, now); err != nil {
+		app.logger.Error("error deleting expired SAML requests", zap.Error(err))
+	}
+	err = app.store.SAML.CreateRequest(ctx, &models.SAMLRequest{
+		ID:             id,
+		OrganizationID: orgID,
+		ExpiresAt:      now.Add(app.config.saml.requestTTL),
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	target, err := app.samlServiceProvider(orgID).AuthnRequestURL(samlIdentityProvider(provider), id, now)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// SAMLACSHandler is our assertion consumer service: the identity provider
+// posts its response here, and the user is signed in as by
+// OIDCCallbackHandler. Only answers to our own AuthnRequests are accepted,
+// each once, and an assertion is never accepted twice.
+func (app *application) SAMLACSHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_578)
+	if err := r.ParseForm(); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	encoded := r.PostForm.Get("SAMLResponse")
+	if encoded == "" {
+		app.badRequestResponse(w, r, errors.New("SAMLResponse is required"))
+		return
+	}
+
+	provider, err := app.store.SAML.GetProvider(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	now := time.Now()
+	assertion, err := app.samlServiceProvider(orgID).ParseResponse(encoded, samlIdentityProvider(provider), now,
+		app.config.saml.clockSkew)
+	if err != nil {
+		app.logger.Warnw("SAML single sign-on failed", "organization", orgID, "error", err.Error())
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if assertion.InResponseTo == "" {
+		app.unauthorizedResponse(w, r, errors.New("sign-ins must start here, not at the identity provider"))
+		return
+	}
+
+	err = app.store.SAML.RecordAssertion(ctx, &models.SAMLAssertion{
+		OrganizationID: orgID,
+		AssertionID:    assertion.ID,
+		ExpiresAt:      assertion.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrSAMLAssertionReplayed) {
+			app.logger.Warnw("SAML assertion replayed", "organization", orgID, "assertion", assertion.ID)
+			app.unauthorizedResponse(w, r, err)
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.store.SAML.ConsumeRequest(ctx, orgID, assertion.InResponseTo, now); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedResponse(w, r, errors.New("sign-in has expired or was already completed, start again"))
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	email := assertion.Attribute(provider.EmailAttribute)
+	if email == "" && assertion.NameIDFormat == saml.NameIDFormatEmail {
+		email = assertion.NameID
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		app.unauthorizedResponse(w, r, fmt.Errorf("the assertion has no %q attribute", provider.EmailAttribute))
+		return
+	}
+
+	app.ssoLogin(w, r, samlPolicy(provider), email, assertion.Attribute(provider.NameAttribute),
+		assertion.Attributes[provider.GroupsAttribute])
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/saml"
+	"github.com/mightyfzeus/rbac/internal/saml/samltest"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+// setUpSAML returns an application serving on srv whose organization signs
+// in with idp, which checks that our AuthnRequests are signed.
+func setUpSAML(t *testing.T) (*httptest.Server, *samltest.IdP, *models.Organization) {
+	t.Helper()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+
+	var err error
+	app.config.saml.baseURL = srv.URL
+	if app.config.saml.key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if app.config.saml.certificate, err = saml.SelfSignedCertificate(app.config.saml.key, "rbac", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	idp, err := samltest.New("https://idp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.SPCertificate = app.config.saml.certificate
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	status, res := doJSON(t, srv, http.MethodPut, "/v1/admin/sso/saml", loginAdmin(t, srv, owner), map[string]any{
+		"organizationId":  org.ID,
+		"metadataXml":     string(idp.Metadata()),
+		"jitProvisioning": true,
+		"roleMappings":    []map[string]string{{"group": "auditors", "role": RoleAuditor}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("saving the provider answered %d: %s", status, res.Error)
+	}
+	return srv, idp, org
+}
+
+// startSAMLLogin starts signing in to org and returns the AuthnRequest the
+// identity provider receives.
+func startSAMLLogin(t *testing.T, srv *httptest.Server, idp *samltest.IdP, org *models.Organization) *samltest.AuthnRequest {
+	t.Helper()
+
+	target := redirectTo(t, follow(t, srv.URL+"/v1/users/sso/saml/login?organizationId="+org.ID.String()))
+	req, err := idp.ReadAuthnRequest(target.RawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// postSAMLResponse posts response to the assertion consumer service at acs
+// and decodes the answer.
+func postSAMLResponse(t *testing.T, acs, response string) (int, testResponse) {
+	t.Helper()
+
+	res, err := http.PostForm(acs, url.Values{"SAMLResponse": {response}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out testResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, out
+}
+
+func TestSAMLSignIn(t *testing.T) {
+	srv, idp, org := setUpSAML(t)
+	idp.User = samltest.User{
+		NameID:     "Ada@Example.com",
+		Attributes: map[string][]string{"name": {"Ada"}, "groups": {"auditors"}},
+	}
+
+	req := startSAMLLogin(t, srv, idp, org)
+	response, err := idp.Response(req.ID, req.ACSURL, req.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, res := postSAMLResponse(t, req.ACSURL, response)
+	if status != http.StatusOK {
+		t.Fatalf("signing in answered %d: %s", status, res.Error)
+	}
+	var login ssoLoginResponse
+	if err := json.Unmarshal(res.Data, &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Token == "" || login.Role != RoleAuditor || login.User.Email != "ada@example.com" {
+		t.Errorf("signed in %q with role %q", login.User.Email, login.Role)
+	}
+
+	status, res = postSAMLResponse(t, req.ACSURL, response)
+	if status != http.StatusUnauthorized || res.Error != store.ErrSAMLAssertionReplayed.Error() {
+		t.Errorf("replaying the assertion answered %d (%s), want %d (%s)",
+			status, res.Error, http.StatusUnauthorized, store.ErrSAMLAssertionReplayed)
+	}
+}
+
+func TestSAMLACSRefuses(t *testing.T) {
+	srv, idp, org := setUpSAML(t)
+	idp.User = samltest.User{NameID: "ada@example.com"}
+	req := startSAMLLogin(t, srv, idp, org)
+
+	other, err := samltest.New(idp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.User = idp.User
+
+	tests := []struct {
+		name         string
+		idp          *samltest.IdP
+		inResponseTo string
+		audience     string
+	}{
+		{"unsolicited", idp, "", req.Issuer},
+		{"answering a request we never sent", idp, "_unknown", req.Issuer},
+		{"signed by another key", other, req.ID, req.Issuer},
+		{"meant for another service provider", idp, req.ID, "https://other.example.com/saml/metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := tt.idp.Response(tt.inResponseTo, req.ACSURL, tt.audience)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, res := postSAMLResponse(t, req.ACSURL, response); status != http.StatusUnauthorized {
+				t.Errorf("answered %d (%s), want %d", status, res.Error, http.StatusUnauthorized)
+			}
+		})
+	}
+
+	// none of the above used up the request
+	response, err := idp.Response(req.ID, req.ACSURL, req.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, res := postSAMLResponse(t, req.ACSURL, response); status != http.StatusOK {
+		t.Errorf("answering the request answered %d: %s", status, res.Error)
+	}
+}
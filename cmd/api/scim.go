@@ -0,0 +1,848 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	scimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	scimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaBulkRequest           = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	scimSchemaBulkResponse          = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	scimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimContentType = "application/scim+json"
+
+	// scimMaxResults caps the resources one list request returns.
+	scimMaxResults = 200
+	// scimMaxBulkOperations caps the operations of one bulk request.
+	scimMaxBulkOperations = 100
+	// scimMaxPayloadSize caps the body of any request, bulk requests included.
+	scimMaxPayloadSize = 1 << 20
+)
+
+const scimContextKey = contextKey("scim")
+
+// scimClient is the identity provider behind a SCIM request: the token it
+// presented and the organization the token provisions.
+type scimClient struct {
+	token *models.ScimToken
+	org   *models.Organization
+}
+
+func scimClientFromContext(ctx context.Context) *scimClient {
+	client, _ := ctx.Value(scimContextKey).(*scimClient)
+	return client
+}
+
+// scimError is a SCIM error response (RFC 7644 section 3.12). Handlers
+// return it to answer with a specific status and scimType.
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func (e *scimError) Error() string {
+	return e.Detail
+}
+
+func newScimError(status int, scimType, detail string) *scimError {
+	return &scimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func writeSCIM(w http.ResponseWriter, status int, data any) error {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(data)
+}
+
+// readSCIM decodes a SCIM request body. Unlike readJSON it accepts unknown
+// attributes: identity providers send schema extensions we do not keep.
+func readSCIM(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, scimMaxPayloadSize)
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "request body is not valid JSON: "+err.Error())
+	}
+	return nil
+}
+
+// scimErrorResponse answers with err in the SCIM error format, mapping store
+// errors the way storeErrorResponse does.
+func (app *application) scimErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var se *scimError
+	switch {
+	case errors.As(err, &se):
+	case errors.Is(err, store.ErrNotFound):
+		se = newScimError(http.StatusNotFound, "", err.Error())
+	case errors.Is(err, store.ErrUniqueViolation):
+		se = newScimError(http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, errSoDViolation), errors.Is(err, store.ErrForeignKeyViolation):
+		se = newScimError(http.StatusConflict, "", err.Error())
+	case errors.Is(err, store.ErrCheckViolation), errors.Is(err, store.ErrNotNullViolation):
+		se = newScimError(http.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, store.ErrSerialization):
+		w.Header().Set("Retry-After", "1")
+		se = newScimError(http.StatusServiceUnavailable, "", "the request conflicted with a concurrent update, please retry")
+	default:
+		app.logger.Errorw("SCIM request failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+		se = newScimError(http.StatusInternalServerError, "", "internal server error")
+	}
+	if se.Status[0] == '4' {
+		app.logger.Warnw("SCIM request rejected", "method", r.Method, "path", r.URL.Path, "status", se.Status, "error", se.Detail)
+	}
+	writeSCIM(w, atoiStatus(se.Status), se)
+}
+
+func atoiStatus(status string) int {
+	n, err := strconv.Atoi(status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return n
+}
+
+// ScimAuthMiddleware authenticates identity providers by the bearer SCIM
+// token of an organization. Revoked tokens and suspended or deleted
+// organizations are refused.
+func (app *application) ScimAuthMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || raw == "" {
+				app.scimErrorResponse(w, r, newScimError(http.StatusUnauthorized, "", "missing bearer token"))
+				return
+			}
+
+			token, err := app.store.Scim.GetTokenByHash(ctx, HashToken(raw))
+			if err != nil || token.RevokedAt != nil {
+				app.scimErrorResponse(w, r, newScimError(http.StatusUnauthorized, "", "invalid token"))
+				return
+			}
+			org, err := app.store.Organization.GetOrganization(ctx, token.OrganizationID)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.scimErrorResponse(w, r, newScimError(http.StatusUnauthorized, "", "invalid token"))
+				return
+			case err != nil:
+				app.scimErrorResponse(w, r, err)
+				return
+			case org.Status == helpers.StatusSuspended:
+				app.scimErrorResponse(w, r, newScimError(http.StatusForbidden, "", errOrgSuspended.Error()))
+				return
+			}
+
+			if err := app.store.Scim.TouchToken(ctx, token.ID, time.Now()); err != nil {
+				app.logger.Error("error recording SCIM token use", zap.String("id", token.ID.String()), zap.Error(err))
+			}
+
+			ctx = context.WithValue(ctx, scimContextKey, &scimClient{token: token, org: org})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// scimCreatedResponse shows the token, which is never shown again.
+type scimCreatedResponse struct {
+	*models.ScimToken
+	Token string `json:"token"`
+}
+
+// CreateScimTokenHandler issues a token an identity provider provisions the
+// organization's users and groups with.
+func (app *application) CreateScimTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermScimManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage SCIM tokens"))
+		return
+	}
+
+	var payload dtos.CreateScimTokenPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if !app.canAdministerOrg(w, r, user, payload.OrganizationID, "manage SCIM tokens of") {
+		return
+	}
+
+	raw, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	raw = "scim_" + raw
+	token := &models.ScimToken{
+		ID:             uuid.New(),
+		OrganizationID: payload.OrganizationID,
+		TokenHash:      HashToken(raw),
+		Description:    payload.Description,
+		CreatedBy:      uuid.MustParse(user.UserID),
+	}
+	if err := app.store.Scim.CreateToken(ctx, token); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, scimCreatedResponse{ScimToken: token, Token: raw},
+		"SCIM token created successfully, store it now as it is not shown again")
+}
+
+// ListScimTokensHandler lists the tokens of the organization given by
+// ?organizationId=.
+func (app *application) ListScimTokensHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermScimManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage SCIM tokens"))
+		return
+	}
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.canAdministerOrg(w, r, user, orgID, "manage SCIM tokens of") {
+		return
+	}
+
+	tokens, err := app.store.Scim.ListTokens(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, tokens, "SCIM tokens")
+}
+
+// RevokeScimTokenHandler revokes the token given by ?id=. Requests with it
+// fail from then on.
+func (app *application) RevokeScimTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermScimManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage SCIM tokens"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	token, err := app.store.Scim.GetToken(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !app.canAdministerOrg(w, r, user, token.OrganizationID, "manage SCIM tokens of") {
+		return
+	}
+
+	if err := app.store.Scim.RevokeToken(ctx, token.ID, time.Now()); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "SCIM token revoked successfully")
+}
+
+// ScimServiceProviderConfigHandler tells identity providers which parts of
+// SCIM are supported.
+func (app *application) ScimServiceProviderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimSchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": true, "maxOperations": scimMaxBulkOperations, "maxPayloadSize": scimMaxPayloadSize},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "SCIM token",
+			"description": "A per-organization bearer token issued by an organization admin",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": scimBaseURL(r) + "/ServiceProviderConfig"},
+	})
+}
+
+func (app *application) ScimResourceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	base := scimBaseURL(r)
+	resourceType := func(name, endpoint, schema string) map[string]any {
+		return map[string]any{
+			"schemas":  []string{scimSchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": base + "/ResourceTypes/" + name},
+		}
+	}
+	resources := []map[string]any{
+		resourceType("User", "/Users", scimSchemaUser),
+		resourceType("Group", "/Groups", scimSchemaGroup),
+	}
+
+	writeSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resources),
+		ItemsPerPage: len(resources),
+		StartIndex:   1,
+		Resources:    resources,
+	})
+}
+
+// scimBaseURL is the absolute URL of the SCIM endpoints as the client
+// reached them.
+func scimBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/scim/v2"
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// scimMultiValue is one value of a multi-valued attribute such as emails or
+// members.
+type scimMultiValue struct {
+	Value   string   `json:"value"`
+	Display string   `json:"display,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	Primary scimBool `json:"primary,omitempty"`
+	Ref     string   `json:"$ref,omitempty"`
+}
+
+// scimBool also accepts the "True" and "False" strings some identity
+// providers send for booleans.
+type scimBool bool
+
+func (b *scimBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseBool(strings.ToLower(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		*b = scimBool(v)
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = scimBool(v)
+	return nil
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	StartIndex   int      `json:"startIndex"`
+	Resources    any      `json:"Resources"`
+}
+
+// scimListPage filters resources by the ?filter= of the request and returns
+// the page ?startIndex= and ?count= select.
+func scimListPage[T any](r *http.Request, resources []T, schema string) (scimListResponse, error) {
+	query := r.URL.Query()
+
+	startIndex, count := 1, scimMaxResults
+	for key, dst := range map[string]*int{"startIndex": &startIndex, "count": &count} {
+		if value := query.Get(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return scimListResponse{}, newScimError(http.StatusBadRequest, "invalidValue", key+" must be an integer")
+			}
+			*dst = n
+		}
+	}
+	// out-of-range values are clamped, as RFC 7644 section 3.4.2.4 asks
+	startIndex = max(startIndex, 1)
+	count = min(max(count, 0), scimMaxResults)
+
+	if raw := query.Get("filter"); raw != "" {
+		filter, err := parseScimFilter(raw, schema)
+		if err != nil {
+			return scimListResponse{}, newScimError(http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+		matched := []T{}
+		for _, res := range resources {
+			m, err := scimMap(res)
+			if err != nil {
+				return scimListResponse{}, err
+			}
+			if filter.match(m) {
+				matched = append(matched, res)
+			}
+		}
+		resources = matched
+	}
+
+	page := []T{}
+	if startIndex <= len(resources) {
+		page = resources[startIndex-1 : min(startIndex-1+count, len(resources))]
+	}
+	return scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resources),
+		ItemsPerPage: len(page),
+		StartIndex:   startIndex,
+		Resources:    page,
+	}, nil
+}
+
+// scimMap converts a resource into the generic form filters and PATCH
+// operations work on.
+func scimMap(res any) (map[string]any, error) {
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	return m, json.Unmarshal(raw, &m)
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyScimPatch applies the operations of a PATCH request (RFC 7644 section
+// 3.5.2) to the resource res and stores the result in dst. Operations on
+// schema extensions are ignored, since no extension attributes are kept.
+func applyScimPatch(res any, req scimPatchRequest, schema string, dst any) error {
+	m, err := scimMap(res)
+	if err != nil {
+		return err
+	}
+	if len(req.Operations) == 0 {
+		return newScimError(http.StatusBadRequest, "invalidValue", "Operations must not be empty")
+	}
+
+	for _, op := range req.Operations {
+		var value any
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return newScimError(http.StatusBadRequest, "invalidSyntax", "invalid operation value: "+err.Error())
+			}
+		}
+		if err := applyScimOperation(m, strings.ToLower(op.Op), op.Path, value, schema); err != nil {
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "the patched resource is invalid: "+err.Error())
+	}
+	return nil
+}
+
+func applyScimOperation(m map[string]any, op, rawPath string, value any, schema string) error {
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "op must be one of [add replace remove]")
+	}
+
+	if rawPath == "" {
+		if op == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "remove operations need a path")
+		}
+		attrs, ok := value.(map[string]any)
+		if !ok {
+			return newScimError(http.StatusBadRequest, "invalidValue", "operations without a path need an object value")
+		}
+		for attr, v := range attrs {
+			if strings.HasPrefix(strings.ToLower(attr), "urn:") {
+				continue
+			}
+			setScimAttr(m, op, scimAttrPath{attr: attr}, v)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(rawPath), "urn:") &&
+		!strings.HasPrefix(strings.ToLower(rawPath), strings.ToLower(schema)+":") {
+		return nil
+	}
+	path, err := parseScimPatchPath(rawPath, schema)
+	if err != nil {
+		return newScimError(http.StatusBadRequest, "invalidPath", err.Error())
+	}
+
+	if path.filter == nil {
+		if op == "remove" {
+			removeScimAttr(m, path.scimAttrPath, value)
+		} else {
+			setScimAttr(m, op, path.scimAttrPath, value)
+		}
+		return nil
+	}
+
+	matched := 0
+	elems := scimElements(m, path.attr)
+	kept := []any{}
+	for _, elem := range elems {
+		em, ok := elem.(map[string]any)
+		if !ok || !path.filter.match(em) {
+			kept = append(kept, elem)
+			continue
+		}
+		matched++
+		switch {
+		case op == "remove" && path.sub == "":
+			continue
+		case op == "remove":
+			delete(em, scimKey(em, path.sub))
+		case path.sub != "":
+			em[scimKey(em, path.sub)] = value
+		default:
+			if replacement, ok := value.(map[string]any); ok {
+				for k, v := range replacement {
+					em[scimKey(em, k)] = v
+				}
+			} else {
+				return newScimError(http.StatusBadRequest, "invalidValue", "the value for "+rawPath+" must be an object")
+			}
+		}
+		kept = append(kept, em)
+	}
+	if matched == 0 && op != "remove" {
+		return newScimError(http.StatusBadRequest, "noTarget", "no value matches "+rawPath)
+	}
+	m[scimKey(m, path.attr)] = kept
+	return nil
+}
+
+// setScimAttr adds or replaces the attribute. Adding to a multi-valued
+// attribute appends the values it does not have yet.
+func setScimAttr(m map[string]any, op string, path scimAttrPath, value any) {
+	if path.sub != "" {
+		parent, _ := scimLookup(m, path.attr)
+		switch p := parent.(type) {
+		case map[string]any:
+			p[scimKey(p, path.sub)] = value
+		case []any:
+			for _, elem := range p {
+				if em, ok := elem.(map[string]any); ok {
+					em[scimKey(em, path.sub)] = value
+				}
+			}
+		default:
+			m[scimKey(m, path.attr)] = map[string]any{path.sub: value}
+		}
+		return
+	}
+
+	key := scimKey(m, path.attr)
+	existing, isMulti := m[key].([]any)
+	if op == "add" && isMulti {
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if !slicesContainsScimValue(existing, v) {
+				existing = append(existing, v)
+			}
+		}
+		m[key] = existing
+		return
+	}
+	if current, ok := m[key].(map[string]any); ok && op == "add" {
+		if additions, ok := value.(map[string]any); ok {
+			for k, v := range additions {
+				current[scimKey(current, k)] = v
+			}
+			return
+		}
+	}
+	m[key] = value
+}
+
+// removeScimAttr removes the attribute, or only the given values of a
+// multi-valued attribute when value lists them.
+func removeScimAttr(m map[string]any, path scimAttrPath, value any) {
+	key := scimKey(m, path.attr)
+	if path.sub != "" {
+		if parent, ok := m[key].(map[string]any); ok {
+			delete(parent, scimKey(parent, path.sub))
+		}
+		return
+	}
+
+	existing, isMulti := m[key].([]any)
+	values, hasValues := value.([]any)
+	if !isMulti || !hasValues {
+		delete(m, key)
+		return
+	}
+	kept := []any{}
+	for _, elem := range existing {
+		if !slicesContainsScimValue(values, elem) {
+			kept = append(kept, elem)
+		}
+	}
+	m[key] = kept
+}
+
+// slicesContainsScimValue reports whether values holds v. Complex values are
+// the same when their value sub-attributes are.
+func slicesContainsScimValue(values []any, v any) bool {
+	vm, complex := v.(map[string]any)
+	for _, candidate := range values {
+		if cm, ok := candidate.(map[string]any); ok && complex {
+			cv, _ := scimLookup(cm, "value")
+			vv, _ := scimLookup(vm, "value")
+			if cv != nil && cv == vv {
+				return true
+			}
+		}
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type scimBulkRequest struct {
+	Schemas      []string            `json:"schemas"`
+	FailOnErrors int                 `json:"failOnErrors"`
+	Operations   []scimBulkOperation `json:"Operations"`
+}
+
+type scimBulkOperation struct {
+	Method string          `json:"method"`
+	BulkID string          `json:"bulkId"`
+	Path   string          `json:"path"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type scimBulkResult struct {
+	Method   string          `json:"method"`
+	BulkID   string          `json:"bulkId,omitempty"`
+	Location string          `json:"location,omitempty"`
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// ScimBulkHandler runs the operations of a bulk request one after another,
+// each as if it were a request of its own. Later operations can refer to
+// resources created earlier by "bulkId:<bulkId>". Processing stops once
+// failOnErrors operations have failed.
+func (app *application) ScimBulkHandler(w http.ResponseWriter, r *http.Request) {
+	var req scimBulkRequest
+	if err := readSCIM(w, r, &req); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	if len(req.Operations) > scimMaxBulkOperations {
+		app.scimErrorResponse(w, r, newScimError(http.StatusRequestEntityTooLarge, "",
+			fmt.Sprintf("a bulk request can have at most %d operations", scimMaxBulkOperations)))
+		return
+	}
+
+	created := map[string]string{}
+	results := []scimBulkResult{}
+	failures := 0
+	for _, op := range req.Operations {
+		result := app.runScimBulkOperation(r, op, created)
+		results = append(results, result)
+		if atoiStatus(result.Status) >= http.StatusBadRequest {
+			failures++
+			if req.FailOnErrors > 0 && failures >= req.FailOnErrors {
+				break
+			}
+		}
+	}
+
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":    []string{scimSchemaBulkResponse},
+		"Operations": results,
+	})
+}
+
+func (app *application) runScimBulkOperation(r *http.Request, op scimBulkOperation, created map[string]string) scimBulkResult {
+	method := strings.ToUpper(op.Method)
+	result := scimBulkResult{Method: method, BulkID: op.BulkID}
+	fail := func(se *scimError) scimBulkResult {
+		result.Status = se.Status
+		result.Response, _ = json.Marshal(se)
+		return result
+	}
+
+	data := op.Data
+	for bulkID, id := range created {
+		data = bytes.ReplaceAll(data, []byte(`"bulkId:`+bulkID+`"`), []byte(`"`+id+`"`))
+	}
+	if bytes.Contains(data, []byte(`"bulkId:`)) {
+		return fail(newScimError(http.StatusConflict, "invalidValue", "the operation refers to a bulkId that has not been created"))
+	}
+
+	path := op.Path
+	if bulkID, ok := strings.CutPrefix(path[strings.LastIndexByte(path, '/')+1:], "bulkId:"); ok {
+		id, ok := created[bulkID]
+		if !ok {
+			return fail(newScimError(http.StatusConflict, "invalidValue", "the operation refers to a bulkId that has not been created"))
+		}
+		path = path[:strings.LastIndexByte(path, '/')+1] + id
+	}
+	handler, id, ok := app.scimBulkRoute(method, path)
+	if !ok {
+		return fail(newScimError(http.StatusBadRequest, "invalidPath", method+" "+op.Path+" is not supported in a bulk request"))
+	}
+	if method == http.MethodPost && op.BulkID == "" {
+		return fail(newScimError(http.StatusBadRequest, "invalidValue", "POST operations need a bulkId"))
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), method, "/scim/v2"+path, bytes.NewReader(data))
+	if err != nil {
+		return fail(newScimError(http.StatusBadRequest, "invalidPath", err.Error()))
+	}
+	req.Host, req.TLS, req.Header = r.Host, r.TLS, r.Header.Clone()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rec := &scimBulkWriter{header: http.Header{}}
+	handler(rec, req)
+
+	result.Status = strconv.Itoa(rec.status)
+	if rec.status >= http.StatusBadRequest {
+		result.Response = json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+		return result
+	}
+	var res struct {
+		ID   string    `json:"id"`
+		Meta *scimMeta `json:"meta"`
+	}
+	if json.Unmarshal(rec.body.Bytes(), &res) == nil && res.Meta != nil {
+		result.Location = res.Meta.Location
+		if method == http.MethodPost {
+			created[op.BulkID] = res.ID
+		}
+	}
+	return result
+}
+
+// scimBulkRoute finds the handler for one bulk operation and the id in its
+// path.
+func (app *application) scimBulkRoute(method, path string) (http.HandlerFunc, string, bool) {
+	resource, id, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	routes := map[string]map[string]http.HandlerFunc{
+		"Users": {
+			http.MethodPost:   app.ScimCreateUserHandler,
+			http.MethodPut:    app.ScimReplaceUserHandler,
+			http.MethodPatch:  app.ScimPatchUserHandler,
+			http.MethodDelete: app.ScimDeleteUserHandler,
+		},
+		"Groups": {
+			http.MethodPost:   app.ScimCreateGroupHandler,
+			http.MethodPut:    app.ScimReplaceGroupHandler,
+			http.MethodPatch:  app.ScimPatchGroupHandler,
+			http.MethodDelete: app.ScimDeleteGroupHandler,
+		},
+	}
+	handler, ok := routes[resource][method]
+	if !ok || (method == http.MethodPost) != (id == "") || strings.Contains(id, "/") {
+		return nil, "", false
+	}
+	return handler, id, true
+}
+
+// scimBulkWriter captures the response of one bulk operation.
+type scimBulkWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *scimBulkWriter) Header() http.Header { return w.header }
+
+func (w *scimBulkWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *scimBulkWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// readScimID parses the {id} of a SCIM resource path. Unknown ids are not
+// found rather than invalid, as SCIM clients expect.
+func readScimID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return uuid.Nil, newScimError(http.StatusNotFound, "", "resource "+chi.URLParam(r, "id")+" not found")
+	}
+	return id, nil
+}
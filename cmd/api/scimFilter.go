@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// scimFilter is a parsed SCIM filter (RFC 7644 section 3.4.2.2). Filters are
+// matched against resources decoded into maps, so users and groups share one
+// implementation.
+type scimFilter interface {
+	match(res map[string]any) bool
+}
+
+type scimAnd struct{ left, right scimFilter }
+
+func (f scimAnd) match(res map[string]any) bool { return f.left.match(res) && f.right.match(res) }
+
+type scimOr struct{ left, right scimFilter }
+
+func (f scimOr) match(res map[string]any) bool { return f.left.match(res) || f.right.match(res) }
+
+type scimNot struct{ inner scimFilter }
+
+func (f scimNot) match(res map[string]any) bool { return !f.inner.match(res) }
+
+// scimCompare is `attr op value`, or `attr pr` when op is "pr".
+type scimCompare struct {
+	path  scimAttrPath
+	op    string
+	value any
+}
+
+func (f scimCompare) match(res map[string]any) bool {
+	values := f.path.values(res)
+	switch f.op {
+	case "pr":
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	case "ne":
+		return !scimCompare{path: f.path, op: "eq", value: f.value}.match(res)
+	case "eq":
+		if f.value == nil {
+			return len(values) == 0
+		}
+	}
+	for _, v := range values {
+		if scimCompareValue(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimValuePath is `attr[filter]`: some value of the multi-valued attribute
+// matches filter.
+type scimValuePath struct {
+	attr   string
+	filter scimFilter
+}
+
+func (f scimValuePath) match(res map[string]any) bool {
+	for _, elem := range scimElements(res, f.attr) {
+		if m, ok := elem.(map[string]any); ok && f.filter.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimAttrPath names an attribute and optionally one of its sub-attributes,
+// such as name.givenName or emails.value.
+type scimAttrPath struct {
+	attr string
+	sub  string
+}
+
+// values returns the values the path refers to. Paths into multi-valued
+// attributes yield one value per element, and a multi-valued complex
+// attribute without a sub-attribute stands for its values.
+func (p scimAttrPath) values(res map[string]any) []any {
+	raw, ok := scimLookup(res, p.attr)
+	if !ok || raw == nil {
+		return nil
+	}
+
+	elems, multi := raw.([]any)
+	if !multi {
+		elems = []any{raw}
+	}
+	values := []any{}
+	for _, elem := range elems {
+		m, complex := elem.(map[string]any)
+		switch {
+		case p.sub != "" && complex:
+			if v, ok := scimLookup(m, p.sub); ok && v != nil {
+				values = append(values, v)
+			}
+		case p.sub == "" && complex && multi:
+			if v, ok := scimLookup(m, "value"); ok && v != nil {
+				values = append(values, v)
+			}
+		case p.sub == "":
+			values = append(values, elem)
+		}
+	}
+	return values
+}
+
+// scimLookup finds the attribute name in m. Attribute names are case
+// insensitive.
+func scimLookup(m map[string]any, name string) (any, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for key, v := range m {
+		if strings.EqualFold(key, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// scimKey returns the key m stores the attribute name under, or name when m
+// does not have it yet.
+func scimKey(m map[string]any, name string) string {
+	if _, ok := m[name]; ok {
+		return name
+	}
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+// scimElements returns the values of a multi-valued attribute.
+func scimElements(res map[string]any, attr string) []any {
+	raw, _ := scimLookup(res, attr)
+	switch v := raw.(type) {
+	case []any:
+		return v
+	case nil:
+		return nil
+	default:
+		return []any{v}
+	}
+}
+
+// scimCompareValue applies a comparison operator. Strings compare case
+// insensitively, and timestamps by time.
+func scimCompareValue(v any, op string, want any) bool {
+	switch want := want.(type) {
+	case string:
+		got, ok := v.(string)
+		if !ok {
+			return false
+		}
+		if tg, err := time.Parse(time.RFC3339Nano, got); err == nil {
+			if tw, err := time.Parse(time.RFC3339Nano, want); err == nil {
+				return scimOrdered(op, tg.Compare(tw))
+			}
+		}
+		got, want = strings.ToLower(got), strings.ToLower(want)
+		switch op {
+		case "co":
+			return strings.Contains(got, want)
+		case "sw":
+			return strings.HasPrefix(got, want)
+		case "ew":
+			return strings.HasSuffix(got, want)
+		}
+		return scimOrdered(op, strings.Compare(got, want))
+	case float64:
+		got, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case got < want:
+			return scimOrdered(op, -1)
+		case got > want:
+			return scimOrdered(op, 1)
+		}
+		return scimOrdered(op, 0)
+	case bool:
+		got, ok := v.(bool)
+		return ok && op == "eq" && got == want
+	}
+	return false
+}
+
+func scimOrdered(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "gt":
+		return c > 0
+	case "ge":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "le":
+		return c <= 0
+	}
+	return false
+}
+
+var scimCompareOps = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le"}
+
+// parseScimFilter parses a filter. schema is the core schema of the resource
+// type, which may prefix attribute names.
+func parseScimFilter(input, schema string) (scimFilter, error) {
+	tokens, err := scimTokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens, schema: schema}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in filter", p.peek().text)
+	}
+	return f, nil
+}
+
+type scimToken struct {
+	text string
+	// quoted is set for string literals.
+	quoted bool
+}
+
+func scimTokenize(input string) ([]scimToken, error) {
+	tokens := []scimToken{}
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("()[]", c) >= 0:
+			tokens = append(tokens, scimToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			s, err := strconv.Unquote(input[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s in filter", input[i:end+1])
+			}
+			tokens = append(tokens, scimToken{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !unicode.IsSpace(rune(input[end])) && strings.IndexByte("()[]\"", input[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, scimToken{text: input[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+	schema string
+}
+
+func (p *scimFilterParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *scimFilterParser) peek() scimToken {
+	if p.done() {
+		return scimToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+// keyword consumes the next token if it is the unquoted keyword word.
+func (p *scimFilterParser) keyword(word string) bool {
+	if t := p.peek(); !p.done() && !t.quoted && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scimFilterParser) expect(text string) error {
+	if !p.keyword(text) {
+		if p.done() {
+			return fmt.Errorf("expected %q at the end of the filter", text)
+		}
+		return fmt.Errorf("expected %q in filter, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scimOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = scimAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseNot() (scimFilter, error) {
+	if !p.keyword("not") {
+		return p.parseAtom()
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return scimNot{inner}, p.expect(")")
+}
+
+func (p *scimFilterParser) parseAtom() (scimFilter, error) {
+	if p.keyword("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	if p.done() {
+		return nil, fmt.Errorf("filter ends unexpectedly")
+	}
+	t := p.tokens[p.pos]
+	if t.quoted {
+		return nil, fmt.Errorf("expected an attribute in filter, got %q", t.text)
+	}
+	p.pos++
+	path, err := parseScimAttrPath(t.text, p.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.keyword("[") {
+		if path.sub != "" {
+			return nil, fmt.Errorf("invalid attribute %q in filter", t.text)
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return scimValuePath{attr: path.attr, filter: inner}, p.expect("]")
+	}
+
+	if p.keyword("pr") {
+		return scimCompare{path: path, op: "pr"}, nil
+	}
+	op := strings.ToLower(p.peek().text)
+	if p.done() || p.peek().quoted || !slices.Contains(scimCompareOps, op) {
+		return nil, fmt.Errorf("expected an operator after %q in filter", t.text)
+	}
+	p.pos++
+
+	if p.done() {
+		return nil, fmt.Errorf("expected a value after %q in filter", op)
+	}
+	v := p.tokens[p.pos]
+	p.pos++
+	value, err := scimFilterValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return scimCompare{path: path, op: op, value: value}, nil
+}
+
+func scimFilterValue(t scimToken) (any, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q in filter", t.text)
+	}
+	return n, nil
+}
+
+// parseScimAttrPath splits an attribute path such as name.givenName, with or
+// without the schema URN in front.
+func parseScimAttrPath(text, schema string) (scimAttrPath, error) {
+	if len(text) > len(schema) && strings.EqualFold(text[:len(schema)+1], schema+":") {
+		text = text[len(schema)+1:]
+	}
+	attr, sub, _ := strings.Cut(text, ".")
+	if attr == "" || strings.Contains(sub, ".") || strings.Contains(attr, ":") {
+		return scimAttrPath{}, fmt.Errorf("invalid attribute %q", text)
+	}
+	return scimAttrPath{attr: attr, sub: sub}, nil
+}
+
+// scimPatchPath is the target of a PATCH operation: an attribute path, or a
+// value path selecting values of a multi-valued attribute and optionally one
+// of their sub-attributes, such as members[value eq "id"].
+type scimPatchPath struct {
+	scimAttrPath
+	filter scimFilter
+}
+
+func parseScimPatchPath(text, schema string) (scimPatchPath, error) {
+	open := strings.IndexByte(text, '[')
+	if open < 0 {
+		path, err := parseScimAttrPath(text, schema)
+		return scimPatchPath{scimAttrPath: path}, err
+	}
+
+	end := strings.LastIndexByte(text, ']')
+	if end < open {
+		return scimPatchPath{}, fmt.Errorf("invalid path %q", text)
+	}
+	path, err := parseScimAttrPath(text[:open], schema)
+	if err != nil || path.sub != "" {
+		return scimPatchPath{}, fmt.Errorf("invalid path %q", text)
+	}
+	filter, err := parseScimFilter(text[open+1:end], schema)
+	if err != nil {
+		return scimPatchPath{}, err
+	}
+	if rest := text[end+1:]; rest != "" {
+		sub, ok := strings.CutPrefix(rest, ".")
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return scimPatchPath{}, fmt.Errorf("invalid path %q", text)
+		}
+		path.sub = sub
+	}
+	return scimPatchPath{scimAttrPath: path, filter: filter}, nil
+}
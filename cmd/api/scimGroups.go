@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+// scimGroup is a group of the organization as a SCIM Group. Its members are
+// users; nested groups are managed through the admin API only.
+type scimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []scimMultiValue `json:"members"`
+	Meta        *scimMeta        `json:"meta,omitempty"`
+}
+
+func toScimGroup(r *http.Request, group *models.Group, members []models.User) scimGroup {
+	base := scimBaseURL(r)
+	res := scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		ID:          group.ID.String(),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.Name,
+		Members:     []scimMultiValue{},
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     base + "/Groups/" + group.ID.String(),
+		},
+	}
+	for _, member := range members {
+		res.Members = append(res.Members, scimMultiValue{
+			Value:   member.ID.String(),
+			Display: member.Name,
+			Ref:     base + "/Users/" + member.ID.String(),
+		})
+	}
+	return res
+}
+
+func (app *application) ScimListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	client := scimClientFromContext(ctx)
+
+	groups, err := app.store.Group.ListGroups(ctx, client.org.ID)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	// identity providers often look groups up by name only, so members are
+	// skipped when they ask for that
+	withMembers := !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+	res := make([]scimGroup, 0, len(groups))
+	for i := range groups {
+		var members []models.User
+		if withMembers {
+			if members, err = app.store.Group.ListMembers(ctx, groups[i].ID); err != nil {
+				app.scimErrorResponse(w, r, err)
+				return
+			}
+		}
+		res = append(res, toScimGroup(r, &groups[i], members))
+	}
+
+	page, err := scimListPage(r, res, scimSchemaGroup)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, page)
+}
+
+func (app *application) ScimGetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, members, err := app.loadScimGroup(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, toScimGroup(r, group, members))
+}
+
+func (app *application) ScimCreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	client := scimClientFromContext(ctx)
+
+	var payload scimGroup
+	if err := readSCIM(w, r, &payload); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	if strings.TrimSpace(payload.DisplayName) == "" {
+		app.scimErrorResponse(w, r, newScimError(http.StatusBadRequest, "invalidValue", "displayName is required"))
+		return
+	}
+
+	group := &models.Group{
+		ID:             uuid.New(),
+		OrganizationID: client.org.ID,
+		Name:           payload.DisplayName,
+		ExternalID:     payload.ExternalID,
+	}
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Group.CreateGroup(ctx, group); err != nil {
+			return err
+		}
+		return app.applyScimGroup(ctx, tx, group, nil, payload)
+	})
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeScimGroup(w, r, http.StatusCreated, group.ID)
+}
+
+// ScimReplaceGroupHandler makes the group match the one sent, members
+// included.
+func (app *application) ScimReplaceGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	group, members, err := app.loadScimGroup(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	var payload scimGroup
+	if err := readSCIM(w, r, &payload); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		return app.applyScimGroup(ctx, tx, group, members, payload)
+	})
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeScimGroup(w, r, http.StatusOK, group.ID)
+}
+
+func (app *application) ScimPatchGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	group, members, err := app.loadScimGroup(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	var req scimPatchRequest
+	if err := readSCIM(w, r, &req); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	var patched scimGroup
+	if err := applyScimPatch(toScimGroup(r, group, members), req, scimSchemaGroup, &patched); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		return app.applyScimGroup(ctx, tx, group, members, patched)
+	})
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeScimGroup(w, r, http.StatusOK, group.ID)
+}
+
+// ScimDeleteGroupHandler deletes the group the way DeleteGroupHandler does.
+func (app *application) ScimDeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, _, err := app.loadScimGroup(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Group.DeleteGroup(r.Context(), group.ID); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyScimGroup stores the changes desired makes to group, whose members are
+// current. Only members of the organization can join, and joining is refused
+// when the group's roles would conflict with theirs. Call it inside the
+// transaction that makes the change.
+func (app *application) applyScimGroup(
+	ctx context.Context,
+	tx store.TxStorage,
+	group *models.Group,
+	current []models.User,
+	desired scimGroup,
+) error {
+	updates := map[string]interface{}{}
+	if desired.DisplayName == "" {
+		return newScimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	if desired.DisplayName != group.Name {
+		updates["name"] = desired.DisplayName
+	}
+	if desired.ExternalID != group.ExternalID {
+		updates["external_id"] = desired.ExternalID
+	}
+	if len(updates) > 0 {
+		if err := tx.Group.UpdateGroup(ctx, group.ID, updates); err != nil {
+			return err
+		}
+	}
+
+	wanted := map[uuid.UUID]bool{}
+	for _, member := range desired.Members {
+		id, err := uuid.Parse(member.Value)
+		if err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "member "+member.Value+" is not a user id")
+		}
+		wanted[id] = true
+	}
+
+	for _, user := range current {
+		if wanted[user.ID] {
+			delete(wanted, user.ID)
+			continue
+		}
+		if err := tx.Group.RemoveMember(ctx, group.ID, user.ID); err != nil {
+			return err
+		}
+	}
+	for id := range wanted {
+		if _, err := tx.Membership.GetMembership(ctx, id, group.OrganizationID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return newScimError(http.StatusBadRequest, "invalidValue", "user "+id.String()+" is not a member of the organization")
+			}
+			return err
+		}
+		if err := tx.Group.AddMember(ctx, &models.GroupMember{GroupID: group.ID, UserID: id}); err != nil {
+			return err
+		}
+		if err := checkStaticSoD(ctx, tx, userPrincipal(id, group.OrganizationID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadScimGroup resolves the group given by {id} within the organization of
+// the SCIM token, along with its members.
+func (app *application) loadScimGroup(r *http.Request) (*models.Group, []models.User, error) {
+	ctx := r.Context()
+
+	id, err := readScimID(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := app.store.Group.GetGroup(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group.OrganizationID != scimClientFromContext(ctx).org.ID {
+		return nil, nil, store.ErrGroupNotFound
+	}
+	members, err := app.store.Group.ListMembers(ctx, group.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return group, members, nil
+}
+
+func (app *application) writeScimGroup(w http.ResponseWriter, r *http.Request, status int, id uuid.UUID) {
+	group, err := app.store.Group.GetGroup(r.Context(), id)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	members, err := app.store.Group.ListMembers(r.Context(), id)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	res := toScimGroup(r, group, members)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", res.Meta.Location)
+	}
+	writeSCIM(w, status, res)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// scimUser is a member of the organization as a SCIM User. The SCIM id is
+// the account id, userName is the email, and active is whether the
+// membership is active: deactivating a user suspends their membership.
+type scimUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *scimName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Active      *scimBool        `json:"active,omitempty"`
+	Emails      []scimMultiValue `json:"emails,omitempty"`
+	Roles       []scimMultiValue `json:"roles,omitempty"`
+	Meta        *scimMeta        `json:"meta,omitempty"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+func toScimUser(r *http.Request, user *models.User, membership *models.Membership) scimUser {
+	active := scimBool(membership.Status == helpers.StatusActive)
+	lastModified := membership.UpdatedAt
+	if user.UpdatedAt.After(lastModified) {
+		lastModified = user.UpdatedAt
+	}
+	return scimUser{
+		Schemas:     []string{scimSchemaUser},
+		ID:          user.ID.String(),
+		ExternalID:  membership.ExternalID,
+		UserName:    user.Email,
+		Name:        &scimName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Active:      &active,
+		Emails:      []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Roles:       []scimMultiValue{{Value: membership.Role, Primary: true}},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      membership.CreatedAt,
+			LastModified: lastModified,
+			Location:     scimBaseURL(r) + "/Users/" + user.ID.String(),
+		},
+	}
+}
+
+// displayName picks the name identity providers sent, preferring the
+// attribute that differs from current so PATCHing any one of them renames
+// the user. It returns current when none does.
+func (u scimUser) displayName(current string) string {
+	candidates := []string{u.DisplayName}
+	if u.Name != nil {
+		candidates = append(candidates, u.Name.Formatted, strings.TrimSpace(u.Name.GivenName+" "+u.Name.FamilyName))
+	}
+	for _, name := range candidates {
+		if name != "" && name != current {
+			return name
+		}
+	}
+	return current
+}
+
+// role is the primary role sent, or the first one. Only one role is kept per
+// membership.
+func (u scimUser) role() (string, error) {
+	if len(u.Roles) == 0 {
+		return "", nil
+	}
+	role := u.Roles[0].Value
+	for _, r := range u.Roles {
+		if r.Primary {
+			role = r.Value
+			break
+		}
+	}
+	if !slices.Contains(MemberRoles, role) {
+		return "", newScimError(http.StatusBadRequest, "invalidValue", "role must be one of ["+strings.Join(MemberRoles, " ")+"]")
+	}
+	return role, nil
+}
+
+func (u scimUser) status() string {
+	if u.Active != nil && !bool(*u.Active) {
+		return helpers.StatusSuspended
+	}
+	return helpers.StatusActive
+}
+
+func (app *application) ScimListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	client := scimClientFromContext(r.Context())
+
+	members, err := app.store.Membership.ListOrganizationMembers(r.Context(), client.org.ID)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	users := make([]scimUser, 0, len(members))
+	for _, member := range members {
+		users = append(users, toScimUser(r, &member.User, &member.Membership))
+	}
+
+	page, err := scimListPage(r, users, scimSchemaUser)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, page)
+}
+
+func (app *application) ScimGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	member, err := app.loadScimMember(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, toScimUser(r, member.User, member.Membership))
+}
+
+// ScimCreateUserHandler provisions a user into the organization. A new
+// account is invited as CreateUserHandler does and stays pending until the
+// user activates it; an existing account just joins the organization.
+func (app *application) ScimCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	client := scimClientFromContext(ctx)
+
+	var payload scimUser
+	if err := readSCIM(w, r, &payload); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(payload.UserName))
+	if err := Validate.Var(email, "required,email"); err != nil {
+		app.scimErrorResponse(w, r, newScimError(http.StatusBadRequest, "invalidValue", "userName must be an email address"))
+		return
+	}
+	role, err := payload.role()
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	if role == "" {
+		role = RoleUser
+	}
+
+	membership := &models.Membership{
+		ID:             uuid.New(),
+		OrganizationID: client.org.ID,
+		Role:           role,
+		Status:         payload.status(),
+		ExternalID:     payload.ExternalID,
+	}
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		existing, err := tx.User.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil:
+			if _, err := tx.Membership.GetMembership(ctx, existing.ID, client.org.ID); err == nil {
+				return newScimError(http.StatusConflict, "uniqueness", "a user with this userName already exists")
+			} else if !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			membership.UserID = existing.ID
+			if err := tx.Membership.CreateMembership(ctx, membership); err != nil {
+				return err
+			}
+			if err := app.publishWebhook(ctx, tx, client.org, models.WebhookEventUserInvited, webhookUser{
+				UserID: existing.ID, Email: existing.Email, Role: membership.Role, Status: existing.Status,
+			}); err != nil {
+				return err
+			}
+		case errors.Is(err, store.ErrNotFound):
+			user := &models.User{
+				ID:     uuid.New(),
+				Name:   payload.displayName(""),
+				Email:  email,
+				Role:   RoleUser,
+				Status: helpers.StatusPending,
+			}
+			if user.Name == "" {
+				user.Name = email
+			}
+			membership.UserID = user.ID
+			if err := app.inviteUser(ctx, tx, client.org, user, membership); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		return checkStaticSoD(ctx, tx, userPrincipal(membership.UserID, client.org.ID))
+	})
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	member, err := app.scimMember(ctx, client.org, membership.UserID)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	res := toScimUser(r, member.User, member.Membership)
+	w.Header().Set("Location", res.Meta.Location)
+	writeSCIM(w, http.StatusCreated, res)
+}
+
+// ScimReplaceUserHandler makes the user match the one sent. Attributes left
+// out keep their value, except externalId.
+func (app *application) ScimReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	member, err := app.loadScimMember(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	var payload scimUser
+	if err := readSCIM(w, r, &payload); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	app.applyScimUser(w, r, member, payload)
+}
+
+func (app *application) ScimPatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	member, err := app.loadScimMember(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	var req scimPatchRequest
+	if err := readSCIM(w, r, &req); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	var patched scimUser
+	if err := applyScimPatch(toScimUser(r, member.User, member.Membership), req, scimSchemaUser, &patched); err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	app.applyScimUser(w, r, member, patched)
+}
+
+// applyScimUser stores the changes desired makes to the member and answers
+// with the result. The email is the account's login, shared with the other
+// organizations the user belongs to, so it cannot be changed. The name is
+// shared too: it only follows the identity provider while this organization
+// is the user's only one.
+func (app *application) applyScimUser(w http.ResponseWriter, r *http.Request, member *memberResponse, desired scimUser) {
+	if desired.UserName != "" && !strings.EqualFold(strings.TrimSpace(desired.UserName), member.Email) {
+		app.scimErrorResponse(w, r, newScimError(http.StatusBadRequest, "mutability", "userName cannot be changed"))
+		return
+	}
+
+	userUpdates := map[string]interface{}{}
+	if name := desired.displayName(member.Name); name != member.Name {
+		memberships, err := app.store.Membership.ListUserMemberships(r.Context(), member.ID)
+		if err != nil {
+			app.scimErrorResponse(w, r, err)
+			return
+		}
+		if len(memberships) == 1 {
+			userUpdates["name"] = name
+		}
+	}
+	membershipUpdates := map[string]interface{}{}
+	if desired.ExternalID != member.Membership.ExternalID {
+		membershipUpdates["external_id"] = desired.ExternalID
+	}
+	role, err := desired.role()
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+	if role != "" && role != member.Membership.Role {
+		membershipUpdates["role"] = role
+	}
+	if desired.Active != nil && desired.status() != member.Membership.Status {
+		membershipUpdates["status"] = desired.status()
+	}
+
+	if len(userUpdates) > 0 || len(membershipUpdates) > 0 {
+		member, err = app.updateMember(r, member, userUpdates, membershipUpdates)
+		if err != nil {
+			app.scimErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	writeSCIM(w, http.StatusOK, toScimUser(r, member.User, member.Membership))
+}
+
+// ScimDeleteUserHandler takes the user out of the organization the way
+// RemoveMemberHandler does, deleting them when it was their last one.
+func (app *application) ScimDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	member, err := app.loadScimMember(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		memberships, err := tx.Membership.ListUserMemberships(ctx, member.ID)
+		if err != nil {
+			return err
+		}
+		if len(memberships) == 1 {
+			return tx.User.DeleteUser(ctx, member.ID)
+		}
+		return tx.Membership.DeleteMembership(ctx, member.Membership.ID)
+	})
+	if err != nil {
+		app.logger.Error("error removing SCIM user", zap.String("id", member.ID.String()), zap.Error(err))
+		app.scimErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadScimMember resolves the user given by {id} within the organization of
+// the SCIM token.
+func (app *application) loadScimMember(r *http.Request) (*memberResponse, error) {
+	id, err := readScimID(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.scimMember(r.Context(), scimClientFromContext(r.Context()).org, id)
+}
+
+func (app *application) scimMember(ctx context.Context, org *models.Organization, id uuid.UUID) (*memberResponse, error) {
+	user, err := app.store.User.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := app.store.Membership.GetMembership(ctx, id, org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &memberResponse{User: user, Membership: membership}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// setUpSCIM returns an application serving on srv, an organization, and the
+// SCIM token its identity provider provisions it with.
+func setUpSCIM(t *testing.T) (*application, *httptest.Server, *models.Organization, string) {
+	t.Helper()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	token := rand.Text()
+	if err := app.store.Scim.CreateToken(context.Background(), &models.ScimToken{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		TokenHash:      HashToken(token),
+		CreatedBy:      owner.ID,
+		CreatedAt:      time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return app, srv, org, token
+}
+
+// doSCIM sends body to the SCIM API with token and decodes the answer into
+// out, unless it is nil.
+func doSCIM(t *testing.T, srv *httptest.Server, method, path, token string, body, out any) int {
+	t.Helper()
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, srv.URL+"/scim/v2"+path, bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", scimContentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+// A user in several organizations keeps their name when one organization's
+// identity provider renames them; their membership still follows it.
+func TestScimReplaceUserName(t *testing.T) {
+	app, srv, org, token := setUpSCIM(t)
+	ctx := context.Background()
+	member := seedMember(t, app, org, "ada@example.com", RoleUser)
+
+	replace := func(name, externalID string) scimUser {
+		t.Helper()
+		var res scimUser
+		status := doSCIM(t, srv, http.MethodPut, "/Users/"+member.ID.String(), token, map[string]any{
+			"schemas":     []string{scimSchemaUser},
+			"userName":    member.Email,
+			"displayName": name,
+			"externalId":  externalID,
+		}, &res)
+		if status != http.StatusOK {
+			t.Fatalf("replacing the user answered %d", status)
+		}
+		return res
+	}
+
+	if res := replace("Ada Lovelace", "ada-1"); res.Name == nil || res.Name.Formatted != "Ada Lovelace" {
+		t.Errorf("the only organization of the user did not rename them: %+v", res.Name)
+	}
+
+	other := seedOrganization(t, app, seedAdmin(t, app, RoleAdmin))
+	if err := app.store.Membership.CreateMembership(ctx, &models.Membership{
+		ID:             uuid.New(),
+		UserID:         member.ID,
+		OrganizationID: other.ID,
+		Role:           RoleUser,
+		Status:         helpers.StatusActive,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := replace("Somebody Else", "ada-2")
+	if res.ExternalID != "ada-2" {
+		t.Errorf("the membership kept external id %q", res.ExternalID)
+	}
+	user, err := app.store.User.GetUser(ctx, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Ada Lovelace" {
+		t.Errorf("one of the user's organizations renamed them to %q", user.Name)
+	}
+}
+
+func TestScimServiceProviderConfig(t *testing.T) {
+	_, srv, _, token := setUpSCIM(t)
+
+	var config struct {
+		Bulk struct {
+			MaxPayloadSize int `json:"maxPayloadSize"`
+		} `json:"bulk"`
+	}
+	if status := doSCIM(t, srv, http.MethodGet, "/ServiceProviderConfig", token, nil, &config); status != http.StatusOK {
+		t.Fatalf("the configuration answered %d", status)
+	}
+	if config.Bulk.MaxPayloadSize != scimMaxPayloadSize {
+		t.Errorf("advertised a payload size of %d, want %d", config.Bulk.MaxPayloadSize, scimMaxPayloadSize)
+	}
+}
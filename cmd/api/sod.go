@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+)
+
+var errSoDViolation = errors.New("separation of duties violation")
+
+func sodViolation(rule SoDRule) error {
+	return fmt.Errorf("%w: %s (%s)", errSoDViolation, rule.Reason, rule.Name)
+}
+
+// sodPrincipal is who a separation-of-duties rule applies to. Admins are
+// principals on their own; users once per organization they belong to.
+type sodPrincipal struct {
+	AccountType    string     `json:"accountType"`
+	AccountID      uuid.UUID  `json:"accountId"`
+	OrganizationID *uuid.UUID `json:"organizationId,omitempty"`
+}
+
+const (
+	sodSourceAdmin      = "admin"
+	sodSourceMembership = "membership"
+	sodSourceGroup      = "group"
+	sodSourceGrant      = "grant"
+)
+
+// sodHolding is one way a principal holds a role. Active holdings are in
+// effect right now; eligible and scheduled grants are held but not active.
+type sodHolding struct {
+	Role     string     `json:"role"`
+	Source   string     `json:"source"`
+	SourceID *uuid.UUID `json:"sourceId,omitempty"`
+	Kind     string     `json:"kind,omitempty"`
+	Active   bool       `json:"active"`
+}
+
+type sodViolationResponse struct {
+	sodPrincipal
+	Rule     SoDRule      `json:"rule"`
+	Holdings []sodHolding `json:"holdings"`
+}
+
+// breaksRule reports the first rule, static or dynamic, that holding role
+// next to roles would break.
+func breaksRule(roles []string, role string) (SoDRule, bool) {
+	for _, rule := range SoDRules {
+		for i, side := range rule.Roles {
+			other := rule.Roles[1-i]
+			if side == role && other != role && slices.Contains(roles, other) {
+				return rule, true
+			}
+		}
+	}
+	return SoDRule{}, false
+}
+
+// brokenRules returns the rules of the given kind that roles break.
+func brokenRules(roles []string, dynamic bool) []SoDRule {
+	broken := []SoDRule{}
+	for _, rule := range SoDRules {
+		if rule.Dynamic == dynamic && slices.Contains(roles, rule.Roles[0]) && slices.Contains(roles, rule.Roles[1]) {
+			broken = append(broken, rule)
+		}
+	}
+	return broken
+}
+
+// principalHoldings lists every role the principal holds at at: an admin's
+// own role, a user's membership and group roles, and the grants that have
+// not ended yet.
+func principalHoldings(ctx context.Context, tx store.TxStorage, p sodPrincipal, at time.Time) ([]sodHolding, error) {
+	holdings := []sodHolding{}
+
+	if p.AccountType == models.GrantAccountAdmin {
+		admin, err := tx.Admin.GetAdmin(ctx, p.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, sodHolding{Role: admin.Role, Source: sodSourceAdmin, SourceID: &admin.ID, Active: true})
+	} else {
+		membership, err := tx.Membership.GetMembership(ctx, p.AccountID, *p.OrganizationID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		if membership != nil {
+			holdings = append(holdings, sodHolding{
+				Role: membership.Role, Source: sodSourceMembership, SourceID: &membership.ID, Active: true,
+			})
+		}
+		groupRoles, err := tx.Group.UserRoles(ctx, p.AccountID, *p.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range groupRoles {
+			holdings = append(holdings, sodHolding{Role: role, Source: sodSourceGroup, Active: true})
+		}
+	}
+
+	grants, err := tx.Grant.ListGrants(ctx, store.GrantFilter{AccountID: p.AccountID})
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		if grant.Role == "" || grant.AccountType != p.AccountType {
+			continue
+		}
+		if (grant.OrganizationID == nil) != (p.OrganizationID == nil) ||
+			(grant.OrganizationID != nil && *grant.OrganizationID != *p.OrganizationID) {
+			continue
+		}
+		status := store.GrantStatus(grant, at)
+		if status != models.GrantStatusActive && status != models.GrantStatusScheduled {
+			continue
+		}
+		holdings = append(holdings, sodHolding{
+			Role:     grant.Role,
+			Source:   sodSourceGrant,
+			SourceID: &grant.ID,
+			Kind:     grant.Kind,
+			Active:   status == models.GrantStatusActive && grant.Kind != models.GrantKindEligible,
+		})
+	}
+	return holdings, nil
+}
+
+func holdingRoles(holdings []sodHolding, activeOnly bool) []string {
+	roles := []string{}
+	for _, holding := range holdings {
+		if (holding.Active || !activeOnly) && !slices.Contains(roles, holding.Role) {
+			roles = append(roles, holding.Role)
+		}
+	}
+	return roles
+}
+
+// checkStaticSoD fails with errSoDViolation when the principal's roles break
+// a static rule. Callers assign the role inside tx first and check after, so
+// that a violation rolls the assignment back.
+func checkStaticSoD(ctx context.Context, tx store.TxStorage, p sodPrincipal) error {
+	holdings, err := principalHoldings(ctx, tx, p, time.Now())
+	if err != nil {
+		return err
+	}
+	if broken := brokenRules(holdingRoles(holdings, false), false); len(broken) > 0 {
+		return sodViolation(broken[0])
+	}
+	return nil
+}
+
+func userPrincipal(userID, orgID uuid.UUID) sodPrincipal {
+	return sodPrincipal{AccountType: models.GrantAccountUser, AccountID: userID, OrganizationID: &orgID}
+}
+
+// enforceSessionSoD drops the group and grant roles of a session that would
+// break a rule next to the roles already in effect. The base role always
+// stays, and group roles win over grants, so the shorter-lived access is the
+// one given up. Assignments are checked against static rules already; this
+// catches dynamic rules and anything assigned before a rule existed.
+func (app *application) enforceSessionSoD(claims *UserClaims) {
+	active := []string{claims.Role}
+	keep := func(roles []string) []string {
+		var kept []string
+		for _, role := range roles {
+			if rule, broken := breaksRule(active, role); broken {
+				app.logger.Warnw("role dropped from session by separation of duties",
+					"account", claims.UserID, "organization", claims.OrgID, "role", role, "rule", rule.Name)
+				continue
+			}
+			active = append(active, role)
+			kept = append(kept, role)
+		}
+		return kept
+	}
+	claims.GroupRoles = keep(claims.GroupRoles)
+	claims.GrantRoles = keep(claims.GrantRoles)
+}
+
+func (app *application) ListSoDRulesHandler(w http.ResponseWriter, r *http.Request) {
+	app.jsonResponse(w, http.StatusOK, SoDRules, "separation of duties rules")
+}
+
+// ListSoDViolationsHandler reports the principals whose roles break a rule
+// right now: any static rule over everything they hold, and dynamic rules
+// over what is active at once. ?organizationId= narrows it to the members of
+// one organization, which its admins and auditors can see; the full report
+// is for super admins.
+func (app *application) ListSoDViolationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermLogsView) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to view separation of duties violations"))
+		return
+	}
+
+	var orgID uuid.UUID
+	if r.URL.Query().Has("organizationId") {
+		if orgID, err = readUUIDParam(r, "organizationId"); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if !app.authorizeOrgRecords(w, r, user, orgID) {
+		return
+	}
+
+	violations := []sodViolationResponse{}
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		principals, err := sodCandidates(ctx, tx, orgID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, p := range principals {
+			holdings, err := principalHoldings(ctx, tx, p, now)
+			if err != nil {
+				return err
+			}
+			broken := slices.Concat(
+				brokenRules(holdingRoles(holdings, false), false),
+				brokenRules(holdingRoles(holdings, true), true),
+			)
+			for _, rule := range broken {
+				violation := sodViolationResponse{sodPrincipal: p, Rule: rule, Holdings: []sodHolding{}}
+				for _, holding := range holdings {
+					if slices.Contains(rule.Roles[:], holding.Role) && (holding.Active || !rule.Dynamic) {
+						violation.Holdings = append(violation.Holdings, holding)
+					}
+				}
+				violations = append(violations, violation)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, violations, "separation of duties violations")
+}
+
+// sodCandidates finds the principals holding any role a rule names, through
+// any source, in the organization orgID or, with uuid.Nil, everywhere.
+func sodCandidates(ctx context.Context, tx store.TxStorage, orgID uuid.UUID) ([]sodPrincipal, error) {
+	roles := []string{}
+	for _, rule := range SoDRules {
+		for _, role := range rule.Roles {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	principals := []sodPrincipal{}
+	seen := map[string]bool{}
+	add := func(accountType string, accountID uuid.UUID, org *uuid.UUID) {
+		p := sodPrincipal{AccountType: accountType, AccountID: accountID, OrganizationID: org}
+		key := accountType + accountID.String()
+		if org != nil {
+			key += org.String()
+		}
+		if !seen[key] {
+			seen[key] = true
+			principals = append(principals, p)
+		}
+	}
+
+	items, err := tx.Review.CollectEntitlements(ctx, store.ReviewScope{OrganizationID: orgID, Roles: roles}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if slices.Contains(roles, item.Role) {
+			add(item.AccountType, item.AccountID, item.OrganizationID)
+		}
+	}
+
+	holders, err := tx.Group.RoleHolders(ctx, orgID, roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, holder := range holders {
+		add(models.GrantAccountUser, holder.UserID, &holder.OrganizationID)
+	}
+	return principals, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+func ruleNames(rules []SoDRule) []string {
+	names := []string{}
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+func TestBrokenRulesByKind(t *testing.T) {
+	roles := []string{RolePaymentsInitiator, RolePaymentsApprover}
+
+	if broken := brokenRules(roles, false); len(broken) != 0 {
+		t.Errorf("static rules broken by holding a dynamic pair: %v", ruleNames(broken))
+	}
+	if broken := ruleNames(brokenRules(roles, true)); !slices.Equal(broken, []string{"payments-initiate-approve"}) {
+		t.Errorf("dynamic rules broken: %v, want payments-initiate-approve", broken)
+	}
+}
+
+func TestEnforceSessionSoD(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name       string
+		claims     UserClaims
+		groupRoles []string
+		grantRoles []string
+	}{
+		{
+			name:       "grant conflicting with the base role",
+			claims:     UserClaims{Role: RolePaymentsInitiator, GrantRoles: []string{RolePaymentsApprover, RoleAdmin}},
+			grantRoles: []string{RoleAdmin},
+		},
+		{
+			name: "grant conflicting with a group role",
+			claims: UserClaims{
+				Role:       RoleUser,
+				GroupRoles: []string{RolePaymentsInitiator},
+				GrantRoles: []string{RolePaymentsApprover},
+			},
+			groupRoles: []string{RolePaymentsInitiator},
+		},
+		{
+			name:       "no conflict",
+			claims:     UserClaims{Role: RoleUser, GrantRoles: []string{RolePaymentsApprover}},
+			grantRoles: []string{RolePaymentsApprover},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			app.enforceSessionSoD(&claims)
+
+			if !slices.Equal(claims.GroupRoles, tt.groupRoles) || !slices.Equal(claims.GrantRoles, tt.grantRoles) {
+				t.Errorf("session kept groups %v and grants %v, want %v and %v",
+					claims.GroupRoles, claims.GrantRoles, tt.groupRoles, tt.grantRoles)
+			}
+			perms := effectivePermissions(claims)
+			if slices.Contains(perms, PermPaymentsInitiate) && slices.Contains(perms, PermPaymentsApprove) {
+				t.Errorf("the session can both initiate and approve payments: %v", perms)
+			}
+		})
+	}
+}
+
+// An initiator can be granted the approver role, since the rule between them
+// is dynamic, but the grant is dropped from their sessions and shows up in
+// the violation report.
+func TestDynamicSoDGrant(t *testing.T) {
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	initiator := seedMember(t, app, org, "initiator@example.com", RolePaymentsInitiator)
+	token := loginAdmin(t, srv, owner)
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/admin/grant", token, map[string]any{
+		"accountType":    models.GrantAccountUser,
+		"accountId":      initiator.ID,
+		"organizationId": org.ID,
+		"role":           RolePaymentsApprover,
+		"validUntil":     time.Now().Add(time.Hour),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("granting approver to an initiator answered %d (%s), want %d", status, res.Error, http.StatusCreated)
+	}
+
+	claims := &UserClaims{Role: RoleUser, OrgID: org.ID.String()}
+	if err := app.refreshClaims(context.Background(), claims, initiator.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(claims.GrantRoles, RolePaymentsApprover) {
+		t.Fatalf("the grant is not active: %v", claims.GrantRoles)
+	}
+	app.enforceSessionSoD(claims)
+	if perms := effectivePermissions(*claims); slices.Contains(perms, PermPaymentsApprove) {
+		t.Errorf("the initiator's session can approve payments: %v", perms)
+	}
+
+	// the authenticated routes allow one request a second
+	time.Sleep(1100 * time.Millisecond)
+	status, res = doJSON(t, srv, http.MethodGet, "/v1/admin/sod/violations?organizationId="+org.ID.String(), token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("violation report answered %d: %s", status, res.Error)
+	}
+	var violations []sodViolationResponse
+	if err := json.Unmarshal(res.Data, &violations); err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || violations[0].Rule.Name != "payments-initiate-approve" ||
+		violations[0].AccountID != initiator.ID || len(violations[0].Holdings) != 2 {
+		t.Errorf("violations: %+v", violations)
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type ssoConfig struct {
+	// callbackURL is where identity providers send users back to. Register
+	// it as the redirect URI with every provider.
+	callbackURL string
+	// stateTTL is how long a user has to finish signing in at the provider.
+	stateTTL time.Duration
+	// timeout bounds each request to a provider.
+	timeout time.Duration
+}
+
+var (
+	errSSORequired       = errors.New("this organization requires single sign-on")
+	errSSONotProvisioned = errors.New("you have not been given access to this organization")
+)
+
+// SaveOIDCProviderHandler sets up single sign-on for the organization, or
+// replaces its settings. The issuer must serve a discovery document.
+func (app *application) SaveOIDCProviderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermSSOManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage single sign-on"))
+		return
+	}
+
+	var payload dtos.SaveOIDCProviderPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	if !app.canAdministerOrg(w, r, user, payload.OrganizationID, "manage single sign-on of") {
+		return
+	}
+
+	provider := &models.OIDCProvider{
+		OrganizationID:  payload.OrganizationID,
+		Issuer:          payload.Issuer,
+		ClientID:        payload.ClientID,
+		ClientSecret:    payload.ClientSecret,
+		EmailClaim:      cmp.Or(payload.EmailClaim, "email"),
+		NameClaim:       cmp.Or(payload.NameClaim, "name"),
+		GroupsClaim:     cmp.Or(payload.GroupsClaim, "groups"),
+		DefaultRole:     cmp.Or(payload.DefaultRole, RoleUser),
+		JITProvisioning: payload.JITProvisioning,
+		SSOOnly:         payload.SSOOnly,
+		UpdatedBy:       uuid.MustParse(user.UserID),
+	}
+
+	scopes := payload.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	provider.Scopes = strings.Join(scopes, " ")
+
+	if provider.RoleMappings, err = ssoRoleMappings(payload.RoleMappings, provider.DefaultRole); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if provider.ClientSecret == "" {
+		existing, err := app.store.OIDC.GetProvider(ctx, provider.OrganizationID)
+		if errors.Is(err, store.ErrNotFound) {
+			app.badRequestResponse(w, r, errors.New("clientSecret is required"))
+			return
+		}
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		provider.ClientSecret = existing.ClientSecret
+	}
+
+	if _, err := app.oidcDiscover(ctx, provider.Issuer); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.OIDC.SaveProvider(ctx, provider); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, provider, "single sign-on saved successfully")
+}
+
+// GetOIDCProviderHandler shows the single sign-on settings of the
+// organization given by ?organizationId=, without the client secret.
+func (app *application) GetOIDCProviderHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := app.loadSSOOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	provider, err := app.store.OIDC.GetProvider(r.Context(), orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, provider, "single sign-on")
+}
+
+// DeleteOIDCProviderHandler turns single sign-on off for the organization
+// given by ?organizationId=. Its members sign in with passwords again.
+func (app *application) DeleteOIDCProviderHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := app.loadSSOOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.OIDC.DeleteProvider(r.Context(), orgID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "single sign-on removed successfully")
+}
+
+// loadSSOOrganization reads ?organizationId= and checks that the caller may
+// manage its single sign-on. It writes the error response itself.
+func (app *application) loadSSOOrganization(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	user, err := GetUserFromContext(r.Context())
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return uuid.Nil, false
+	}
+	if !app.HasPermission(user, PermSSOManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage single sign-on"))
+		return uuid.Nil, false
+	}
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return uuid.Nil, false
+	}
+	if !app.canAdministerOrg(w, r, user, orgID, "manage single sign-on of") {
+		return uuid.Nil, false
+	}
+	return orgID, true
+}
+
+// OIDCLoginHandler starts signing in to the organization given by
+// ?organizationId= by redirecting to its identity provider.
+func (app *application) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, err := readUUIDParam(r, "organizationId")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	provider, err := app.store.OIDC.GetProvider(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	org, err := app.store.Organization.GetOrganization(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if org.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errOrgSuspended)
+		return
+	}
+
+	discovery, err := app.oidcDiscover(ctx, provider.Issuer)
+	if err != nil {
+		app.logger.Warnw("identity provider unavailable", "organization", orgID, "issuer", provider.Issuer, "error", err.Error())
+		app.serviceUnavailableResponse(w, r, err)
+		return
+	}
+
+	state, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	verifier, challenge, err := app.oidcPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	if _, err := app.store.OIDC.DeleteExpiredLoginStates(ctx, now); err != nil {
+		app.logger.Error("error deleting expired sign-ins", zap.Error(err))
+	}
+	err = app.store.OIDC.CreateLoginState(ctx, &models.OIDCLoginState{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		StateHash:      HashToken(state),
+		CodeVerifier:   verifier,
+		Nonce:          nonce,
+		ExpiresAt:      now.Add(app.config.sso.stateTTL),
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, app.oidcAuthorizeURL(discovery, provider, state, challenge, nonce), http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes signing in once the identity provider sends
+// the user back, and answers like LoginUserHandler with a token scoped to the
+// organization. Accounts are matched by email. With JIT provisioning, users
+// signing in for the first time join the organization, and get an active
+// account if they had none; pending accounts are activated. When the
+// provider has role mappings, the membership role follows the user's groups
+// on every sign-in.
+func (app *application) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	rawState := query.Get("state")
+	if rawState == "" {
+		app.badRequestResponse(w, r, errors.New("state is required"))
+		return
+	}
+	state, err := app.store.OIDC.ConsumeLoginState(ctx, HashToken(rawState), time.Now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedResponse(w, r, errors.New("sign-in has expired or was already completed, start again"))
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		app.unauthorizedResponse(w, r, fmt.Errorf("%w: %s: %s", errOIDCProvider, providerErr, query.Get("error_description")))
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		app.badRequestResponse(w, r, errors.New("code is required"))
+		return
+	}
+
+	provider, err := app.store.OIDC.GetProvider(ctx, state.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	claims, err := app.oidcSignIn(ctx, provider, code, state)
+	if err != nil {
+		app.logger.Warnw("single sign-on failed", "organization", state.OrganizationID, "error", err.Error())
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	email, _ := claims[provider.EmailClaim].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		app.unauthorizedResponse(w, r, fmt.Errorf("the ID token has no %q claim", provider.EmailClaim))
+		return
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		app.unauthorizedResponse(w, r, errors.New("the identity provider has not verified this email"))
+		return
+	}
+	name, _ := claims[provider.NameClaim].(string)
+
+	app.ssoLogin(w, r, oidcPolicy(provider), email, name, oidcGroups(claims[provider.GroupsClaim]))
+}
+
+// ssoLogin signs in the user an identity provider vouched for, answering
+// like LoginUserHandler with a token scoped to the organization.
+func (app *application) ssoLogin(w http.ResponseWriter, r *http.Request, policy ssoPolicy, email, name string, groups []string) {
+	if name == "" {
+		name = email
+	}
+
+	user, membership, err := app.ssoProvision(r.Context(), policy, email, name, groups)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSSONotProvisioned), errors.Is(err, errAccountSuspended),
+			errors.Is(err, errMembershipSuspended), errors.Is(err, errOrgSuspended):
+			app.unauthorizedResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := GenerateJWT(user.ID, user.Email, user.Name, membership.Role, membership.OrganizationID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"token":          token,
+		"data":           user,
+		"organizationId": membership.OrganizationID,
+		"role":           membership.Role,
+	}, "login successful")
+}
+
+// oidcSignIn redeems the authorization code and returns the claims of the
+// verified ID token.
+func (app *application) oidcSignIn(ctx context.Context, provider *models.OIDCProvider, code string, state *models.OIDCLoginState) (jwt.MapClaims, error) {
+	discovery, err := app.oidcDiscover(ctx, provider.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := app.oidcExchange(ctx, discovery, provider, code, state.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return app.oidcVerifyIDToken(ctx, discovery, provider, idToken, state.Nonce)
+}
+
+// oidcGroups reads a groups claim, which providers send as a list or, for a
+// single group, a string.
+func oidcGroups(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		groups := []string{}
+		for _, group := range v {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// ssoPolicy is how sign-ins through an organization's identity provider
+// are provisioned, whichever protocol it speaks.
+type ssoPolicy struct {
+	organizationID  uuid.UUID
+	jitProvisioning bool
+	roleMappings    []models.SSORoleMapping
+	defaultRole     string
+}
+
+func oidcPolicy(provider *models.OIDCProvider) ssoPolicy {
+	return ssoPolicy{
+		organizationID:  provider.OrganizationID,
+		jitProvisioning: provider.JITProvisioning,
+		roleMappings:    provider.RoleMappings,
+		defaultRole:     provider.DefaultRole,
+	}
+}
+
+// ssoRoleMappings checks the role mappings and default role an admin set.
+func ssoRoleMappings(payload []dtos.SSORoleMappingPayload, defaultRole string) ([]models.SSORoleMapping, error) {
+	mappings := []models.SSORoleMapping{}
+	roles := []string{defaultRole}
+	for _, mapping := range payload {
+		roles = append(roles, mapping.Role)
+		mappings = append(mappings, models.SSORoleMapping{Group: mapping.Group, Role: mapping.Role})
+	}
+	for _, role := range roles {
+		if !slices.Contains(MemberRoles, role) {
+			return nil, errors.New("roles must be one of [" + strings.Join(MemberRoles, " ") + "]")
+		}
+	}
+	return mappings, nil
+}
+
+// ssoRole is the role of the first mapping whose group the user is in, or
+// the default role.
+func ssoRole(policy ssoPolicy, groups []string) string {
+	for _, mapping := range policy.roleMappings {
+		if slices.Contains(groups, mapping.Group) {
+			return mapping.Role
+		}
+	}
+	return policy.defaultRole
+}
+
+// ssoProvision finds or provisions the account and membership an SSO
+// sign-in is for.
+func (app *application) ssoProvision(
+	ctx context.Context,
+	policy ssoPolicy,
+	email string,
+	name string,
+	groups []string,
+) (*models.User, *models.Membership, error) {
+	role := ssoRole(policy, groups)
+
+	var user *models.User
+	var membership *models.Membership
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		org, err := tx.Organization.GetOrganization(ctx, policy.organizationID)
+		if err != nil {
+			return err
+		}
+		if org.Status == helpers.StatusSuspended {
+			return errOrgSuspended
+		}
+
+		user, err = tx.User.GetUserByEmail(ctx, email)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			if !policy.jitProvisioning {
+				return errSSONotProvisioned
+			}
+			user = &models.User{
+				ID:     uuid.New(),
+				Name:   name,
+				Email:  email,
+				Role:   RoleUser,
+				Status: helpers.StatusActive,
+			}
+			if err := tx.User.CreateUser(ctx, user); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case user.Status == helpers.StatusSuspended:
+			return errAccountSuspended
+		case user.Status == helpers.StatusPending:
+			// the provider vouches for the email, as the invite would have
+			if err := tx.User.UpdateUser(ctx, user.ID, map[string]interface{}{"status": helpers.StatusActive}); err != nil {
+				return err
+			}
+			user.Status = helpers.StatusActive
+			if err := app.publishUserWebhook(ctx, tx, user, models.WebhookEventUserActivated); err != nil {
+				return err
+			}
+		}
+
+		membership, err = tx.Membership.GetMembership(ctx, user.ID, org.ID)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			if !policy.jitProvisioning {
+				return errSSONotProvisioned
+			}
+			membership = &models.Membership{
+				ID:             uuid.New(),
+				UserID:         user.ID,
+				OrganizationID: org.ID,
+				Role:           role,
+				Status:         helpers.StatusActive,
+			}
+			if err := tx.Membership.CreateMembership(ctx, membership); err != nil {
+				return err
+			}
+			if err := app.publishWebhook(ctx, tx, org, models.WebhookEventUserInvited, webhookUser{
+				UserID: user.ID, Email: user.Email, Role: membership.Role, Status: user.Status,
+			}); err != nil {
+				return err
+			}
+			return checkStaticSoD(ctx, tx, userPrincipal(user.ID, org.ID))
+		case err != nil:
+			return err
+		case membership.Status == helpers.StatusSuspended:
+			return errMembershipSuspended
+		case len(policy.roleMappings) > 0 && membership.Role != role:
+			before := membership
+			if err := tx.Membership.UpdateMembership(ctx, membership.ID, map[string]interface{}{"role": role}); err != nil {
+				return err
+			}
+			if err := checkStaticSoD(ctx, tx, userPrincipal(user.ID, org.ID)); err != nil {
+				return err
+			}
+			if membership, err = tx.Membership.GetMembership(ctx, user.ID, org.ID); err != nil {
+				return err
+			}
+			return app.publishMemberWebhooks(ctx, tx, before, &memberResponse{User: user, Membership: membership})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, membership, nil
+}
+
+// ssoRequired reports whether the organization only lets its members sign in
+// through one of its identity providers.
+func (app *application) ssoRequired(ctx context.Context, orgID uuid.UUID) (bool, error) {
+	oidc, err := app.store.OIDC.GetProvider(ctx, orgID)
+	switch {
+	case err == nil && oidc.SSOOnly:
+		return true, nil
+	case err != nil && !errors.Is(err, store.ErrNotFound):
+		return false, err
+	}
+
+	saml, err := app.store.SAML.GetProvider(ctx, orgID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return saml.SSOOnly, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// ssoLoginResponse is the data LoginUserHandler and the single sign-on
+// handlers answer with.
+type ssoLoginResponse struct {
+	Token          string      `json:"token"`
+	Role           string      `json:"role"`
+	OrganizationID string      `json:"organizationId"`
+	User           models.User `json:"data"`
+}
+
+// setUpOIDC returns an application serving on srv whose organization signs
+// in with issuer, configured with settings on top of the issuer's client.
+func setUpOIDC(t *testing.T, settings map[string]any) (*application, *httptest.Server, *testIssuer, *models.Organization) {
+	t.Helper()
+
+	app := newTestApp(t)
+	srv := httptest.NewServer(app.mount())
+	t.Cleanup(srv.Close)
+	app.config.sso.callbackURL = srv.URL + "/v1/users/sso/oidc/callback"
+	issuer := newTestIssuer(t)
+
+	owner := seedAdmin(t, app, RoleAdmin)
+	org := seedOrganization(t, app, owner)
+	payload := map[string]any{
+		"organizationId": org.ID,
+		"issuer":         issuer.URL,
+		"clientId":       issuer.ClientID,
+		"clientSecret":   issuer.ClientSecret,
+	}
+	for key, value := range settings {
+		payload[key] = value
+	}
+	status, res := doJSON(t, srv, http.MethodPut, "/v1/admin/sso/oidc", loginAdmin(t, srv, owner), payload)
+	if status != http.StatusOK {
+		t.Fatalf("saving the provider answered %d: %s", status, res.Error)
+	}
+	return app, srv, issuer, org
+}
+
+// startOIDCLogin starts signing in to org and returns the provider's answer
+// to the authorization request, which redirects back to the callback.
+func startOIDCLogin(t *testing.T, srv *httptest.Server, org *models.Organization) *http.Response {
+	t.Helper()
+
+	authorize := redirectTo(t, follow(t, srv.URL+"/v1/users/sso/oidc/login?organizationId="+org.ID.String()))
+	if method := authorize.Query().Get("code_challenge_method"); method != "S256" {
+		t.Fatalf("the authorization request uses code_challenge_method %q, want S256", method)
+	}
+	return follow(t, authorize.String())
+}
+
+// oidcSignIn goes through a whole sign-in to org and decodes the answer of
+// the callback.
+func oidcSignIn(t *testing.T, srv *httptest.Server, org *models.Organization) (int, testResponse) {
+	t.Helper()
+
+	callback := redirectTo(t, startOIDCLogin(t, srv, org))
+	return getJSON(t, callback.String())
+}
+
+// getJSON sends a GET to target and decodes the answer.
+func getJSON(t *testing.T, target string) (int, testResponse) {
+	t.Helper()
+
+	res := follow(t, target)
+	defer res.Body.Close()
+	var out testResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("GET %s: decoding the answer: %v", target, err)
+	}
+	return res.StatusCode, out
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	app, srv, issuer, org := setUpOIDC(t, map[string]any{
+		"jitProvisioning": true,
+		"roleMappings":    []map[string]string{{"group": "auditors", "role": RoleAuditor}},
+	})
+	ctx := context.Background()
+
+	issuer.SetClaims(jwt.MapClaims{
+		"email":          "New.Hire@Example.com",
+		"email_verified": true,
+		"name":           "New Hire",
+		"groups":         []string{"engineering", "auditors"},
+	})
+	status, res := oidcSignIn(t, srv, org)
+	if status != http.StatusOK {
+		t.Fatalf("the first sign-in answered %d: %s", status, res.Error)
+	}
+	var login ssoLoginResponse
+	if err := json.Unmarshal(res.Data, &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Token == "" || login.Role != RoleAuditor || login.OrganizationID != org.ID.String() {
+		t.Errorf("the first sign-in answered role %q in %q", login.Role, login.OrganizationID)
+	}
+
+	user, err := app.store.User.GetUserByEmail(ctx, "new.hire@example.com")
+	if err != nil {
+		t.Fatalf("the user was not provisioned: %v", err)
+	}
+	if user.Status != helpers.StatusActive || user.Name != "New Hire" {
+		t.Errorf("provisioned %q with status %q", user.Name, user.Status)
+	}
+
+	// the role follows the groups on every sign-in
+	issuer.SetClaims(jwt.MapClaims{"email": "new.hire@example.com", "groups": []string{"engineering"}})
+	if status, res := oidcSignIn(t, srv, org); status != http.StatusOK {
+		t.Fatalf("the second sign-in answered %d: %s", status, res.Error)
+	}
+	membership, err := app.store.Membership.GetMembership(ctx, user.ID, org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.Role != RoleUser {
+		t.Errorf("after leaving the group the role is %q, want the default %q", membership.Role, RoleUser)
+	}
+
+	issuer.SetClaims(jwt.MapClaims{"email": "unverified@example.com", "email_verified": false})
+	if status, _ := oidcSignIn(t, srv, org); status != http.StatusUnauthorized {
+		t.Errorf("an unverified email answered %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+// The authorization code only works with the verifier of the login that
+// asked for it, and each login can be finished once.
+func TestOIDCPKCE(t *testing.T) {
+	_, srv, issuer, org := setUpOIDC(t, map[string]any{"jitProvisioning": true})
+	issuer.SetClaims(jwt.MapClaims{"email": "pkce@example.com"})
+
+	first := redirectTo(t, startOIDCLogin(t, srv, org))
+	second := redirectTo(t, startOIDCLogin(t, srv, org))
+
+	swapped := *first
+	query := first.Query()
+	query.Set("state", second.Query().Get("state"))
+	swapped.RawQuery = query.Encode()
+	if status, res := getJSON(t, swapped.String()); status != http.StatusUnauthorized {
+		t.Errorf("redeeming a code with another login's verifier answered %d (%s), want %d",
+			status, res.Error, http.StatusUnauthorized)
+	}
+
+	// the provider burned the code, as real ones do, so start over
+	third := redirectTo(t, startOIDCLogin(t, srv, org))
+	if status, res := getJSON(t, third.String()); status != http.StatusOK {
+		t.Fatalf("finishing a login answered %d: %s", status, res.Error)
+	}
+	if status, _ := getJSON(t, third.String()); status != http.StatusUnauthorized {
+		t.Errorf("finishing the same login again answered %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCWithoutJIT(t *testing.T) {
+	app, srv, issuer, org := setUpOIDC(t, map[string]any{"jitProvisioning": false})
+	member := seedMember(t, app, org, "member@example.com", RoleUser)
+
+	issuer.SetClaims(jwt.MapClaims{"email": "stranger@example.com"})
+	if status, res := oidcSignIn(t, srv, org); status != http.StatusUnauthorized || res.Error != errSSONotProvisioned.Error() {
+		t.Errorf("an unknown user answered %d (%s), want %d", status, res.Error, http.StatusUnauthorized)
+	}
+
+	issuer.SetClaims(jwt.MapClaims{"email": member.Email})
+	if status, res := oidcSignIn(t, srv, org); status != http.StatusOK {
+		t.Errorf("an existing member answered %d: %s", status, res.Error)
+	}
+}
+
+func TestPasswordLoginWhenSSORequired(t *testing.T) {
+	app, srv, _, org := setUpOIDC(t, map[string]any{"ssoOnly": true})
+	member := seedMember(t, app, org, "member@example.com", RoleUser)
+
+	status, res := doJSON(t, srv, http.MethodPost, "/v1/users/auth/login", "", map[string]string{
+		"email":    member.Email,
+		"password": testPassword,
+	})
+	if status != http.StatusUnauthorized || res.Error != errSSORequired.Error() {
+		t.Errorf("password login answered %d (%s), want %d (%s)",
+			status, res.Error, http.StatusUnauthorized, errSSORequired)
+	}
+
+	// the password still works once the organization allows it
+	app.store.OIDC.DeleteProvider(context.Background(), org.ID)
+	if status, res := doJSON(t, srv, http.MethodPost, "/v1/users/auth/login", "", map[string]string{
+		"email":    member.Email,
+		"password": testPassword,
+	}); status != http.StatusOK {
+		t.Errorf("password login without SSO answered %d: %s", status, res.Error)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+// StartTransferHandler offers the organization given by ?id= to another
+// admin. Only its owner or a super admin can start a transfer; the receiving
+// admin gets a token by email and has transferTTL to accept it.
+func (app *application) StartTransferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermOrgTransfer) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to transfer organizations"))
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.StartTransferPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	org, err := app.store.Organization.GetOrganization(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isSuperAdmin(user) && !isSelf(user, org.AdminID) {
+		app.unauthorizedResponse(w, r, errors.New("only the owner or a super admin can transfer this organization"))
+		return
+	}
+	if payload.ToAdminID == org.AdminID {
+		app.badRequestResponse(w, r, errors.New("organization is already owned by this admin"))
+		return
+	}
+
+	target, err := app.store.Admin.GetAdmin(ctx, payload.ToAdminID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if target.Status != helpers.StatusActive {
+		app.storeErrorResponse(w, r, store.ErrAdminNotActive)
+		return
+	}
+
+	rawToken, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	transfer := &models.OrganizationTransfer{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		FromAdminID:    org.AdminID,
+		ToAdminID:      target.ID,
+		InitiatedBy:    uuid.MustParse(user.UserID),
+		TokenHash:      HashToken(rawToken),
+		Status:         models.TransferStatusPending,
+		ExpiresAt:      now.Add(app.config.transferTTL),
+	}
+
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := expireStaleTransfer(r, tx, org.ID, now); err != nil {
+			return err
+		}
+		if err := tx.Organization.CreateTransfer(ctx, transfer); err != nil {
+			return err
+		}
+		return app.enqueueTransferOffer(ctx, tx.Outbox, transfer, org, target.Email)
+	})
+	if err != nil {
+		app.logger.Error("error starting organization transfer", zap.String("id", org.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, transfer, "organization transfer started; waiting for the receiving admin to accept")
+}
+
+// AcceptTransferHandler completes a transfer. The caller must be the
+// receiving admin and present the token from the transfer email.
+func (app *application) AcceptTransferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	var payload dtos.AcceptTransferPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	transfer, err := app.store.Organization.GetTransferByToken(ctx, HashToken(payload.Token))
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isSelf(user, transfer.ToAdminID) {
+		app.unauthorizedResponse(w, r, errors.New("this transfer was offered to another admin"))
+		return
+	}
+	if transfer.Status != models.TransferStatusPending {
+		app.conflictResponse(w, r, errors.New("transfer is already "+transfer.Status))
+		return
+	}
+
+	now := time.Now()
+	if now.After(transfer.ExpiresAt) {
+		if err := app.store.Organization.ResolveTransfer(ctx, transfer.ID, models.TransferStatusExpired, uuid.Nil, now); err != nil {
+			app.logger.Error("error expiring organization transfer", zap.String("id", transfer.ID.String()), zap.Error(err))
+		}
+		app.conflictResponse(w, r, errors.New("transfer has expired; ask for a new one"))
+		return
+	}
+
+	var updated *models.Organization
+	err = app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		org, err := tx.Organization.GetOrganization(ctx, transfer.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if org.AdminID != transfer.FromAdminID {
+			return errTransferOwnerChanged
+		}
+
+		admin, err := tx.Admin.GetAdmin(ctx, transfer.ToAdminID)
+		if err != nil {
+			return err
+		}
+		if admin.Status != helpers.StatusActive {
+			return store.ErrAdminNotActive
+		}
+
+		if err := tx.Organization.ResolveTransfer(ctx, transfer.ID, models.TransferStatusAccepted, admin.ID, now); err != nil {
+			return err
+		}
+		if err := tx.Organization.UpdateOrganization(ctx, org.ID, map[string]interface{}{
+			"admin_id": admin.ID,
+		}); err != nil {
+			return err
+		}
+
+		updated, err = tx.Organization.GetOrganization(ctx, org.ID)
+		return err
+	})
+	if errors.Is(err, errTransferOwnerChanged) {
+		app.conflictResponse(w, r, err)
+		return
+	}
+	if err != nil {
+		app.logger.Error("error accepting organization transfer", zap.String("id", transfer.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Infow("organization transferred",
+		"organization", updated.ID, "from", transfer.FromAdminID, "to", transfer.ToAdminID)
+	app.jsonResponse(w, http.StatusOK, updated, "organization transferred successfully")
+}
+
+// CancelTransferHandler withdraws the pending transfer given by ?id=. The
+// organization's administrators can withdraw it and the receiving admin can
+// decline it.
+func (app *application) CancelTransferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	transfer, err := app.store.Organization.GetTransfer(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if !isSelf(user, transfer.ToAdminID) && !isSelf(user, transfer.InitiatedBy) {
+		if !app.HasPermission(user, PermOrgTransfer) {
+			app.unauthorizedResponse(w, r, errors.New("unauthorized to cancel organization transfers"))
+			return
+		}
+		if !app.canAdministerOrg(w, r, user, transfer.OrganizationID, "cancel transfers of") {
+			return
+		}
+	}
+
+	err = app.store.Organization.ResolveTransfer(ctx, transfer.ID, models.TransferStatusCancelled, uuid.MustParse(user.UserID), time.Now())
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "organization transfer cancelled")
+}
+
+// ListTransfersHandler lists the transfers of the organization given by ?id=,
+// or, without it, the transfers from or to the caller. ?status= narrows
+// either list.
+func (app *application) ListTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.TransferStatusPending, models.TransferStatusAccepted,
+		models.TransferStatusCancelled, models.TransferStatusExpired:
+	default:
+		app.badRequestResponse(w, r, errors.New("invalid transfer status"))
+		return
+	}
+	filter := store.TransferFilter{Status: status}
+
+	if r.URL.Query().Get("id") != "" {
+		org, ok := app.loadOrganization(w, r, PermOrgView, "view")
+		if !ok {
+			return
+		}
+		filter.OrganizationID = org.ID
+	} else {
+		user, err := GetUserFromContext(ctx)
+		if err != nil {
+			app.unauthorizedResponse(w, r, err)
+			return
+		}
+		filter.AdminID = uuid.MustParse(user.UserID)
+	}
+
+	transfers, err := app.store.Organization.ListTransfers(ctx, filter)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, transfers, "organization transfers")
+}
+
+var errTransferOwnerChanged = errors.New("the organization changed owner after this transfer was started")
+
+// expireStaleTransfer marks the organization's pending transfer expired if its
+// token has run out, so a new transfer can be started.
+func expireStaleTransfer(r *http.Request, tx store.TxStorage, orgID uuid.UUID, now time.Time) error {
+	ctx := r.Context()
+
+	pending, err := tx.Organization.ListTransfers(ctx, store.TransferFilter{
+		OrganizationID: orgID,
+		Status:         models.TransferStatusPending,
+	})
+	if err != nil {
+		return err
+	}
+	for _, transfer := range pending {
+		if now.After(transfer.ExpiresAt) {
+			if err := tx.Organization.ResolveTransfer(ctx, transfer.ID, models.TransferStatusExpired, uuid.Nil, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/cmd/helpers"
 	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
 )
 
+var errNoActiveMembership = errors.New("user is not an active member of any organization")
+
+// LoginUserHandler signs the user in to their oldest active membership. The
+// token is scoped to that organization; /users/switch-org moves to another.
 func (app *application) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload dtos.LoginPayload
 
@@ -26,16 +33,139 @@ func (app *application) LoginUserHandler(w http.ResponseWriter, r *http.Request)
 		app.badRequestResponse(w, r, errors.New("user is pending"))
 		return
 	}
+	if user.Status == helpers.StatusSuspended {
+		app.unauthorizedResponse(w, r, errAccountSuspended)
+		return
+	}
+
+	memberships, err := app.store.Membership.ListUserMemberships(r.Context(), user.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	// organizations that require single sign-on are skipped: a password
+	// does not get into them
+	var membership *models.Membership
+	ssoOnly := false
+	for i := range memberships {
+		err := app.checkMembershipActive(r.Context(), &memberships[i])
+		if err == nil {
+			required, err := app.ssoRequired(r.Context(), memberships[i].OrganizationID)
+			if err != nil {
+				app.storeErrorResponse(w, r, err)
+				return
+			}
+			if required {
+				ssoOnly = true
+				continue
+			}
+			membership = &memberships[i]
+			break
+		}
+		if !errors.Is(err, errMembershipSuspended) && !errors.Is(err, errOrgSuspended) {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+	}
+	if membership == nil {
+		if ssoOnly {
+			app.unauthorizedResponse(w, r, errSSORequired)
+			return
+		}
+		app.unauthorizedResponse(w, r, errNoActiveMembership)
+		return
+	}
 
-	token, err := GenerateJWT(user.ID, user.Email, user.Name, user.Role)
+	token, err := GenerateJWT(user.ID, user.Email, user.Name, membership.Role, membership.OrganizationID)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	app.jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"token": token,
-		"data":  user,
+		"token":          token,
+		"data":           user,
+		"organizationId": membership.OrganizationID,
+		"memberships":    memberships,
 	}, "login successful")
 
 }
+
+// SwitchOrganizationHandler issues a token scoped to another organization the
+// user is an active member of. Organizations that require single sign-on
+// must be signed in to directly.
+func (app *application) SwitchOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if claims.OrgID == "" {
+		app.unauthorizedResponse(w, r, errors.New("only users can switch organizations"))
+		return
+	}
+
+	var payload dtos.SwitchOrganizationPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	userID := uuid.MustParse(claims.UserID)
+	membership, err := app.store.Membership.GetMembership(ctx, userID, payload.OrganizationID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if err := app.checkMembershipActive(ctx, membership); err != nil {
+		if errors.Is(err, errMembershipSuspended) || errors.Is(err, errOrgSuspended) {
+			app.unauthorizedResponse(w, r, err)
+			return
+		}
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if required, err := app.ssoRequired(ctx, membership.OrganizationID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	} else if required {
+		app.unauthorizedResponse(w, r, errSSORequired)
+		return
+	}
+
+	user, err := app.store.User.GetUser(ctx, userID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := GenerateJWT(user.ID, user.Email, user.Name, membership.Role, membership.OrganizationID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"token":          token,
+		"organizationId": membership.OrganizationID,
+		"role":           membership.Role,
+	}, "switched organization")
+}
+
+// checkMembershipActive fails with errMembershipSuspended or errOrgSuspended
+// unless the user can act in the membership's organization.
+func (app *application) checkMembershipActive(ctx context.Context, membership *models.Membership) error {
+	if membership.Status == helpers.StatusSuspended {
+		return errMembershipSuspended
+	}
+	org, err := app.store.Organization.GetOrganization(ctx, membership.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if org.Status == helpers.StatusSuspended {
+		return errOrgSuspended
+	}
+	return nil
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/cmd/helpers"
+	"github.com/mightyfzeus/rbac/internal/dtos"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"github.com/mightyfzeus/rbac/internal/store"
+	"go.uber.org/zap"
+)
+
+type webhookConfig struct {
+	// timeout bounds a single delivery attempt.
+	timeout time.Duration
+	// allowPrivate lets subscriptions point at loopback, link-local and
+	// private addresses, for developing against a local receiver.
+	allowPrivate bool
+	client       *http.Client
+}
+
+// WebhookEventTypes are the events a subscription can filter on.
+var WebhookEventTypes = []string{
+	models.WebhookEventUserInvited,
+	models.WebhookEventUserActivated,
+	models.WebhookEventUserSuspended,
+	models.WebhookEventUserReactivated,
+	models.WebhookEventUserRoleChanged,
+	models.WebhookEventOrgCreated,
+	models.WebhookEventOrgDeleted,
+}
+
+const webhookUserAgent = "rbac-webhooks/1"
+
+var errWebhookAddress = errors.New("url must not point at a loopback, link-local, private or unspecified address")
+
+// newWebhookClient returns the client deliveries go through. It never follows
+// redirects, so a subscription is delivered to the URL it names or not at
+// all, and unless allowPrivate it refuses to connect to addresses
+// webhookAddressAllowed rejects. That is checked on the address actually
+// dialed, so a name that resolved to a public address when the subscription
+// was saved cannot be pointed inside later.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookAddressAllowed(addrPort.Addr()) {
+				return errWebhookAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the receiver, hiding its address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookAddressAllowed reports whether deliveries may go to addr: anything
+// but this host, the local network and the cloud metadata endpoints on it.
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsUnspecified() && !addr.IsLoopback() && !addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast()
+}
+
+// webhookEvent is the body of every webhook request.
+type webhookEvent struct {
+	ID             uuid.UUID       `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID *uuid.UUID      `json:"organizationId,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// webhookMessage is the outbox payload for models.OutboxKindWebhook: one
+// event for one subscription.
+type webhookMessage struct {
+	SubscriptionID uuid.UUID    `json:"subscriptionId"`
+	Event          webhookEvent `json:"event"`
+}
+
+// webhookUser is the data of the user.* events.
+type webhookUser struct {
+	UserID       uuid.UUID `json:"userId"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role,omitempty"`
+	PreviousRole string    `json:"previousRole,omitempty"`
+	Status       string    `json:"status,omitempty"`
+}
+
+// publishWebhook queues the event for every active subscription that wants
+// it: those on org, on the organizations above it for as long as their admins
+// administer org, and the global ones. Pass the transaction that makes the
+// change so the event only goes out if it commits.
+func (app *application) publishWebhook(
+	ctx context.Context,
+	tx store.TxStorage,
+	org *models.Organization,
+	eventType string,
+	data any,
+) error {
+	orgIDs := []uuid.UUID{org.ID}
+	if org.InheritPermissions && org.ParentID != nil {
+		ancestors, err := tx.Organization.ListAncestors(ctx, org.ID)
+		if err != nil {
+			return err
+		}
+		for _, ancestor := range ancestors {
+			orgIDs = append(orgIDs, ancestor.ID)
+			if !ancestor.InheritPermissions {
+				break
+			}
+		}
+	}
+
+	subs, err := tx.Webhook.MatchSubscriptions(ctx, orgIDs, eventType)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := webhookEvent{
+		ID:             uuid.New(),
+		Type:           eventType,
+		OrganizationID: &org.ID,
+		CreatedAt:      time.Now().UTC(),
+		Data:           raw,
+	}
+	for _, sub := range subs {
+		payload, err := json.Marshal(webhookMessage{SubscriptionID: sub.ID, Event: event})
+		if err != nil {
+			return err
+		}
+		if err := app.enqueueOutbox(ctx, tx.Outbox, models.OutboxKindWebhook, "webhook_subscription", sub.ID, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishUserWebhook publishes a user event in every organization the user
+// belongs to, with their role there.
+func (app *application) publishUserWebhook(ctx context.Context, tx store.TxStorage, user *models.User, eventType string) error {
+	memberships, err := tx.Membership.ListUserMemberships(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, membership := range memberships {
+		org, err := tx.Organization.GetOrganization(ctx, membership.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if err := app.publishWebhook(ctx, tx, org, eventType, webhookUser{
+			UserID: user.ID, Email: user.Email, Role: membership.Role, Status: user.Status,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishMemberWebhooks publishes what changed between the membership before
+// and the member after an update: a suspension, a reactivation or a new
+// role.
+func (app *application) publishMemberWebhooks(
+	ctx context.Context,
+	tx store.TxStorage,
+	before *models.Membership,
+	after *memberResponse,
+) error {
+	user := webhookUser{
+		UserID: after.ID,
+		Email:  after.Email,
+		Role:   after.Membership.Role,
+		Status: after.Membership.Status,
+	}
+	events := []string{}
+	if before.Status != after.Membership.Status {
+		if after.Membership.Status == helpers.StatusSuspended {
+			events = append(events, models.WebhookEventUserSuspended)
+		} else {
+			events = append(events, models.WebhookEventUserReactivated)
+		}
+	}
+	if before.Role != after.Membership.Role {
+		user.PreviousRole = before.Role
+		events = append(events, models.WebhookEventUserRoleChanged)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	org, err := tx.Organization.GetOrganization(ctx, after.Membership.OrganizationID)
+	if err != nil {
+		return err
+	}
+	for _, eventType := range events {
+		if err := app.publishWebhook(ctx, tx, org, eventType, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhook is the outbox handler for webhooks. Events for
+// subscriptions that were deleted or paused since are dropped.
+func (app *application) deliverWebhook(ctx context.Context, msg *models.OutboxMessage) error {
+	var m webhookMessage
+	if err := json.Unmarshal(msg.Payload, &m); err != nil {
+		return err
+	}
+
+	sub, err := app.store.Webhook.GetSubscription(ctx, m.SubscriptionID)
+	switch {
+	case errors.Is(err, store.ErrWebhookNotFound), err == nil && !sub.Active:
+		app.logger.Infow("dropping webhook event for an inactive subscription",
+			"subscription", m.SubscriptionID, "event", m.Event.ID, "type", m.Event.Type)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	_, err = app.sendWebhook(ctx, sub, m.Event, msg.Attempts+1, &msg.ID)
+	return err
+}
+
+// sendWebhook posts the event to the subscription and logs the attempt.
+func (app *application) sendWebhook(
+	ctx context.Context,
+	sub *models.WebhookSubscription,
+	event webhookEvent,
+	attempt int,
+	outboxMessageID *uuid.UUID,
+) (*models.WebhookDelivery, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDelivery{
+		ID:              uuid.New(),
+		SubscriptionID:  sub.ID,
+		OutboxMessageID: outboxMessageID,
+		EventID:         event.ID,
+		EventType:       event.Type,
+		Attempt:         attempt,
+		URL:             sub.URL,
+		CreatedAt:       time.Now(),
+	}
+	start := time.Now()
+	delivery.StatusCode, err = app.postWebhook(ctx, sub, event, body)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	if err := app.store.Webhook.RecordDelivery(ctx, delivery); err != nil {
+		app.logger.Error("error recording webhook delivery", zap.String("subscription", sub.ID.String()), zap.Error(err))
+	}
+	return delivery, err
+}
+
+// postWebhook sends body signed with the subscription's secret. Receivers
+// recompute the HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" and compare it
+// to X-Webhook-Signature. Anything but a 2xx response is a failure.
+func (app *application) postWebhook(ctx context.Context, sub *models.WebhookSubscription, event webhookEvent, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.webhooks.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set("X-Webhook-Id", event.ID.String())
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(sub.Secret, timestamp, body))
+
+	resp, err := app.config.webhooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookCreatedResponse shows the signing secret, which is never shown
+// again.
+type webhookCreatedResponse struct {
+	*models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+func (app *application) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermWebhooksManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage webhooks"))
+		return
+	}
+
+	var payload dtos.CreateWebhookPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+	eventTypes, err := app.webhookEventTypes(payload.EventTypes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := app.checkWebhookURL(ctx, payload.URL); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.authorizeWebhookOrg(w, r, user, payload.OrganizationID, "manage") {
+		return
+	}
+
+	secret, err := app.GenerateInviteToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	sub := &models.WebhookSubscription{
+		ID:             uuid.New(),
+		OrganizationID: payload.OrganizationID,
+		URL:            payload.URL,
+		Secret:         "whsec_" + secret,
+		Description:    payload.Description,
+		Active:         true,
+		EventTypes:     eventTypes,
+		CreatedBy:      uuid.MustParse(user.UserID),
+	}
+	if err := app.store.Webhook.CreateSubscription(ctx, sub); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, webhookCreatedResponse{WebhookSubscription: sub, Secret: sub.Secret},
+		"webhook created successfully, store the secret now as it is not shown again")
+}
+
+// ListWebhooksHandler lists the subscriptions of the organization given by
+// ?organizationId=, or every subscription for super admins.
+func (app *application) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+	if !app.HasPermission(user, PermWebhooksManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage webhooks"))
+		return
+	}
+
+	var orgID uuid.UUID
+	if r.URL.Query().Has("organizationId") {
+		if orgID, err = readUUIDParam(r, "organizationId"); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if !app.authorizeOrgList(w, r, user, orgID) {
+		return
+	}
+
+	subs, err := app.store.Webhook.ListSubscriptions(ctx, orgID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, subs, "webhooks")
+}
+
+func (app *application) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, sub, "webhook")
+}
+
+func (app *application) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	sub, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var payload dtos.UpdateWebhookPayload
+	if err := app.DecodeAndValidate(w, r, &payload); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.URL != nil {
+		if err := app.checkWebhookURL(ctx, *payload.URL); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		updates["url"] = *payload.URL
+	}
+	if payload.Description != nil {
+		updates["description"] = *payload.Description
+	}
+	if payload.Active != nil {
+		updates["active"] = *payload.Active
+	}
+	var eventTypes []string
+	if payload.EventTypes != nil {
+		var err error
+		if eventTypes, err = app.webhookEventTypes(*payload.EventTypes); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if len(updates) == 0 && eventTypes == nil {
+		app.badRequestResponse(w, r, errors.New("nothing to update"))
+		return
+	}
+
+	var updated *models.WebhookSubscription
+	err := app.store.WithTx(ctx, func(tx store.TxStorage) error {
+		if err := tx.Webhook.UpdateSubscription(ctx, sub.ID, updates, eventTypes); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = tx.Webhook.GetSubscription(ctx, sub.ID)
+		return err
+	})
+	if err != nil {
+		app.logger.Error("error updating webhook", zap.String("id", sub.ID.String()), zap.Error(err))
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, updated, "webhook updated successfully")
+}
+
+// DeleteWebhookHandler deletes the subscription with its delivery log.
+// Events already queued for it are dropped.
+func (app *application) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Webhook.DeleteSubscription(r.Context(), sub.ID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, nil, "webhook deleted successfully")
+}
+
+// PingWebhookHandler sends a webhook.ping event to the subscription right
+// away, once, and reports how it went. Paused subscriptions can be pinged
+// too.
+func (app *application) PingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(map[string]uuid.UUID{"subscriptionId": sub.ID})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	event := webhookEvent{
+		ID:             uuid.New(),
+		Type:           models.WebhookEventPing,
+		OrganizationID: sub.OrganizationID,
+		CreatedAt:      time.Now().UTC(),
+		Data:           data,
+	}
+
+	delivery, err := app.sendWebhook(r.Context(), sub, event, 1, nil)
+	if delivery == nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err != nil {
+		app.jsonResponse(w, http.StatusOK, delivery, "webhook ping failed: "+err.Error())
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, delivery, "webhook ping delivered")
+}
+
+// ListWebhookDeliveriesHandler returns the newest delivery attempts of the
+// subscription, ?limit= at a time.
+func (app *application) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := readIntParam(r, "limit", 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	deliveries, err := app.store.Webhook.ListDeliveries(r.Context(), sub.ID, limit)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, deliveries, "webhook deliveries")
+}
+
+// loadWebhook resolves the subscription given by ?id= and checks that the
+// caller may manage it. It writes the error response itself.
+func (app *application) loadWebhook(w http.ResponseWriter, r *http.Request) (*models.WebhookSubscription, bool) {
+	ctx := r.Context()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return nil, false
+	}
+	if !app.HasPermission(user, PermWebhooksManage) {
+		app.unauthorizedResponse(w, r, errors.New("unauthorized to manage webhooks"))
+		return nil, false
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	sub, err := app.store.Webhook.GetSubscription(ctx, id)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !app.authorizeWebhookOrg(w, r, user, sub.OrganizationID, "manage") {
+		return nil, false
+	}
+
+	return sub, true
+}
+
+// authorizeWebhookOrg lets admins of the organization manage its
+// subscriptions. Global subscriptions are for super admins. It writes the
+// error response itself.
+func (app *application) authorizeWebhookOrg(w http.ResponseWriter, r *http.Request, user UserClaims, orgID *uuid.UUID, action string) bool {
+	if orgID == nil {
+		if isSuperAdmin(user) {
+			return true
+		}
+		app.unauthorizedResponse(w, r, errors.New("only super admins can "+action+" webhooks for every organization"))
+		return false
+	}
+	return app.canAdministerOrg(w, r, user, *orgID, action+" webhooks of")
+}
+
+// webhookEventTypes checks eventTypes against the catalog and drops
+// duplicates.
+func (app *application) webhookEventTypes(eventTypes []string) ([]string, error) {
+	unique := []string{}
+	for _, eventType := range eventTypes {
+		if !slices.Contains(WebhookEventTypes, eventType) {
+			return nil, errors.New("eventTypes must be among [" + strings.Join(WebhookEventTypes, " ") + "]")
+		}
+		if !slices.Contains(unique, eventType) {
+			unique = append(unique, eventType)
+		}
+	}
+	return unique, nil
+}
+
+// checkWebhookURL requires https in production, where payloads carry
+// account details, and refuses hosts that resolve to an address deliveries
+// may not go to.
+func (app *application) checkWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be a valid http or https URL")
+	}
+	if app.config.env == "production" && u.Scheme != "https" {
+		return errors.New("url must use https")
+	}
+	if app.config.webhooks.allowPrivate {
+		return nil
+	}
+
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		addrs = append(addrs, addr)
+	} else if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname()); err != nil {
+		return fmt.Errorf("url host %q does not resolve", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !webhookAddressAllowed(addr) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
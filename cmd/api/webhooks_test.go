@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestWebhookAddressAllowed(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.8", false},
+		{"172.16.4.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.1.2.3", false},
+	}
+	for _, tt := range tests {
+		if got := webhookAddressAllowed(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("webhookAddressAllowed(%s) = %v, want %v", tt.addr, got, tt.allowed)
+		}
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.8/hook",
+		"http://0.0.0.0/hook",
+		"ftp://93.184.216.34/hook",
+		"/hook",
+	} {
+		if err := app.checkWebhookURL(ctx, raw); err == nil {
+			t.Errorf("checkWebhookURL(%q) accepted it", raw)
+		}
+	}
+
+	if err := app.checkWebhookURL(ctx, "https://93.184.216.34/hook"); err != nil {
+		t.Errorf("a public address was refused: %v", err)
+	}
+
+	app.config.webhooks.allowPrivate = true
+	if err := app.checkWebhookURL(ctx, "http://127.0.0.1:8080/hook"); err != nil {
+		t.Errorf("a private address was refused with allowPrivate: %v", err)
+	}
+}
+
+// The address is checked again when connecting, so a host that resolves
+// somewhere else by then is still refused.
+func TestWebhookClientRefusesPrivateDial(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	if _, err := newWebhookClient(false).Get(receiver.URL); !errors.Is(err, errWebhookAddress) {
+		t.Errorf("connecting to %s: %v, want %v", receiver.URL, err, errWebhookAddress)
+	}
+
+	res, err := newWebhookClient(true).Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("connecting with allowPrivate: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("receiver answered %d", res.StatusCode)
+	}
+}
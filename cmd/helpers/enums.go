@@ -1,6 +1,7 @@
 package helpers
 
 var (
-	StatusActive  = "active"
-	StatusPending = "pending"
+	StatusActive    = "active"
+	StatusPending   = "pending"
+	StatusSuspended = "suspended"
 )
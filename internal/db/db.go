@@ -1,7 +1,6 @@
 package db
 
 import (
-	"log"
 	"time"
 
 	"context"
@@ -33,10 +32,6 @@ func New(connStr string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*g
 	sqlDB.SetMaxOpenConns(maxOpenConns)
 	sqlDB.SetMaxIdleConns(maxIdleConns)
 
-	if err := migrate(gormDB); err != nil {
-		return nil, err
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -47,22 +42,6 @@ func New(connStr string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*g
 	return gormDB, nil
 }
 
-func migrate(db *gorm.DB) error {
-	statements := []string{
-		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`,
-	}
-
-	// Execute other SQL statements
-	for _, stmt := range statements {
-		if err := db.Exec(stmt).Error; err != nil {
-			log.Printf("Error executing statement: %s\n%v\n", stmt, err)
-			return err
-		}
-	}
-
-	return nil
-}
-
 func ConnectToRedis(addr, username, password string) (*redis.Client, error) {
 	ctx := context.Background()
 
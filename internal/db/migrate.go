@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the pg_advisory_lock key held while migrating so that
+// replicas starting at the same time apply migrations one after another.
+const migrationLockKey int64 = 0x72626163 // "rbac"
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		body, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a single connection that holds the migration advisory
+// lock for the duration of the call.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		checksum   text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if a, ok := applied[mig.Version]; ok {
+				if a.checksum != mig.Checksum {
+					return fmt.Errorf("%w: %d_%s", ErrMigrationModified, mig.Version, mig.Name)
+				}
+				continue
+			}
+
+			if err := m.apply(ctx, conn, mig.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+					mig.Version, mig.Name, mig.Checksum,
+				)
+				return err
+			}); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied steps migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, mig.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("rolling back migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if a, ok := applied[mig.Version]; ok {
+				appliedAt := a.appliedAt
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+				status.Modified = a.checksum != mig.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []MigrationStatus
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s)
+		}
+	}
+	return pending, nil
+}
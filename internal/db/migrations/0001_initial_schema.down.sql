@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS outbox_messages;
+DROP TABLE IF EXISTS user_invites;
+DROP TABLE IF EXISTS admin_invites;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS admins;
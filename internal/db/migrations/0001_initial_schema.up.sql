@@ -0,0 +1,86 @@
+-- Baseline schema. Statements are idempotent so databases that were
+-- previously created by GORM's AutoMigrate can adopt versioned migrations.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS admins (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name        text NOT NULL,
+    email       text NOT NULL,
+    role        text NOT NULL,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    status      varchar(20) DEFAULT 'pending',
+    created_by  uuid,
+    super_admin uuid,
+    password    text NOT NULL,
+    CONSTRAINT chk_admins_status CHECK (status IN ('active', 'pending'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_admins_email ON admins (email);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name        text NOT NULL,
+    email       text NOT NULL,
+    description text,
+    website     text,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    admin_id    uuid,
+    CONSTRAINT fk_admins_organizations FOREIGN KEY (admin_id) REFERENCES admins (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_email ON organizations (email);
+
+CREATE TABLE IF NOT EXISTS users (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name            text NOT NULL,
+    email           text NOT NULL,
+    password        text,
+    role            text NOT NULL,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    status          varchar(20) DEFAULT 'pending',
+    organization_id uuid,
+    CONSTRAINT chk_users_status CHECK (status IN ('active', 'pending')),
+    CONSTRAINT fk_organizations_users FOREIGN KEY (organization_id) REFERENCES organizations (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS admin_invites (
+    id         uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    admin_id   uuid,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_invites (
+    id         uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id    uuid NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    created_at timestamptz NOT NULL,
+    email      text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind            text NOT NULL,
+    aggregate_type  text,
+    aggregate_id    uuid,
+    payload         jsonb NOT NULL,
+    status          varchar(20) DEFAULT 'pending',
+    attempts        bigint NOT NULL DEFAULT 0,
+    max_attempts    bigint NOT NULL,
+    next_attempt_at timestamptz NOT NULL,
+    locked_until    timestamptz,
+    last_error      text,
+    delivered_at    timestamptz,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_outbox_messages_status CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_due
+    ON outbox_messages (next_attempt_at)
+    WHERE status = 'pending';
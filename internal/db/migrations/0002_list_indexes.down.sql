@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_user_invites_user_id;
+DROP INDEX IF EXISTS idx_admin_invites_admin_id;
+DROP INDEX IF EXISTS idx_admins_created_at;
+DROP INDEX IF EXISTS idx_users_org_created_at;
+DROP INDEX IF EXISTS idx_organizations_admin_id;
+DROP INDEX IF EXISTS idx_organizations_created_at;
+DROP INDEX IF EXISTS idx_admins_search;
+DROP INDEX IF EXISTS idx_users_search;
+DROP INDEX IF EXISTS idx_organizations_search;
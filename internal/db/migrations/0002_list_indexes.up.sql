@@ -0,0 +1,19 @@
+-- Full-text search over name and email. The expression must stay identical to
+-- searchExpr in internal/store/pagination.go or the planner won't use it.
+CREATE INDEX idx_organizations_search ON organizations USING gin (
+    to_tsvector('simple', coalesce(name, '') || ' ' || regexp_replace(coalesce(email, ''), '[@.]', ' ', 'g'))
+);
+CREATE INDEX idx_users_search ON users USING gin (
+    to_tsvector('simple', coalesce(name, '') || ' ' || regexp_replace(coalesce(email, ''), '[@.]', ' ', 'g'))
+);
+CREATE INDEX idx_admins_search ON admins USING gin (
+    to_tsvector('simple', coalesce(name, '') || ' ' || regexp_replace(coalesce(email, ''), '[@.]', ' ', 'g'))
+);
+
+-- Keyset pagination indexes for the default sort.
+CREATE INDEX idx_organizations_created_at ON organizations (created_at, id);
+CREATE INDEX idx_organizations_admin_id ON organizations (admin_id, created_at, id);
+CREATE INDEX idx_users_org_created_at ON users (organization_id, created_at, id);
+CREATE INDEX idx_admins_created_at ON admins (created_at, id);
+CREATE INDEX idx_admin_invites_admin_id ON admin_invites (admin_id, created_at, id);
+CREATE INDEX idx_user_invites_user_id ON user_invites (user_id, created_at, id);
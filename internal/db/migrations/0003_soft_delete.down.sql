@@ -0,0 +1,20 @@
+-- Soft-deleted rows are purged first, otherwise the full unique indexes below
+-- can't be rebuilt.
+DELETE FROM user_invites WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DELETE FROM admin_invites WHERE deleted_at IS NOT NULL;
+DELETE FROM organizations WHERE deleted_at IS NOT NULL;
+DELETE FROM admins WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_admins_email;
+CREATE UNIQUE INDEX idx_admins_email ON admins (email);
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+DROP INDEX idx_organizations_email;
+CREATE UNIQUE INDEX idx_organizations_email ON organizations (email);
+
+ALTER TABLE user_invites DROP COLUMN deleted_at;
+ALTER TABLE admin_invites DROP COLUMN deleted_at;
+ALTER TABLE admins DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE organizations DROP COLUMN deleted_at;
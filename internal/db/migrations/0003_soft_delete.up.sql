@@ -0,0 +1,21 @@
+ALTER TABLE organizations ADD COLUMN deleted_at timestamptz;
+ALTER TABLE users ADD COLUMN deleted_at timestamptz;
+ALTER TABLE admins ADD COLUMN deleted_at timestamptz;
+ALTER TABLE admin_invites ADD COLUMN deleted_at timestamptz;
+ALTER TABLE user_invites ADD COLUMN deleted_at timestamptz;
+
+-- Only deleted rows are ever looked up by deleted_at (restore and purge).
+CREATE INDEX idx_organizations_deleted_at ON organizations (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_admins_deleted_at ON admins (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_admin_invites_deleted_at ON admin_invites (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_user_invites_deleted_at ON user_invites (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Emails only need to be unique among live rows, so the address of a deleted
+-- account can be reused while it waits to be purged.
+DROP INDEX idx_organizations_email;
+CREATE UNIQUE INDEX idx_organizations_email ON organizations (email) WHERE deleted_at IS NULL;
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deleted_at IS NULL;
+DROP INDEX idx_admins_email;
+CREATE UNIQUE INDEX idx_admins_email ON admins (email) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- Suspended admins stay locked out as pending rather than being reactivated.
+UPDATE admins SET status = 'pending' WHERE status = 'suspended';
+ALTER TABLE admins DROP CONSTRAINT chk_admins_status;
+ALTER TABLE admins ADD CONSTRAINT chk_admins_status CHECK (status IN ('active', 'pending'));
@@ -0,0 +1,2 @@
+ALTER TABLE admins DROP CONSTRAINT chk_admins_status;
+ALTER TABLE admins ADD CONSTRAINT chk_admins_status CHECK (status IN ('active', 'pending', 'suspended'));
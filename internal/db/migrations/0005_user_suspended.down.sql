@@ -0,0 +1,4 @@
+-- Suspended users stay locked out as pending rather than being reactivated.
+UPDATE users SET status = 'pending' WHERE status = 'suspended';
+ALTER TABLE users DROP CONSTRAINT chk_users_status;
+ALTER TABLE users ADD CONSTRAINT chk_users_status CHECK (status IN ('active', 'pending'));
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP CONSTRAINT chk_users_status;
+ALTER TABLE users ADD CONSTRAINT chk_users_status CHECK (status IN ('active', 'pending', 'suspended'));
@@ -0,0 +1,6 @@
+DROP TABLE organization_suspensions;
+
+ALTER TABLE organizations DROP CONSTRAINT chk_organizations_status;
+ALTER TABLE organizations DROP COLUMN suspension_reason;
+ALTER TABLE organizations DROP COLUMN suspended_at;
+ALTER TABLE organizations DROP COLUMN status;
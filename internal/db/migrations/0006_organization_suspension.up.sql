@@ -0,0 +1,17 @@
+ALTER TABLE organizations ADD COLUMN status varchar(20) NOT NULL DEFAULT 'active';
+ALTER TABLE organizations ADD COLUMN suspended_at timestamptz;
+ALTER TABLE organizations ADD COLUMN suspension_reason text;
+ALTER TABLE organizations ADD CONSTRAINT chk_organizations_status CHECK (status IN ('active', 'suspended'));
+
+CREATE TABLE organization_suspensions (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- History goes when the organization is purged.
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    action          text NOT NULL,
+    reason          text,
+    actor_id        uuid NOT NULL,
+    actor_role      text NOT NULL,
+    created_at      timestamptz,
+    CONSTRAINT chk_organization_suspensions_action CHECK (action IN ('suspend', 'unsuspend'))
+);
+CREATE INDEX idx_organization_suspensions_org ON organization_suspensions (organization_id, created_at DESC);
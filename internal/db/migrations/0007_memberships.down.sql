@@ -0,0 +1,17 @@
+-- Users keep the organization they joined first; other memberships are lost.
+ALTER TABLE users ADD COLUMN organization_id uuid;
+
+UPDATE users u
+SET organization_id = m.organization_id,
+    status = CASE WHEN m.status = 'suspended' AND u.status = 'active' THEN 'suspended' ELSE u.status END
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, organization_id, status
+    FROM memberships
+    ORDER BY user_id, deleted_at IS NOT NULL, created_at
+) m
+WHERE m.user_id = u.id;
+
+ALTER TABLE users
+    ADD CONSTRAINT fk_organizations_users FOREIGN KEY (organization_id) REFERENCES organizations (id);
+
+DROP TABLE memberships;
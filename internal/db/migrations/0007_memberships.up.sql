@@ -0,0 +1,33 @@
+CREATE TABLE memberships (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id         uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    role            text NOT NULL,
+    status          varchar(20) NOT NULL DEFAULT 'active',
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    CONSTRAINT chk_memberships_status CHECK (status IN ('active', 'suspended'))
+);
+CREATE UNIQUE INDEX idx_memberships_user_org ON memberships (user_id, organization_id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_memberships_org ON memberships (organization_id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_memberships_deleted_at ON memberships (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Every user becomes a member of the organization they were created in, with
+-- the role they had. Suspension used to be set by organization admins on the
+-- user, so it moves to the membership.
+INSERT INTO memberships (user_id, organization_id, role, status, created_at, updated_at, deleted_at)
+SELECT id,
+       organization_id,
+       role,
+       CASE WHEN status = 'suspended' THEN 'suspended' ELSE 'active' END,
+       created_at,
+       updated_at,
+       deleted_at
+FROM users
+WHERE organization_id IS NOT NULL;
+
+UPDATE users SET status = 'active' WHERE status = 'suspended';
+
+ALTER TABLE users DROP CONSTRAINT fk_organizations_users;
+ALTER TABLE users DROP COLUMN organization_id;
@@ -0,0 +1,29 @@
+CREATE TABLE groups (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Groups go when the organization is purged.
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    -- Deleting a parent lifts its children to the top level.
+    parent_id       uuid REFERENCES groups (id) ON DELETE SET NULL,
+    name            text NOT NULL,
+    description     text,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_groups_parent CHECK (parent_id <> id)
+);
+CREATE UNIQUE INDEX idx_groups_org_name ON groups (organization_id, name);
+CREATE INDEX idx_groups_parent ON groups (parent_id) WHERE parent_id IS NOT NULL;
+
+CREATE TABLE group_members (
+    group_id   uuid NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    user_id    uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamptz,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_group_members_user ON group_members (user_id);
+
+CREATE TABLE group_roles (
+    group_id   uuid NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    role       text NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (group_id, role)
+);
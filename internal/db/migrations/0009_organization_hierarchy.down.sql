@@ -0,0 +1,4 @@
+DROP INDEX idx_organizations_parent;
+ALTER TABLE organizations DROP CONSTRAINT chk_organizations_parent;
+ALTER TABLE organizations DROP COLUMN inherit_permissions;
+ALTER TABLE organizations DROP COLUMN parent_id;
@@ -0,0 +1,5 @@
+-- Purging a parent lifts its children to the top level.
+ALTER TABLE organizations ADD COLUMN parent_id uuid REFERENCES organizations (id) ON DELETE SET NULL;
+ALTER TABLE organizations ADD COLUMN inherit_permissions boolean NOT NULL DEFAULT true;
+ALTER TABLE organizations ADD CONSTRAINT chk_organizations_parent CHECK (parent_id <> id);
+CREATE INDEX idx_organizations_parent ON organizations (parent_id) WHERE parent_id IS NOT NULL;
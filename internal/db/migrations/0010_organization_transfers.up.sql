@@ -0,0 +1,22 @@
+CREATE TABLE organization_transfers (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- History goes when the organization is purged.
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    -- Admin ids are kept without foreign keys so the history survives purges.
+    from_admin_id   uuid NOT NULL,
+    to_admin_id     uuid NOT NULL,
+    initiated_by    uuid NOT NULL,
+    token_hash      text NOT NULL,
+    status          varchar(20) NOT NULL DEFAULT 'pending',
+    expires_at      timestamptz NOT NULL,
+    resolved_by     uuid,
+    resolved_at     timestamptz,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_organization_transfers_status CHECK (status IN ('pending', 'accepted', 'cancelled', 'expired'))
+);
+-- At most one transfer per organization can be pending.
+CREATE UNIQUE INDEX idx_organization_transfers_pending ON organization_transfers (organization_id) WHERE status = 'pending';
+CREATE UNIQUE INDEX idx_organization_transfers_token ON organization_transfers (token_hash);
+CREATE INDEX idx_organization_transfers_org ON organization_transfers (organization_id, created_at DESC);
+CREATE INDEX idx_organization_transfers_to_admin ON organization_transfers (to_admin_id) WHERE status = 'pending';
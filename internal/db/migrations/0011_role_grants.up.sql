@@ -0,0 +1,27 @@
+CREATE TABLE role_grants (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Grants name an admin or a user, so the account has no foreign key.
+    account_type    varchar(10) NOT NULL,
+    account_id      uuid NOT NULL,
+    -- User grants apply inside one organization and go when it is purged.
+    organization_id uuid REFERENCES organizations (id) ON DELETE CASCADE,
+    role            text NOT NULL,
+    kind            varchar(20) NOT NULL DEFAULT 'assigned',
+    valid_from      timestamptz NOT NULL,
+    valid_until     timestamptz NOT NULL,
+    justification   text,
+    granted_by      uuid NOT NULL,
+    notified_at     timestamptz,
+    expired_at      timestamptz,
+    revoked_at      timestamptz,
+    revoked_by      uuid,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_role_grants_account_type CHECK (account_type IN ('admin', 'user')),
+    CONSTRAINT chk_role_grants_kind CHECK (kind IN ('assigned', 'eligible', 'elevated')),
+    CONSTRAINT chk_role_grants_window CHECK (valid_until > valid_from),
+    CONSTRAINT chk_role_grants_scope CHECK ((account_type = 'user') = (organization_id IS NOT NULL))
+);
+CREATE INDEX idx_role_grants_account ON role_grants (account_id, valid_until) WHERE revoked_at IS NULL;
+CREATE INDEX idx_role_grants_expiry ON role_grants (valid_until) WHERE revoked_at IS NULL AND expired_at IS NULL;
+CREATE INDEX idx_role_grants_org ON role_grants (organization_id, created_at DESC);
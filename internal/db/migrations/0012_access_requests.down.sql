@@ -0,0 +1,8 @@
+DROP TABLE access_decisions;
+DROP TABLE access_requests;
+DROP TABLE access_approvers;
+DROP TABLE access_policies;
+
+ALTER TABLE role_grants DROP CONSTRAINT chk_role_grants_target;
+ALTER TABLE role_grants DROP COLUMN permission;
+ALTER TABLE role_grants ALTER COLUMN role DROP DEFAULT;
@@ -0,0 +1,57 @@
+-- A grant gives either a role or a single permission.
+ALTER TABLE role_grants ALTER COLUMN role SET DEFAULT '';
+ALTER TABLE role_grants ADD COLUMN permission text NOT NULL DEFAULT '';
+ALTER TABLE role_grants ADD CONSTRAINT chk_role_grants_target CHECK ((role <> '') <> (permission <> ''));
+
+CREATE TABLE access_policies (
+    organization_id uuid PRIMARY KEY REFERENCES organizations (id) ON DELETE CASCADE,
+    quorum          integer NOT NULL DEFAULT 1,
+    updated_by      uuid NOT NULL,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_access_policies_quorum CHECK (quorum >= 1)
+);
+
+CREATE TABLE access_approvers (
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    account_id      uuid NOT NULL,
+    account_type    varchar(10) NOT NULL,
+    created_at      timestamptz,
+    CONSTRAINT access_approvers_pkey PRIMARY KEY (organization_id, account_id),
+    CONSTRAINT chk_access_approvers_account_type CHECK (account_type IN ('admin', 'user'))
+);
+
+CREATE TABLE access_requests (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    requester_id    uuid NOT NULL,
+    role            text NOT NULL DEFAULT '',
+    permission      text NOT NULL DEFAULT '',
+    justification   text NOT NULL,
+    grant_minutes   integer NOT NULL,
+    status          varchar(20) NOT NULL DEFAULT 'pending',
+    expires_at      timestamptz NOT NULL,
+    resolved_at     timestamptz,
+    grant_id        uuid REFERENCES role_grants (id) ON DELETE SET NULL,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_access_requests_status CHECK (status IN ('pending', 'approved', 'rejected', 'expired', 'cancelled')),
+    CONSTRAINT chk_access_requests_target CHECK ((role <> '') <> (permission <> '')),
+    CONSTRAINT chk_access_requests_grant_minutes CHECK (grant_minutes > 0)
+);
+-- A user can only have one pending request for the same access.
+CREATE UNIQUE INDEX idx_access_requests_pending ON access_requests (organization_id, requester_id, role, permission)
+    WHERE status = 'pending';
+CREATE INDEX idx_access_requests_org ON access_requests (organization_id, created_at DESC);
+CREATE INDEX idx_access_requests_expiry ON access_requests (expires_at) WHERE status = 'pending';
+
+CREATE TABLE access_decisions (
+    request_id    uuid NOT NULL REFERENCES access_requests (id) ON DELETE CASCADE,
+    approver_id   uuid NOT NULL,
+    approver_type varchar(10) NOT NULL,
+    decision      varchar(10) NOT NULL,
+    comment       text,
+    created_at    timestamptz,
+    CONSTRAINT access_decisions_pkey PRIMARY KEY (request_id, approver_id),
+    CONSTRAINT chk_access_decisions_decision CHECK (decision IN ('approve', 'reject'))
+);
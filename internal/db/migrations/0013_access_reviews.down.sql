@@ -0,0 +1,3 @@
+DROP TABLE access_review_items;
+DROP TABLE access_reviewers;
+DROP TABLE access_reviews;
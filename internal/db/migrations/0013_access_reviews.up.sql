@@ -0,0 +1,51 @@
+-- Reviews are audit evidence, so they keep no foreign keys to the accounts,
+-- organizations and grants they list and outlive them.
+CREATE TABLE access_reviews (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name        text NOT NULL,
+    scope_type  varchar(20) NOT NULL,
+    scope_value text NOT NULL,
+    status      varchar(20) NOT NULL DEFAULT 'open',
+    due_at      timestamptz,
+    created_by  uuid NOT NULL,
+    closed_by   uuid,
+    closed_at   timestamptz,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    CONSTRAINT chk_access_reviews_scope_type CHECK (scope_type IN ('organization', 'role', 'permission')),
+    CONSTRAINT chk_access_reviews_status CHECK (status IN ('open', 'closed'))
+);
+CREATE INDEX idx_access_reviews_created ON access_reviews (created_at DESC);
+
+CREATE TABLE access_reviewers (
+    review_id  uuid NOT NULL REFERENCES access_reviews (id) ON DELETE CASCADE,
+    admin_id   uuid NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT access_reviewers_pkey PRIMARY KEY (review_id, admin_id)
+);
+
+CREATE TABLE access_review_items (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    review_id       uuid NOT NULL REFERENCES access_reviews (id) ON DELETE CASCADE,
+    account_type    varchar(10) NOT NULL,
+    account_id      uuid NOT NULL,
+    account_email   text NOT NULL DEFAULT '',
+    source          varchar(20) NOT NULL,
+    source_id       uuid NOT NULL,
+    organization_id uuid,
+    role            text NOT NULL DEFAULT '',
+    permission      text NOT NULL DEFAULT '',
+    valid_until     timestamptz,
+    decision        varchar(20) NOT NULL DEFAULT 'pending',
+    comment         text,
+    reviewed_by     uuid,
+    reviewed_at     timestamptz,
+    applied_at      timestamptz,
+    apply_note      text NOT NULL DEFAULT '',
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    CONSTRAINT chk_access_review_items_account_type CHECK (account_type IN ('admin', 'user')),
+    CONSTRAINT chk_access_review_items_source CHECK (source IN ('admin', 'membership', 'grant')),
+    CONSTRAINT chk_access_review_items_decision CHECK (decision IN ('pending', 'certified', 'revoked'))
+);
+CREATE INDEX idx_access_review_items_review ON access_review_items (review_id, account_id);
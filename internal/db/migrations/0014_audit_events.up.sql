@@ -0,0 +1,38 @@
+-- Audit events are evidence: they keep no foreign keys, so they outlive the
+-- accounts and resources they name, and rows can only ever be added.
+CREATE TABLE audit_events (
+    id              uuid PRIMARY KEY,
+    seq             bigint NOT NULL,
+    actor_type      varchar(10) NOT NULL DEFAULT '',
+    actor_id        uuid,
+    actor_role      text NOT NULL DEFAULT '',
+    action          text NOT NULL,
+    resource_type   text NOT NULL,
+    resource_id     uuid,
+    organization_id uuid,
+    before          jsonb,
+    after           jsonb,
+    ip              text NOT NULL DEFAULT '',
+    request_id      text NOT NULL DEFAULT '',
+    outcome         varchar(10) NOT NULL,
+    status          integer NOT NULL,
+    created_at      timestamptz NOT NULL,
+    prev_hash       text NOT NULL DEFAULT '',
+    hash            text NOT NULL,
+    CONSTRAINT audit_events_seq_key UNIQUE (seq),
+    CONSTRAINT chk_audit_events_outcome CHECK (outcome IN ('success', 'denied', 'failure'))
+);
+CREATE INDEX idx_audit_events_created ON audit_events (created_at DESC, id);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, created_at DESC);
+CREATE INDEX idx_audit_events_resource ON audit_events (resource_id, created_at DESC);
+CREATE INDEX idx_audit_events_org ON audit_events (organization_id, created_at DESC);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,20 @@
+-- The decision log is sampled telemetry rather than evidence: it keeps no
+-- foreign keys and is purged after its retention.
+CREATE TABLE authz_decisions (
+    id              uuid PRIMARY KEY,
+    subject_type    varchar(10) NOT NULL DEFAULT '',
+    subject_id      uuid,
+    subject_role    text NOT NULL DEFAULT '',
+    organization_id uuid,
+    check_kind      varchar(20) NOT NULL,
+    permission      text NOT NULL DEFAULT '',
+    resource        text NOT NULL DEFAULT '',
+    outcome         varchar(10) NOT NULL,
+    latency_ns      bigint NOT NULL,
+    request_id      text NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL,
+    CONSTRAINT chk_authz_decisions_outcome CHECK (outcome IN ('allow', 'deny'))
+);
+CREATE INDEX idx_authz_decisions_created ON authz_decisions (created_at DESC);
+CREATE INDEX idx_authz_decisions_subject ON authz_decisions (subject_id, created_at DESC);
+CREATE INDEX idx_authz_decisions_denied ON authz_decisions (created_at DESC) WHERE outcome = 'deny';
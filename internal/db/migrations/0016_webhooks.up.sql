@@ -0,0 +1,36 @@
+CREATE TABLE webhook_subscriptions (
+    id              uuid PRIMARY KEY,
+    -- NULL subscribes to every organization.
+    organization_id uuid REFERENCES organizations (id) ON DELETE CASCADE,
+    url             text NOT NULL,
+    secret          text NOT NULL,
+    description     text NOT NULL DEFAULT '',
+    active          boolean NOT NULL,
+    created_by      uuid NOT NULL,
+    created_at      timestamptz,
+    updated_at      timestamptz
+);
+CREATE INDEX idx_webhook_subscriptions_org ON webhook_subscriptions (organization_id) WHERE active;
+
+-- A subscription without event types receives every event.
+CREATE TABLE webhook_event_types (
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_type      text NOT NULL,
+    PRIMARY KEY (subscription_id, event_type)
+);
+
+CREATE TABLE webhook_deliveries (
+    id                uuid PRIMARY KEY,
+    subscription_id   uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    -- Outbox messages are never purged, but the log does not depend on them.
+    outbox_message_id uuid,
+    event_id          uuid NOT NULL,
+    event_type        text NOT NULL,
+    attempt           integer NOT NULL,
+    url               text NOT NULL,
+    status_code       integer NOT NULL DEFAULT 0,
+    error             text NOT NULL DEFAULT '',
+    duration_ms       bigint NOT NULL,
+    created_at        timestamptz NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at DESC);
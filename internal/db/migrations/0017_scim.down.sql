@@ -0,0 +1,3 @@
+ALTER TABLE groups DROP COLUMN external_id;
+ALTER TABLE memberships DROP COLUMN external_id;
+DROP TABLE scim_tokens;
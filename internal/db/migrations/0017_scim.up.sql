@@ -0,0 +1,15 @@
+CREATE TABLE scim_tokens (
+    id              uuid PRIMARY KEY,
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    token_hash      text NOT NULL,
+    description     text NOT NULL DEFAULT '',
+    created_by      uuid NOT NULL,
+    last_used_at    timestamptz,
+    revoked_at      timestamptz,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX idx_scim_tokens_hash ON scim_tokens (token_hash);
+CREATE INDEX idx_scim_tokens_org ON scim_tokens (organization_id);
+
+ALTER TABLE memberships ADD COLUMN external_id text NOT NULL DEFAULT '';
+ALTER TABLE groups ADD COLUMN external_id text NOT NULL DEFAULT '';
@@ -0,0 +1,29 @@
+CREATE TABLE oidc_providers (
+    organization_id  uuid PRIMARY KEY REFERENCES organizations (id) ON DELETE CASCADE,
+    issuer           text NOT NULL,
+    client_id        text NOT NULL,
+    client_secret    text NOT NULL,
+    scopes           text NOT NULL,
+    email_claim      text NOT NULL,
+    name_claim       text NOT NULL,
+    groups_claim     text NOT NULL,
+    role_mappings    jsonb NOT NULL DEFAULT '[]',
+    default_role     text NOT NULL,
+    jit_provisioning boolean NOT NULL DEFAULT false,
+    sso_only         boolean NOT NULL DEFAULT false,
+    updated_by       uuid NOT NULL,
+    created_at       timestamptz,
+    updated_at       timestamptz
+);
+
+CREATE TABLE oidc_login_states (
+    id              uuid PRIMARY KEY,
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    state_hash      text NOT NULL,
+    code_verifier   text NOT NULL,
+    nonce           text NOT NULL,
+    expires_at      timestamptz NOT NULL,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX idx_oidc_login_states_hash ON oidc_login_states (state_hash);
+CREATE INDEX idx_oidc_login_states_expires ON oidc_login_states (expires_at);
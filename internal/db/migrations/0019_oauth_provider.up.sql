@@ -0,0 +1,48 @@
+CREATE TABLE oauth_clients (
+    id            uuid PRIMARY KEY,
+    name          text NOT NULL,
+    secret_hash   text NOT NULL DEFAULT '',
+    public        boolean NOT NULL DEFAULT false,
+    redirect_uris jsonb NOT NULL DEFAULT '[]',
+    grant_types   jsonb NOT NULL DEFAULT '[]',
+    scopes        text NOT NULL,
+    created_by    uuid NOT NULL,
+    created_at    timestamptz,
+    updated_at    timestamptz
+);
+
+CREATE TABLE oauth_authorization_codes (
+    id              uuid PRIMARY KEY,
+    code_hash       text NOT NULL,
+    client_id       uuid NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    subject_id      uuid NOT NULL,
+    subject_role    text NOT NULL,
+    organization_id uuid REFERENCES organizations (id) ON DELETE CASCADE,
+    redirect_uri    text NOT NULL,
+    scope           text NOT NULL,
+    nonce           text NOT NULL DEFAULT '',
+    code_challenge  text NOT NULL,
+    expires_at      timestamptz NOT NULL,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX idx_oauth_codes_hash ON oauth_authorization_codes (code_hash);
+CREATE INDEX idx_oauth_codes_expires ON oauth_authorization_codes (expires_at);
+
+CREATE TABLE oauth_tokens (
+    id              uuid PRIMARY KEY,
+    token_hash      text NOT NULL,
+    kind            text NOT NULL,
+    client_id       uuid NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    subject_id      uuid,
+    subject_role    text NOT NULL DEFAULT '',
+    organization_id uuid REFERENCES organizations (id) ON DELETE CASCADE,
+    scope           text NOT NULL,
+    family_id       uuid NOT NULL,
+    expires_at      timestamptz NOT NULL,
+    revoked_at      timestamptz,
+    created_at      timestamptz,
+    CONSTRAINT chk_oauth_tokens_kind CHECK (kind IN ('access', 'refresh'))
+);
+CREATE UNIQUE INDEX idx_oauth_tokens_hash ON oauth_tokens (token_hash);
+CREATE INDEX idx_oauth_tokens_family ON oauth_tokens (family_id);
+CREATE INDEX idx_oauth_tokens_expires ON oauth_tokens (expires_at);
@@ -0,0 +1,3 @@
+DROP TABLE saml_assertions;
+DROP TABLE saml_requests;
+DROP TABLE saml_providers;
@@ -0,0 +1,34 @@
+CREATE TABLE saml_providers (
+    organization_id  uuid PRIMARY KEY REFERENCES organizations (id) ON DELETE CASCADE,
+    entity_id        text NOT NULL,
+    sso_url          text NOT NULL,
+    certificates     jsonb NOT NULL DEFAULT '[]',
+    metadata_url     text NOT NULL DEFAULT '',
+    email_attribute  text NOT NULL,
+    name_attribute   text NOT NULL,
+    groups_attribute text NOT NULL,
+    role_mappings    jsonb NOT NULL DEFAULT '[]',
+    default_role     text NOT NULL,
+    jit_provisioning boolean NOT NULL DEFAULT false,
+    sso_only         boolean NOT NULL DEFAULT false,
+    updated_by       uuid NOT NULL,
+    created_at       timestamptz,
+    updated_at       timestamptz
+);
+
+CREATE TABLE saml_requests (
+    id              text PRIMARY KEY,
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    expires_at      timestamptz NOT NULL,
+    created_at      timestamptz
+);
+CREATE INDEX idx_saml_requests_expires ON saml_requests (expires_at);
+
+CREATE TABLE saml_assertions (
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    assertion_id    text NOT NULL,
+    expires_at      timestamptz NOT NULL,
+    created_at      timestamptz,
+    PRIMARY KEY (organization_id, assertion_id)
+);
+CREATE INDEX idx_saml_assertions_expires ON saml_assertions (expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE magic_links;
+DROP TABLE magic_link_policies;
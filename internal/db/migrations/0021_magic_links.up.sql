@@ -0,0 +1,25 @@
+CREATE TABLE magic_link_policies (
+    organization_id uuid PRIMARY KEY REFERENCES organizations (id) ON DELETE CASCADE,
+    enabled         boolean NOT NULL DEFAULT false,
+    bind_ip         boolean NOT NULL DEFAULT false,
+    bind_device     boolean NOT NULL DEFAULT false,
+    updated_by      uuid NOT NULL,
+    created_at      timestamptz,
+    updated_at      timestamptz
+);
+
+CREATE TABLE magic_links (
+    id              uuid PRIMARY KEY,
+    token_hash      text NOT NULL,
+    user_id         uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email           text NOT NULL,
+    ip_address      text NOT NULL DEFAULT '',
+    device_hash     text NOT NULL DEFAULT '',
+    expires_at      timestamptz NOT NULL,
+    used_at         timestamptz,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX idx_magic_links_token_hash ON magic_links (token_hash);
+CREATE INDEX idx_magic_links_email ON magic_links (email, created_at);
+CREATE INDEX idx_magic_links_expires ON magic_links (expires_at);
@@ -1,6 +1,8 @@
 package dtos
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -40,4 +42,234 @@ type CreateOrganizationPayload struct {
 	Email       string `json:"email" gorm:"uniqueIndex;not null"`
 	Description string `json:"description" gorm:"not null"`
 	Website     string `json:"website" gorm:"not null"`
+
+	ParentID *uuid.UUID `json:"parentId"`
+	// InheritPermissions defaults to true.
+	InheritPermissions *bool `json:"inheritPermissions"`
+}
+
+type UpdateAdminPayload struct {
+	Name *string `json:"name" validate:"omitempty,min=1"`
+	Role *string `json:"role" validate:"omitempty,oneof=admin super_admin"`
+}
+
+type ReassignOrganizationsPayload struct {
+	ToAdminID uuid.UUID `json:"toAdminId" validate:"required"`
+}
+
+type UpdateMemberPayload struct {
+	Name *string `json:"name" validate:"omitempty,min=1"`
+	Role *string `json:"role"`
+}
+
+type UpdateOrganizationPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1"`
+	Email       *string `json:"email" validate:"omitempty,email"`
+	Description *string `json:"description"`
+	Website     *string `json:"website"`
+
+	InheritPermissions *bool `json:"inheritPermissions"`
+}
+
+type SuspensionPayload struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type SwitchOrganizationPayload struct {
+	OrganizationID uuid.UUID `json:"organizationId" validate:"required"`
+}
+
+type CreateGroupPayload struct {
+	OrganizationID uuid.UUID  `json:"organizationId" validate:"required"`
+	Name           string     `json:"name" validate:"required,max=100"`
+	Description    string     `json:"description" validate:"max=500"`
+	ParentID       *uuid.UUID `json:"parentId"`
+}
+
+// UpdateGroupPayload moves the group to the top level when ParentID is the
+// nil uuid.
+type UpdateGroupPayload struct {
+	Name        *string    `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string    `json:"description" validate:"omitempty,max=500"`
+	ParentID    *uuid.UUID `json:"parentId"`
+}
+
+type GroupMemberPayload struct {
+	UserID uuid.UUID `json:"userId" validate:"required"`
+}
+
+type GroupRolePayload struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// MoveOrganizationPayload moves the organization to the top level when
+// ParentID is omitted.
+type MoveOrganizationPayload struct {
+	ParentID *uuid.UUID `json:"parentId"`
+}
+
+type StartTransferPayload struct {
+	ToAdminID uuid.UUID `json:"toAdminId" validate:"required"`
+}
+
+type AcceptTransferPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// CreateGrantPayload grants Role to an account between ValidFrom (now when
+// omitted) and ValidUntil. User grants name the organization they apply in.
+type CreateGrantPayload struct {
+	AccountType    string     `json:"accountType" validate:"required,oneof=admin user"`
+	AccountID      uuid.UUID  `json:"accountId" validate:"required"`
+	OrganizationID *uuid.UUID `json:"organizationId"`
+	Role           string     `json:"role" validate:"required"`
+	Kind           string     `json:"kind" validate:"omitempty,oneof=assigned eligible"`
+	ValidFrom      *time.Time `json:"validFrom"`
+	ValidUntil     time.Time  `json:"validUntil" validate:"required"`
+	Justification  string     `json:"justification" validate:"max=500"`
+}
+
+type ElevationPayload struct {
+	Role          string `json:"role" validate:"required"`
+	Minutes       int    `json:"minutes" validate:"required,min=1"`
+	Justification string `json:"justification" validate:"required,max=500"`
+}
+
+// AccessRequestPayload asks for either Role or Permission in the caller's
+// organization for Minutes once approved.
+type AccessRequestPayload struct {
+	Role          string `json:"role" validate:"required_without=Permission,excluded_with=Permission"`
+	Permission    string `json:"permission"`
+	Minutes       int    `json:"minutes" validate:"required,min=1"`
+	Justification string `json:"justification" validate:"required,max=500"`
+}
+
+type AccessDecisionPayload struct {
+	Comment string `json:"comment" validate:"max=500"`
+}
+
+type AccessApproverPayload struct {
+	AccountType string    `json:"accountType" validate:"required,oneof=admin user"`
+	AccountID   uuid.UUID `json:"accountId" validate:"required"`
+}
+
+// AccessPolicyPayload replaces an organization's approvers. With no
+// approvers the organization's admins decide.
+type AccessPolicyPayload struct {
+	Quorum    int                     `json:"quorum" validate:"required,min=1"`
+	Approvers []AccessApproverPayload `json:"approvers" validate:"dive"`
+}
+
+// StartReviewPayload starts an access review. ScopeValue is an organization
+// ID, a role or a permission depending on ScopeType. Reviewers default to the
+// caller.
+type StartReviewPayload struct {
+	Name       string      `json:"name" validate:"required,max=200"`
+	ScopeType  string      `json:"scopeType" validate:"required,oneof=organization role permission"`
+	ScopeValue string      `json:"scopeValue" validate:"required"`
+	Reviewers  []uuid.UUID `json:"reviewers"`
+	DueAt      *time.Time  `json:"dueAt"`
+}
+
+type ReviewDecisionPayload struct {
+	Decision string `json:"decision" validate:"required,oneof=certified revoked"`
+	Comment  string `json:"comment" validate:"max=500"`
+}
+
+// CreateWebhookPayload subscribes URL to the events of the organization, or
+// of every organization when OrganizationID is omitted. No EventTypes means
+// every event.
+type CreateWebhookPayload struct {
+	OrganizationID *uuid.UUID `json:"organizationId"`
+	URL            string     `json:"url" validate:"required,http_url,max=2000"`
+	EventTypes     []string   `json:"eventTypes" validate:"dive,required"`
+	Description    string     `json:"description" validate:"max=500"`
+}
+
+// UpdateWebhookPayload replaces the event types when EventTypes is present;
+// an empty list subscribes to every event.
+type UpdateWebhookPayload struct {
+	URL         *string   `json:"url" validate:"omitempty,http_url,max=2000"`
+	EventTypes  *[]string `json:"eventTypes" validate:"omitempty,dive,required"`
+	Description *string   `json:"description" validate:"omitempty,max=500"`
+	Active      *bool     `json:"active"`
+}
+
+type CreateScimTokenPayload struct {
+	OrganizationID uuid.UUID `json:"organizationId" validate:"required"`
+	Description    string    `json:"description" validate:"max=500"`
+}
+
+// SaveOIDCProviderPayload configures the organization's identity provider.
+// ClientSecret can be left out to keep the current one.
+type SaveOIDCProviderPayload struct {
+	OrganizationID  uuid.UUID               `json:"organizationId" validate:"required"`
+	Issuer          string                  `json:"issuer" validate:"required,http_url,max=2000"`
+	ClientID        string                  `json:"clientId" validate:"required,max=500"`
+	ClientSecret    string                  `json:"clientSecret" validate:"max=2000"`
+	Scopes          []string                `json:"scopes" validate:"dive,required"`
+	EmailClaim      string                  `json:"emailClaim" validate:"max=200"`
+	NameClaim       string                  `json:"nameClaim" validate:"max=200"`
+	GroupsClaim     string                  `json:"groupsClaim" validate:"max=200"`
+	RoleMappings    []SSORoleMappingPayload `json:"roleMappings" validate:"dive"`
+	DefaultRole     string                  `json:"defaultRole"`
+	JITProvisioning bool                    `json:"jitProvisioning"`
+	SSOOnly         bool                    `json:"ssoOnly"`
+}
+
+type SSORoleMappingPayload struct {
+	Group string `json:"group" validate:"required"`
+	Role  string `json:"role" validate:"required"`
+}
+
+// SaveSAMLProviderPayload configures the organization's SAML identity
+// provider from its metadata, given inline or as a URL to fetch it from.
+type SaveSAMLProviderPayload struct {
+	OrganizationID  uuid.UUID               `json:"organizationId" validate:"required"`
+	MetadataXML     string                  `json:"metadataXml" validate:"max=1000000"`
+	MetadataURL     string                  `json:"metadataUrl" validate:"omitempty,http_url,max=2000"`
+	EmailAttribute  string                  `json:"emailAttribute" validate:"max=500"`
+	NameAttribute   string                  `json:"nameAttribute" validate:"max=500"`
+	GroupsAttribute string                  `json:"groupsAttribute" validate:"max=500"`
+	RoleMappings    []SSORoleMappingPayload `json:"roleMappings" validate:"dive"`
+	DefaultRole     string                  `json:"defaultRole"`
+	JITProvisioning bool                    `json:"jitProvisioning"`
+	SSOOnly         bool                    `json:"ssoOnly"`
+}
+
+// CreateOAuthClientPayload registers an application that signs its users in
+// through us. Scopes are space-separated.
+type CreateOAuthClientPayload struct {
+	Name         string   `json:"name" validate:"required,max=200"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirectUris" validate:"dive,required,max=2000"`
+	GrantTypes   []string `json:"grantTypes" validate:"dive,oneof=authorization_code refresh_token client_credentials"`
+	Scopes       string   `json:"scopes" validate:"max=1000"`
+}
+
+type UpdateOAuthClientPayload struct {
+	Name         *string   `json:"name" validate:"omitempty,max=200"`
+	RedirectURIs *[]string `json:"redirectUris" validate:"omitempty,dive,required,max=2000"`
+	GrantTypes   *[]string `json:"grantTypes" validate:"omitempty,dive,oneof=authorization_code refresh_token client_credentials"`
+	Scopes       *string   `json:"scopes" validate:"omitempty,max=1000"`
+}
+
+type MagicLinkPolicyPayload struct {
+	Enabled    bool `json:"enabled"`
+	BindIP     bool `json:"bindIp"`
+	BindDevice bool `json:"bindDevice"`
+}
+
+// RequestMagicLinkPayload asks for a link signing the member with the email
+// in to the organization.
+type RequestMagicLinkPayload struct {
+	Email          string    `json:"email" validate:"required,email"`
+	OrganizationID uuid.UUID `json:"organizationId" validate:"required"`
+}
+
+// MagicLinkLoginPayload redeems a link. DeviceToken is the one handed out
+// with the link, for organizations that bind links to the device.
+type MagicLinkLoginPayload struct {
+	Token       string `json:"token" validate:"required,max=200"`
+	DeviceToken string `json:"deviceToken" validate:"max=200"`
 }
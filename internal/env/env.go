@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(key, fallback string) string {
@@ -27,3 +28,45 @@ func GetInt(key string, fallback int) int {
 	return valueInt
 
 }
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	valueDuration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+
+	return valueDuration
+
+}
+
+func GetBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	valueBool, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+
+	return valueBool
+
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	valueFloat, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return valueFloat
+
+}
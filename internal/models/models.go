@@ -1,23 +1,42 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name      string    `json:"name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"password"`
-	Role      string    `json:"role" gorm:"not null"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	Status    string    `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('active','pending')"`
+	ID        uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name      string         `json:"name" gorm:"not null"`
+	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
+	Password  string         `json:"-"`
+	Role      string         `json:"role" gorm:"not null"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Status    string         `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('active','pending','suspended')"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 
-	OrganizationID uuid.UUID    `json:"organizationId"`
-	Organization   Organization ` json:"-"  gorm:"foreignKey:OrganizationID"`
+	Memberships []Membership `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// Membership places a user in an organization. Role and status are per
+// organization, so one account can belong to several organizations.
+type Membership struct {
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID         uuid.UUID      `json:"userId" gorm:"type:uuid;not null"`
+	OrganizationID uuid.UUID      `json:"organizationId" gorm:"type:uuid;not null"`
+	Role           string         `json:"role" gorm:"not null"`
+	Status         string         `json:"status" gorm:"type:varchar(20);default:'active';check:status IN ('active','suspended')"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+
+	// ExternalID is the identifier the organization's identity provider
+	// gave the user when it provisioned them through SCIM.
+	ExternalID string `json:"externalId,omitempty" gorm:"not null;default:''"`
 }
 
 type Admin struct {
@@ -27,41 +46,627 @@ type Admin struct {
 	Role          string         `json:"role" gorm:"not null"`
 	CreatedAt     time.Time      `json:"createdAt"`
 	UpdatedAt     time.Time      `json:"updatedAt"`
-	Status        string         `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('active','pending')"`
+	Status        string         `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('active','pending','suspended')"`
 	CreatedBy     uuid.UUID      `json:"createdBy"`
 	SuperAdmin    uuid.UUID      ` json:"-"  gorm:"foreignKey:CreatedBy"`
 	Organizations []Organization `json:"-" gorm:"foreignKey:AdminID"`
 	Password      string         `json:"-" gorm:"not null"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 }
 
 type Organization struct {
-	ID          uuid.UUID ` json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Email       string    `json:"email" gorm:"uniqueIndex;not null"`
+	ID          uuid.UUID      ` json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	Email       string         `json:"email" gorm:"uniqueIndex;not null"`
+	Description string         `json:"description"`
+	Website     string         `json:"website"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	AdminID     uuid.UUID      `json:"adminId"`
+	Admin       Admin          `json:"-" gorm:"foreignKey:AdminID"`
+	DeletedAt   gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+
+	Status           string     `json:"status" gorm:"type:varchar(20);default:'active';check:status IN ('active','suspended')"`
+	SuspendedAt      *time.Time `json:"suspendedAt"`
+	SuspensionReason string     `json:"suspensionReason,omitempty"`
+
+	// ParentID places the organization under another one. Admins of the
+	// parent administer it too while InheritPermissions is set.
+	ParentID           *uuid.UUID `json:"parentId" gorm:"type:uuid"`
+	InheritPermissions bool       `json:"inheritPermissions" gorm:"not null"`
+
+	Memberships []Membership `json:"-" gorm:"foreignKey:OrganizationID"`
+}
+
+type AdminInvites struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AdminId   uuid.UUID      `json:"adminId"`
+	TokenHash string         `json:"-" gorm:"not null"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	UsedAt    time.Time      `json:"usedAt"`
+	CreatedAt time.Time      `json:"createdAt" gorm:"not null"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+}
+type UserInvites struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserId    uuid.UUID      `json:"userId" gorm:"not null"`
+	TokenHash string         `json:"-" gorm:"not null"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	UsedAt    time.Time      `json:"usedAt"`
+	CreatedAt time.Time      `json:"createdAt" gorm:"not null"`
+	Email     string         `json:"email" gorm:"not null"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+}
+
+const (
+	SuspensionActionSuspend   = "suspend"
+	SuspensionActionUnsuspend = "unsuspend"
+)
+
+// OrganizationSuspension records one suspension or unsuspension of an
+// organization, with who did it and why.
+type OrganizationSuspension struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;not null"`
+	Action         string    `json:"action" gorm:"not null;check:action IN ('suspend','unsuspend')"`
+	Reason         string    `json:"reason"`
+	ActorID        uuid.UUID `json:"actorId" gorm:"type:uuid;not null"`
+	ActorRole      string    `json:"actorRole" gorm:"not null"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusAccepted  = "accepted"
+	TransferStatusCancelled = "cancelled"
+	TransferStatusExpired   = "expired"
+)
+
+// OrganizationTransfer hands an organization from one admin to another. It
+// stays pending until the receiving admin accepts it with the emailed token,
+// and the row is kept afterwards as the record of the transfer.
+type OrganizationTransfer struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrganizationID uuid.UUID  `json:"organizationId" gorm:"type:uuid;not null"`
+	FromAdminID    uuid.UUID  `json:"fromAdminId" gorm:"type:uuid;not null"`
+	ToAdminID      uuid.UUID  `json:"toAdminId" gorm:"type:uuid;not null"`
+	InitiatedBy    uuid.UUID  `json:"initiatedBy" gorm:"type:uuid;not null"`
+	TokenHash      string     `json:"-" gorm:"not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('pending','accepted','cancelled','expired')"`
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null"`
+	ResolvedBy     *uuid.UUID `json:"resolvedBy" gorm:"type:uuid"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+const (
+	GrantAccountAdmin = "admin"
+	GrantAccountUser  = "user"
+
+	// GrantKindAssigned gives the role for the whole window.
+	GrantKindAssigned = "assigned"
+	// GrantKindEligible gives nothing by itself; it lets the account elevate
+	// to the role for a short while when it needs to.
+	GrantKindEligible = "eligible"
+	// GrantKindElevated is a short grant an account gave itself under an
+	// eligible grant.
+	GrantKindElevated = "elevated"
+
+	GrantStatusScheduled = "scheduled"
+	GrantStatusActive    = "active"
+	GrantStatusExpired   = "expired"
+	GrantStatusRevoked   = "revoked"
+)
+
+// RoleGrant gives an admin, or a user inside one organization, an extra role
+// or a single extra permission between ValidFrom and ValidUntil.
+type RoleGrant struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	AccountType    string     `json:"accountType" gorm:"type:varchar(10);not null;check:account_type IN ('admin','user')"`
+	AccountID      uuid.UUID  `json:"accountId" gorm:"type:uuid;not null"`
+	OrganizationID *uuid.UUID `json:"organizationId" gorm:"type:uuid"`
+	Role           string     `json:"role" gorm:"not null"`
+	Permission     string     `json:"permission,omitempty" gorm:"not null"`
+	Kind           string     `json:"kind" gorm:"type:varchar(20);default:'assigned';check:kind IN ('assigned','eligible','elevated')"`
+	ValidFrom      time.Time  `json:"validFrom" gorm:"not null"`
+	ValidUntil     time.Time  `json:"validUntil" gorm:"not null"`
+	Justification  string     `json:"justification"`
+	GrantedBy      uuid.UUID  `json:"grantedBy" gorm:"type:uuid;not null"`
+	NotifiedAt     *time.Time `json:"notifiedAt"`
+	ExpiredAt      *time.Time `json:"expiredAt"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	RevokedBy      *uuid.UUID `json:"revokedBy" gorm:"type:uuid"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved"
+	AccessRequestRejected  = "rejected"
+	AccessRequestExpired   = "expired"
+	AccessRequestCancelled = "cancelled"
+
+	AccessDecisionApprove = "approve"
+	AccessDecisionReject  = "reject"
+)
+
+// AccessPolicy sets how many approvals an organization's access requests
+// need. Organizations without one need a single approval.
+type AccessPolicy struct {
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;primaryKey"`
+	Quorum         int       `json:"quorum" gorm:"not null"`
+	UpdatedBy      uuid.UUID `json:"updatedBy" gorm:"type:uuid;not null"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// AccessApprover designates an admin or member who decides an
+// organization's access requests. Without any, its admins decide.
+type AccessApprover struct {
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;primaryKey"`
+	AccountID      uuid.UUID `json:"accountId" gorm:"type:uuid;primaryKey"`
+	AccountType    string    `json:"accountType" gorm:"type:varchar(10);not null;check:account_type IN ('admin','user')"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// AccessRequest is a member asking for a role or a permission in their
+// organization. Once approved it points at the grant it created.
+type AccessRequest struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrganizationID uuid.UUID  `json:"organizationId" gorm:"type:uuid;not null"`
+	RequesterID    uuid.UUID  `json:"requesterId" gorm:"type:uuid;not null"`
+	Role           string     `json:"role,omitempty" gorm:"not null"`
+	Permission     string     `json:"permission,omitempty" gorm:"not null"`
+	Justification  string     `json:"justification" gorm:"not null"`
+	GrantMinutes   int        `json:"grantMinutes" gorm:"not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('pending','approved','rejected','expired','cancelled')"`
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	GrantID        *uuid.UUID `json:"grantId" gorm:"type:uuid"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// AccessDecision is one approver's vote on an access request.
+type AccessDecision struct {
+	RequestID    uuid.UUID `json:"requestId" gorm:"type:uuid;primaryKey"`
+	ApproverID   uuid.UUID `json:"approverId" gorm:"type:uuid;primaryKey"`
+	ApproverType string    `json:"approverType" gorm:"type:varchar(10);not null"`
+	Decision     string    `json:"decision" gorm:"type:varchar(10);not null;check:decision IN ('approve','reject')"`
+	Comment      string    `json:"comment"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+const (
+	ReviewScopeOrganization = "organization"
+	ReviewScopeRole         = "role"
+	ReviewScopePermission   = "permission"
+
+	ReviewStatusOpen   = "open"
+	ReviewStatusClosed = "closed"
+
+	ReviewSourceAdmin      = "admin"
+	ReviewSourceMembership = "membership"
+	ReviewSourceGrant      = "grant"
+
+	ReviewDecisionPending   = "pending"
+	ReviewDecisionCertified = "certified"
+	ReviewDecisionRevoked   = "revoked"
+)
+
+// AccessReview is a certification campaign over everyone who holds access in
+// its scope: an organization's ID, a role or a permission.
+type AccessReview struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	ScopeType  string     `json:"scopeType" gorm:"type:varchar(20);not null;check:scope_type IN ('organization','role','permission')"`
+	ScopeValue string     `json:"scopeValue" gorm:"not null"`
+	Status     string     `json:"status" gorm:"type:varchar(20);default:'open';check:status IN ('open','closed')"`
+	DueAt      *time.Time `json:"dueAt"`
+	CreatedBy  uuid.UUID  `json:"createdBy" gorm:"type:uuid;not null"`
+	ClosedBy   *uuid.UUID `json:"closedBy" gorm:"type:uuid"`
+	ClosedAt   *time.Time `json:"closedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// AccessReviewer is an admin asked to decide the items of a review.
+type AccessReviewer struct {
+	ReviewID  uuid.UUID `json:"reviewId" gorm:"type:uuid;primaryKey"`
+	AdminID   uuid.UUID `json:"adminId" gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AccessReviewItem is one piece of access captured when its review started:
+// an admin's role, a membership or a grant, named by Source and SourceID.
+type AccessReviewItem struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ReviewID       uuid.UUID  `json:"reviewId" gorm:"type:uuid;not null"`
+	AccountType    string     `json:"accountType" gorm:"type:varchar(10);not null"`
+	AccountID      uuid.UUID  `json:"accountId" gorm:"type:uuid;not null"`
+	AccountEmail   string     `json:"accountEmail" gorm:"not null"`
+	Source         string     `json:"source" gorm:"type:varchar(20);not null;check:source IN ('admin','membership','grant')"`
+	SourceID       uuid.UUID  `json:"sourceId" gorm:"type:uuid;not null"`
+	OrganizationID *uuid.UUID `json:"organizationId" gorm:"type:uuid"`
+	Role           string     `json:"role,omitempty" gorm:"not null"`
+	Permission     string     `json:"permission,omitempty" gorm:"not null"`
+	ValidUntil     *time.Time `json:"validUntil,omitempty"`
+	Decision       string     `json:"decision" gorm:"type:varchar(20);default:'pending';check:decision IN ('pending','certified','revoked')"`
+	Comment        string     `json:"comment"`
+	ReviewedBy     *uuid.UUID `json:"reviewedBy" gorm:"type:uuid"`
+	ReviewedAt     *time.Time `json:"reviewedAt"`
+	AppliedAt      *time.Time `json:"appliedAt"`
+	ApplyNote      string     `json:"applyNote,omitempty" gorm:"not null"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// Group collects members of an organization so roles can be granted to all
+// of them at once. A group nested under a parent passes the parent's roles on
+// to its own members.
+type Group struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrganizationID uuid.UUID  `json:"organizationId" gorm:"type:uuid;not null"`
+	ParentID       *uuid.UUID `json:"parentId" gorm:"type:uuid"`
+	Name           string     `json:"name" gorm:"not null"`
+	Description    string     `json:"description"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+
+	// ExternalID is set on groups provisioned through SCIM.
+	ExternalID string `json:"externalId,omitempty" gorm:"not null;default:''"`
+}
+
+type GroupMember struct {
+	GroupID   uuid.UUID `json:"groupId" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `json:"userId" gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GroupRole binds a role to a group.
+type GroupRole struct {
+	GroupID   uuid.UUID `json:"groupId" gorm:"type:uuid;primaryKey"`
+	Role      string    `json:"role" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	OutboxStatusDead      = "dead"
+
+	OutboxKindEmail   = "email"
+	OutboxKindWebhook = "webhook"
+)
+
+// OutboxMessage is written in the same transaction as the business change that
+// produced it and delivered later by the outbox dispatcher.
+type OutboxMessage struct {
+	ID            uuid.UUID       `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Kind          string          `json:"kind" gorm:"not null"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateID   uuid.UUID       `json:"aggregateId" gorm:"type:uuid"`
+	Payload       json.RawMessage `json:"-" gorm:"type:jsonb;not null"`
+	Status        string          `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('pending','delivered','dead')"`
+	Attempts      int             `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts   int             `json:"maxAttempts" gorm:"not null"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt" gorm:"not null"`
+	LockedUntil   *time.Time      `json:"-"`
+	LastError     string          `json:"lastError"`
+	DeliveredAt   *time.Time      `json:"deliveredAt"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+}
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records who did what to which resource through the API. Before
+// and After hold only the fields the action changed. Events form a hash chain
+// in Seq order: Hash covers the event and PrevHash, the Hash of the event
+// before it, so editing or removing one breaks the chain from there on.
+type AuditEvent struct {
+	ID             uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey"`
+	Seq            int64           `json:"seq" gorm:"not null;uniqueIndex"`
+	ActorType      string          `json:"actorType,omitempty" gorm:"type:varchar(10)"`
+	ActorID        *uuid.UUID      `json:"actorId,omitempty" gorm:"type:uuid"`
+	ActorRole      string          `json:"actorRole,omitempty"`
+	Action         string          `json:"action" gorm:"not null"`
+	ResourceType   string          `json:"resourceType" gorm:"not null"`
+	ResourceID     *uuid.UUID      `json:"resourceId,omitempty" gorm:"type:uuid"`
+	OrganizationID *uuid.UUID      `json:"organizationId,omitempty" gorm:"type:uuid"`
+	Before         json.RawMessage `json:"before,omitempty" gorm:"type:jsonb"`
+	After          json.RawMessage `json:"after,omitempty" gorm:"type:jsonb"`
+	IP             string          `json:"ip"`
+	RequestID      string          `json:"requestId"`
+	Outcome        string          `json:"outcome" gorm:"type:varchar(10);not null;check:outcome IN ('success','denied','failure')"`
+	Status         int             `json:"status" gorm:"not null"`
+	CreatedAt      time.Time       `json:"createdAt" gorm:"not null"`
+	PrevHash       string          `json:"prevHash"`
+	Hash           string          `json:"hash" gorm:"not null"`
+}
+
+const (
+	AuthzOutcomeAllow = "allow"
+	AuthzOutcomeDeny  = "deny"
+
+	// AuthzCheckPermission is a permission check inside a handler,
+	// AuthzCheckRoute one made by middleware before the handler runs and
+	// AuthzCheckOrgAdmin the check that the caller administers an
+	// organization.
+	AuthzCheckPermission = "permission"
+	AuthzCheckRoute      = "route"
+	AuthzCheckOrgAdmin   = "org_admin"
+)
+
+// AuthzDecision is one authorization check and its outcome. Resource is the
+// request the check guarded, or the organization for org_admin checks.
+type AuthzDecision struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	SubjectType    string     `json:"subjectType,omitempty" gorm:"type:varchar(10)"`
+	SubjectID      *uuid.UUID `json:"subjectId,omitempty" gorm:"type:uuid"`
+	SubjectRole    string     `json:"subjectRole,omitempty"`
+	OrganizationID *uuid.UUID `json:"organizationId,omitempty" gorm:"type:uuid"`
+	Check          string     `json:"check" gorm:"column:check_kind;type:varchar(20);not null"`
+	Permission     string     `json:"permission,omitempty"`
+	Resource       string     `json:"resource,omitempty"`
+	Outcome        string     `json:"outcome" gorm:"type:varchar(10);not null;check:outcome IN ('allow','deny')"`
+	LatencyNs      int64      `json:"latencyNs" gorm:"not null"`
+	RequestID      string     `json:"requestId,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"not null"`
+}
+
+const (
+	WebhookEventUserInvited     = "user.invited"
+	WebhookEventUserActivated   = "user.activated"
+	WebhookEventUserSuspended   = "user.suspended"
+	WebhookEventUserReactivated = "user.reactivated"
+	WebhookEventUserRoleChanged = "user.role_changed"
+	WebhookEventOrgCreated      = "organization.created"
+	WebhookEventOrgDeleted      = "organization.deleted"
+	// WebhookEventPing is only ever sent by the test-ping endpoint.
+	WebhookEventPing = "webhook.ping"
+)
+
+// WebhookSubscription sends the events of an organization, and of the
+// organizations below it while they inherit permissions, to URL. Without an
+// organization it receives the events of every organization. EventTypes
+// filters the events; empty means all of them.
+type WebhookSubscription struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	OrganizationID *uuid.UUID `json:"organizationId" gorm:"type:uuid"`
+	URL            string     `json:"url" gorm:"not null"`
+	// Secret signs every payload. It is only shown when the subscription is
+	// created.
+	Secret      string    `json:"-" gorm:"not null"`
 	Description string    `json:"description"`
-	Website     string    `json:"website"`
+	Active      bool      `json:"active" gorm:"not null"`
+	EventTypes  []string  `json:"eventTypes" gorm:"-"`
+	CreatedBy   uuid.UUID `json:"createdBy" gorm:"type:uuid;not null"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
-	AdminID     uuid.UUID `json:"adminId"`
-	Admin       Admin     `json:"-" gorm:"foreignKey:AdminID"`
+}
 
-	Users []User ` json:"-"  gorm:"foreignKey:OrganizationID"`
+type WebhookEventType struct {
+	SubscriptionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	EventType      string    `gorm:"primaryKey"`
 }
 
-type AdminInvites struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	AdminId   uuid.UUID `json:"adminId"`
-	TokenHash string    `json:"tokenHash" gorm:"not null"`
-	ExpiresAt time.Time `json:"expiresAt"`
-	UsedAt    time.Time `json:"usedAt"`
-	CreatedAt time.Time `json:"createdAt" gorm:"not null"`
+// WebhookDelivery is one attempt to deliver an event. Pings have no outbox
+// message.
+type WebhookDelivery struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	SubscriptionID  uuid.UUID  `json:"subscriptionId" gorm:"type:uuid;not null"`
+	OutboxMessageID *uuid.UUID `json:"outboxMessageId,omitempty" gorm:"type:uuid"`
+	EventID         uuid.UUID  `json:"eventId" gorm:"type:uuid;not null"`
+	EventType       string     `json:"eventType" gorm:"not null"`
+	Attempt         int        `json:"attempt" gorm:"not null"`
+	URL             string     `json:"url" gorm:"not null"`
+	StatusCode      int        `json:"statusCode"`
+	Error           string     `json:"error,omitempty"`
+	DurationMs      int64      `json:"durationMs" gorm:"not null"`
+	CreatedAt       time.Time  `json:"createdAt" gorm:"not null"`
 }
-type UserInvites struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	UserId    uuid.UUID `json:"userId" gorm:"not null"`
-	TokenHash string    `json:"tokenHash" gorm:"not null"`
-	ExpiresAt time.Time `json:"expiresAt"`
-	UsedAt    time.Time `json:"usedAt"`
-	CreatedAt time.Time `json:"createdAt" gorm:"not null"`
-	Email     string    `json:"email" gorm:"not null"`
+
+// ScimToken lets an organization's identity provider provision its users and
+// groups through SCIM. Only the hash of the token is stored.
+type ScimToken struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	OrganizationID uuid.UUID  `json:"organizationId" gorm:"type:uuid;not null"`
+	TokenHash      string     `json:"-" gorm:"not null"`
+	Description    string     `json:"description"`
+	CreatedBy      uuid.UUID  `json:"createdBy" gorm:"type:uuid;not null"`
+	LastUsedAt     *time.Time `json:"lastUsedAt"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// OIDCProvider lets the members of an organization sign in through the
+// organization's OpenID Connect identity provider. The claim fields name the
+// ID token claims the email, name and groups are read from.
+type OIDCProvider struct {
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;primaryKey"`
+	Issuer         string    `json:"issuer" gorm:"not null"`
+	ClientID       string    `json:"clientId" gorm:"not null"`
+	// ClientSecret authenticates us to the provider. It is never shown.
+	ClientSecret string `json:"-" gorm:"not null"`
+	Scopes       string `json:"scopes" gorm:"not null"`
+	EmailClaim   string `json:"emailClaim" gorm:"not null"`
+	NameClaim    string `json:"nameClaim" gorm:"not null"`
+	GroupsClaim  string `json:"groupsClaim" gorm:"not null"`
+	// RoleMappings give a member the role of the first mapping whose group is
+	// in their groups claim, or DefaultRole when none is.
+	RoleMappings []SSORoleMapping `json:"roleMappings" gorm:"type:jsonb;serializer:json;not null"`
+	DefaultRole  string           `json:"defaultRole" gorm:"not null"`
+	// JITProvisioning adds users signing in for the first time to the
+	// organization, creating their account if they have none.
+	JITProvisioning bool `json:"jitProvisioning" gorm:"column:jit_provisioning;not null"`
+	// SSOOnly stops members from signing in to the organization with a
+	// password.
+	SSOOnly   bool      `json:"ssoOnly" gorm:"column:sso_only;not null"`
+	UpdatedBy uuid.UUID `json:"updatedBy" gorm:"type:uuid;not null"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type SSORoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// OIDCLoginState is a sign-in in progress: the state sent to the provider,
+// which only the hash of is kept, and the PKCE verifier and nonce to check
+// its answer with. It can be used once.
+type OIDCLoginState struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null"`
+	StateHash      string    `gorm:"not null"`
+	CodeVerifier   string    `gorm:"not null"`
+	Nonce          string    `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// OAuthClient is an application that signs its users in through us. Its id
+// is the OAuth client_id. Public clients, such as single-page and mobile
+// apps, cannot keep a secret and authenticate with PKCE alone.
+type OAuthClient struct {
+	ID   uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Name string    `json:"name" gorm:"not null"`
+	// SecretHash is the hash of the client secret, which is only shown when
+	// it is issued. Public clients have none.
+	SecretHash   string    `json:"-" gorm:"not null"`
+	Public       bool      `json:"public" gorm:"not null"`
+	RedirectURIs []string  `json:"redirectUris" gorm:"type:jsonb;serializer:json;not null"`
+	GrantTypes   []string  `json:"grantTypes" gorm:"type:jsonb;serializer:json;not null"`
+	Scopes       string    `json:"scopes" gorm:"not null"`
+	CreatedBy    uuid.UUID `json:"createdBy" gorm:"type:uuid;not null"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+const (
+	OAuthTokenAccess  = "access"
+	OAuthTokenRefresh = "refresh"
+)
+
+// OAuthAuthorizationCode is a code handed to a client for the account that
+// signed in, which only the hash of is kept. It can be exchanged once, with
+// the PKCE verifier of CodeChallenge.
+type OAuthAuthorizationCode struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CodeHash string    `gorm:"not null"`
+	ClientID uuid.UUID `gorm:"type:uuid;not null"`
+	// SubjectID, SubjectRole and OrganizationID identify the account and the
+	// organization it signed in to the way a login token does.
+	SubjectID      uuid.UUID  `gorm:"type:uuid;not null"`
+	SubjectRole    string     `gorm:"not null"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid"`
+	RedirectURI    string     `gorm:"not null"`
+	Scope          string     `gorm:"not null"`
+	Nonce          string     `gorm:"not null"`
+	CodeChallenge  string     `gorm:"not null"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// OAuthToken is an access or refresh token issued to a client, which only
+// the hash of is kept. Tokens of the client credentials grant have no
+// subject. Every token issued from one authorization shares its FamilyID, so
+// they can be revoked together.
+type OAuthToken struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	TokenHash      string     `gorm:"not null"`
+	Kind           string     `gorm:"not null;check:kind IN ('access','refresh')"`
+	ClientID       uuid.UUID  `gorm:"type:uuid;not null"`
+	SubjectID      *uuid.UUID `gorm:"type:uuid"`
+	SubjectRole    string     `gorm:"not null"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid"`
+	Scope          string     `gorm:"not null"`
+	FamilyID       uuid.UUID  `gorm:"type:uuid;not null"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	RevokedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+// SAMLProvider lets the members of an organization sign in through the
+// organization's SAML 2.0 identity provider, as imported from its metadata.
+// The attribute fields name the assertion attributes the email, name and
+// groups are read from.
+type SAMLProvider struct {
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;primaryKey"`
+	// EntityID, SSOURL and Certificates come from the provider's metadata.
+	// Certificates are the base64 DER certificates it signs with.
+	EntityID     string   `json:"entityId" gorm:"not null"`
+	SSOURL       string   `json:"ssoUrl" gorm:"column:sso_url;not null"`
+	Certificates []string `json:"certificates" gorm:"type:jsonb;serializer:json;not null"`
+	// MetadataURL is where the metadata was fetched from, if it was.
+	MetadataURL     string           `json:"metadataUrl" gorm:"column:metadata_url;not null"`
+	EmailAttribute  string           `json:"emailAttribute" gorm:"not null"`
+	NameAttribute   string           `json:"nameAttribute" gorm:"not null"`
+	GroupsAttribute string           `json:"groupsAttribute" gorm:"not null"`
+	RoleMappings    []SSORoleMapping `json:"roleMappings" gorm:"type:jsonb;serializer:json;not null"`
+	DefaultRole     string           `json:"defaultRole" gorm:"not null"`
+	JITProvisioning bool             `json:"jitProvisioning" gorm:"column:jit_provisioning;not null"`
+	SSOOnly         bool             `json:"ssoOnly" gorm:"column:sso_only;not null"`
+	UpdatedBy       uuid.UUID        `json:"updatedBy" gorm:"type:uuid;not null"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+}
+
+// SAMLRequest is an AuthnRequest waiting for its response. It can be
+// answered once.
+type SAMLRequest struct {
+	ID             string    `gorm:"primaryKey"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// SAMLAssertion is an assertion that was accepted, remembered until it
+// expires so it cannot be replayed.
+type SAMLAssertion struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	AssertionID    string    `gorm:"primaryKey"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// MagicLinkPolicy says whether the members of an organization may sign in
+// with a link sent to their email, and what the link only works with.
+// Organizations without one have magic links turned off.
+type MagicLinkPolicy struct {
+	OrganizationID uuid.UUID `json:"organizationId" gorm:"type:uuid;primaryKey"`
+	Enabled        bool      `json:"enabled" gorm:"not null"`
+	// BindIP makes links only work from the address they were asked for from.
+	BindIP bool `json:"bindIp" gorm:"column:bind_ip;not null"`
+	// BindDevice makes links only work with the device token handed to
+	// whoever asked for them.
+	BindDevice bool      `json:"bindDevice" gorm:"not null"`
+	UpdatedBy  uuid.UUID `json:"updatedBy" gorm:"type:uuid;not null"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// MagicLink signs a member in to an organization once. Only the hashes of
+// its token and device token are kept. Links stay after they are used or
+// expire, until the rate limit window has passed, as the rate limit counts
+// them by email.
+type MagicLink struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TokenHash      string    `gorm:"not null"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null"`
+	Email          string    `gorm:"not null"`
+	// IPAddress and DeviceHash are empty unless the link is bound to them.
+	IPAddress  string `gorm:"column:ip_address;not null"`
+	DeviceHash string `gorm:"not null"`
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	CreatedAt  time.Time
 }
@@ -0,0 +1,194 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	// hashes the signature algorithms below use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algDigestSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var (
+	signatureAlgs = map[string]crypto.Hash{algRSASHA256: crypto.SHA256, algRSASHA512: crypto.SHA512}
+	digestAlgs    = map[string]crypto.Hash{algDigestSHA256: crypto.SHA256, algDigestSHA512: crypto.SHA512}
+)
+
+// errNotSigned is returned by verify for an element without a signature.
+var errNotSigned = errors.New("saml: not signed")
+
+// verify checks the enveloped XML signature of e against certs. Only a
+// signature over e as a whole is accepted, so what is read from e afterwards
+// is what was signed. Canonicalization must be exclusive, and SHA-1 is
+// refused.
+func verify(e *Element, certs []*x509.Certificate) error {
+	sigs := e.ChildrenOf(nsDSig, "Signature")
+	switch {
+	case len(sigs) == 0:
+		return errNotSigned
+	case len(sigs) > 1:
+		return errors.New("saml: more than one signature")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.Child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("saml: signature has no SignedInfo")
+	}
+	c14n := signedInfo.Child(nsDSig, "CanonicalizationMethod")
+	if c14n == nil || c14n.Attr("Algorithm") != algExcC14N {
+		return errors.New("saml: signature must use exclusive canonicalization")
+	}
+	method := signedInfo.Child(nsDSig, "SignatureMethod")
+	if method == nil {
+		return errors.New("saml: signature has no SignatureMethod")
+	}
+	hash, ok := signatureAlgs[method.Attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("saml: unsupported signature algorithm %q", method.Attr("Algorithm"))
+	}
+
+	refs := signedInfo.ChildrenOf(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return errors.New("saml: signature must have exactly one reference")
+	}
+	ref := refs[0]
+	if id := e.Attr("ID"); id == "" || ref.Attr("URI") != "#"+id {
+		return errors.New("saml: signature does not reference the signed element")
+	}
+
+	var inclusive []string
+	enveloped := false
+	if transforms := ref.Child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.ChildrenOf(nsDSig, "Transform") {
+			switch t.Attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				inclusive = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("saml: unsupported transform %q", t.Attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return errors.New("saml: signature must be enveloped")
+	}
+
+	digestMethod := ref.Child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("saml: reference has no DigestMethod")
+	}
+	digestHash, ok := digestAlgs[digestMethod.Attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("saml: unsupported digest algorithm %q", digestMethod.Attr("Algorithm"))
+	}
+	digestValue := ref.Child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return errors.New("saml: reference has no DigestValue")
+	}
+	want, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return fmt.Errorf("saml: invalid DigestValue: %w", err)
+	}
+	h := digestHash.New()
+	h.Write(canonicalize(e, sig, inclusive))
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return errors.New("saml: digest does not match, the element was changed")
+	}
+
+	sigValue := sig.Child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return errors.New("saml: signature has no SignatureValue")
+	}
+	signature, err := decodeBase64(sigValue.Text())
+	if err != nil {
+		return fmt.Errorf("saml: invalid SignatureValue: %w", err)
+	}
+	h = hash.New()
+	h.Write(canonicalize(signedInfo, nil, inclusivePrefixes(c14n)))
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(key, hash, hashed, signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("saml: signature is not from the identity provider")
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of a
+// canonicalization method or transform.
+func inclusivePrefixes(method *Element) []string {
+	if in := method.Child(algExcC14N, "InclusiveNamespaces"); in != nil {
+		return strings.Fields(in.Attr("PrefixList"))
+	}
+	return nil
+}
+
+// Sign adds an enveloped RSA-SHA256 signature to e, which must have an ID,
+// after its Issuer as SAML requires.
+func Sign(e *Element, key *rsa.PrivateKey, cert *x509.Certificate) error {
+	id := e.Attr("ID")
+	if id == "" {
+		return errors.New("saml: the element to sign has no ID")
+	}
+
+	digest := crypto.SHA256.New()
+	digest.Write(canonicalize(e, nil, nil))
+	signedInfo, err := Parse([]byte(`<ds:SignedInfo xmlns:ds="` + nsDSig + `">` +
+		`<ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="` + algRSASHA256 + `"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#` + escapeString(id) + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + algEnveloped + `"></ds:Transform>` +
+		`<ds:Transform Algorithm="` + algExcC14N + `"></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + algDigestSHA256 + `"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest.Sum(nil)) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`))
+	if err != nil {
+		return err
+	}
+
+	hashed := crypto.SHA256.New()
+	hashed.Write(canonicalize(signedInfo, nil, nil))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed.Sum(nil))
+	if err != nil {
+		return err
+	}
+
+	sig, err := Parse([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `">` +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(signature) + `</ds:SignatureValue>` +
+		`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(cert.Raw) +
+		`</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature>`))
+	if err != nil {
+		return err
+	}
+	signedInfo.parent = sig
+	sig.Children = append([]any{signedInfo}, sig.Children...)
+
+	e.insertAfter(sig, nsAssertion, "Issuer")
+	return nil
+}
+
+// decodeBase64 decodes standard base64, which XML often wraps over lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
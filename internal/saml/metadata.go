@@ -0,0 +1,208 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	BindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatEmail = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// IdentityProvider is what we need to know of an identity provider: who it
+// is, where to send AuthnRequests and the certificates it signs with.
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL receives AuthnRequests with the HTTP-Redirect binding.
+	SSOURL string
+	// Certificates are base64 DER X.509 certificates. More than one is
+	// usual while the provider rolls its key over.
+	Certificates []string
+}
+
+// ParseMetadata reads the identity provider from its metadata, which may be
+// an EntityDescriptor or an EntitiesDescriptor with a single identity
+// provider in it.
+func ParseMetadata(data []byte) (*IdentityProvider, error) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []*Element
+	switch {
+	case root.Is(nsMetadata, "EntityDescriptor"):
+		entities = []*Element{root}
+	case root.Is(nsMetadata, "EntitiesDescriptor"):
+		entities = root.ChildrenOf(nsMetadata, "EntityDescriptor")
+	default:
+		return nil, errors.New("saml: metadata must be an EntityDescriptor")
+	}
+
+	var idp *IdentityProvider
+	for _, entity := range entities {
+		descriptor := entity.Child(nsMetadata, "IDPSSODescriptor")
+		if descriptor == nil {
+			continue
+		}
+		if idp != nil {
+			return nil, errors.New("saml: metadata describes more than one identity provider")
+		}
+		idp = &IdentityProvider{EntityID: entity.Attr("entityID")}
+
+		for _, sso := range descriptor.ChildrenOf(nsMetadata, "SingleSignOnService") {
+			if sso.Attr("Binding") == BindingRedirect {
+				idp.SSOURL = sso.Attr("Location")
+				break
+			}
+		}
+		for _, kd := range descriptor.ChildrenOf(nsMetadata, "KeyDescriptor") {
+			if use := kd.Attr("use"); use != "" && use != "signing" {
+				continue
+			}
+			keyInfo := kd.Child(nsDSig, "KeyInfo")
+			if keyInfo == nil {
+				continue
+			}
+			for _, data := range keyInfo.ChildrenOf(nsDSig, "X509Data") {
+				for _, c := range data.ChildrenOf(nsDSig, "X509Certificate") {
+					idp.Certificates = append(idp.Certificates, c.Text())
+				}
+			}
+		}
+	}
+
+	switch {
+	case idp == nil:
+		return nil, errors.New("saml: metadata describes no identity provider")
+	case idp.EntityID == "":
+		return nil, errors.New("saml: metadata has no entityID")
+	case idp.SSOURL == "":
+		return nil, errors.New("saml: identity provider has no HTTP-Redirect SingleSignOnService")
+	}
+	if _, err := idp.certificates(); err != nil {
+		return nil, err
+	}
+	return idp, nil
+}
+
+// certificates parses the provider's signing certificates. Their validity
+// period is not checked: metadata pins them, as is usual for SAML.
+func (idp *IdentityProvider) certificates() ([]*x509.Certificate, error) {
+	if len(idp.Certificates) == 0 {
+		return nil, errors.New("saml: identity provider has no signing certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(idp.Certificates))
+	for _, raw := range idp.Certificates {
+		der, err := decodeBase64(raw)
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// ServiceProvider is us, as one organization's identity provider sees us.
+type ServiceProvider struct {
+	EntityID string
+	// ACSURL is the assertion consumer service, which receives responses
+	// with the HTTP-POST binding.
+	ACSURL      string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+type spMetadata struct {
+	XMLName    xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID   string       `xml:"entityID,attr"`
+	Descriptor spDescriptor `xml:"SPSSODescriptor"`
+}
+
+type spDescriptor struct {
+	AuthnRequestsSigned        bool            `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool            `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string          `xml:"protocolSupportEnumeration,attr"`
+	KeyDescriptor              spKeyDescriptor `xml:"KeyDescriptor"`
+	NameIDFormat               string          `xml:"NameIDFormat"`
+	ACS                        spEndpoint      `xml:"AssertionConsumerService"`
+}
+
+type spKeyDescriptor struct {
+	Use     string    `xml:"use,attr"`
+	KeyInfo spKeyInfo `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
+
+type spKeyInfo struct {
+	Certificate string `xml:"http://www.w3.org/2000/09/xmldsig# X509Data>X509Certificate"`
+}
+
+type spEndpoint struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata is our metadata, to be imported by the identity provider.
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	out, err := xml.MarshalIndent(spMetadata{
+		EntityID: sp.EntityID,
+		Descriptor: spDescriptor{
+			AuthnRequestsSigned:        true,
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			KeyDescriptor: spKeyDescriptor{
+				Use:     "signing",
+				KeyInfo: spKeyInfo{Certificate: base64.StdEncoding.EncodeToString(sp.Certificate.Raw)},
+			},
+			NameIDFormat: NameIDFormatEmail,
+			ACS:          spEndpoint{Binding: BindingPOST, Location: sp.ACSURL, IsDefault: true},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// SelfSignedCertificate makes a certificate for key. SAML only uses
+// certificates to carry keys, so one nobody vouches for is enough.
+func SelfSignedCertificate(key *rsa.PrivateKey, commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
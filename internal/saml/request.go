@@ -0,0 +1,66 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NewID returns a random ID for a request or assertion. IDs must not start
+// with a digit, hence the underscore.
+func NewID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// AuthnRequestURL is where to send the user to sign in at idp: its SSO URL
+// with an AuthnRequest with the id, signed as the HTTP-Redirect binding
+// prescribes (SAML 2.0 Bindings section 3.4.4.1).
+func (sp *ServiceProvider) AuthnRequestURL(idp *IdentityProvider, id string, now time.Time) (string, error) {
+	request := `<samlp:AuthnRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + escapeString(id) + `" Version="2.0" IssueInstant="` + now.UTC().Format(time.RFC3339) + `"` +
+		` Destination="` + escapeString(idp.SSOURL) + `"` +
+		` AssertionConsumerServiceURL="` + escapeString(sp.ACSURL) + `" ProtocolBinding="` + BindingPOST + `">` +
+		`<saml:Issuer>` + escapeString(sp.EntityID) + `</saml:Issuer>` +
+		`<samlp:NameIDPolicy Format="` + NameIDFormatEmail + `" AllowCreate="true"></samlp:NameIDPolicy>` +
+		`</samlp:AuthnRequest>`
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// the signature covers the query exactly as sent
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(deflated.Bytes())) +
+		"&SigAlg=" + url.QueryEscape(algRSASHA256)
+	hashed := crypto.SHA256.New()
+	hashed.Write([]byte(query))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sp.Key, crypto.SHA256, hashed.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+
+	sep := "?"
+	if strings.Contains(idp.SSOURL, "?") {
+		sep = "&"
+	}
+	return idp.SSOURL + sep + query, nil
+}
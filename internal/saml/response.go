@@ -0,0 +1,219 @@
+package saml
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// Assertion is what a validated response says about the user.
+type Assertion struct {
+	ID string
+	// InResponseTo is the ID of the AuthnRequest the response answers, or ""
+	// when the identity provider sent it unasked.
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	Attributes   map[string][]string
+	// ExpiresAt is when the assertion stops being accepted, so how long a
+	// replay cache must remember it.
+	ExpiresAt time.Time
+}
+
+// Attribute is the first value of the attribute, or "".
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ParseResponse validates the base64 SAMLResponse idp posted to our
+// assertion consumer service and returns its assertion. The response or
+// the assertion must be signed by idp, and the assertion must be meant for
+// us and valid at now, give or take skew. Whether it answers a request of
+// ours and was seen before is left to the caller.
+func (sp *ServiceProvider) ParseResponse(encoded string, idp *IdentityProvider, now time.Time, skew time.Duration) (*Assertion, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid SAMLResponse: %w", err)
+	}
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !root.Is(nsProtocol, "Response") || root.Attr("Version") != "2.0" {
+		return nil, errors.New("saml: not a SAML 2.0 response")
+	}
+	if dest := root.Attr("Destination"); dest != "" && dest != sp.ACSURL {
+		return nil, fmt.Errorf("saml: the response is for %q", dest)
+	}
+	if err := responseStatus(root); err != nil {
+		return nil, err
+	}
+	if issuer := root.Child(nsAssertion, "Issuer"); issuer != nil && issuer.Text() != idp.EntityID {
+		return nil, fmt.Errorf("saml: the response is from %q", issuer.Text())
+	}
+
+	if len(root.ChildrenOf(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("saml: encrypted assertions are not supported")
+	}
+	assertions := root.ChildrenOf(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("saml: the response must hold exactly one assertion")
+	}
+	el := assertions[0]
+
+	// only what a verified signature covers is read below
+	certs, err := idp.certificates()
+	if err != nil {
+		return nil, err
+	}
+	signed := false
+	for _, target := range []*Element{root, el} {
+		switch err := verify(target, certs); {
+		case err == nil:
+			signed = true
+		case !errors.Is(err, errNotSigned):
+			return nil, err
+		}
+	}
+	if !signed {
+		return nil, errors.New("saml: neither the response nor its assertion is signed")
+	}
+
+	if el.Attr("Version") != "2.0" || el.Attr("ID") == "" {
+		return nil, errors.New("saml: not a SAML 2.0 assertion")
+	}
+	if issuer := el.Child(nsAssertion, "Issuer"); issuer == nil || issuer.Text() != idp.EntityID {
+		return nil, errors.New("saml: the assertion is not from the identity provider")
+	}
+	a := &Assertion{
+		ID:           el.Attr("ID"),
+		InResponseTo: root.Attr("InResponseTo"),
+		Attributes:   map[string][]string{},
+	}
+
+	subject := el.Child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("saml: the assertion has no subject")
+	}
+	if nameID := subject.Child(nsAssertion, "NameID"); nameID != nil {
+		a.NameID = nameID.Text()
+		a.NameIDFormat = nameID.Attr("Format")
+	}
+	if a.ExpiresAt, err = sp.confirmSubject(subject, a.InResponseTo, now, skew); err != nil {
+		return nil, err
+	}
+
+	conditions := el.Child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, errors.New("saml: the assertion has no conditions")
+	}
+	if notBefore, err := timeAttr(conditions, "NotBefore"); err != nil {
+		return nil, err
+	} else if !notBefore.IsZero() && now.Add(skew).Before(notBefore) {
+		return nil, errors.New("saml: the assertion is not valid yet")
+	}
+	if notOnOrAfter, err := timeAttr(conditions, "NotOnOrAfter"); err != nil {
+		return nil, err
+	} else if !notOnOrAfter.IsZero() {
+		if !now.Before(notOnOrAfter.Add(skew)) {
+			return nil, errors.New("saml: the assertion has expired")
+		}
+		if notOnOrAfter.Before(a.ExpiresAt) {
+			a.ExpiresAt = notOnOrAfter
+		}
+	}
+	a.ExpiresAt = a.ExpiresAt.Add(skew)
+
+	// every audience restriction must name us
+	restrictions := conditions.ChildrenOf(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, errors.New("saml: the assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		ok := false
+		for _, audience := range restriction.ChildrenOf(nsAssertion, "Audience") {
+			ok = ok || audience.Text() == sp.EntityID
+		}
+		if !ok {
+			return nil, errors.New("saml: the assertion is meant for another service provider")
+		}
+	}
+
+	for _, statement := range el.ChildrenOf(nsAssertion, "AttributeStatement") {
+		for _, attr := range statement.ChildrenOf(nsAssertion, "Attribute") {
+			name := attr.Attr("Name")
+			for _, value := range attr.ChildrenOf(nsAssertion, "AttributeValue") {
+				a.Attributes[name] = append(a.Attributes[name], value.Text())
+			}
+		}
+	}
+	return a, nil
+}
+
+// responseStatus reports a response that is not a success as an error.
+func responseStatus(root *Element) error {
+	status := root.Child(nsProtocol, "Status")
+	if status == nil {
+		return errors.New("saml: the response has no status")
+	}
+	code := status.Child(nsProtocol, "StatusCode")
+	if code == nil {
+		return errors.New("saml: the response has no status code")
+	}
+	if code.Attr("Value") == statusSuccess {
+		return nil
+	}
+
+	msg := "saml: the identity provider answered " + code.Attr("Value")
+	if sub := code.Child(nsProtocol, "StatusCode"); sub != nil {
+		msg += " (" + sub.Attr("Value") + ")"
+	}
+	if message := status.Child(nsProtocol, "StatusMessage"); message != nil {
+		msg += ": " + message.Text()
+	}
+	return errors.New(msg)
+}
+
+// confirmSubject checks that a bearer subject confirmation lets us accept
+// the assertion now, and returns until when it does.
+func (sp *ServiceProvider) confirmSubject(subject *Element, inResponseTo string, now time.Time, skew time.Duration) (time.Time, error) {
+	for _, confirmation := range subject.ChildrenOf(nsAssertion, "SubjectConfirmation") {
+		if confirmation.Attr("Method") != methodBearer {
+			continue
+		}
+		data := confirmation.Child(nsAssertion, "SubjectConfirmationData")
+		if data == nil || data.Attr("Recipient") != sp.ACSURL || data.Attr("InResponseTo") != inResponseTo {
+			continue
+		}
+		notOnOrAfter, err := timeAttr(data, "NotOnOrAfter")
+		if err != nil {
+			return time.Time{}, err
+		}
+		if notOnOrAfter.IsZero() || !now.Before(notOnOrAfter.Add(skew)) {
+			continue
+		}
+		return notOnOrAfter, nil
+	}
+	return time.Time{}, errors.New("saml: the assertion has no valid bearer confirmation for us")
+}
+
+// timeAttr parses an xs:dateTime attribute, which is zero when missing.
+func timeAttr(e *Element, name string) (time.Time, error) {
+	value := e.Attr(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("saml: invalid %s: %w", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,249 @@
+package saml_test
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/saml"
+	"github.com/mightyfzeus/rbac/internal/saml/samltest"
+)
+
+const (
+	testRequestID = "_request"
+	testSkew      = 2 * time.Minute
+)
+
+var (
+	assertionPattern = regexp.MustCompile(`(?s)<saml:Assertion .*</saml:Assertion>`)
+	signaturePattern = regexp.MustCompile(`(?s)<ds:Signature .*?</ds:Signature>`)
+	assertionID      = regexp.MustCompile(`<saml:Assertion [^>]*ID="([^"]+)"`)
+)
+
+// setUp returns an identity provider signing ada@example.com in, and the
+// service provider its responses are for.
+func setUp(t *testing.T) (*samltest.IdP, *saml.IdentityProvider, *saml.ServiceProvider) {
+	t.Helper()
+
+	idp, err := samltest.New("https://idp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.User = samltest.User{
+		NameID:     "ada@example.com",
+		Attributes: map[string][]string{"groups": {"engineering", "auditors"}},
+	}
+	metadata, err := saml.ParseMetadata(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := &saml.ServiceProvider{
+		EntityID: "https://sp.example.com/saml/metadata",
+		ACSURL:   "https://sp.example.com/saml/acs",
+	}
+	return idp, metadata, sp
+}
+
+// response returns the XML of a response from idp answering testRequestID.
+func response(t *testing.T, idp *samltest.IdP, sp *saml.ServiceProvider) string {
+	t.Helper()
+
+	encoded, err := idp.Response(testRequestID, sp.ACSURL, sp.EntityID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func encode(xml string) string {
+	return base64.StdEncoding.EncodeToString([]byte(xml))
+}
+
+// forged is the assertion of doc, unsigned and naming eve instead of ada.
+func forged(doc string) string {
+	assertion := assertionPattern.FindString(doc)
+	id := assertionID.FindStringSubmatch(assertion)[1]
+	assertion = signaturePattern.ReplaceAllString(assertion, "")
+	assertion = strings.ReplaceAll(assertion, id, "_forged")
+	return strings.ReplaceAll(assertion, "ada@example.com", "eve@example.com")
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		signResponse  bool
+		signAssertion bool
+	}{
+		{"signed assertion", false, true},
+		{"signed response", true, false},
+		{"both signed", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, metadata, sp := setUp(t)
+			idp.SignResponse, idp.SignAssertion = tt.signResponse, tt.signAssertion
+
+			now := time.Now()
+			a, err := sp.ParseResponse(encode(response(t, idp, sp)), metadata, now, testSkew)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.ID == "" || a.InResponseTo != testRequestID || a.NameID != "ada@example.com" ||
+				a.NameIDFormat != saml.NameIDFormatEmail {
+				t.Errorf("assertion %+v", a)
+			}
+			if groups := a.Attributes["groups"]; len(groups) != 2 || a.Attribute("groups") != "engineering" {
+				t.Errorf("groups %v", groups)
+			}
+			if expires := now.Add(idp.Lifetime + testSkew); a.ExpiresAt.Before(expires.Add(-time.Minute)) || a.ExpiresAt.After(expires) {
+				t.Errorf("the assertion expires at %v, want about %v", a.ExpiresAt, expires)
+			}
+		})
+	}
+}
+
+func TestParseResponseRefuses(t *testing.T) {
+	idp, metadata, sp := setUp(t)
+	now := time.Now()
+	valid := response(t, idp, sp)
+
+	other, err := samltest.New(idp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.User = idp.User
+
+	unsigned := *idp
+	unsigned.SignAssertion = false
+
+	signedResponse := *idp
+	signedResponse.SignResponse, signedResponse.SignAssertion = true, false
+	signedDoc := response(t, &signedResponse, sp)
+
+	wrongAudience := *sp
+	wrongAudience.EntityID = "https://other.example.com/saml/metadata"
+
+	tests := []struct {
+		name string
+		doc  string
+		sp   *saml.ServiceProvider
+		now  time.Time
+		// want is part of the error, so a broken test document does not
+		// pass for the wrong reason.
+		want string
+	}{
+		{
+			name: "unsigned",
+			want: "is signed",
+			doc:  response(t, &unsigned, sp),
+		},
+		{
+			name: "signed by another key",
+			want: "not from the identity provider",
+			doc:  response(t, other, sp),
+		},
+		{
+			name: "assertion changed after signing",
+			want: "digest does not match",
+			doc:  strings.Replace(valid, "ada@example.com", "eve@example.com", 1),
+		},
+		{
+			name: "response changed after signing",
+			want: "digest does not match",
+			doc:  strings.Replace(signedDoc, "ada@example.com", "eve@example.com", 1),
+		},
+		{
+			name: "signature value changed",
+			want: "not from the identity provider",
+			doc:  strings.Replace(valid, "<ds:SignatureValue>", "<ds:SignatureValue>AAAA", 1),
+		},
+		{
+			name: "wrapped: a forged assertion next to the signed one",
+			want: "exactly one assertion",
+			doc:  strings.Replace(valid, "<saml:Assertion ", forged(valid)+"<saml:Assertion ", 1),
+		},
+		{
+			name: "wrapped: the signed assertion moved into extensions",
+			want: "is signed",
+			doc: assertionPattern.ReplaceAllLiteralString(valid,
+				"<samlp:Extensions>"+assertionPattern.FindString(valid)+"</samlp:Extensions>"+forged(valid)),
+		},
+		{
+			name: "wrapped: the forged assertion holds the signed one",
+			want: "is signed",
+			doc: assertionPattern.ReplaceAllLiteralString(valid,
+				strings.TrimSuffix(forged(valid), "</saml:Assertion>")+assertionPattern.FindString(valid)+"</saml:Assertion>"),
+		},
+		{
+			name: "wrapped: the signed response around a forged assertion",
+			want: "digest does not match",
+			doc:  assertionPattern.ReplaceAllLiteralString(signedDoc, forged(signedDoc)),
+		},
+		{
+			name: "meant for another service provider",
+			want: "another service provider",
+			doc:  valid,
+			sp:   &wrongAudience,
+		},
+		{
+			name: "before NotBefore",
+			want: "not valid yet",
+			doc:  valid,
+			now:  now.Add(-testSkew - time.Minute),
+		},
+		{
+			name: "on or after NotOnOrAfter",
+			want: "no valid bearer confirmation",
+			doc:  valid,
+			now:  now.Add(idp.Lifetime + testSkew + time.Minute),
+		},
+		{
+			name: "document type declaration",
+			want: "document type declarations",
+			doc: `<?xml version="1.0"?><!DOCTYPE samlp:Response [<!ENTITY user "ada@example.com">]>` +
+				strings.Replace(valid, "ada@example.com", "&user;", 1),
+		},
+		{
+			name: "external entity",
+			want: "document type declarations",
+			doc: `<?xml version="1.0"?><!DOCTYPE r [<!ENTITY xxe SYSTEM "file:///etc/passwd">]>` +
+				`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">&xxe;</samlp:Response>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, at := sp, now
+			if tt.sp != nil {
+				sp = tt.sp
+			}
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			a, err := sp.ParseResponse(encode(tt.doc), metadata, at, testSkew)
+			if err == nil {
+				t.Fatalf("accepted, signing in %q", a.NameID)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("refused with %q, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// the clock may be off by the skew
+	if _, err := sp.ParseResponse(encode(valid), metadata, now.Add(-testSkew/2), testSkew); err != nil {
+		t.Errorf("refused within the clock skew: %v", err)
+	}
+}
+
+func TestParseRefusesDocumentTypes(t *testing.T) {
+	_, err := saml.Parse([]byte(`<!DOCTYPE lolz [<!ENTITY lol "lol"><!ENTITY lol2 "&lol;&lol;&lol;">]><lolz>&lol2;</lolz>`))
+	if err == nil || !strings.Contains(err.Error(), "document type") {
+		t.Errorf("Parse: %v, want document types refused", err)
+	}
+}
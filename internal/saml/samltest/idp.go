@@ -0,0 +1,277 @@
+package samltest
+
+import (
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mightyfzeus/rbac/internal/saml"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	sigAlgRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+)
+
+// IdP is an identity provider for tests. It serves its metadata at
+// /metadata and signs User in to whichever service provider sends it an
+// AuthnRequest at /sso, without asking for credentials.
+type IdP struct {
+	// URL is where the IdP is served; its entity ID is URL + "/metadata".
+	URL         string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+	// SPCertificate, when set, must have signed the AuthnRequests.
+	SPCertificate *x509.Certificate
+	// User is who signs in.
+	User User
+	// SignResponse and SignAssertion choose what is signed. New signs the
+	// assertion only.
+	SignResponse  bool
+	SignAssertion bool
+	// Lifetime is how long assertions are valid.
+	Lifetime time.Duration
+}
+
+// User is the subject of the assertions the IdP issues.
+type User struct {
+	NameID     string
+	Attributes map[string][]string
+}
+
+// New returns an IdP served at url with a fresh key.
+func New(url string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := saml.SelfSignedCertificate(key, "samltest", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{
+		URL:           strings.TrimSuffix(url, "/"),
+		Key:           key,
+		Certificate:   cert,
+		SignAssertion: true,
+		Lifetime:      5 * time.Minute,
+	}, nil
+}
+
+func (idp *IdP) EntityID() string { return idp.URL + "/metadata" }
+
+func (idp *IdP) SSOURL() string { return idp.URL + "/sso" }
+
+// Metadata is the IdP's metadata.
+func (idp *IdP) Metadata() []byte {
+	cert := base64.StdEncoding.EncodeToString(idp.Certificate.Raw)
+	return []byte(xml.Header +
+		`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + escape(idp.EntityID()) + `">` +
+		`<md:IDPSSODescriptor WantAuthnRequestsSigned="` + fmt.Sprint(idp.SPCertificate != nil) + `"` +
+		` protocolSupportEnumeration="` + nsProtocol + `">` +
+		`<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:X509Data><ds:X509Certificate>` + cert + `</ds:X509Certificate></ds:X509Data>` +
+		`</ds:KeyInfo></md:KeyDescriptor>` +
+		`<md:NameIDFormat>` + saml.NameIDFormatEmail + `</md:NameIDFormat>` +
+		`<md:SingleSignOnService Binding="` + saml.BindingRedirect + `" Location="` + escape(idp.SSOURL()) + `"/>` +
+		`</md:IDPSSODescriptor></md:EntityDescriptor>`)
+}
+
+// AuthnRequest is what the IdP read from an AuthnRequest.
+type AuthnRequest struct {
+	ID         string
+	Issuer     string
+	ACSURL     string
+	RelayState string
+}
+
+// ReadAuthnRequest reads the AuthnRequest in the query of a redirect to the
+// IdP, checking its signature when SPCertificate is set.
+func (idp *IdP) ReadAuthnRequest(rawQuery string) (*AuthnRequest, error) {
+	raw := map[string]string{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		name, value, _ := strings.Cut(part, "=")
+		raw[name] = value
+	}
+	if raw["SAMLRequest"] == "" {
+		return nil, errors.New("samltest: no SAMLRequest")
+	}
+
+	if idp.SPCertificate != nil {
+		signed := "SAMLRequest=" + raw["SAMLRequest"]
+		if _, ok := raw["RelayState"]; ok {
+			signed += "&RelayState=" + raw["RelayState"]
+		}
+		signed += "&SigAlg=" + raw["SigAlg"]
+
+		if alg, _ := url.QueryUnescape(raw["SigAlg"]); alg != sigAlgRSASHA256 {
+			return nil, fmt.Errorf("samltest: unsupported SigAlg %q", alg)
+		}
+		value, _ := url.QueryUnescape(raw["Signature"])
+		signature, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("samltest: invalid Signature: %w", err)
+		}
+		key, ok := idp.SPCertificate.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("samltest: SPCertificate has no RSA key")
+		}
+		hashed := crypto.SHA256.New()
+		hashed.Write([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed.Sum(nil), signature); err != nil {
+			return nil, errors.New("samltest: the AuthnRequest signature is invalid")
+		}
+	}
+
+	value, err := url.QueryUnescape(raw["SAMLRequest"])
+	if err != nil {
+		return nil, err
+	}
+	deflated, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("samltest: invalid SAMLRequest: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(strings.NewReader(string(deflated))), 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("samltest: invalid SAMLRequest: %w", err)
+	}
+	el, err := saml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !el.Is(nsProtocol, "AuthnRequest") {
+		return nil, errors.New("samltest: not an AuthnRequest")
+	}
+
+	req := &AuthnRequest{ID: el.Attr("ID"), ACSURL: el.Attr("AssertionConsumerServiceURL")}
+	req.RelayState, _ = url.QueryUnescape(raw["RelayState"])
+	if issuer := el.Child(nsAssertion, "Issuer"); issuer != nil {
+		req.Issuer = issuer.Text()
+	}
+	if req.ID == "" || req.ACSURL == "" || req.Issuer == "" {
+		return nil, errors.New("samltest: the AuthnRequest needs an ID, Issuer and AssertionConsumerServiceURL")
+	}
+	return req, nil
+}
+
+// Response is a base64 SAMLResponse signing User in to the service provider
+// audience, posted to acsURL. An empty inResponseTo makes it unsolicited.
+func (idp *IdP) Response(inResponseTo, acsURL, audience string) (string, error) {
+	responseID, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+	assertionID, err := saml.NewID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	issued := now.Format(time.RFC3339)
+	expires := now.Add(idp.Lifetime).Format(time.RFC3339)
+
+	irt := ""
+	if inResponseTo != "" {
+		irt = ` InResponseTo="` + escape(inResponseTo) + `"`
+	}
+
+	var attrs strings.Builder
+	names := make([]string, 0, len(idp.User.Attributes))
+	for name := range idp.User.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrs.WriteString(`<saml:Attribute Name="` + escape(name) + `">`)
+		for _, value := range idp.User.Attributes[name] {
+			attrs.WriteString(`<saml:AttributeValue>` + escape(value) + `</saml:AttributeValue>`)
+		}
+		attrs.WriteString(`</saml:Attribute>`)
+	}
+
+	root, err := saml.Parse([]byte(`<samlp:Response xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"` +
+		` ID="` + responseID + `" Version="2.0" IssueInstant="` + issued + `" Destination="` + escape(acsURL) + `"` + irt + `>` +
+		`<saml:Issuer>` + escape(idp.EntityID()) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		`<saml:Assertion ID="` + assertionID + `" Version="2.0" IssueInstant="` + issued + `">` +
+		`<saml:Issuer>` + escape(idp.EntityID()) + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + saml.NameIDFormatEmail + `">` + escape(idp.User.NameID) + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData` + irt + ` NotOnOrAfter="` + expires + `" Recipient="` + escape(acsURL) + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + issued + `" NotOnOrAfter="` + expires + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + escape(audience) + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="` + issued + `" SessionIndex="` + assertionID + `">` +
+		`<saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified</saml:AuthnContextClassRef></saml:AuthnContext>` +
+		`</saml:AuthnStatement>` +
+		`<saml:AttributeStatement>` + attrs.String() + `</saml:AttributeStatement>` +
+		`</saml:Assertion></samlp:Response>`))
+	if err != nil {
+		return "", err
+	}
+
+	if idp.SignAssertion {
+		if err := saml.Sign(root.Child(nsAssertion, "Assertion"), idp.Key, idp.Certificate); err != nil {
+			return "", err
+		}
+	}
+	if idp.SignResponse {
+		if err := saml.Sign(root, idp.Key, idp.Certificate); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(root.Bytes()), nil
+}
+
+var postForm = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{.URL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form></body></html>
+`))
+
+func (idp *IdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/metadata":
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(idp.Metadata())
+	case "/sso":
+		req, err := idp.ReadAuthnRequest(r.URL.RawQuery)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err := idp.Response(req.ID, req.ACSURL, req.Issuer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		postForm.Execute(w, map[string]string{"URL": req.ACSURL, "SAMLResponse": response, "RelayState": req.RelayState})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
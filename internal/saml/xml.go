@@ -0,0 +1,318 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// Element is a parsed XML element. Prefixes are kept as written, so the
+// element can be canonicalized and its signature checked; Namespace resolves
+// them.
+type Element struct {
+	Prefix   string
+	Local    string
+	Attrs    []Attr
+	Children []any // *Element or string
+
+	// decls are the namespaces declared on the element, "" being the
+	// default namespace.
+	decls  []Attr
+	parent *Element
+}
+
+// Attr is an attribute other than a namespace declaration.
+type Attr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// Parse reads an XML document. Document type declarations are refused, so
+// entities cannot be smuggled in.
+func Parse(data []byte) (*Element, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *Element
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil && current == nil {
+				return nil, errors.New("saml: more than one root element")
+			}
+			el := &Element{Prefix: t.Name.Space, Local: t.Name.Local, parent: current}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					el.decls = append(el.decls, Attr{Local: a.Name.Local, Value: a.Value})
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.decls = append(el.decls, Attr{Value: a.Value})
+				default:
+					el.Attrs = append(el.Attrs, Attr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+				}
+			}
+			if _, ok := el.lookup(el.Prefix); !ok {
+				return nil, fmt.Errorf("saml: undeclared namespace prefix %q", el.Prefix)
+			}
+			for _, a := range el.Attrs {
+				if _, ok := el.lookup(a.Prefix); !ok {
+					return nil, fmt.Errorf("saml: undeclared namespace prefix %q", a.Prefix)
+				}
+			}
+			if current == nil {
+				root = el
+			} else {
+				current.Children = append(current.Children, el)
+			}
+			current = el
+		case xml.EndElement:
+			if current == nil || t.Name.Space != current.Prefix || t.Name.Local != current.Local {
+				return nil, errors.New("saml: mismatched end element")
+			}
+			current = current.parent
+		case xml.CharData:
+			if current == nil {
+				if len(bytes.TrimSpace(t)) > 0 {
+					return nil, errors.New("saml: text outside the root element")
+				}
+				continue
+			}
+			current.Children = append(current.Children, string(t))
+		case xml.Directive:
+			return nil, errors.New("saml: document type declarations are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("saml: incomplete document")
+	}
+	return root, nil
+}
+
+// lookup resolves prefix in the element's scope.
+func (e *Element) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, d := range el.decls {
+			if d.Local == prefix {
+				return d.Value, true
+			}
+		}
+	}
+	// the default namespace is empty unless declared
+	return "", prefix == ""
+}
+
+// Namespace is the namespace URI of the element.
+func (e *Element) Namespace() string {
+	ns, _ := e.lookup(e.Prefix)
+	return ns
+}
+
+// Is reports whether the element has the namespace and local name.
+func (e *Element) Is(ns, local string) bool {
+	return e.Local == local && e.Namespace() == ns
+}
+
+// Attr is the value of the unqualified attribute local, or "".
+func (e *Element) Attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Child is the first child element with the namespace and local name.
+func (e *Element) Child(ns, local string) *Element {
+	for _, c := range e.Children {
+		if el, ok := c.(*Element); ok && el.Is(ns, local) {
+			return el
+		}
+	}
+	return nil
+}
+
+// ChildrenOf are the child elements with the namespace and local name.
+func (e *Element) ChildrenOf(ns, local string) []*Element {
+	var found []*Element
+	for _, c := range e.Children {
+		if el, ok := c.(*Element); ok && el.Is(ns, local) {
+			found = append(found, el)
+		}
+	}
+	return found
+}
+
+// Text is the text directly inside the element, with surrounding space
+// trimmed. Comments in between are dropped, not cut at.
+func (e *Element) Text() string {
+	var b strings.Builder
+	for _, c := range e.Children {
+		if s, ok := c.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// insertAfter adds child after the first child element with the namespace
+// and local name, or first when there is none.
+func (e *Element) insertAfter(child *Element, ns, local string) {
+	child.parent = e
+	at := 0
+	for i, c := range e.Children {
+		if el, ok := c.(*Element); ok && el.Is(ns, local) {
+			at = i + 1
+			break
+		}
+	}
+	e.Children = append(e.Children[:at], append([]any{child}, e.Children[at:]...)...)
+}
+
+// Bytes serializes the element in canonical form.
+func (e *Element) Bytes() []byte {
+	return canonicalize(e, nil, nil)
+}
+
+// canonicalize writes the element by Exclusive XML Canonicalization without
+// comments (https://www.w3.org/TR/xml-exc-c14n/), leaving out skip. The
+// namespaces of inclusive are rendered as inclusive canonicalization would.
+func canonicalize(e *Element, skip *Element, inclusive []string) []byte {
+	var b bytes.Buffer
+	writeCanonical(&b, e, skip, inclusive, map[string]string{})
+	return b.Bytes()
+}
+
+func writeCanonical(b *bytes.Buffer, e *Element, skip *Element, inclusive []string, rendered map[string]string) {
+	if e == skip {
+		return
+	}
+
+	// the namespaces the element and its attributes use, which are
+	// declared where first needed in the output
+	used := []string{e.Prefix}
+	for _, a := range e.Attrs {
+		if a.Prefix != "" {
+			used = append(used, a.Prefix)
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := e.lookup(prefix); ok {
+			used = append(used, prefix)
+		}
+	}
+
+	scope := make(map[string]string, len(rendered))
+	for prefix, ns := range rendered {
+		scope[prefix] = ns
+	}
+	var decls []Attr
+	for _, prefix := range used {
+		if prefix == "xml" {
+			continue
+		}
+		ns, _ := e.lookup(prefix)
+		current, ok := scope[prefix]
+		if prefix == "" && !ok {
+			current, ok = "", ns == ""
+		}
+		if ok && current == ns {
+			continue
+		}
+		scope[prefix] = ns
+		decls = append(decls, Attr{Local: prefix, Value: ns})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Local < decls[j].Local })
+
+	attrs := make([]Attr, len(e.Attrs))
+	copy(attrs, e.Attrs)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, _ := e.lookup(attrs[i].Prefix)
+		nj, _ := e.lookup(attrs[j].Prefix)
+		if attrs[i].Prefix == "" {
+			ni = ""
+		}
+		if attrs[j].Prefix == "" {
+			nj = ""
+		}
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	name := qualified(e.Prefix, e.Local)
+	b.WriteString("<" + name)
+	for _, d := range decls {
+		if d.Local == "" {
+			b.WriteString(` xmlns="`)
+		} else {
+			b.WriteString(" xmlns:" + d.Local + `="`)
+		}
+		escapeAttr(b, d.Value)
+		b.WriteString(`"`)
+	}
+	for _, a := range attrs {
+		b.WriteString(" " + qualified(a.Prefix, a.Local) + `="`)
+		escapeAttr(b, a.Value)
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+
+	for _, c := range e.Children {
+		switch c := c.(type) {
+		case string:
+			escapeText(b, c)
+		case *Element:
+			writeCanonical(b, c, skip, inclusive, scope)
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
+
+func qualified(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(b *bytes.Buffer, s string) {
+	textEscaper.WriteString(b, s)
+}
+
+func escapeAttr(b *bytes.Buffer, s string) {
+	attrEscaper.WriteString(b, s)
+}
+
+// escapeString escapes s for use in XML text or a quoted attribute.
+func escapeString(s string) string {
+	var b bytes.Buffer
+	escapeAttr(&b, s)
+	return strings.ReplaceAll(b.String(), ">", "&gt;")
+}
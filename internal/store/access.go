@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccessStore struct {
+	db *gorm.DB
+}
+
+// AccessRequestFilter narrows ListRequests. Zero fields match everything.
+type AccessRequestFilter struct {
+	OrganizationID uuid.UUID
+	RequesterID    uuid.UUID
+	Status         string
+}
+
+// defaultAccessPolicy applies to organizations that never set one.
+func defaultAccessPolicy(orgID uuid.UUID) *models.AccessPolicy {
+	return &models.AccessPolicy{OrganizationID: orgID, Quorum: 1}
+}
+
+// GetPolicy returns the organization's access policy, or the default
+// single-approval policy if it has none.
+func (a *AccessStore) GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.AccessPolicy, error) {
+	var policy models.AccessPolicy
+	err := a.db.WithContext(ctx).Where("organization_id = ?", orgID).Limit(1).Find(&policy).Error
+	if err != nil {
+		return nil, dbError(err, nil)
+	}
+	if policy.OrganizationID == uuid.Nil {
+		return defaultAccessPolicy(orgID), nil
+	}
+	return &policy, nil
+}
+
+// SetPolicy saves the policy and replaces the organization's approvers with
+// approvers.
+func (a *AccessStore) SetPolicy(ctx context.Context, policy *models.AccessPolicy, approvers []models.AccessApprover) error {
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "organization_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"quorum", "updated_by", "updated_at"}),
+		}).Create(policy).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("organization_id = ?", policy.OrganizationID).Delete(&models.AccessApprover{}).Error; err != nil {
+			return err
+		}
+		if len(approvers) == 0 {
+			return nil
+		}
+		return tx.Create(&approvers).Error
+	})
+	return withDomain(dbError(err, nil), ErrCheckViolation, "chk_access_policies_quorum", ErrAccessQuorum)
+}
+
+func (a *AccessStore) ListApprovers(ctx context.Context, orgID uuid.UUID) ([]models.AccessApprover, error) {
+	approvers := []models.AccessApprover{}
+	err := a.db.WithContext(ctx).
+		Where("organization_id = ?", orgID).
+		Order("created_at, account_id").
+		Find(&approvers).
+		Error
+	return approvers, dbError(err, nil)
+}
+
+func (a *AccessStore) CreateRequest(ctx context.Context, req *models.AccessRequest) error {
+	err := dbError(a.db.WithContext(ctx).Create(req).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_access_requests_pending", ErrDuplicateAccessRequest)
+}
+
+func (a *AccessStore) GetRequest(ctx context.Context, id uuid.UUID) (*models.AccessRequest, error) {
+	var req models.AccessRequest
+	err := a.db.WithContext(ctx).Where("id = ?", id).First(&req).Error
+	if err := dbError(err, ErrAccessRequestNotFound); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListRequests returns the matching requests, newest first.
+func (a *AccessStore) ListRequests(ctx context.Context, f AccessRequestFilter) ([]models.AccessRequest, error) {
+	q := a.db.WithContext(ctx).Model(&models.AccessRequest{})
+	if f.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", f.OrganizationID)
+	}
+	if f.RequesterID != uuid.Nil {
+		q = q.Where("requester_id = ?", f.RequesterID)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+
+	reqs := []models.AccessRequest{}
+	err := q.Order("created_at DESC, id").Find(&reqs).Error
+	return reqs, dbError(err, nil)
+}
+
+// ListExpiredRequests returns pending requests whose decision window closed
+// by at.
+func (a *AccessStore) ListExpiredRequests(ctx context.Context, at time.Time) ([]models.AccessRequest, error) {
+	reqs := []models.AccessRequest{}
+	err := a.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", models.AccessRequestPending, at).
+		Order("expires_at, id").
+		Find(&reqs).
+		Error
+	return reqs, dbError(err, nil)
+}
+
+// ResolveRequest moves a pending request to status, linking the grant an
+// approval created. It fails with ErrAccessRequestNotPending if the request
+// was resolved in the meantime.
+func (a *AccessStore) ResolveRequest(
+	ctx context.Context,
+	id uuid.UUID,
+	status string,
+	grantID *uuid.UUID,
+	at time.Time,
+) error {
+	result := a.db.WithContext(ctx).
+		Model(&models.AccessRequest{}).
+		Where("id = ? AND status = ?", id, models.AccessRequestPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"grant_id":    grantID,
+			"resolved_at": at,
+		})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessRequestNotPending
+	}
+	return nil
+}
+
+func (a *AccessStore) RecordDecision(ctx context.Context, decision *models.AccessDecision) error {
+	err := dbError(a.db.WithContext(ctx).Create(decision).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "access_decisions_pkey", ErrDuplicateDecision)
+}
+
+// ListDecisions returns the votes on a request in the order they were cast.
+func (a *AccessStore) ListDecisions(ctx context.Context, requestID uuid.UUID) ([]models.AccessDecision, error) {
+	decisions := []models.AccessDecision{}
+	err := a.db.WithContext(ctx).
+		Where("request_id = ?", requestID).
+		Order("created_at, approver_id").
+		Find(&decisions).
+		Error
+	return decisions, dbError(err, nil)
+}
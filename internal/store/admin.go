@@ -2,8 +2,7 @@ package store
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -22,18 +21,12 @@ type AdminStore struct {
 func (u *AdminStore) LoginAdmin(ctx context.Context, email, password string) (*models.Admin, error) {
 	var admin models.Admin
 	err := u.db.WithContext(ctx).Where("email = ?", email).First(&admin).Error
-	if err != nil {
-		switch {
-		case err.Error() == "record not found":
-			return nil, ErrUserNotFound
-		default:
-			return nil, err
-		}
-
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
 	}
 
 	if !CheckPassword(password, admin.Password) {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	return &admin, nil
@@ -41,24 +34,17 @@ func (u *AdminStore) LoginAdmin(ctx context.Context, email, password string) (*m
 }
 
 func (u *AdminStore) CreateAdmin(ctx context.Context, user *models.Admin) error {
-	err := u.db.WithContext(ctx).Create(user).Error
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "Duplicate entry") {
-			return ErrDuplicateEmail
-		}
-	}
-	return err
+	err := dbError(u.db.WithContext(ctx).Create(user).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_admins_email", ErrDuplicateEmail)
 }
 
 func (a *AdminStore) GetAdmin(ctx context.Context, id uuid.UUID) (*models.Admin, error) {
 	var admin models.Admin
 	err := a.db.WithContext(ctx).Where("id = ?", id).First(&admin).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound
-		}
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
 	}
-	return &admin, err
+	return &admin, nil
 }
 
 func (a *AdminStore) UpdateAdmin(
@@ -66,20 +52,99 @@ func (a *AdminStore) UpdateAdmin(
 	adminID uuid.UUID,
 	updates map[string]interface{},
 ) error {
-	return a.db.WithContext(ctx).
+	err := a.db.WithContext(ctx).
 		Model(&models.Admin{}).
 		Where("id = ?", adminID).
 		Updates(updates).
 		Error
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_admins_email", ErrDuplicateEmail)
 }
 
 func (a *AdminStore) GetAdminByEmail(ctx context.Context, email string) (*models.Admin, error) {
 	var admin models.Admin
 	err := a.db.WithContext(ctx).Where("email = ?", email).First(&admin).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound
-		}
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
 	}
-	return &admin, err
+	return &admin, nil
+}
+
+var adminListSpec = listSpec{
+	sortable:    []string{"created_at", "name", "email"},
+	defaultSort: "created_at",
+	search:      searchExpr("admins"),
+}
+
+// ListAdmins honours Status, Role, Search and CreatedFrom/CreatedTo.
+func (a *AdminStore) ListAdmins(ctx context.Context, p ListParams) ([]models.Admin, PageInfo, error) {
+	q := a.db.WithContext(ctx).Model(&models.Admin{})
+	if p.Status != "" {
+		q = q.Where("admins.status = ?", p.Status)
+	}
+	if p.Role != "" {
+		q = q.Where("admins.role = ?", p.Role)
+	}
+	return gormPage(q, "admins", p, adminListSpec, func(admin models.Admin) uuid.UUID {
+		return admin.ID
+	})
+}
+
+// DeleteAdmin soft-deletes the admin and their invites. Organizations must be
+// handed over to another admin first.
+func (a *AdminStore) DeleteAdmin(ctx context.Context, id uuid.UUID) error {
+	at := deletionTime()
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var owned int64
+		if err := tx.Model(&models.Organization{}).Where("admin_id = ?", id).Count(&owned).Error; err != nil {
+			return err
+		}
+		if owned > 0 {
+			return ErrAdminOwnsOrgs
+		}
+
+		result := tx.Model(&models.Admin{}).Where("id = ?", id).Update("deleted_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return tx.Model(&models.AdminInvites{}).Where("admin_id = ?", id).Update("deleted_at", at).Error
+	})
+	return dbError(err, nil)
+}
+
+// RestoreAdmin undoes DeleteAdmin if it happened at or after deletedSince.
+func (a *AdminStore) RestoreAdmin(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var admin models.Admin
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&admin).Error
+		if err != nil {
+			return dbError(err, ErrUserNotFound)
+		}
+		if err := checkRestorable(admin.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Model(&models.Admin{}).Where("id = ?", id).Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.AdminInvites{}).
+			Where("admin_id = ? AND deleted_at = ?", id, admin.DeletedAt.Time).
+			Update("deleted_at", nil).
+			Error
+	})
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_admins_email", ErrDuplicateEmail)
+}
+
+// PurgeDeleted permanently removes admins deleted before deletedBefore.
+// Admins still referenced by an organization row are skipped until those
+// organizations are purged.
+func (a *AdminStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := a.db.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", deletedBefore).
+		Where("NOT EXISTS (SELECT 1 FROM organizations WHERE organizations.admin_id = admins.id)").
+		Delete(&models.Admin{})
+	return result.RowsAffected, dbError(result.Error, nil)
 }
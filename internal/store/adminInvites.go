@@ -2,8 +2,7 @@ package store
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -15,24 +14,16 @@ type AdminInviteStore struct {
 }
 
 func (a *AdminInviteStore) CreateAdminInvites(ctx context.Context, invite *models.AdminInvites) error {
-	err := a.db.WithContext(ctx).Create(invite).Error
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "Duplicate entry") {
-			return ErrDuplicateEmail
-		}
-	}
-	return err
+	return dbError(a.db.WithContext(ctx).Create(invite).Error, nil)
 }
 
 func (a *AdminInviteStore) ValidateToken(ctx context.Context, token string) (*models.AdminInvites, error) {
 	var invite models.AdminInvites
 	err := a.db.WithContext(ctx).Where("token_hash = ?", token).First(&invite).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrInvalidToken
-		}
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
 	}
-	return &invite, err
+	return &invite, nil
 }
 
 func (a *AdminInviteStore) UpdateInvite(
@@ -40,20 +31,46 @@ func (a *AdminInviteStore) UpdateInvite(
 	id uuid.UUID,
 	updates map[string]interface{},
 ) error {
-	return a.db.WithContext(ctx).
+	err := a.db.WithContext(ctx).
 		Model(&models.AdminInvites{}).
 		Where("id = ?", id).
 		Updates(updates).
 		Error
+	return dbError(err, nil)
 }
 
 func (a *AdminInviteStore) GetInviteByAdminId(ctx context.Context, adminID uuid.UUID) (*models.AdminInvites, error) {
 	var invite models.AdminInvites
 	err := a.db.WithContext(ctx).Where("admin_id = ?", adminID).First(&invite).Error
+	if err := dbError(err, ErrInviteNotFound); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+var inviteListSpec = listSpec{
+	sortable:    []string{"created_at", "expires_at"},
+	defaultSort: "created_at",
+}
+
+// ListAdminInvites honours AdminID, Status (the invite state) and
+// CreatedFrom/CreatedTo.
+func (a *AdminInviteStore) ListAdminInvites(ctx context.Context, p ListParams) ([]models.AdminInvites, PageInfo, error) {
+	q := a.db.WithContext(ctx).Model(&models.AdminInvites{})
+	if p.AdminID != uuid.Nil {
+		q = q.Where("admin_invites.admin_id = ?", p.AdminID)
+	}
+	q, err := inviteStateQuery(q, "admin_invites", p.Status, time.Now())
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrInviteNotFound
-		}
+		return nil, PageInfo{}, err
 	}
-	return &invite, err
+	return gormPage(q, "admin_invites", p, inviteListSpec, func(invite models.AdminInvites) uuid.UUID {
+		return invite.ID
+	})
+}
+
+// PurgeDeleted permanently removes invites deleted before deletedBefore.
+func (a *AdminInviteStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := a.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&models.AdminInvites{})
+	return result.RowsAffected, dbError(result.Error, nil)
 }
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type AuthzStore struct {
+	db *gorm.DB
+}
+
+// AuthzFilter narrows ListDecisions. Zero fields match everything.
+type AuthzFilter struct {
+	SubjectID      uuid.UUID
+	OrganizationID uuid.UUID
+	Check          string
+	Permission     string
+	Outcome        string
+}
+
+func (s *AuthzStore) AppendDecisions(ctx context.Context, decisions []models.AuthzDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+	return dbError(s.db.WithContext(ctx).Create(&decisions).Error, nil)
+}
+
+// ListDecisions returns up to limit decisions matching f, newest first.
+func (s *AuthzStore) ListDecisions(ctx context.Context, f AuthzFilter, limit int) ([]models.AuthzDecision, error) {
+	decisions := []models.AuthzDecision{}
+	q := s.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if f.SubjectID != uuid.Nil {
+		q = q.Where("subject_id = ?", f.SubjectID)
+	}
+	if f.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", f.OrganizationID)
+	}
+	if f.Check != "" {
+		q = q.Where("check_kind = ?", f.Check)
+	}
+	if f.Permission != "" {
+		q = q.Where("permission = ?", f.Permission)
+	}
+	if f.Outcome != "" {
+		q = q.Where("outcome = ?", f.Outcome)
+	}
+	err := q.Find(&decisions).Error
+	return decisions, dbError(err, nil)
+}
+
+func (s *AuthzStore) PurgeDecisions(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AuthzDecision{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Error kinds every store method reports through. Domain errors such as
+// ErrUserNotFound wrap one of these, so callers can match either the precise
+// error or the kind.
+var (
+	ErrNotFound            = errors.New("record not found")
+	ErrUniqueViolation     = errors.New("unique constraint violation")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrCheckViolation      = errors.New("check constraint violation")
+	ErrNotNullViolation    = errors.New("not null violation")
+	ErrSerialization       = errors.New("serialization failure")
+)
+
+// Postgres SQLSTATE codes, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgCheckViolation       = "23514"
+	pgNotNullViolation     = "23502"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+var pgKinds = map[string]error{
+	pgUniqueViolation:      ErrUniqueViolation,
+	pgForeignKeyViolation:  ErrForeignKeyViolation,
+	pgCheckViolation:       ErrCheckViolation,
+	pgNotNullViolation:     ErrNotNullViolation,
+	pgSerializationFailure: ErrSerialization,
+	pgDeadlockDetected:     ErrSerialization,
+}
+
+// kindError is a domain error of a given kind.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func newKindError(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+func (e *kindError) Error() string { return e.msg }
+func (e *kindError) Unwrap() error { return e.kind }
+
+// ConstraintError describes a database error that violated a constraint or
+// could not be serialized. It matches its Kind, its Domain error when a store
+// attached one, and the underlying driver error.
+type ConstraintError struct {
+	Kind       error
+	Domain     error
+	Code       string
+	Table      string
+	Constraint string
+	Columns    []string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Domain != nil {
+		return e.Domain.Error()
+	}
+
+	msg := e.Kind.Error()
+	if e.Table != "" {
+		msg += " on " + e.Table
+	}
+	if len(e.Columns) > 0 {
+		msg += fmt.Sprintf(" (%s)", strings.Join(e.Columns, ", "))
+	}
+	if e.Constraint != "" {
+		msg += ": " + e.Constraint
+	}
+	return msg
+}
+
+func (e *ConstraintError) Unwrap() []error {
+	errs := []error{e.Kind}
+	if e.Domain != nil {
+		errs = append(errs, e.Domain)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// detailColumnsRe extracts the column list from details such as
+// `Key (email)=(a@b.c) already exists.`
+var detailColumnsRe = regexp.MustCompile(`^Key \(([^)]+)\)`)
+
+// dbError translates an error returned by gorm. gorm.ErrRecordNotFound becomes
+// notFound (ErrNotFound when nil), Postgres constraint and serialization
+// failures become *ConstraintError, and anything else is returned as is.
+func dbError(err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if notFound == nil {
+			return ErrNotFound
+		}
+		return notFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	kind, ok := pgKinds[pgErr.Code]
+	if !ok {
+		return err
+	}
+
+	ce := &ConstraintError{
+		Kind:       kind,
+		Code:       pgErr.Code,
+		Table:      pgErr.TableName,
+		Constraint: pgErr.ConstraintName,
+		Err:        err,
+	}
+	if pgErr.ColumnName != "" {
+		ce.Columns = []string{pgErr.ColumnName}
+	} else if m := detailColumnsRe.FindStringSubmatch(pgErr.Detail); m != nil {
+		for _, col := range strings.Split(m[1], ",") {
+			ce.Columns = append(ce.Columns, strings.TrimSpace(col))
+		}
+	}
+	return ce
+}
+
+// withDomain attaches domain to err when err is a *ConstraintError of the
+// given kind. If constraint is not empty it must also match, so a table with
+// several unique indexes can report each one differently.
+func withDomain(err error, kind error, constraint string, domain error) error {
+	var ce *ConstraintError
+	if !errors.As(err, &ce) || ce.Kind != kind {
+		return err
+	}
+	if constraint != "" && ce.Constraint != constraint {
+		return err
+	}
+
+	annotated := *ce
+	annotated.Domain = domain
+	return &annotated
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type GroupStore struct {
+	db *gorm.DB
+}
+
+func (g *GroupStore) CreateGroup(ctx context.Context, group *models.Group) error {
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if group.ParentID != nil {
+			if err := checkGroupParent(tx, group.ID, group.OrganizationID, *group.ParentID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(group).Error
+	})
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_groups_org_name", ErrDuplicateGroup)
+}
+
+func (g *GroupStore) GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	var group models.Group
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&group).Error
+	if err := dbError(err, ErrGroupNotFound); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListGroups returns every group of the organization, ordered by name.
+func (g *GroupStore) ListGroups(ctx context.Context, orgID uuid.UUID) ([]models.Group, error) {
+	groups := []models.Group{}
+	err := g.db.WithContext(ctx).
+		Where("organization_id = ?", orgID).
+		Order("name, id").
+		Find(&groups).
+		Error
+	return groups, dbError(err, nil)
+}
+
+// UpdateGroup applies updates. A parent_id update must be a uuid.UUID or nil;
+// the new parent has to be in the same organization and must not be the group
+// itself or one of its subgroups.
+func (g *GroupStore) UpdateGroup(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if parentID, ok := updates["parent_id"].(uuid.UUID); ok {
+			var group models.Group
+			if err := tx.Where("id = ?", id).First(&group).Error; err != nil {
+				return dbError(err, ErrGroupNotFound)
+			}
+			if err := checkGroupParent(tx, id, group.OrganizationID, parentID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Group{}).Where("id = ?", id).Updates(updates).Error
+	})
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_groups_org_name", ErrDuplicateGroup)
+}
+
+// DeleteGroup removes the group with its members and role bindings. Its
+// subgroups move up to the top level.
+func (g *GroupStore) DeleteGroup(ctx context.Context, id uuid.UUID) error {
+	result := g.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Group{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+func (g *GroupStore) AddMember(ctx context.Context, member *models.GroupMember) error {
+	err := dbError(g.db.WithContext(ctx).Create(member).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "group_members_pkey", ErrDuplicateGroupMember)
+}
+
+func (g *GroupStore) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	result := g.db.WithContext(ctx).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupMemberNotFound
+	}
+	return nil
+}
+
+// ListMembers returns the users directly in the group who are still members
+// of its organization.
+func (g *GroupStore) ListMembers(ctx context.Context, groupID uuid.UUID) ([]models.User, error) {
+	users := []models.User{}
+	err := g.db.WithContext(ctx).
+		Joins("JOIN group_members ON group_members.user_id = users.id").
+		Where("group_members.group_id = ?", groupID).
+		Where("users.id IN (?)", g.db.Model(&models.Membership{}).
+			Select("user_id").
+			Where("organization_id = (SELECT organization_id FROM groups WHERE id = ?)", groupID),
+		).
+		Order("users.name, users.id").
+		Find(&users).
+		Error
+	return users, dbError(err, nil)
+}
+
+func (g *GroupStore) AddRole(ctx context.Context, role *models.GroupRole) error {
+	err := dbError(g.db.WithContext(ctx).Create(role).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "group_roles_pkey", ErrDuplicateGroupRole)
+}
+
+func (g *GroupStore) RemoveRole(ctx context.Context, groupID uuid.UUID, role string) error {
+	result := g.db.WithContext(ctx).
+		Where("group_id = ? AND role = ?", groupID, role).
+		Delete(&models.GroupRole{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupRoleNotFound
+	}
+	return nil
+}
+
+func (g *GroupStore) ListRoles(ctx context.Context, groupID uuid.UUID) ([]models.GroupRole, error) {
+	roles := []models.GroupRole{}
+	err := g.db.WithContext(ctx).Where("group_id = ?", groupID).Order("role").Find(&roles).Error
+	return roles, dbError(err, nil)
+}
+
+// UserRoles returns the roles the user holds through groups of the
+// organization: those bound to groups they are in and to every ancestor of
+// those groups.
+func (g *GroupStore) UserRoles(ctx context.Context, userID, orgID uuid.UUID) ([]string, error) {
+	roles := []string{}
+	err := g.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE member_groups AS (
+			SELECT groups.id, groups.parent_id
+			FROM groups
+			JOIN group_members ON group_members.group_id = groups.id
+			WHERE group_members.user_id = ? AND groups.organization_id = ?
+			UNION
+			SELECT groups.id, groups.parent_id
+			FROM groups
+			JOIN member_groups ON groups.id = member_groups.parent_id
+		)
+		SELECT DISTINCT role FROM group_roles
+		WHERE group_id IN (SELECT id FROM member_groups)
+		ORDER BY role`, userID, orgID).
+		Scan(&roles).
+		Error
+	return roles, dbError(err, nil)
+}
+
+// GroupRoleHolder is a user who holds Role through the groups of an
+// organization.
+type GroupRoleHolder struct {
+	UserID         uuid.UUID `json:"userId"`
+	OrganizationID uuid.UUID `json:"organizationId"`
+	Role           string    `json:"role"`
+}
+
+// RoleHolders returns the users who hold any of roles through groups, in the
+// organization orgID or, with uuid.Nil, in every organization. Like
+// UserRoles it follows roles down to the members of subgroups.
+func (g *GroupStore) RoleHolders(ctx context.Context, orgID uuid.UUID, roles []string) ([]GroupRoleHolder, error) {
+	holders := []GroupRoleHolder{}
+	if len(roles) == 0 {
+		return holders, nil
+	}
+
+	orgFilter, args := "", []interface{}{roles}
+	if orgID != uuid.Nil {
+		orgFilter, args = "AND groups.organization_id = ?", append(args, orgID)
+	}
+	err := g.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE bound_groups AS (
+			SELECT groups.id, group_roles.role
+			FROM groups
+			JOIN group_roles ON group_roles.group_id = groups.id
+			WHERE group_roles.role IN ? `+orgFilter+`
+			UNION
+			SELECT groups.id, bound_groups.role
+			FROM groups
+			JOIN bound_groups ON groups.parent_id = bound_groups.id
+		)
+		SELECT DISTINCT group_members.user_id, groups.organization_id, bound_groups.role
+		FROM bound_groups
+		JOIN groups ON groups.id = bound_groups.id
+		JOIN group_members ON group_members.group_id = bound_groups.id
+		ORDER BY groups.organization_id, group_members.user_id, bound_groups.role`, args...).
+		Scan(&holders).
+		Error
+	return holders, dbError(err, nil)
+}
+
+// checkGroupParent rejects a parent from another organization and parents
+// that would close a cycle, i.e. groupID itself or any of its descendants.
+func checkGroupParent(tx *gorm.DB, groupID, orgID, parentID uuid.UUID) error {
+	var parent models.Group
+	if err := tx.Where("id = ?", parentID).First(&parent).Error; err != nil {
+		return dbError(err, ErrGroupNotFound)
+	}
+	if parent.OrganizationID != orgID {
+		return ErrGroupParentOrg
+	}
+
+	var cycles int64
+	err := tx.Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM groups WHERE id = ?
+			UNION
+			SELECT groups.id, groups.parent_id
+			FROM groups
+			JOIN ancestors ON groups.id = ancestors.parent_id
+		)
+		SELECT count(*) FROM ancestors WHERE id = ?`, parentID, groupID).
+		Scan(&cycles).
+		Error
+	if err != nil {
+		return err
+	}
+	if cycles > 0 {
+		return ErrGroupCycle
+	}
+	return nil
+}
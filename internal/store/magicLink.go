@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MagicLinkStore struct {
+	db *gorm.DB
+}
+
+// GetPolicy returns the organization's magic link policy, or a disabled one
+// if it has none.
+func (m *MagicLinkStore) GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.MagicLinkPolicy, error) {
+	var policy models.MagicLinkPolicy
+	err := m.db.WithContext(ctx).Where("organization_id = ?", orgID).Limit(1).Find(&policy).Error
+	if err != nil {
+		return nil, dbError(err, nil)
+	}
+	if policy.OrganizationID == uuid.Nil {
+		return &models.MagicLinkPolicy{OrganizationID: orgID}, nil
+	}
+	return &policy, nil
+}
+
+func (m *MagicLinkStore) SetPolicy(ctx context.Context, policy *models.MagicLinkPolicy) error {
+	err := m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "bind_ip", "bind_device", "updated_by", "updated_at"}),
+	}).Create(policy).Error
+	return dbError(err, nil)
+}
+
+func (m *MagicLinkStore) CreateLink(ctx context.Context, link *models.MagicLink) error {
+	return dbError(m.db.WithContext(ctx).Create(link).Error, nil)
+}
+
+// CountLinks counts the links sent to email since since, used or not. In a
+// transaction, the email stays locked until it ends, so concurrent callers
+// that count before creating a link take turns instead of all getting in
+// under the limit.
+func (m *MagicLinkStore) CountLinks(ctx context.Context, email string, since time.Time) (int64, error) {
+	var n int64
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", email).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.MagicLink{}).
+			Where("email = ? AND created_at > ?", email, since).
+			Count(&n).
+			Error
+	})
+	return n, dbError(err, nil)
+}
+
+// GetLink returns the link with the token hash if it is unused and has not
+// expired at now.
+func (m *MagicLinkStore) GetLink(ctx context.Context, tokenHash string, now time.Time) (*models.MagicLink, error) {
+	var link models.MagicLink
+	err := m.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		First(&link).
+		Error
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// UseLink marks the link used. Only one caller can, the others get
+// ErrInvalidToken.
+func (m *MagicLinkStore) UseLink(ctx context.Context, id uuid.UUID, now time.Time) error {
+	result := m.db.WithContext(ctx).
+		Model(&models.MagicLink{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RotateLink replaces the token hash of the link, if it is unused and has
+// not expired at now, and returns ErrInvalidToken otherwise.
+func (m *MagicLinkStore) RotateLink(ctx context.Context, id uuid.UUID, tokenHash string, now time.Time) error {
+	result := m.db.WithContext(ctx).
+		Model(&models.MagicLink{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("token_hash", tokenHash)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// DeleteExpired removes the links that expired before before.
+func (m *MagicLinkStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := m.db.WithContext(ctx).Where("expires_at <= ?", before).Delete(&models.MagicLink{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
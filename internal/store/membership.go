@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type MembershipStore struct {
+	db *gorm.DB
+}
+
+func (m *MembershipStore) CreateMembership(ctx context.Context, membership *models.Membership) error {
+	err := dbError(m.db.WithContext(ctx).Create(membership).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_memberships_user_org", ErrDuplicateMembership)
+}
+
+func (m *MembershipStore) GetMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	var membership models.Membership
+	err := m.db.WithContext(ctx).
+		Where("user_id = ? AND organization_id = ?", userID, orgID).
+		First(&membership).
+		Error
+	if err := dbError(err, ErrMembershipNotFound); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// GetDeletedMembership returns the most recently deleted membership of the
+// user in the organization.
+func (m *MembershipStore) GetDeletedMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	var membership models.Membership
+	err := m.db.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND organization_id = ? AND deleted_at IS NOT NULL", userID, orgID).
+		Order("deleted_at DESC").
+		First(&membership).
+		Error
+	if err := dbError(err, ErrMembershipNotFound); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListUserMemberships returns the user's memberships, oldest first.
+func (m *MembershipStore) ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error) {
+	memberships := []models.Membership{}
+	err := m.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at, id").
+		Find(&memberships).
+		Error
+	return memberships, dbError(err, nil)
+}
+
+// OrganizationMember is a user with their membership in one organization.
+type OrganizationMember struct {
+	User       models.User
+	Membership models.Membership
+}
+
+// ListOrganizationMembers returns every member of the organization, oldest
+// membership first.
+func (m *MembershipStore) ListOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]OrganizationMember, error) {
+	memberships := []models.Membership{}
+	err := m.db.WithContext(ctx).
+		Where("organization_id = ?", orgID).
+		Order("created_at, id").
+		Find(&memberships).
+		Error
+	if err != nil {
+		return nil, dbError(err, nil)
+	}
+
+	members := []OrganizationMember{}
+	if len(memberships) == 0 {
+		return members, nil
+	}
+	ids := make([]uuid.UUID, len(memberships))
+	for i, membership := range memberships {
+		ids[i] = membership.UserID
+	}
+	var users []models.User
+	if err := m.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, dbError(err, nil)
+	}
+	byID := make(map[uuid.UUID]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	for _, membership := range memberships {
+		if user, ok := byID[membership.UserID]; ok {
+			members = append(members, OrganizationMember{User: user, Membership: membership})
+		}
+	}
+	return members, nil
+}
+
+func (m *MembershipStore) UpdateMembership(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	err := m.db.WithContext(ctx).
+		Model(&models.Membership{}).
+		Where("id = ?", id).
+		Updates(updates).
+		Error
+	return dbError(err, nil)
+}
+
+func (m *MembershipStore) DeleteMembership(ctx context.Context, id uuid.UUID) error {
+	result := m.db.WithContext(ctx).Model(&models.Membership{}).Where("id = ?", id).Update("deleted_at", deletionTime())
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMembershipNotFound
+	}
+	return nil
+}
+
+// RestoreMembership undoes DeleteMembership if it happened at or after
+// deletedSince. Both the user and the organization must still exist.
+func (m *MembershipStore) RestoreMembership(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var membership models.Membership
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&membership).Error
+		if err != nil {
+			return dbError(err, ErrMembershipNotFound)
+		}
+		if err := checkRestorable(membership.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", membership.OrganizationID).First(&models.Organization{}).Error; err != nil {
+			return dbError(err, ErrOrgDeleted)
+		}
+		if err := tx.Where("id = ?", membership.UserID).First(&models.User{}).Error; err != nil {
+			return dbError(err, ErrUserNotFound)
+		}
+
+		return tx.Unscoped().Model(&models.Membership{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	})
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_memberships_user_org", ErrDuplicateMembership)
+}
+
+// PurgeDeleted permanently removes memberships deleted before deletedBefore.
+func (m *MembershipStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := m.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&models.Membership{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// memData holds every table of the in-memory store. Rows are stored by value
+// so that cloning the maps is enough to snapshot the whole database.
+type memData struct {
+	admins        map[uuid.UUID]models.Admin
+	adminInvites  map[uuid.UUID]models.AdminInvites
+	organizations map[uuid.UUID]models.Organization
+	users         map[uuid.UUID]models.User
+	userInvites   map[uuid.UUID]models.UserInvites
+	memberships   map[uuid.UUID]models.Membership
+	groups        map[uuid.UUID]models.Group
+	groupMembers  map[groupMemberKey]models.GroupMember
+	groupRoles    map[groupRoleKey]models.GroupRole
+	roleGrants    map[uuid.UUID]models.RoleGrant
+	outbox        map[uuid.UUID]models.OutboxMessage
+
+	orgSuspensions map[uuid.UUID]models.OrganizationSuspension
+	orgTransfers   map[uuid.UUID]models.OrganizationTransfer
+
+	accessPolicies  map[uuid.UUID]models.AccessPolicy
+	accessApprovers map[accessApproverKey]models.AccessApprover
+	accessRequests  map[uuid.UUID]models.AccessRequest
+	accessDecisions map[accessDecisionKey]models.AccessDecision
+
+	accessReviews     map[uuid.UUID]models.AccessReview
+	accessReviewers   map[accessReviewerKey]models.AccessReviewer
+	accessReviewItems map[uuid.UUID]models.AccessReviewItem
+
+	auditEvents    map[uuid.UUID]models.AuditEvent
+	authzDecisions map[uuid.UUID]models.AuthzDecision
+
+	webhooks          map[uuid.UUID]models.WebhookSubscription
+	webhookDeliveries map[uuid.UUID]models.WebhookDelivery
+
+	scimTokens map[uuid.UUID]models.ScimToken
+
+	oidcProviders   map[uuid.UUID]models.OIDCProvider
+	oidcLoginStates map[uuid.UUID]models.OIDCLoginState
+	samlProviders   map[uuid.UUID]models.SAMLProvider
+	samlRequests    map[string]models.SAMLRequest
+	samlAssertions  map[samlAssertionKey]models.SAMLAssertion
+	magicPolicies   map[uuid.UUID]models.MagicLinkPolicy
+	magicLinks      map[uuid.UUID]models.MagicLink
+	oauthClients    map[uuid.UUID]models.OAuthClient
+	oauthCodes      map[uuid.UUID]models.OAuthAuthorizationCode
+	oauthTokens     map[uuid.UUID]models.OAuthToken
+}
+
+func newMemData() *memData {
+	return &memData{
+		admins:        map[uuid.UUID]models.Admin{},
+		adminInvites:  map[uuid.UUID]models.AdminInvites{},
+		organizations: map[uuid.UUID]models.Organization{},
+		users:         map[uuid.UUID]models.User{},
+		userInvites:   map[uuid.UUID]models.UserInvites{},
+		memberships:   map[uuid.UUID]models.Membership{},
+		groups:        map[uuid.UUID]models.Group{},
+		groupMembers:  map[groupMemberKey]models.GroupMember{},
+		groupRoles:    map[groupRoleKey]models.GroupRole{},
+		roleGrants:    map[uuid.UUID]models.RoleGrant{},
+		outbox:        map[uuid.UUID]models.OutboxMessage{},
+
+		orgSuspensions: map[uuid.UUID]models.OrganizationSuspension{},
+		orgTransfers:   map[uuid.UUID]models.OrganizationTransfer{},
+
+		accessPolicies:  map[uuid.UUID]models.AccessPolicy{},
+		accessApprovers: map[accessApproverKey]models.AccessApprover{},
+		accessRequests:  map[uuid.UUID]models.AccessRequest{},
+		accessDecisions: map[accessDecisionKey]models.AccessDecision{},
+
+		accessReviews:     map[uuid.UUID]models.AccessReview{},
+		accessReviewers:   map[accessReviewerKey]models.AccessReviewer{},
+		accessReviewItems: map[uuid.UUID]models.AccessReviewItem{},
+
+		auditEvents:    map[uuid.UUID]models.AuditEvent{},
+		authzDecisions: map[uuid.UUID]models.AuthzDecision{},
+
+		webhooks:          map[uuid.UUID]models.WebhookSubscription{},
+		webhookDeliveries: map[uuid.UUID]models.WebhookDelivery{},
+
+		scimTokens: map[uuid.UUID]models.ScimToken{},
+
+		oidcProviders:   map[uuid.UUID]models.OIDCProvider{},
+		oidcLoginStates: map[uuid.UUID]models.OIDCLoginState{},
+		samlProviders:   map[uuid.UUID]models.SAMLProvider{},
+		samlRequests:    map[string]models.SAMLRequest{},
+		samlAssertions:  map[samlAssertionKey]models.SAMLAssertion{},
+		magicPolicies:   map[uuid.UUID]models.MagicLinkPolicy{},
+		magicLinks:      map[uuid.UUID]models.MagicLink{},
+		oauthClients:    map[uuid.UUID]models.OAuthClient{},
+		oauthCodes:      map[uuid.UUID]models.OAuthAuthorizationCode{},
+		oauthTokens:     map[uuid.UUID]models.OAuthToken{},
+	}
+}
+
+func (d *memData) clone() *memData {
+	return &memData{
+		admins:        maps.Clone(d.admins),
+		adminInvites:  maps.Clone(d.adminInvites),
+		organizations: maps.Clone(d.organizations),
+		users:         maps.Clone(d.users),
+		userInvites:   maps.Clone(d.userInvites),
+		memberships:   maps.Clone(d.memberships),
+		groups:        maps.Clone(d.groups),
+		groupMembers:  maps.Clone(d.groupMembers),
+		groupRoles:    maps.Clone(d.groupRoles),
+		roleGrants:    maps.Clone(d.roleGrants),
+		outbox:        maps.Clone(d.outbox),
+
+		orgSuspensions: maps.Clone(d.orgSuspensions),
+		orgTransfers:   maps.Clone(d.orgTransfers),
+
+		accessPolicies:  maps.Clone(d.accessPolicies),
+		accessApprovers: maps.Clone(d.accessApprovers),
+		accessRequests:  maps.Clone(d.accessRequests),
+		accessDecisions: maps.Clone(d.accessDecisions),
+
+		accessReviews:     maps.Clone(d.accessReviews),
+		accessReviewers:   maps.Clone(d.accessReviewers),
+		accessReviewItems: maps.Clone(d.accessReviewItems),
+
+		auditEvents:    maps.Clone(d.auditEvents),
+		authzDecisions: maps.Clone(d.authzDecisions),
+
+		webhooks:          maps.Clone(d.webhooks),
+		webhookDeliveries: maps.Clone(d.webhookDeliveries),
+
+		scimTokens: maps.Clone(d.scimTokens),
+
+		oidcProviders:   maps.Clone(d.oidcProviders),
+		oidcLoginStates: maps.Clone(d.oidcLoginStates),
+		samlProviders:   maps.Clone(d.samlProviders),
+		samlRequests:    maps.Clone(d.samlRequests),
+		samlAssertions:  maps.Clone(d.samlAssertions),
+		magicPolicies:   maps.Clone(d.magicPolicies),
+		magicLinks:      maps.Clone(d.magicLinks),
+		oauthClients:    maps.Clone(d.oauthClients),
+		oauthCodes:      maps.Clone(d.oauthCodes),
+		oauthTokens:     maps.Clone(d.oauthTokens),
+	}
+}
+
+type memDB struct {
+	mu   sync.Mutex
+	data *memData
+}
+
+// do runs fn with exclusive access to the data.
+func (m *memDB) do(ctx context.Context, fn func(d *memData) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn(m.data)
+}
+
+// NewMemoryStorage returns a Storage backed by process memory, for tests and
+// local demos. Nothing is persisted.
+//
+// WithTx is serializable: it holds the store for the whole callback and works
+// on a snapshot that replaces the live data only if the callback succeeds. The
+// callback must therefore use the TxStorage it is given. Nesting is not
+// supported: using the outer Storage, or starting another WithTx, from inside
+// the callback waits for the callback itself and deadlocks.
+func NewMemoryStorage() Storage {
+	root := &memDB{data: newMemData()}
+
+	s := Storage{
+		Admin:        &MemoryAdminStore{db: root},
+		AdminInvites: &MemoryAdminInviteStore{db: root},
+		Organization: &MemoryOrganizationStore{db: root},
+		User:         &MemoryUserStore{db: root},
+		UserInvite:   &MemoryUserInviteStore{db: root},
+		Membership:   &MemoryMembershipStore{db: root},
+		Group:        &MemoryGroupStore{db: root},
+		Grant:        &MemoryRoleGrantStore{db: root},
+		Access:       &MemoryAccessStore{db: root},
+		Review:       &MemoryReviewStore{db: root},
+		Audit:        &MemoryAuditStore{db: root},
+		Authz:        &MemoryAuthzStore{db: root},
+		Webhook:      &MemoryWebhookStore{db: root},
+		Scim:         &MemoryScimStore{db: root},
+		OIDC:         &MemoryOIDCStore{db: root},
+		SAML:         &MemorySAMLStore{db: root},
+		MagicLink:    &MemoryMagicLinkStore{db: root},
+		OAuth:        &MemoryOAuthStore{db: root},
+		Outbox:       &MemoryOutboxStore{db: root},
+	}
+	s.runTx = func(ctx context.Context, fn func(tx TxStorage) error) error {
+		return memoryTx(ctx, root, fn)
+	}
+	return s
+}
+
+func memoryTx(ctx context.Context, root *memDB, fn func(tx TxStorage) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+
+	tx := &memDB{data: root.data.clone()}
+	txs := TxStorage{
+		Admin:        &MemoryAdminStore{db: tx},
+		AdminInvites: &MemoryAdminInviteStore{db: tx},
+		Organization: &MemoryOrganizationStore{db: tx},
+		User:         &MemoryUserStore{db: tx},
+		UserInvite:   &MemoryUserInviteStore{db: tx},
+		Membership:   &MemoryMembershipStore{db: tx},
+		Group:        &MemoryGroupStore{db: tx},
+		Grant:        &MemoryRoleGrantStore{db: tx},
+		Access:       &MemoryAccessStore{db: tx},
+		Review:       &MemoryReviewStore{db: tx},
+		Audit:        &MemoryAuditStore{db: tx},
+		Authz:        &MemoryAuthzStore{db: tx},
+		Webhook:      &MemoryWebhookStore{db: tx},
+		Scim:         &MemoryScimStore{db: tx},
+		OIDC:         &MemoryOIDCStore{db: tx},
+		SAML:         &MemorySAMLStore{db: tx},
+		MagicLink:    &MemoryMagicLinkStore{db: tx},
+		OAuth:        &MemoryOAuthStore{db: tx},
+		Outbox:       &MemoryOutboxStore{db: tx},
+	}
+
+	if err := fn(txs); err != nil {
+		return err
+	}
+
+	root.data = tx.data
+	return nil
+}
+
+var modelSchemas sync.Map
+
+// applyUpdates mimics gorm's Updates(map) on an in-memory row: keys are column
+// names, and updated_at is bumped unless it is set explicitly.
+func applyUpdates(row any, updates map[string]interface{}) error {
+	sch, err := schema.Parse(row, &modelSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	rv := reflect.ValueOf(row).Elem()
+	for column, value := range updates {
+		field := sch.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column %q on %s", column, sch.Table)
+		}
+		if err := field.Set(ctx, rv, value); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := updates["updated_at"]; !ok {
+		if field := sch.LookUpField("updated_at"); field != nil {
+			return field.Set(ctx, rv, time.Now())
+		}
+	}
+	return nil
+}
+
+// stampCreate fills created_at/updated_at the way gorm does on Create.
+func stampCreate(createdAt, updatedAt *time.Time) {
+	now := time.Now()
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	if updatedAt != nil && updatedAt.IsZero() {
+		*updatedAt = now
+	}
+}
+
+// deletedAt is the soft-delete marker gorm would write for a deletion at at.
+func deletedAt(at time.Time) gorm.DeletedAt {
+	return gorm.DeletedAt{Time: at, Valid: true}
+}
+
+// memConstraint builds the error Postgres would have raised for a violated
+// constraint, so both implementations fail the same way.
+func memConstraint(kind error, table, constraint string, domain error, columns ...string) error {
+	return &ConstraintError{
+		Kind:       kind,
+		Domain:     domain,
+		Table:      table,
+		Constraint: constraint,
+		Columns:    columns,
+	}
+}
+
+// memCheckIn enforces a `column IN (...)` check constraint.
+func memCheckIn(table, column, value string, allowed ...string) error {
+	if slices.Contains(allowed, value) {
+		return nil
+	}
+	return memConstraint(ErrCheckViolation, table, "chk_"+table+"_"+column, nil, column)
+}
@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryAccessStore struct {
+	db *memDB
+}
+
+type accessApproverKey struct {
+	OrganizationID uuid.UUID
+	AccountID      uuid.UUID
+}
+
+type accessDecisionKey struct {
+	RequestID  uuid.UUID
+	ApproverID uuid.UUID
+}
+
+func (a *MemoryAccessStore) GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.AccessPolicy, error) {
+	policy := defaultAccessPolicy(orgID)
+	err := a.db.do(ctx, func(d *memData) error {
+		if found, ok := d.accessPolicies[orgID]; ok {
+			*policy = found
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (a *MemoryAccessStore) SetPolicy(ctx context.Context, policy *models.AccessPolicy, approvers []models.AccessApprover) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if _, ok := d.organizations[policy.OrganizationID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "access_policies", "access_policies_organization_id_fkey", nil,
+				"organization_id")
+		}
+		if policy.Quorum < 1 {
+			return memConstraint(ErrCheckViolation, "access_policies", "chk_access_policies_quorum", ErrAccessQuorum, "quorum")
+		}
+		for _, approver := range approvers {
+			if err := memCheckIn("access_approvers", "account_type", approver.AccountType,
+				models.GrantAccountAdmin, models.GrantAccountUser); err != nil {
+				return err
+			}
+		}
+
+		if existing, ok := d.accessPolicies[policy.OrganizationID]; ok {
+			policy.CreatedAt = existing.CreatedAt
+			policy.UpdatedAt = time.Now()
+		}
+		stampCreate(&policy.CreatedAt, &policy.UpdatedAt)
+		d.accessPolicies[policy.OrganizationID] = *policy
+
+		for key := range d.accessApprovers {
+			if key.OrganizationID == policy.OrganizationID {
+				delete(d.accessApprovers, key)
+			}
+		}
+		for i := range approvers {
+			key := accessApproverKey{approvers[i].OrganizationID, approvers[i].AccountID}
+			if _, ok := d.accessApprovers[key]; ok {
+				return memConstraint(ErrUniqueViolation, "access_approvers", "access_approvers_pkey", nil,
+					"organization_id", "account_id")
+			}
+			stampCreate(&approvers[i].CreatedAt, nil)
+			d.accessApprovers[key] = approvers[i]
+		}
+		return nil
+	})
+}
+
+func (a *MemoryAccessStore) ListApprovers(ctx context.Context, orgID uuid.UUID) ([]models.AccessApprover, error) {
+	approvers := []models.AccessApprover{}
+	err := a.db.do(ctx, func(d *memData) error {
+		for key, approver := range d.accessApprovers {
+			if key.OrganizationID == orgID {
+				approvers = append(approvers, approver)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(approvers, func(x, y models.AccessApprover) int {
+		return compareKeys(x.CreatedAt, x.AccountID, y.CreatedAt, y.AccountID)
+	})
+	return approvers, err
+}
+
+func (a *MemoryAccessStore) CreateRequest(ctx context.Context, req *models.AccessRequest) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if req.ID == uuid.Nil {
+			req.ID = uuid.New()
+		}
+		if req.Status == "" {
+			req.Status = models.AccessRequestPending
+		}
+		if err := d.checkAccessRequest(req); err != nil {
+			return err
+		}
+		stampCreate(&req.CreatedAt, &req.UpdatedAt)
+		d.accessRequests[req.ID] = *req
+		return nil
+	})
+}
+
+func (a *MemoryAccessStore) GetRequest(ctx context.Context, id uuid.UUID) (*models.AccessRequest, error) {
+	var req models.AccessRequest
+	err := a.db.do(ctx, func(d *memData) error {
+		found, ok := d.accessRequests[id]
+		if !ok {
+			return ErrAccessRequestNotFound
+		}
+		req = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (a *MemoryAccessStore) ListRequests(ctx context.Context, f AccessRequestFilter) ([]models.AccessRequest, error) {
+	reqs := []models.AccessRequest{}
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, req := range d.accessRequests {
+			if f.OrganizationID != uuid.Nil && req.OrganizationID != f.OrganizationID {
+				continue
+			}
+			if f.RequesterID != uuid.Nil && req.RequesterID != f.RequesterID {
+				continue
+			}
+			if f.Status != "" && req.Status != f.Status {
+				continue
+			}
+			reqs = append(reqs, req)
+		}
+		return nil
+	})
+	slices.SortFunc(reqs, func(x, y models.AccessRequest) int {
+		return y.CreatedAt.Compare(x.CreatedAt)
+	})
+	return reqs, err
+}
+
+func (a *MemoryAccessStore) ListExpiredRequests(ctx context.Context, at time.Time) ([]models.AccessRequest, error) {
+	reqs := []models.AccessRequest{}
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, req := range d.accessRequests {
+			if req.Status == models.AccessRequestPending && !req.ExpiresAt.After(at) {
+				reqs = append(reqs, req)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(reqs, func(x, y models.AccessRequest) int {
+		return compareKeys(x.ExpiresAt, x.ID, y.ExpiresAt, y.ID)
+	})
+	return reqs, err
+}
+
+func (a *MemoryAccessStore) ResolveRequest(
+	ctx context.Context,
+	id uuid.UUID,
+	status string,
+	grantID *uuid.UUID,
+	at time.Time,
+) error {
+	return a.db.do(ctx, func(d *memData) error {
+		req, ok := d.accessRequests[id]
+		if !ok || req.Status != models.AccessRequestPending {
+			return ErrAccessRequestNotPending
+		}
+		req.Status = status
+		req.GrantID = grantID
+		req.ResolvedAt = &at
+		req.UpdatedAt = time.Now()
+		if err := d.checkAccessRequest(&req); err != nil {
+			return err
+		}
+		d.accessRequests[id] = req
+		return nil
+	})
+}
+
+func (a *MemoryAccessStore) RecordDecision(ctx context.Context, decision *models.AccessDecision) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if _, ok := d.accessRequests[decision.RequestID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "access_decisions", "access_decisions_request_id_fkey", nil,
+				"request_id")
+		}
+		key := accessDecisionKey{decision.RequestID, decision.ApproverID}
+		if _, ok := d.accessDecisions[key]; ok {
+			return memConstraint(ErrUniqueViolation, "access_decisions", "access_decisions_pkey", ErrDuplicateDecision,
+				"request_id", "approver_id")
+		}
+		if err := memCheckIn("access_decisions", "decision", decision.Decision,
+			models.AccessDecisionApprove, models.AccessDecisionReject); err != nil {
+			return err
+		}
+		stampCreate(&decision.CreatedAt, nil)
+		d.accessDecisions[key] = *decision
+		return nil
+	})
+}
+
+func (a *MemoryAccessStore) ListDecisions(ctx context.Context, requestID uuid.UUID) ([]models.AccessDecision, error) {
+	decisions := []models.AccessDecision{}
+	err := a.db.do(ctx, func(d *memData) error {
+		for key, decision := range d.accessDecisions {
+			if key.RequestID == requestID {
+				decisions = append(decisions, decision)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(decisions, func(x, y models.AccessDecision) int {
+		return compareKeys(x.CreatedAt, x.ApproverID, y.CreatedAt, y.ApproverID)
+	})
+	return decisions, err
+}
+
+func (d *memData) checkAccessRequest(req *models.AccessRequest) error {
+	if req.Status == models.AccessRequestPending {
+		for _, existing := range d.accessRequests {
+			if existing.ID != req.ID && existing.Status == models.AccessRequestPending &&
+				existing.OrganizationID == req.OrganizationID && existing.RequesterID == req.RequesterID &&
+				existing.Role == req.Role && existing.Permission == req.Permission {
+				return memConstraint(ErrUniqueViolation, "access_requests", "idx_access_requests_pending",
+					ErrDuplicateAccessRequest, "organization_id", "requester_id", "role", "permission")
+			}
+		}
+	}
+	if _, ok := d.organizations[req.OrganizationID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "access_requests", "access_requests_organization_id_fkey", nil,
+			"organization_id")
+	}
+	if (req.Role != "") == (req.Permission != "") {
+		return memConstraint(ErrCheckViolation, "access_requests", "chk_access_requests_target", nil, "role", "permission")
+	}
+	if req.GrantMinutes <= 0 {
+		return memConstraint(ErrCheckViolation, "access_requests", "chk_access_requests_grant_minutes", nil, "grant_minutes")
+	}
+	return memCheckIn("access_requests", "status", req.Status,
+		models.AccessRequestPending, models.AccessRequestApproved, models.AccessRequestRejected,
+		models.AccessRequestExpired, models.AccessRequestCancelled)
+}
+
+// purgeOrgAccess mirrors the cascades from organizations to the access
+// tables.
+func (d *memData) purgeOrgAccess(orgID uuid.UUID) {
+	delete(d.accessPolicies, orgID)
+	for key := range d.accessApprovers {
+		if key.OrganizationID == orgID {
+			delete(d.accessApprovers, key)
+		}
+	}
+	for id, req := range d.accessRequests {
+		if req.OrganizationID != orgID {
+			continue
+		}
+		delete(d.accessRequests, id)
+		for key := range d.accessDecisions {
+			if key.RequestID == id {
+				delete(d.accessDecisions, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type MemoryAdminStore struct {
+	db *memDB
+}
+
+func (a *MemoryAdminStore) LoginAdmin(ctx context.Context, email, password string) (*models.Admin, error) {
+	admin, err := a.GetAdminByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CheckPassword(password, admin.Password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return admin, nil
+}
+
+func (a *MemoryAdminStore) CreateAdmin(ctx context.Context, user *models.Admin) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if user.ID == uuid.Nil {
+			user.ID = uuid.New()
+		}
+		if user.Status == "" {
+			user.Status = "pending"
+		}
+		if err := d.checkAdmin(user); err != nil {
+			return err
+		}
+		stampCreate(&user.CreatedAt, &user.UpdatedAt)
+		d.admins[user.ID] = *user
+		return nil
+	})
+}
+
+func (a *MemoryAdminStore) GetAdmin(ctx context.Context, id uuid.UUID) (*models.Admin, error) {
+	var admin models.Admin
+	err := a.db.do(ctx, func(d *memData) error {
+		found, ok := d.admins[id]
+		if !ok || found.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		admin = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (a *MemoryAdminStore) GetAdminByEmail(ctx context.Context, email string) (*models.Admin, error) {
+	var admin models.Admin
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, found := range d.admins {
+			if found.Email == email && !found.DeletedAt.Valid {
+				admin = found
+				return nil
+			}
+		}
+		return ErrUserNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (a *MemoryAdminStore) UpdateAdmin(
+	ctx context.Context,
+	adminID uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return a.db.do(ctx, func(d *memData) error {
+		admin, ok := d.admins[adminID]
+		if !ok || admin.DeletedAt.Valid {
+			return nil
+		}
+		if err := applyUpdates(&admin, updates); err != nil {
+			return err
+		}
+		if err := d.checkAdmin(&admin); err != nil {
+			return err
+		}
+		d.admins[adminID] = admin
+		return nil
+	})
+}
+
+func (d *memData) checkAdmin(admin *models.Admin) error {
+	for _, existing := range d.admins {
+		if !admin.DeletedAt.Valid && !existing.DeletedAt.Valid && existing.ID != admin.ID && existing.Email == admin.Email {
+			return memConstraint(ErrUniqueViolation, "admins", "idx_admins_email", ErrDuplicateEmail, "email")
+		}
+	}
+	return memCheckIn("admins", "status", admin.Status, "active", "pending", "suspended")
+}
+
+type MemoryAdminInviteStore struct {
+	db *memDB
+}
+
+func (a *MemoryAdminInviteStore) CreateAdminInvites(ctx context.Context, invite *models.AdminInvites) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if invite.ID == uuid.Nil {
+			invite.ID = uuid.New()
+		}
+		if _, ok := d.adminInvites[invite.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "admin_invites", "admin_invites_pkey", nil, "id")
+		}
+		stampCreate(&invite.CreatedAt, nil)
+		d.adminInvites[invite.ID] = *invite
+		return nil
+	})
+}
+
+func (a *MemoryAdminInviteStore) ValidateToken(ctx context.Context, token string) (*models.AdminInvites, error) {
+	var invite models.AdminInvites
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, found := range d.adminInvites {
+			if found.TokenHash == token && !found.DeletedAt.Valid {
+				invite = found
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (a *MemoryAdminInviteStore) UpdateInvite(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return a.db.do(ctx, func(d *memData) error {
+		invite, ok := d.adminInvites[id]
+		if !ok || invite.DeletedAt.Valid {
+			return nil
+		}
+		if err := applyUpdates(&invite, updates); err != nil {
+			return err
+		}
+		d.adminInvites[id] = invite
+		return nil
+	})
+}
+
+func (a *MemoryAdminInviteStore) GetInviteByAdminId(ctx context.Context, adminID uuid.UUID) (*models.AdminInvites, error) {
+	var invite models.AdminInvites
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, found := range d.adminInvites {
+			if found.AdminId == adminID && !found.DeletedAt.Valid {
+				invite = found
+				return nil
+			}
+		}
+		return ErrInviteNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (a *MemoryAdminStore) ListAdmins(ctx context.Context, p ListParams) ([]models.Admin, PageInfo, error) {
+	var rows []models.Admin
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, admin := range d.admins {
+			if admin.DeletedAt.Valid {
+				continue
+			}
+			if p.Status != "" && admin.Status != p.Status {
+				continue
+			}
+			if p.Role != "" && admin.Role != p.Role {
+				continue
+			}
+			rows = append(rows, admin)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return memPage(rows, p, adminListSpec,
+		func(admin models.Admin) uuid.UUID { return admin.ID },
+		func(admin models.Admin) string { return admin.Name + " " + admin.Email },
+	)
+}
+
+func (a *MemoryAdminInviteStore) ListAdminInvites(ctx context.Context, p ListParams) ([]models.AdminInvites, PageInfo, error) {
+	if err := validInviteState(p.Status); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	var rows []models.AdminInvites
+	now := time.Now()
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, invite := range d.adminInvites {
+			if invite.DeletedAt.Valid {
+				continue
+			}
+			if p.AdminID != uuid.Nil && invite.AdminId != p.AdminID {
+				continue
+			}
+			if p.Status != "" && inviteState(invite.UsedAt, invite.ExpiresAt, now) != p.Status {
+				continue
+			}
+			rows = append(rows, invite)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	return memPage(rows, p, inviteListSpec,
+		func(invite models.AdminInvites) uuid.UUID { return invite.ID },
+		nil,
+	)
+}
+
+func (a *MemoryAdminStore) DeleteAdmin(ctx context.Context, id uuid.UUID) error {
+	at := deletedAt(deletionTime())
+	return a.db.do(ctx, func(d *memData) error {
+		admin, ok := d.admins[id]
+		if !ok || admin.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		for _, org := range d.organizations {
+			if org.AdminID == id && !org.DeletedAt.Valid {
+				return ErrAdminOwnsOrgs
+			}
+		}
+		admin.DeletedAt = at
+		d.admins[id] = admin
+
+		for inviteID, invite := range d.adminInvites {
+			if invite.AdminId == id && !invite.DeletedAt.Valid {
+				invite.DeletedAt = at
+				d.adminInvites[inviteID] = invite
+			}
+		}
+		return nil
+	})
+}
+
+func (a *MemoryAdminStore) RestoreAdmin(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	return a.db.do(ctx, func(d *memData) error {
+		admin, ok := d.admins[id]
+		if !ok || !admin.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		if err := checkRestorable(admin.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+
+		at := admin.DeletedAt
+		admin.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkAdmin(&admin); err != nil {
+			return err
+		}
+		d.admins[id] = admin
+
+		for inviteID, invite := range d.adminInvites {
+			if invite.AdminId == id && invite.DeletedAt == at {
+				invite.DeletedAt = gorm.DeletedAt{}
+				d.adminInvites[inviteID] = invite
+			}
+		}
+		return nil
+	})
+}
+
+func (a *MemoryAdminStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := a.db.do(ctx, func(d *memData) error {
+		referenced := map[uuid.UUID]bool{}
+		for _, org := range d.organizations {
+			referenced[org.AdminID] = true
+		}
+		for id, admin := range d.admins {
+			if admin.DeletedAt.Valid && admin.DeletedAt.Time.Before(deletedBefore) && !referenced[id] {
+				delete(d.admins, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (a *MemoryAdminInviteStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := a.db.do(ctx, func(d *memData) error {
+		for id, invite := range d.adminInvites {
+			if invite.DeletedAt.Valid && invite.DeletedAt.Time.Before(deletedBefore) {
+				delete(d.adminInvites, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryAuditStore struct {
+	db *memDB
+}
+
+func (s *MemoryAuditStore) Append(ctx context.Context, event *models.AuditEvent) error {
+	return s.db.do(ctx, func(d *memData) error {
+		var last models.AuditEvent
+		for _, e := range d.auditEvents {
+			if e.Seq > last.Seq {
+				last = e
+			}
+		}
+		if err := chainAudit(event, last); err != nil {
+			return err
+		}
+		d.auditEvents[event.ID] = *event
+		return nil
+	})
+}
+
+func (s *MemoryAuditStore) ListEvents(ctx context.Context, f AuditFilter, p ListParams) ([]models.AuditEvent, PageInfo, error) {
+	var rows []models.AuditEvent
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, e := range d.auditEvents {
+			switch {
+			case f.ActorID != uuid.Nil && (e.ActorID == nil || *e.ActorID != f.ActorID),
+				f.ResourceID != uuid.Nil && (e.ResourceID == nil || *e.ResourceID != f.ResourceID),
+				f.OrganizationID != uuid.Nil && (e.OrganizationID == nil || *e.OrganizationID != f.OrganizationID),
+				f.Action != "" && e.Action != f.Action,
+				f.ResourceType != "" && e.ResourceType != f.ResourceType,
+				f.Outcome != "" && e.Outcome != f.Outcome:
+				continue
+			}
+			rows = append(rows, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return memPage(rows, p, auditListSpec,
+		func(e models.AuditEvent) uuid.UUID { return e.ID },
+		func(models.AuditEvent) string { return "" },
+	)
+}
+
+func (s *MemoryAuditStore) ChainEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, e := range d.auditEvents {
+			if e.Seq > afterSeq {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(events, func(a, b models.AuditEvent) int {
+		return int(a.Seq - b.Seq)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, err
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryAuthzStore struct {
+	db *memDB
+}
+
+func (s *MemoryAuthzStore) AppendDecisions(ctx context.Context, decisions []models.AuthzDecision) error {
+	return s.db.do(ctx, func(d *memData) error {
+		for _, decision := range decisions {
+			d.authzDecisions[decision.ID] = decision
+		}
+		return nil
+	})
+}
+
+func (s *MemoryAuthzStore) ListDecisions(ctx context.Context, f AuthzFilter, limit int) ([]models.AuthzDecision, error) {
+	decisions := []models.AuthzDecision{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, decision := range d.authzDecisions {
+			if AuthzMatches(decision, f) {
+				decisions = append(decisions, decision)
+			}
+		}
+		return nil
+	})
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].CreatedAt.After(decisions[j].CreatedAt)
+	})
+	if len(decisions) > limit {
+		decisions = decisions[:limit]
+	}
+	return decisions, err
+}
+
+func (s *MemoryAuthzStore) PurgeDecisions(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.do(ctx, func(d *memData) error {
+		for id, decision := range d.authzDecisions {
+			if decision.CreatedAt.Before(before) {
+				delete(d.authzDecisions, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// AuthzMatches reports whether decision passes f.
+func AuthzMatches(decision models.AuthzDecision, f AuthzFilter) bool {
+	switch {
+	case f.SubjectID != uuid.Nil && (decision.SubjectID == nil || *decision.SubjectID != f.SubjectID),
+		f.OrganizationID != uuid.Nil && (decision.OrganizationID == nil || *decision.OrganizationID != f.OrganizationID),
+		f.Check != "" && decision.Check != f.Check,
+		f.Permission != "" && decision.Permission != f.Permission,
+		f.Outcome != "" && decision.Outcome != f.Outcome:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type groupMemberKey struct {
+	groupID, userID uuid.UUID
+}
+
+type groupRoleKey struct {
+	groupID uuid.UUID
+	role    string
+}
+
+type MemoryGroupStore struct {
+	db *memDB
+}
+
+func (g *MemoryGroupStore) CreateGroup(ctx context.Context, group *models.Group) error {
+	return g.db.do(ctx, func(d *memData) error {
+		if group.ID == uuid.Nil {
+			group.ID = uuid.New()
+		}
+		if err := d.checkGroup(group); err != nil {
+			return err
+		}
+		stampCreate(&group.CreatedAt, &group.UpdatedAt)
+		d.groups[group.ID] = *group
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	var group models.Group
+	err := g.db.do(ctx, func(d *memData) error {
+		found, ok := d.groups[id]
+		if !ok {
+			return ErrGroupNotFound
+		}
+		group = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (g *MemoryGroupStore) ListGroups(ctx context.Context, orgID uuid.UUID) ([]models.Group, error) {
+	groups := []models.Group{}
+	err := g.db.do(ctx, func(d *memData) error {
+		for _, group := range d.groups {
+			if group.OrganizationID == orgID {
+				groups = append(groups, group)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(groups, func(a, b models.Group) int {
+		return compareKeys(a.Name, a.ID, b.Name, b.ID)
+	})
+	return groups, err
+}
+
+func (g *MemoryGroupStore) UpdateGroup(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return g.db.do(ctx, func(d *memData) error {
+		group, ok := d.groups[id]
+		if !ok {
+			return nil
+		}
+		if err := applyUpdates(&group, updates); err != nil {
+			return err
+		}
+		if err := d.checkGroup(&group); err != nil {
+			return err
+		}
+		d.groups[id] = group
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) DeleteGroup(ctx context.Context, id uuid.UUID) error {
+	return g.db.do(ctx, func(d *memData) error {
+		if _, ok := d.groups[id]; !ok {
+			return ErrGroupNotFound
+		}
+		d.deleteGroups(func(group models.Group) bool { return group.ID == id })
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) AddMember(ctx context.Context, member *models.GroupMember) error {
+	return g.db.do(ctx, func(d *memData) error {
+		key := groupMemberKey{member.GroupID, member.UserID}
+		if _, ok := d.groupMembers[key]; ok {
+			return memConstraint(ErrUniqueViolation, "group_members", "group_members_pkey", ErrDuplicateGroupMember,
+				"group_id", "user_id")
+		}
+		if _, ok := d.groups[member.GroupID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "group_members", "group_members_group_id_fkey", nil, "group_id")
+		}
+		if _, ok := d.users[member.UserID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "group_members", "group_members_user_id_fkey", nil, "user_id")
+		}
+		stampCreate(&member.CreatedAt, nil)
+		d.groupMembers[key] = *member
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	return g.db.do(ctx, func(d *memData) error {
+		key := groupMemberKey{groupID, userID}
+		if _, ok := d.groupMembers[key]; !ok {
+			return ErrGroupMemberNotFound
+		}
+		delete(d.groupMembers, key)
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) ListMembers(ctx context.Context, groupID uuid.UUID) ([]models.User, error) {
+	users := []models.User{}
+	err := g.db.do(ctx, func(d *memData) error {
+		group := d.groups[groupID]
+		for key := range d.groupMembers {
+			if key.groupID != groupID {
+				continue
+			}
+			user, ok := d.users[key.userID]
+			if !ok || user.DeletedAt.Valid {
+				continue
+			}
+			if _, ok := d.liveMembership(user.ID, group.OrganizationID); ok {
+				users = append(users, user)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(users, func(a, b models.User) int {
+		return compareKeys(a.Name, a.ID, b.Name, b.ID)
+	})
+	return users, err
+}
+
+func (g *MemoryGroupStore) AddRole(ctx context.Context, role *models.GroupRole) error {
+	return g.db.do(ctx, func(d *memData) error {
+		key := groupRoleKey{role.GroupID, role.Role}
+		if _, ok := d.groupRoles[key]; ok {
+			return memConstraint(ErrUniqueViolation, "group_roles", "group_roles_pkey", ErrDuplicateGroupRole,
+				"group_id", "role")
+		}
+		if _, ok := d.groups[role.GroupID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "group_roles", "group_roles_group_id_fkey", nil, "group_id")
+		}
+		stampCreate(&role.CreatedAt, nil)
+		d.groupRoles[key] = *role
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) RemoveRole(ctx context.Context, groupID uuid.UUID, role string) error {
+	return g.db.do(ctx, func(d *memData) error {
+		key := groupRoleKey{groupID, role}
+		if _, ok := d.groupRoles[key]; !ok {
+			return ErrGroupRoleNotFound
+		}
+		delete(d.groupRoles, key)
+		return nil
+	})
+}
+
+func (g *MemoryGroupStore) ListRoles(ctx context.Context, groupID uuid.UUID) ([]models.GroupRole, error) {
+	roles := []models.GroupRole{}
+	err := g.db.do(ctx, func(d *memData) error {
+		for key, role := range d.groupRoles {
+			if key.groupID == groupID {
+				roles = append(roles, role)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(roles, func(a, b models.GroupRole) int {
+		return strings.Compare(a.Role, b.Role)
+	})
+	return roles, err
+}
+
+func (g *MemoryGroupStore) UserRoles(ctx context.Context, userID, orgID uuid.UUID) ([]string, error) {
+	roles := []string{}
+	err := g.db.do(ctx, func(d *memData) error {
+		inherited := map[uuid.UUID]bool{}
+		for key := range d.groupMembers {
+			if key.userID != userID || d.groups[key.groupID].OrganizationID != orgID {
+				continue
+			}
+			for id := &key.groupID; id != nil && !inherited[*id]; id = d.groups[*id].ParentID {
+				inherited[*id] = true
+			}
+		}
+		for key := range d.groupRoles {
+			if inherited[key.groupID] && !slices.Contains(roles, key.role) {
+				roles = append(roles, key.role)
+			}
+		}
+		return nil
+	})
+	slices.Sort(roles)
+	return roles, err
+}
+
+func (g *MemoryGroupStore) RoleHolders(ctx context.Context, orgID uuid.UUID, roles []string) ([]GroupRoleHolder, error) {
+	holders := []GroupRoleHolder{}
+	err := g.db.do(ctx, func(d *memData) error {
+		seen := map[GroupRoleHolder]bool{}
+		for key := range d.groupMembers {
+			group := d.groups[key.groupID]
+			if orgID != uuid.Nil && group.OrganizationID != orgID {
+				continue
+			}
+			for id := &key.groupID; id != nil; id = d.groups[*id].ParentID {
+				for roleKey := range d.groupRoles {
+					holder := GroupRoleHolder{UserID: key.userID, OrganizationID: group.OrganizationID, Role: roleKey.role}
+					if roleKey.groupID == *id && slices.Contains(roles, roleKey.role) && !seen[holder] {
+						seen[holder] = true
+						holders = append(holders, holder)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(holders, func(x, y GroupRoleHolder) int {
+		return cmp.Or(
+			strings.Compare(x.OrganizationID.String(), y.OrganizationID.String()),
+			strings.Compare(x.UserID.String(), y.UserID.String()),
+			strings.Compare(x.Role, y.Role),
+		)
+	})
+	return holders, err
+}
+
+func (d *memData) checkGroup(group *models.Group) error {
+	for _, existing := range d.groups {
+		if existing.ID != group.ID && existing.OrganizationID == group.OrganizationID && existing.Name == group.Name {
+			return memConstraint(ErrUniqueViolation, "groups", "idx_groups_org_name", ErrDuplicateGroup,
+				"organization_id", "name")
+		}
+	}
+	if _, ok := d.organizations[group.OrganizationID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "groups", "groups_organization_id_fkey", nil, "organization_id")
+	}
+	if group.ParentID == nil {
+		return nil
+	}
+
+	parent, ok := d.groups[*group.ParentID]
+	if !ok {
+		return ErrGroupNotFound
+	}
+	if parent.OrganizationID != group.OrganizationID {
+		return ErrGroupParentOrg
+	}
+	for id := group.ParentID; id != nil; id = d.groups[*id].ParentID {
+		if *id == group.ID {
+			return ErrGroupCycle
+		}
+	}
+	return nil
+}
+
+// deleteGroups removes the groups matching drop along with their members and
+// role bindings. Surviving subgroups move up to the top level, as ON DELETE
+// SET NULL does.
+func (d *memData) deleteGroups(drop func(models.Group) bool) {
+	for id, group := range d.groups {
+		if drop(group) {
+			delete(d.groups, id)
+		}
+	}
+	for id, group := range d.groups {
+		if group.ParentID != nil {
+			if _, ok := d.groups[*group.ParentID]; !ok {
+				group.ParentID = nil
+				d.groups[id] = group
+			}
+		}
+	}
+	for key := range d.groupMembers {
+		if _, ok := d.groups[key.groupID]; !ok {
+			delete(d.groupMembers, key)
+		}
+	}
+	for key := range d.groupRoles {
+		if _, ok := d.groups[key.groupID]; !ok {
+			delete(d.groupRoles, key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryMagicLinkStore struct {
+	db *memDB
+}
+
+func (m *MemoryMagicLinkStore) GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.MagicLinkPolicy, error) {
+	policy := &models.MagicLinkPolicy{OrganizationID: orgID}
+	err := m.db.do(ctx, func(d *memData) error {
+		if found, ok := d.magicPolicies[orgID]; ok {
+			*policy = found
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (m *MemoryMagicLinkStore) SetPolicy(ctx context.Context, policy *models.MagicLinkPolicy) error {
+	return m.db.do(ctx, func(d *memData) error {
+		if _, ok := d.organizations[policy.OrganizationID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "magic_link_policies", "magic_link_policies_organization_id_fkey", nil,
+				"organization_id")
+		}
+
+		if existing, ok := d.magicPolicies[policy.OrganizationID]; ok {
+			policy.CreatedAt = existing.CreatedAt
+			policy.UpdatedAt = time.Now()
+		}
+		stampCreate(&policy.CreatedAt, &policy.UpdatedAt)
+		d.magicPolicies[policy.OrganizationID] = *policy
+		return nil
+	})
+}
+
+func (m *MemoryMagicLinkStore) CreateLink(ctx context.Context, link *models.MagicLink) error {
+	return m.db.do(ctx, func(d *memData) error {
+		if _, ok := d.magicLinks[link.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "magic_links", "magic_links_pkey", nil, "id")
+		}
+		for _, existing := range d.magicLinks {
+			if existing.TokenHash == link.TokenHash {
+				return memConstraint(ErrUniqueViolation, "magic_links", "idx_magic_links_token_hash", nil, "token_hash")
+			}
+		}
+		if _, ok := d.users[link.UserID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "magic_links", "magic_links_user_id_fkey", nil, "user_id")
+		}
+		if _, ok := d.organizations[link.OrganizationID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "magic_links", "magic_links_organization_id_fkey", nil,
+				"organization_id")
+		}
+		stampCreate(&link.CreatedAt, nil)
+		d.magicLinks[link.ID] = *link
+		return nil
+	})
+}
+
+func (m *MemoryMagicLinkStore) CountLinks(ctx context.Context, email string, since time.Time) (int64, error) {
+	var n int64
+	err := m.db.do(ctx, func(d *memData) error {
+		for _, link := range d.magicLinks {
+			if link.Email == email && link.CreatedAt.After(since) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (m *MemoryMagicLinkStore) GetLink(ctx context.Context, tokenHash string, now time.Time) (*models.MagicLink, error) {
+	var link models.MagicLink
+	err := m.db.do(ctx, func(d *memData) error {
+		for _, found := range d.magicLinks {
+			if found.TokenHash == tokenHash && found.UsedAt == nil && found.ExpiresAt.After(now) {
+				link = found
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (m *MemoryMagicLinkStore) UseLink(ctx context.Context, id uuid.UUID, now time.Time) error {
+	return m.db.do(ctx, func(d *memData) error {
+		link, ok := d.magicLinks[id]
+		if !ok || link.UsedAt != nil || !link.ExpiresAt.After(now) {
+			return ErrInvalidToken
+		}
+		link.UsedAt = &now
+		d.magicLinks[id] = link
+		return nil
+	})
+}
+
+func (m *MemoryMagicLinkStore) RotateLink(ctx context.Context, id uuid.UUID, tokenHash string, now time.Time) error {
+	return m.db.do(ctx, func(d *memData) error {
+		link, ok := d.magicLinks[id]
+		if !ok || link.UsedAt != nil || !link.ExpiresAt.After(now) {
+			return ErrInvalidToken
+		}
+		link.TokenHash = tokenHash
+		d.magicLinks[id] = link
+		return nil
+	})
+}
+
+func (m *MemoryMagicLinkStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := m.db.do(ctx, func(d *memData) error {
+		for id, link := range d.magicLinks {
+			if !link.ExpiresAt.After(before) {
+				delete(d.magicLinks, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
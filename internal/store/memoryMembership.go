@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type MemoryMembershipStore struct {
+	db *memDB
+}
+
+func (m *MemoryMembershipStore) CreateMembership(ctx context.Context, membership *models.Membership) error {
+	return m.db.do(ctx, func(d *memData) error {
+		if membership.ID == uuid.Nil {
+			membership.ID = uuid.New()
+		}
+		if membership.Status == "" {
+			membership.Status = "active"
+		}
+		if err := d.checkMembership(membership); err != nil {
+			return err
+		}
+		stampCreate(&membership.CreatedAt, &membership.UpdatedAt)
+		d.memberships[membership.ID] = *membership
+		return nil
+	})
+}
+
+func (m *MemoryMembershipStore) GetMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	var membership models.Membership
+	err := m.db.do(ctx, func(d *memData) error {
+		found, ok := d.liveMembership(userID, orgID)
+		if !ok {
+			return ErrMembershipNotFound
+		}
+		membership = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (m *MemoryMembershipStore) GetDeletedMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	var membership models.Membership
+	err := m.db.do(ctx, func(d *memData) error {
+		found := false
+		for _, candidate := range d.memberships {
+			if candidate.UserID != userID || candidate.OrganizationID != orgID || !candidate.DeletedAt.Valid {
+				continue
+			}
+			if !found || candidate.DeletedAt.Time.After(membership.DeletedAt.Time) {
+				membership = candidate
+				found = true
+			}
+		}
+		if !found {
+			return ErrMembershipNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (m *MemoryMembershipStore) ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error) {
+	memberships := []models.Membership{}
+	err := m.db.do(ctx, func(d *memData) error {
+		for _, membership := range d.memberships {
+			if membership.UserID == userID && !membership.DeletedAt.Valid {
+				memberships = append(memberships, membership)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(memberships, func(a, b models.Membership) int {
+		return compareKeys(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return memberships, err
+}
+
+func (m *MemoryMembershipStore) ListOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]OrganizationMember, error) {
+	members := []OrganizationMember{}
+	err := m.db.do(ctx, func(d *memData) error {
+		for _, membership := range d.memberships {
+			if membership.OrganizationID != orgID || membership.DeletedAt.Valid {
+				continue
+			}
+			if user, ok := d.users[membership.UserID]; ok && !user.DeletedAt.Valid {
+				members = append(members, OrganizationMember{User: user, Membership: membership})
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(members, func(a, b OrganizationMember) int {
+		return compareKeys(a.Membership.CreatedAt, a.Membership.ID, b.Membership.CreatedAt, b.Membership.ID)
+	})
+	return members, err
+}
+
+func (m *MemoryMembershipStore) UpdateMembership(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return m.db.do(ctx, func(d *memData) error {
+		membership, ok := d.memberships[id]
+		if !ok || membership.DeletedAt.Valid {
+			return nil
+		}
+		if err := applyUpdates(&membership, updates); err != nil {
+			return err
+		}
+		if err := d.checkMembership(&membership); err != nil {
+			return err
+		}
+		d.memberships[id] = membership
+		return nil
+	})
+}
+
+func (m *MemoryMembershipStore) DeleteMembership(ctx context.Context, id uuid.UUID) error {
+	at := deletedAt(deletionTime())
+	return m.db.do(ctx, func(d *memData) error {
+		membership, ok := d.memberships[id]
+		if !ok || membership.DeletedAt.Valid {
+			return ErrMembershipNotFound
+		}
+		membership.DeletedAt = at
+		d.memberships[id] = membership
+		return nil
+	})
+}
+
+func (m *MemoryMembershipStore) RestoreMembership(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	return m.db.do(ctx, func(d *memData) error {
+		membership, ok := d.memberships[id]
+		if !ok || !membership.DeletedAt.Valid {
+			return ErrMembershipNotFound
+		}
+		if err := checkRestorable(membership.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+		if org, ok := d.organizations[membership.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return ErrOrgDeleted
+		}
+		if user, ok := d.users[membership.UserID]; !ok || user.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+
+		membership.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkMembership(&membership); err != nil {
+			return err
+		}
+		d.memberships[id] = membership
+		return nil
+	})
+}
+
+func (m *MemoryMembershipStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := m.db.do(ctx, func(d *memData) error {
+		for id, membership := range d.memberships {
+			if membership.DeletedAt.Valid && membership.DeletedAt.Time.Before(deletedBefore) {
+				delete(d.memberships, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// liveMembership finds the user's undeleted membership in the organization.
+func (d *memData) liveMembership(userID, orgID uuid.UUID) (models.Membership, bool) {
+	for _, membership := range d.memberships {
+		if membership.UserID == userID && membership.OrganizationID == orgID && !membership.DeletedAt.Valid {
+			return membership, true
+		}
+	}
+	return models.Membership{}, false
+}
+
+// hasLiveMembership reports whether the user still belongs to any
+// organization.
+func (d *memData) hasLiveMembership(userID uuid.UUID) bool {
+	for _, membership := range d.memberships {
+		if membership.UserID == userID && !membership.DeletedAt.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *memData) checkMembership(membership *models.Membership) error {
+	if !membership.DeletedAt.Valid {
+		if existing, ok := d.liveMembership(membership.UserID, membership.OrganizationID); ok && existing.ID != membership.ID {
+			return memConstraint(ErrUniqueViolation, "memberships", "idx_memberships_user_org", ErrDuplicateMembership,
+				"user_id", "organization_id")
+		}
+	}
+	if _, ok := d.users[membership.UserID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "memberships", "memberships_user_id_fkey", nil, "user_id")
+	}
+	if _, ok := d.organizations[membership.OrganizationID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "memberships", "memberships_organization_id_fkey", nil, "organization_id")
+	}
+	return memCheckIn("memberships", "status", membership.Status, "active", "suspended")
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryOAuthStore struct {
+	db *memDB
+}
+
+func cloneOAuthClient(client models.OAuthClient) models.OAuthClient {
+	client.RedirectURIs = slices.Clone(client.RedirectURIs)
+	client.GrantTypes = slices.Clone(client.GrantTypes)
+	return client
+}
+
+func (o *MemoryOAuthStore) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if client.ID == uuid.Nil {
+			client.ID = uuid.New()
+		}
+		if _, ok := d.oauthClients[client.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "oauth_clients", "oauth_clients_pkey", nil, "id")
+		}
+		stampCreate(&client.CreatedAt, &client.UpdatedAt)
+		d.oauthClients[client.ID] = cloneOAuthClient(*client)
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) GetClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.oauthClients[id]
+		if !ok {
+			return ErrOAuthClientNotFound
+		}
+		client = cloneOAuthClient(found)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (o *MemoryOAuthStore) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, client := range d.oauthClients {
+			clients = append(clients, cloneOAuthClient(client))
+		}
+		return nil
+	})
+	slices.SortFunc(clients, func(a, b models.OAuthClient) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return clients, err
+}
+
+func (o *MemoryOAuthStore) UpdateClient(ctx context.Context, client *models.OAuthClient) error {
+	return o.db.do(ctx, func(d *memData) error {
+		existing, ok := d.oauthClients[client.ID]
+		if !ok {
+			return ErrOAuthClientNotFound
+		}
+		client.CreatedBy, client.CreatedAt = existing.CreatedBy, existing.CreatedAt
+		client.UpdatedAt = time.Now()
+		d.oauthClients[client.ID] = cloneOAuthClient(*client)
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) DeleteClient(ctx context.Context, id uuid.UUID) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if _, ok := d.oauthClients[id]; !ok {
+			return ErrOAuthClientNotFound
+		}
+		delete(d.oauthClients, id)
+		for codeID, code := range d.oauthCodes {
+			if code.ClientID == id {
+				delete(d.oauthCodes, codeID)
+			}
+		}
+		for tokenID, token := range d.oauthTokens {
+			if token.ClientID == id {
+				delete(d.oauthTokens, tokenID)
+			}
+		}
+		return nil
+	})
+}
+
+// checkOAuthRefs enforces the foreign keys of codes and tokens.
+func checkOAuthRefs(d *memData, table string, clientID uuid.UUID, orgID *uuid.UUID) error {
+	if _, ok := d.oauthClients[clientID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, table, table+"_client_id_fkey", nil, "client_id")
+	}
+	if orgID != nil {
+		if _, ok := d.organizations[*orgID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, table, table+"_organization_id_fkey", nil, "organization_id")
+		}
+	}
+	return nil
+}
+
+func (o *MemoryOAuthStore) CreateCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if code.ID == uuid.Nil {
+			code.ID = uuid.New()
+		}
+		if _, ok := d.oauthCodes[code.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "oauth_authorization_codes", "oauth_authorization_codes_pkey", nil, "id")
+		}
+		for _, existing := range d.oauthCodes {
+			if existing.CodeHash == code.CodeHash {
+				return memConstraint(ErrUniqueViolation, "oauth_authorization_codes", "idx_oauth_codes_hash", nil, "code_hash")
+			}
+		}
+		if err := checkOAuthRefs(d, "oauth_authorization_codes", code.ClientID, code.OrganizationID); err != nil {
+			return err
+		}
+		stampCreate(&code.CreatedAt, nil)
+		d.oauthCodes[code.ID] = *code
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	err := o.db.do(ctx, func(d *memData) error {
+		for id, candidate := range d.oauthCodes {
+			if candidate.CodeHash == codeHash {
+				delete(d.oauthCodes, id)
+				code = candidate
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !code.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &code, nil
+}
+
+func (o *MemoryOAuthStore) CreateToken(ctx context.Context, token *models.OAuthToken) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if token.ID == uuid.Nil {
+			token.ID = uuid.New()
+		}
+		if _, ok := d.oauthTokens[token.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "oauth_tokens", "oauth_tokens_pkey", nil, "id")
+		}
+		for _, existing := range d.oauthTokens {
+			if existing.TokenHash == token.TokenHash {
+				return memConstraint(ErrUniqueViolation, "oauth_tokens", "idx_oauth_tokens_hash", nil, "token_hash")
+			}
+		}
+		if err := memCheckIn("oauth_tokens", "kind", token.Kind, models.OAuthTokenAccess, models.OAuthTokenRefresh); err != nil {
+			return err
+		}
+		if err := checkOAuthRefs(d, "oauth_tokens", token.ClientID, token.OrganizationID); err != nil {
+			return err
+		}
+		stampCreate(&token.CreatedAt, nil)
+		d.oauthTokens[token.ID] = *token
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) GetTokenByHash(ctx context.Context, tokenHash string) (*models.OAuthToken, error) {
+	var token models.OAuthToken
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, candidate := range d.oauthTokens {
+			if candidate.TokenHash == tokenHash {
+				token = candidate
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (o *MemoryOAuthStore) RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return o.db.do(ctx, func(d *memData) error {
+		token, ok := d.oauthTokens[id]
+		if !ok || token.RevokedAt != nil {
+			return ErrInvalidToken
+		}
+		token.RevokedAt = &at
+		d.oauthTokens[id] = token
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	return o.db.do(ctx, func(d *memData) error {
+		for id, token := range d.oauthTokens {
+			if token.FamilyID == familyID && token.RevokedAt == nil {
+				token.RevokedAt = &at
+				d.oauthTokens[id] = token
+			}
+		}
+		return nil
+	})
+}
+
+func (o *MemoryOAuthStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := o.db.do(ctx, func(d *memData) error {
+		for id, code := range d.oauthCodes {
+			if !code.ExpiresAt.After(before) {
+				delete(d.oauthCodes, id)
+				n++
+			}
+		}
+		for id, token := range d.oauthTokens {
+			if !token.ExpiresAt.After(before) {
+				delete(d.oauthTokens, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
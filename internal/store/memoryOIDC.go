@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryOIDCStore struct {
+	db *memDB
+}
+
+func (o *MemoryOIDCStore) SaveProvider(ctx context.Context, provider *models.OIDCProvider) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if org, ok := d.organizations[provider.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "oidc_providers", "oidc_providers_organization_id_fkey", nil,
+				"organization_id")
+		}
+
+		if existing, ok := d.oidcProviders[provider.OrganizationID]; ok {
+			provider.CreatedAt = existing.CreatedAt
+			provider.UpdatedAt = time.Now()
+		}
+		stampCreate(&provider.CreatedAt, &provider.UpdatedAt)
+		saved := *provider
+		saved.RoleMappings = slices.Clone(provider.RoleMappings)
+		d.oidcProviders[provider.OrganizationID] = saved
+		return nil
+	})
+}
+
+func (o *MemoryOIDCStore) GetProvider(ctx context.Context, orgID uuid.UUID) (*models.OIDCProvider, error) {
+	var provider models.OIDCProvider
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.oidcProviders[orgID]
+		if !ok {
+			return ErrOIDCProviderNotFound
+		}
+		provider = found
+		provider.RoleMappings = slices.Clone(found.RoleMappings)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (o *MemoryOIDCStore) DeleteProvider(ctx context.Context, orgID uuid.UUID) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if _, ok := d.oidcProviders[orgID]; !ok {
+			return ErrOIDCProviderNotFound
+		}
+		delete(d.oidcProviders, orgID)
+		return nil
+	})
+}
+
+func (o *MemoryOIDCStore) CreateLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if state.ID == uuid.Nil {
+			state.ID = uuid.New()
+		}
+		if _, ok := d.oidcLoginStates[state.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "oidc_login_states", "oidc_login_states_pkey", nil, "id")
+		}
+		for _, existing := range d.oidcLoginStates {
+			if existing.StateHash == state.StateHash {
+				return memConstraint(ErrUniqueViolation, "oidc_login_states", "idx_oidc_login_states_hash", nil, "state_hash")
+			}
+		}
+		if org, ok := d.organizations[state.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "oidc_login_states", "oidc_login_states_organization_id_fkey", nil,
+				"organization_id")
+		}
+		stampCreate(&state.CreatedAt, nil)
+		d.oidcLoginStates[state.ID] = *state
+		return nil
+	})
+}
+
+func (o *MemoryOIDCStore) ConsumeLoginState(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := o.db.do(ctx, func(d *memData) error {
+		for id, candidate := range d.oidcLoginStates {
+			if candidate.StateHash == stateHash {
+				delete(d.oidcLoginStates, id)
+				state = candidate
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !state.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &state, nil
+}
+
+func (o *MemoryOIDCStore) DeleteExpiredLoginStates(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := o.db.do(ctx, func(d *memData) error {
+		for id, state := range d.oidcLoginStates {
+			if !state.ExpiresAt.After(before) {
+				delete(d.oidcLoginStates, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
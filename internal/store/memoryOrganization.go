@@ -0,0 +1,397 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type MemoryOrganizationStore struct {
+	db *memDB
+}
+
+func (o *MemoryOrganizationStore) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if org.ID == uuid.Nil {
+			org.ID = uuid.New()
+		}
+		if org.Status == "" {
+			org.Status = "active"
+		}
+		if err := d.checkOrganization(org); err != nil {
+			return err
+		}
+		stampCreate(&org.CreatedAt, &org.UpdatedAt)
+		d.organizations[org.ID] = *org
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.organizations[id]
+		if !ok || found.DeletedAt.Valid {
+			return ErrOrgNotFound
+		}
+		org = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (o *MemoryOrganizationStore) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
+	at := deletedAt(deletionTime())
+	return o.db.do(ctx, func(d *memData) error {
+		org, ok := d.organizations[id]
+		if !ok || org.DeletedAt.Valid {
+			return ErrOrgNotFound
+		}
+		for _, child := range d.organizations {
+			if child.ParentID != nil && *child.ParentID == id && !child.DeletedAt.Valid {
+				return ErrOrgHasChildren
+			}
+		}
+		org.DeletedAt = at
+		d.organizations[id] = org
+
+		for membershipID, membership := range d.memberships {
+			if membership.OrganizationID != id || membership.DeletedAt.Valid {
+				continue
+			}
+			membership.DeletedAt = at
+			d.memberships[membershipID] = membership
+
+			userID := membership.UserID
+			if d.hasLiveMembership(userID) {
+				continue
+			}
+			user := d.users[userID]
+			user.DeletedAt = at
+			d.users[userID] = user
+			for inviteID, invite := range d.userInvites {
+				if invite.UserId == userID && !invite.DeletedAt.Valid {
+					invite.DeletedAt = at
+					d.userInvites[inviteID] = invite
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) GetDeletedOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.organizations[id]
+		if !ok || !found.DeletedAt.Valid {
+			return ErrOrgNotFound
+		}
+		org = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (o *MemoryOrganizationStore) RestoreOrganization(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	return o.db.do(ctx, func(d *memData) error {
+		org, ok := d.organizations[id]
+		if !ok || !org.DeletedAt.Valid {
+			return ErrOrgNotFound
+		}
+		if err := checkRestorable(org.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+		if admin, ok := d.admins[org.AdminID]; !ok || admin.DeletedAt.Valid {
+			return ErrOrgOwnerDeleted
+		}
+
+		at := org.DeletedAt
+		org.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkOrganization(&org); err != nil {
+			return err
+		}
+		d.organizations[id] = org
+
+		for membershipID, membership := range d.memberships {
+			if membership.OrganizationID != id || membership.DeletedAt != at {
+				continue
+			}
+
+			userID := membership.UserID
+			if user := d.users[userID]; user.DeletedAt == at {
+				user.DeletedAt = gorm.DeletedAt{}
+				if err := d.checkUser(&user); err != nil {
+					return err
+				}
+				d.users[userID] = user
+				for inviteID, invite := range d.userInvites {
+					if invite.UserId == userID && invite.DeletedAt == at {
+						invite.DeletedAt = gorm.DeletedAt{}
+						d.userInvites[inviteID] = invite
+					}
+				}
+			}
+
+			membership.DeletedAt = gorm.DeletedAt{}
+			if err := d.checkMembership(&membership); err != nil {
+				return err
+			}
+			d.memberships[membershipID] = membership
+		}
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) ReassignOrganizations(ctx context.Context, fromAdminID, toAdminID uuid.UUID) (int64, error) {
+	var moved int64
+	err := o.db.do(ctx, func(d *memData) error {
+		target, ok := d.admins[toAdminID]
+		if !ok || target.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		if target.Status != "active" {
+			return ErrAdminNotActive
+		}
+		for id, org := range d.organizations {
+			if org.AdminID == fromAdminID {
+				org.AdminID = toAdminID
+				org.UpdatedAt = time.Now()
+				d.organizations[id] = org
+				moved++
+			}
+		}
+		return nil
+	})
+	return moved, err
+}
+
+func (o *MemoryOrganizationStore) UpdateOrganization(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return o.db.do(ctx, func(d *memData) error {
+		org, ok := d.organizations[id]
+		if !ok || org.DeletedAt.Valid {
+			return nil
+		}
+		if err := applyUpdates(&org, updates); err != nil {
+			return err
+		}
+		if err := d.checkOrganization(&org); err != nil {
+			return err
+		}
+		d.organizations[id] = org
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) RecordSuspension(ctx context.Context, event *models.OrganizationSuspension) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if event.ID == uuid.Nil {
+			event.ID = uuid.New()
+		}
+		if _, ok := d.organizations[event.OrganizationID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "organization_suspensions",
+				"organization_suspensions_organization_id_fkey", nil, "organization_id")
+		}
+		if err := memCheckIn("organization_suspensions", "action", event.Action,
+			models.SuspensionActionSuspend, models.SuspensionActionUnsuspend); err != nil {
+			return err
+		}
+		stampCreate(&event.CreatedAt, nil)
+		d.orgSuspensions[event.ID] = *event
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) ListSuspensions(ctx context.Context, orgID uuid.UUID) ([]models.OrganizationSuspension, error) {
+	events := []models.OrganizationSuspension{}
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, event := range d.orgSuspensions {
+			if event.OrganizationID == orgID {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(events[j].CreatedAt)
+	})
+	return events, err
+}
+
+func (o *MemoryOrganizationStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := o.db.do(ctx, func(d *memData) error {
+		for id, org := range d.organizations {
+			if org.DeletedAt.Valid && org.DeletedAt.Time.Before(deletedBefore) {
+				delete(d.organizations, id)
+				purged++
+				for membershipID, membership := range d.memberships {
+					if membership.OrganizationID == id {
+						delete(d.memberships, membershipID)
+					}
+				}
+				d.deleteGroups(func(group models.Group) bool { return group.OrganizationID == id })
+				for childID, child := range d.organizations {
+					if child.ParentID != nil && *child.ParentID == id {
+						child.ParentID = nil
+						d.organizations[childID] = child
+					}
+				}
+				for eventID, event := range d.orgSuspensions {
+					if event.OrganizationID == id {
+						delete(d.orgSuspensions, eventID)
+					}
+				}
+				for transferID, transfer := range d.orgTransfers {
+					if transfer.OrganizationID == id {
+						delete(d.orgTransfers, transferID)
+					}
+				}
+				for grantID, grant := range d.roleGrants {
+					if grant.OrganizationID != nil && *grant.OrganizationID == id {
+						delete(d.roleGrants, grantID)
+					}
+				}
+				d.purgeOrgAccess(id)
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (d *memData) checkOrganization(org *models.Organization) error {
+	for _, existing := range d.organizations {
+		if !org.DeletedAt.Valid && !existing.DeletedAt.Valid && existing.ID != org.ID && existing.Email == org.Email {
+			return memConstraint(ErrUniqueViolation, "organizations", "idx_organizations_email", ErrDuplicateOrgEmail, "email")
+		}
+	}
+	if _, ok := d.admins[org.AdminID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "organizations", "fk_admins_organizations", nil, "admin_id")
+	}
+	return memCheckIn("organizations", "status", org.Status, "active", "suspended")
+}
+
+func (o *MemoryOrganizationStore) ListOrganizations(ctx context.Context, p ListParams) ([]models.Organization, PageInfo, error) {
+	var rows []models.Organization
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, org := range d.organizations {
+			if org.DeletedAt.Valid {
+				continue
+			}
+			if p.AdminID != uuid.Nil && org.AdminID != p.AdminID {
+				continue
+			}
+			if p.Status != "" && org.Status != p.Status {
+				continue
+			}
+			rows = append(rows, org)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return memPage(rows, p, organizationListSpec,
+		func(org models.Organization) uuid.UUID { return org.ID },
+		func(org models.Organization) string { return org.Name + " " + org.Email },
+	)
+}
+
+func (o *MemoryOrganizationStore) ListAncestors(ctx context.Context, id uuid.UUID) ([]models.Organization, error) {
+	var ancestors []models.Organization
+	err := o.db.do(ctx, func(d *memData) error {
+		ancestors = d.orgAncestors(id)
+		return nil
+	})
+	return ancestors, err
+}
+
+func (o *MemoryOrganizationStore) ListSubtree(ctx context.Context, id uuid.UUID) ([]OrganizationNode, error) {
+	var nodes []OrganizationNode
+	err := o.db.do(ctx, func(d *memData) error {
+		var err error
+		nodes, err = d.orgSubtree(id)
+		return err
+	})
+	return nodes, err
+}
+
+func (o *MemoryOrganizationStore) MoveOrganization(ctx context.Context, id uuid.UUID, parentID *uuid.UUID, maxDepth int) error {
+	return o.db.do(ctx, func(d *memData) error {
+		subtree, err := d.orgSubtree(id)
+		if err != nil {
+			return err
+		}
+		if parentID != nil {
+			if parent, ok := d.organizations[*parentID]; !ok || parent.DeletedAt.Valid {
+				return ErrOrgNotFound
+			}
+			if err := checkOrgMove(subtree, *parentID, len(d.orgAncestors(*parentID))+1, maxDepth); err != nil {
+				return err
+			}
+		}
+
+		org := d.organizations[id]
+		org.ParentID = parentID
+		org.UpdatedAt = time.Now()
+		d.organizations[id] = org
+		return nil
+	})
+}
+
+// orgAncestors walks up from id, nearest first, stopping at a deleted
+// ancestor.
+func (d *memData) orgAncestors(id uuid.UUID) []models.Organization {
+	ancestors := []models.Organization{}
+	for parentID := d.organizations[id].ParentID; parentID != nil && len(ancestors) < orgTreeGuard; {
+		parent, ok := d.organizations[*parentID]
+		if !ok || parent.DeletedAt.Valid {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		parentID = parent.ParentID
+	}
+	return ancestors
+}
+
+func (d *memData) orgSubtree(id uuid.UUID) ([]OrganizationNode, error) {
+	root, ok := d.organizations[id]
+	if !ok || root.DeletedAt.Valid {
+		return nil, ErrOrgNotFound
+	}
+
+	nodes := []OrganizationNode{{Organization: root}}
+	for i := 0; i < len(nodes) && nodes[i].Depth < orgTreeGuard; i++ {
+		var children []OrganizationNode
+		for _, org := range d.organizations {
+			if org.ParentID != nil && *org.ParentID == nodes[i].ID && !org.DeletedAt.Valid {
+				children = append(children, OrganizationNode{Organization: org, Depth: nodes[i].Depth + 1})
+			}
+		}
+		nodes = append(nodes, children...)
+	}
+	slices.SortStableFunc(nodes, func(a, b OrganizationNode) int {
+		if a.Depth != b.Depth {
+			return a.Depth - b.Depth
+		}
+		return compareKeys(a.Name, a.ID, b.Name, b.ID)
+	})
+	return nodes, nil
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+func (o *MemoryOrganizationStore) CreateTransfer(ctx context.Context, transfer *models.OrganizationTransfer) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if transfer.ID == uuid.Nil {
+			transfer.ID = uuid.New()
+		}
+		if transfer.Status == "" {
+			transfer.Status = models.TransferStatusPending
+		}
+		if err := d.checkTransfer(transfer); err != nil {
+			return err
+		}
+		stampCreate(&transfer.CreatedAt, &transfer.UpdatedAt)
+		d.orgTransfers[transfer.ID] = *transfer
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) GetTransfer(ctx context.Context, id uuid.UUID) (*models.OrganizationTransfer, error) {
+	var transfer models.OrganizationTransfer
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.orgTransfers[id]
+		if !ok {
+			return ErrTransferNotFound
+		}
+		transfer = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (o *MemoryOrganizationStore) GetTransferByToken(ctx context.Context, tokenHash string) (*models.OrganizationTransfer, error) {
+	var transfer models.OrganizationTransfer
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, candidate := range d.orgTransfers {
+			if candidate.TokenHash == tokenHash {
+				transfer = candidate
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (o *MemoryOrganizationStore) ListTransfers(ctx context.Context, f TransferFilter) ([]models.OrganizationTransfer, error) {
+	transfers := []models.OrganizationTransfer{}
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, transfer := range d.orgTransfers {
+			if f.OrganizationID != uuid.Nil && transfer.OrganizationID != f.OrganizationID {
+				continue
+			}
+			if f.AdminID != uuid.Nil && transfer.FromAdminID != f.AdminID && transfer.ToAdminID != f.AdminID {
+				continue
+			}
+			if f.Status != "" && transfer.Status != f.Status {
+				continue
+			}
+			transfers = append(transfers, transfer)
+		}
+		return nil
+	})
+	slices.SortFunc(transfers, func(a, b models.OrganizationTransfer) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return transfers, err
+}
+
+func (o *MemoryOrganizationStore) ResolveTransfer(
+	ctx context.Context,
+	id uuid.UUID,
+	status string,
+	by uuid.UUID,
+	at time.Time,
+) error {
+	return o.db.do(ctx, func(d *memData) error {
+		transfer, ok := d.orgTransfers[id]
+		if !ok || transfer.Status != models.TransferStatusPending {
+			return ErrTransferNotPending
+		}
+		if err := applyUpdates(&transfer, resolveTransferUpdates(status, by, at)); err != nil {
+			return err
+		}
+		if err := d.checkTransfer(&transfer); err != nil {
+			return err
+		}
+		d.orgTransfers[id] = transfer
+		return nil
+	})
+}
+
+func (o *MemoryOrganizationStore) RotateTransferToken(ctx context.Context, id uuid.UUID, tokenHash string) error {
+	return o.db.do(ctx, func(d *memData) error {
+		transfer, ok := d.orgTransfers[id]
+		if !ok || transfer.Status != models.TransferStatusPending {
+			return ErrTransferNotPending
+		}
+		transfer.TokenHash = tokenHash
+		d.orgTransfers[id] = transfer
+		return nil
+	})
+}
+
+func (d *memData) checkTransfer(transfer *models.OrganizationTransfer) error {
+	if transfer.Status == models.TransferStatusPending {
+		for _, existing := range d.orgTransfers {
+			if existing.ID != transfer.ID && existing.OrganizationID == transfer.OrganizationID &&
+				existing.Status == models.TransferStatusPending {
+				return memConstraint(ErrUniqueViolation, "organization_transfers", "idx_organization_transfers_pending",
+					ErrTransferPending, "organization_id")
+			}
+		}
+	}
+	if _, ok := d.organizations[transfer.OrganizationID]; !ok {
+		return memConstraint(ErrForeignKeyViolation, "organization_transfers",
+			"organization_transfers_organization_id_fkey", nil, "organization_id")
+	}
+	return memCheckIn("organization_transfers", "status", transfer.Status,
+		models.TransferStatusPending, models.TransferStatusAccepted,
+		models.TransferStatusCancelled, models.TransferStatusExpired)
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryOutboxStore struct {
+	db *memDB
+}
+
+func (o *MemoryOutboxStore) Enqueue(ctx context.Context, msg *models.OutboxMessage) error {
+	return o.db.do(ctx, func(d *memData) error {
+		if msg.ID == uuid.Nil {
+			msg.ID = uuid.New()
+		}
+		if msg.Status == "" {
+			msg.Status = models.OutboxStatusPending
+		}
+		if _, ok := d.outbox[msg.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "outbox_messages", "outbox_messages_pkey", nil, "id")
+		}
+		if err := memCheckIn("outbox_messages", "status", msg.Status,
+			models.OutboxStatusPending, models.OutboxStatusDelivered, models.OutboxStatusDead); err != nil {
+			return err
+		}
+		stampCreate(&msg.CreatedAt, &msg.UpdatedAt)
+		d.outbox[msg.ID] = *msg
+		return nil
+	})
+}
+
+func (o *MemoryOutboxStore) ClaimDue(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+	lease time.Duration,
+) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, msg := range d.outbox {
+			if msg.Status != models.OutboxStatusPending || msg.NextAttemptAt.After(now) {
+				continue
+			}
+			if msg.LockedUntil != nil && !msg.LockedUntil.Before(now) {
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		sort.Slice(msgs, func(i, j int) bool {
+			return msgs[i].NextAttemptAt.Before(msgs[j].NextAttemptAt)
+		})
+		if len(msgs) > limit {
+			msgs = msgs[:limit]
+		}
+
+		lockedUntil := now.Add(lease)
+		for _, msg := range msgs {
+			msg.LockedUntil = &lockedUntil
+			d.outbox[msg.ID] = msg
+		}
+		return nil
+	})
+	return msgs, err
+}
+
+func (o *MemoryOutboxStore) MarkDelivered(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return o.db.do(ctx, func(d *memData) error {
+		msg, ok := d.outbox[id]
+		if !ok {
+			return nil
+		}
+		msg.Status = models.OutboxStatusDelivered
+		msg.Attempts++
+		msg.DeliveredAt = &at
+		msg.LockedUntil = nil
+		msg.LastError = ""
+		msg.UpdatedAt = time.Now()
+		d.outbox[id] = msg
+		return nil
+	})
+}
+
+func (o *MemoryOutboxStore) MarkFailed(
+	ctx context.Context,
+	id uuid.UUID,
+	lastErr string,
+	nextAttemptAt time.Time,
+	dead bool,
+) error {
+	return o.db.do(ctx, func(d *memData) error {
+		msg, ok := d.outbox[id]
+		if !ok {
+			return nil
+		}
+		msg.Status = models.OutboxStatusPending
+		if dead {
+			msg.Status = models.OutboxStatusDead
+		}
+		msg.Attempts++
+		msg.NextAttemptAt = nextAttemptAt
+		msg.LockedUntil = nil
+		msg.LastError = lastErr
+		msg.UpdatedAt = time.Now()
+		d.outbox[id] = msg
+		return nil
+	})
+}
+
+func (o *MemoryOutboxStore) GetMessage(ctx context.Context, id uuid.UUID) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := o.db.do(ctx, func(d *memData) error {
+		found, ok := d.outbox[id]
+		if !ok {
+			return ErrOutboxMessageNotFound
+		}
+		msg = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (o *MemoryOutboxStore) ListMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := o.db.do(ctx, func(d *memData) error {
+		for _, msg := range d.outbox {
+			if status == "" || msg.Status == status {
+				msgs = append(msgs, msg)
+			}
+		}
+		return nil
+	})
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs, err
+}
+
+func (o *MemoryOutboxStore) Replay(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return o.db.do(ctx, func(d *memData) error {
+		msg, ok := d.outbox[id]
+		if !ok {
+			return ErrOutboxMessageNotFound
+		}
+		if msg.Status != models.OutboxStatusDead {
+			return ErrOutboxMessageNotDead
+		}
+		msg.Status = models.OutboxStatusPending
+		msg.Attempts = 0
+		msg.NextAttemptAt = at
+		msg.LockedUntil = nil
+		msg.UpdatedAt = time.Now()
+		d.outbox[id] = msg
+		return nil
+	})
+}
@@ -0,0 +1,261 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryReviewStore struct {
+	db *memDB
+}
+
+type accessReviewerKey struct {
+	ReviewID uuid.UUID
+	AdminID  uuid.UUID
+}
+
+func (s *MemoryReviewStore) CollectEntitlements(ctx context.Context, scope ReviewScope, at time.Time) ([]models.AccessReviewItem, error) {
+	items := []models.AccessReviewItem{}
+	err := s.db.do(ctx, func(d *memData) error {
+		if scope.OrganizationID == uuid.Nil {
+			for _, admin := range d.admins {
+				if !admin.DeletedAt.Valid && slices.Contains(scope.Roles, admin.Role) {
+					items = append(items, adminReviewItem(admin))
+				}
+			}
+		}
+		for _, membership := range d.memberships {
+			if membership.DeletedAt.Valid {
+				continue
+			}
+			if scope.OrganizationID != uuid.Nil && membership.OrganizationID == scope.OrganizationID ||
+				scope.OrganizationID == uuid.Nil && slices.Contains(scope.Roles, membership.Role) {
+				items = append(items, membershipReviewItem(membership))
+			}
+		}
+		for _, grant := range d.roleGrants {
+			if grant.RevokedAt != nil || !grant.ValidUntil.After(at) {
+				continue
+			}
+			inOrg := grant.OrganizationID != nil && *grant.OrganizationID == scope.OrganizationID
+			if scope.OrganizationID != uuid.Nil && inOrg ||
+				scope.OrganizationID == uuid.Nil && (grant.Role != "" && slices.Contains(scope.Roles, grant.Role) ||
+					grant.Permission != "" && grant.Permission == scope.Permission) {
+				items = append(items, grantReviewItem(grant))
+			}
+		}
+
+		for i := range items {
+			if items[i].AccountType == models.GrantAccountAdmin {
+				items[i].AccountEmail = d.admins[items[i].AccountID].Email
+			} else {
+				items[i].AccountEmail = d.users[items[i].AccountID].Email
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(items, compareReviewItems)
+	return items, err
+}
+
+func (s *MemoryReviewStore) CreateReview(
+	ctx context.Context,
+	review *models.AccessReview,
+	reviewers []models.AccessReviewer,
+	items []models.AccessReviewItem,
+) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if review.ID == uuid.Nil {
+			review.ID = uuid.New()
+		}
+		if review.Status == "" {
+			review.Status = models.ReviewStatusOpen
+		}
+		if err := memCheckIn("access_reviews", "scope_type", review.ScopeType,
+			models.ReviewScopeOrganization, models.ReviewScopeRole, models.ReviewScopePermission); err != nil {
+			return err
+		}
+		stampCreate(&review.CreatedAt, &review.UpdatedAt)
+		d.accessReviews[review.ID] = *review
+
+		for i := range reviewers {
+			reviewers[i].ReviewID = review.ID
+			key := accessReviewerKey{review.ID, reviewers[i].AdminID}
+			if _, ok := d.accessReviewers[key]; ok {
+				return memConstraint(ErrUniqueViolation, "access_reviewers", "access_reviewers_pkey", nil,
+					"review_id", "admin_id")
+			}
+			stampCreate(&reviewers[i].CreatedAt, nil)
+			d.accessReviewers[key] = reviewers[i]
+		}
+		for i := range items {
+			items[i].ReviewID = review.ID
+			if items[i].ID == uuid.Nil {
+				items[i].ID = uuid.New()
+			}
+			if items[i].Decision == "" {
+				items[i].Decision = models.ReviewDecisionPending
+			}
+			stampCreate(&items[i].CreatedAt, &items[i].UpdatedAt)
+			d.accessReviewItems[items[i].ID] = items[i]
+		}
+		return nil
+	})
+}
+
+func (s *MemoryReviewStore) GetReview(ctx context.Context, id uuid.UUID) (*models.AccessReview, error) {
+	var review models.AccessReview
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.accessReviews[id]
+		if !ok {
+			return ErrReviewNotFound
+		}
+		review = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (s *MemoryReviewStore) ListReviews(ctx context.Context, f ReviewFilter) ([]models.AccessReview, error) {
+	reviews := []models.AccessReview{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for id, review := range d.accessReviews {
+			if f.Status != "" && review.Status != f.Status {
+				continue
+			}
+			if _, ok := d.accessReviewers[accessReviewerKey{id, f.ReviewerID}]; f.ReviewerID != uuid.Nil && !ok {
+				continue
+			}
+			reviews = append(reviews, review)
+		}
+		return nil
+	})
+	slices.SortFunc(reviews, func(x, y models.AccessReview) int {
+		return y.CreatedAt.Compare(x.CreatedAt)
+	})
+	return reviews, err
+}
+
+func (s *MemoryReviewStore) ListReviewers(ctx context.Context, reviewID uuid.UUID) ([]models.AccessReviewer, error) {
+	reviewers := []models.AccessReviewer{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for key, reviewer := range d.accessReviewers {
+			if key.ReviewID == reviewID {
+				reviewers = append(reviewers, reviewer)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(reviewers, func(x, y models.AccessReviewer) int {
+		return compareKeys(x.CreatedAt, x.AdminID, y.CreatedAt, y.AdminID)
+	})
+	return reviewers, err
+}
+
+func (s *MemoryReviewStore) GetItem(ctx context.Context, id uuid.UUID) (*models.AccessReviewItem, error) {
+	var item models.AccessReviewItem
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.accessReviewItems[id]
+		if !ok {
+			return ErrReviewItemNotFound
+		}
+		item = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *MemoryReviewStore) ListItems(ctx context.Context, reviewID uuid.UUID, decision string) ([]models.AccessReviewItem, error) {
+	items := []models.AccessReviewItem{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, item := range d.accessReviewItems {
+			if item.ReviewID == reviewID && (decision == "" || item.Decision == decision) {
+				items = append(items, item)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(items, compareReviewItems)
+	return items, err
+}
+
+func (s *MemoryReviewStore) DecideItem(
+	ctx context.Context,
+	id uuid.UUID,
+	decision, comment string,
+	by uuid.UUID,
+	at time.Time,
+) error {
+	return s.db.do(ctx, func(d *memData) error {
+		item, ok := d.accessReviewItems[id]
+		if !ok {
+			return ErrReviewItemNotFound
+		}
+		if d.accessReviews[item.ReviewID].Status != models.ReviewStatusOpen {
+			return ErrReviewClosed
+		}
+		if err := memCheckIn("access_review_items", "decision", decision,
+			models.ReviewDecisionPending, models.ReviewDecisionCertified, models.ReviewDecisionRevoked); err != nil {
+			return err
+		}
+		item.Decision = decision
+		item.Comment = comment
+		item.ReviewedBy = &by
+		item.ReviewedAt = &at
+		item.UpdatedAt = time.Now()
+		d.accessReviewItems[id] = item
+		return nil
+	})
+}
+
+func (s *MemoryReviewStore) MarkItemApplied(ctx context.Context, id uuid.UUID, note string, at time.Time) error {
+	return s.db.do(ctx, func(d *memData) error {
+		item, ok := d.accessReviewItems[id]
+		if !ok {
+			return nil
+		}
+		item.AppliedAt = &at
+		item.ApplyNote = note
+		item.UpdatedAt = time.Now()
+		d.accessReviewItems[id] = item
+		return nil
+	})
+}
+
+func (s *MemoryReviewStore) CloseReview(ctx context.Context, id, by uuid.UUID, at time.Time) error {
+	return s.db.do(ctx, func(d *memData) error {
+		review, ok := d.accessReviews[id]
+		if !ok {
+			return ErrReviewNotFound
+		}
+		if review.Status != models.ReviewStatusOpen {
+			return ErrReviewClosed
+		}
+		review.Status = models.ReviewStatusClosed
+		review.ClosedBy = &by
+		review.ClosedAt = &at
+		review.UpdatedAt = time.Now()
+		d.accessReviews[id] = review
+		return nil
+	})
+}
+
+// compareReviewItems orders items like the SQL stores: by account, then by
+// where the access comes from.
+func compareReviewItems(x, y models.AccessReviewItem) int {
+	if c := bytes.Compare(x.AccountID[:], y.AccountID[:]); c != 0 {
+		return c
+	}
+	return compareKeys(x.Source, x.SourceID, y.Source, y.SourceID)
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryRoleGrantStore struct {
+	db *memDB
+}
+
+func (g *MemoryRoleGrantStore) CreateGrant(ctx context.Context, grant *models.RoleGrant) error {
+	return g.db.do(ctx, func(d *memData) error {
+		if grant.ID == uuid.Nil {
+			grant.ID = uuid.New()
+		}
+		if grant.Kind == "" {
+			grant.Kind = models.GrantKindAssigned
+		}
+		if err := d.checkGrant(grant); err != nil {
+			return err
+		}
+		stampCreate(&grant.CreatedAt, &grant.UpdatedAt)
+		d.roleGrants[grant.ID] = *grant
+		return nil
+	})
+}
+
+func (g *MemoryRoleGrantStore) GetGrant(ctx context.Context, id uuid.UUID) (*models.RoleGrant, error) {
+	var grant models.RoleGrant
+	err := g.db.do(ctx, func(d *memData) error {
+		found, ok := d.roleGrants[id]
+		if !ok {
+			return ErrGrantNotFound
+		}
+		grant = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (g *MemoryRoleGrantStore) ListGrants(ctx context.Context, f GrantFilter) ([]models.RoleGrant, error) {
+	now := time.Now()
+	grants := []models.RoleGrant{}
+	err := g.db.do(ctx, func(d *memData) error {
+		for _, grant := range d.roleGrants {
+			if f.AccountID != uuid.Nil && grant.AccountID != f.AccountID {
+				continue
+			}
+			if f.OrganizationID != uuid.Nil && (grant.OrganizationID == nil || *grant.OrganizationID != f.OrganizationID) {
+				continue
+			}
+			if f.Kind != "" && grant.Kind != f.Kind {
+				continue
+			}
+			if f.Status != "" && GrantStatus(grant, now) != f.Status {
+				continue
+			}
+			grants = append(grants, grant)
+		}
+		return nil
+	})
+	slices.SortFunc(grants, func(a, b models.RoleGrant) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return grants, err
+}
+
+func (g *MemoryRoleGrantStore) ActiveGrants(ctx context.Context, accountID uuid.UUID, orgID *uuid.UUID, at time.Time) ([]models.RoleGrant, error) {
+	grants := []models.RoleGrant{}
+	err := g.db.do(ctx, func(d *memData) error {
+		for _, grant := range d.roleGrants {
+			if grant.AccountID != accountID || grant.Kind == models.GrantKindEligible {
+				continue
+			}
+			if (orgID == nil) != (grant.OrganizationID == nil) ||
+				(orgID != nil && *grant.OrganizationID != *orgID) {
+				continue
+			}
+			if GrantStatus(grant, at) == models.GrantStatusActive {
+				grants = append(grants, grant)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(grants, func(a, b models.RoleGrant) int {
+		return compareKeys(a.ValidFrom, a.ID, b.ValidFrom, b.ID)
+	})
+	return grants, err
+}
+
+func (g *MemoryRoleGrantStore) RevokeGrant(ctx context.Context, id, by uuid.UUID, at time.Time) error {
+	return g.db.do(ctx, func(d *memData) error {
+		grant, ok := d.roleGrants[id]
+		if !ok {
+			return ErrGrantNotFound
+		}
+		if grant.RevokedAt != nil || !grant.ValidUntil.After(at) {
+			return ErrGrantEnded
+		}
+		if err := applyUpdates(&grant, map[string]interface{}{
+			"revoked_at": at,
+			"revoked_by": by,
+		}); err != nil {
+			return err
+		}
+		d.roleGrants[id] = grant
+		return nil
+	})
+}
+
+func (g *MemoryRoleGrantStore) ExpireGrants(ctx context.Context, at time.Time) (int64, error) {
+	var expired int64
+	err := g.db.do(ctx, func(d *memData) error {
+		for id, grant := range d.roleGrants {
+			if grant.RevokedAt != nil || grant.ExpiredAt != nil || grant.ValidUntil.After(at) {
+				continue
+			}
+			if err := applyUpdates(&grant, map[string]interface{}{"expired_at": at}); err != nil {
+				return err
+			}
+			d.roleGrants[id] = grant
+			expired++
+		}
+		return nil
+	})
+	return expired, err
+}
+
+func (g *MemoryRoleGrantStore) ListExpiringGrants(ctx context.Context, before time.Time) ([]models.RoleGrant, error) {
+	now := time.Now()
+	grants := []models.RoleGrant{}
+	err := g.db.do(ctx, func(d *memData) error {
+		for _, grant := range d.roleGrants {
+			if grant.RevokedAt != nil || grant.ExpiredAt != nil || grant.NotifiedAt != nil {
+				continue
+			}
+			if grant.ValidUntil.After(now) && !grant.ValidUntil.After(before) {
+				grants = append(grants, grant)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(grants, func(a, b models.RoleGrant) int {
+		return compareKeys(a.ValidUntil, a.ID, b.ValidUntil, b.ID)
+	})
+	return grants, err
+}
+
+func (g *MemoryRoleGrantStore) MarkGrantNotified(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	marked := false
+	err := g.db.do(ctx, func(d *memData) error {
+		grant, ok := d.roleGrants[id]
+		if !ok || grant.NotifiedAt != nil {
+			return nil
+		}
+		if err := applyUpdates(&grant, map[string]interface{}{"notified_at": at}); err != nil {
+			return err
+		}
+		d.roleGrants[id] = grant
+		marked = true
+		return nil
+	})
+	return marked, err
+}
+
+func (d *memData) checkGrant(grant *models.RoleGrant) error {
+	if err := memCheckIn("role_grants", "account_type", grant.AccountType,
+		models.GrantAccountAdmin, models.GrantAccountUser); err != nil {
+		return err
+	}
+	if err := memCheckIn("role_grants", "kind", grant.Kind,
+		models.GrantKindAssigned, models.GrantKindEligible, models.GrantKindElevated); err != nil {
+		return err
+	}
+	if !grant.ValidUntil.After(grant.ValidFrom) {
+		return memConstraint(ErrCheckViolation, "role_grants", "chk_role_grants_window", ErrGrantWindow,
+			"valid_from", "valid_until")
+	}
+	if (grant.Role != "") == (grant.Permission != "") {
+		return memConstraint(ErrCheckViolation, "role_grants", "chk_role_grants_target", ErrGrantTarget,
+			"role", "permission")
+	}
+	if (grant.AccountType == models.GrantAccountUser) != (grant.OrganizationID != nil) {
+		return memConstraint(ErrCheckViolation, "role_grants", "chk_role_grants_scope", ErrGrantScope,
+			"account_type", "organization_id")
+	}
+	if grant.OrganizationID != nil {
+		if _, ok := d.organizations[*grant.OrganizationID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "role_grants", "role_grants_organization_id_fkey", nil,
+				"organization_id")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemorySAMLStore struct {
+	db *memDB
+}
+
+type samlAssertionKey struct {
+	OrganizationID uuid.UUID
+	AssertionID    string
+}
+
+func cloneSAMLProvider(provider models.SAMLProvider) models.SAMLProvider {
+	provider.Certificates = slices.Clone(provider.Certificates)
+	provider.RoleMappings = slices.Clone(provider.RoleMappings)
+	return provider
+}
+
+func (s *MemorySAMLStore) SaveProvider(ctx context.Context, provider *models.SAMLProvider) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if org, ok := d.organizations[provider.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "saml_providers", "saml_providers_organization_id_fkey", nil,
+				"organization_id")
+		}
+
+		if existing, ok := d.samlProviders[provider.OrganizationID]; ok {
+			provider.CreatedAt = existing.CreatedAt
+			provider.UpdatedAt = time.Now()
+		}
+		stampCreate(&provider.CreatedAt, &provider.UpdatedAt)
+		d.samlProviders[provider.OrganizationID] = cloneSAMLProvider(*provider)
+		return nil
+	})
+}
+
+func (s *MemorySAMLStore) GetProvider(ctx context.Context, orgID uuid.UUID) (*models.SAMLProvider, error) {
+	var provider models.SAMLProvider
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.samlProviders[orgID]
+		if !ok {
+			return ErrSAMLProviderNotFound
+		}
+		provider = cloneSAMLProvider(found)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (s *MemorySAMLStore) DeleteProvider(ctx context.Context, orgID uuid.UUID) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if _, ok := d.samlProviders[orgID]; !ok {
+			return ErrSAMLProviderNotFound
+		}
+		delete(d.samlProviders, orgID)
+		return nil
+	})
+}
+
+func (s *MemorySAMLStore) CreateRequest(ctx context.Context, request *models.SAMLRequest) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if _, ok := d.samlRequests[request.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "saml_requests", "saml_requests_pkey", nil, "id")
+		}
+		if org, ok := d.organizations[request.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "saml_requests", "saml_requests_organization_id_fkey", nil,
+				"organization_id")
+		}
+		stampCreate(&request.CreatedAt, nil)
+		d.samlRequests[request.ID] = *request
+		return nil
+	})
+}
+
+func (s *MemorySAMLStore) ConsumeRequest(ctx context.Context, orgID uuid.UUID, id string, now time.Time) (*models.SAMLRequest, error) {
+	var request models.SAMLRequest
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.samlRequests[id]
+		if !ok || found.OrganizationID != orgID {
+			return ErrInvalidToken
+		}
+		delete(d.samlRequests, id)
+		request = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !request.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &request, nil
+}
+
+func (s *MemorySAMLStore) RecordAssertion(ctx context.Context, assertion *models.SAMLAssertion) error {
+	return s.db.do(ctx, func(d *memData) error {
+		key := samlAssertionKey{OrganizationID: assertion.OrganizationID, AssertionID: assertion.AssertionID}
+		if _, ok := d.samlAssertions[key]; ok {
+			return memConstraint(ErrUniqueViolation, "saml_assertions", "saml_assertions_pkey", ErrSAMLAssertionReplayed,
+				"organization_id", "assertion_id")
+		}
+		if org, ok := d.organizations[assertion.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "saml_assertions", "saml_assertions_organization_id_fkey", nil,
+				"organization_id")
+		}
+		stampCreate(&assertion.CreatedAt, nil)
+		d.samlAssertions[key] = *assertion
+		return nil
+	})
+}
+
+func (s *MemorySAMLStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.do(ctx, func(d *memData) error {
+		for id, request := range d.samlRequests {
+			if !request.ExpiresAt.After(before) {
+				delete(d.samlRequests, id)
+				n++
+			}
+		}
+		for key, assertion := range d.samlAssertions {
+			if !assertion.ExpiresAt.After(before) {
+				delete(d.samlAssertions, key)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+type MemoryScimStore struct {
+	db *memDB
+}
+
+func (s *MemoryScimStore) CreateToken(ctx context.Context, token *models.ScimToken) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if token.ID == uuid.Nil {
+			token.ID = uuid.New()
+		}
+		if _, ok := d.scimTokens[token.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "scim_tokens", "scim_tokens_pkey", nil, "id")
+		}
+		for _, existing := range d.scimTokens {
+			if existing.TokenHash == token.TokenHash {
+				return memConstraint(ErrUniqueViolation, "scim_tokens", "idx_scim_tokens_hash", nil, "token_hash")
+			}
+		}
+		if org, ok := d.organizations[token.OrganizationID]; !ok || org.DeletedAt.Valid {
+			return memConstraint(ErrForeignKeyViolation, "scim_tokens", "scim_tokens_organization_id_fkey", nil, "organization_id")
+		}
+		stampCreate(&token.CreatedAt, nil)
+		d.scimTokens[token.ID] = *token
+		return nil
+	})
+}
+
+func (s *MemoryScimStore) GetToken(ctx context.Context, id uuid.UUID) (*models.ScimToken, error) {
+	var token models.ScimToken
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.scimTokens[id]
+		if !ok {
+			return ErrScimTokenNotFound
+		}
+		token = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *MemoryScimStore) GetTokenByHash(ctx context.Context, tokenHash string) (*models.ScimToken, error) {
+	var token models.ScimToken
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, candidate := range d.scimTokens {
+			if candidate.TokenHash == tokenHash {
+				token = candidate
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *MemoryScimStore) ListTokens(ctx context.Context, orgID uuid.UUID) ([]models.ScimToken, error) {
+	tokens := []models.ScimToken{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, token := range d.scimTokens {
+			if token.OrganizationID == orgID {
+				tokens = append(tokens, token)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(tokens, func(a, b models.ScimToken) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return tokens, err
+}
+
+func (s *MemoryScimStore) RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return s.db.do(ctx, func(d *memData) error {
+		token, ok := d.scimTokens[id]
+		if !ok || token.RevokedAt != nil {
+			return ErrScimTokenNotFound
+		}
+		token.RevokedAt = &at
+		d.scimTokens[id] = token
+		return nil
+	})
+}
+
+func (s *MemoryScimStore) TouchToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if token, ok := d.scimTokens[id]; ok {
+			token.LastUsedAt = &at
+			d.scimTokens[id] = token
+		}
+		return nil
+	})
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type MemoryUserStore struct {
+	db *memDB
+}
+
+func (u *MemoryUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	return u.db.do(ctx, func(d *memData) error {
+		if user.ID == uuid.Nil {
+			user.ID = uuid.New()
+		}
+		if user.Status == "" {
+			user.Status = "pending"
+		}
+		if err := d.checkUser(user); err != nil {
+			return err
+		}
+		stampCreate(&user.CreatedAt, &user.UpdatedAt)
+		d.users[user.ID] = *user
+		return nil
+	})
+}
+
+func (u *MemoryUserStore) UpdateUser(
+	ctx context.Context,
+	userId uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return u.db.do(ctx, func(d *memData) error {
+		user, ok := d.users[userId]
+		if !ok || user.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		if err := applyUpdates(&user, updates); err != nil {
+			return err
+		}
+		if err := d.checkUser(&user); err != nil {
+			return err
+		}
+		d.users[userId] = user
+		return nil
+	})
+}
+
+func (u *MemoryUserStore) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := u.db.do(ctx, func(d *memData) error {
+		found, ok := d.users[id]
+		if !ok || found.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		user = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *MemoryUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := u.db.do(ctx, func(d *memData) error {
+		for _, found := range d.users {
+			if found.Email == email && !found.DeletedAt.Valid {
+				user = found
+				return nil
+			}
+		}
+		return ErrUserNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *MemoryUserStore) LoginUser(ctx context.Context, email, password string) (*models.User, error) {
+	var user models.User
+	err := u.db.do(ctx, func(d *memData) error {
+		for _, found := range d.users {
+			if found.Email == email && !found.DeletedAt.Valid {
+				user = found
+				return nil
+			}
+		}
+		return ErrUserNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !CheckPassword(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &user, nil
+}
+
+func (d *memData) checkUser(user *models.User) error {
+	for _, existing := range d.users {
+		if !user.DeletedAt.Valid && !existing.DeletedAt.Valid && existing.ID != user.ID && existing.Email == user.Email {
+			return memConstraint(ErrUniqueViolation, "users", "idx_users_email", ErrDuplicateEmail, "email")
+		}
+	}
+	return memCheckIn("users", "status", user.Status, "active", "pending", "suspended")
+}
+
+type MemoryUserInviteStore struct {
+	db *memDB
+}
+
+func (a *MemoryUserInviteStore) CreateUserInvites(ctx context.Context, invite *models.UserInvites) error {
+	return a.db.do(ctx, func(d *memData) error {
+		if invite.ID == uuid.Nil {
+			invite.ID = uuid.New()
+		}
+		if _, ok := d.userInvites[invite.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "user_invites", "user_invites_pkey", nil, "id")
+		}
+		stampCreate(&invite.CreatedAt, nil)
+		d.userInvites[invite.ID] = *invite
+		return nil
+	})
+}
+
+func (a *MemoryUserInviteStore) ValidateUserToken(ctx context.Context, token string) (*models.UserInvites, error) {
+	var invite models.UserInvites
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, found := range d.userInvites {
+			if found.TokenHash == token && !found.DeletedAt.Valid {
+				invite = found
+				return nil
+			}
+		}
+		return ErrInvalidToken
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (a *MemoryUserInviteStore) UpdateUserInvite(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	return a.db.do(ctx, func(d *memData) error {
+		invite, ok := d.userInvites[id]
+		if !ok || invite.DeletedAt.Valid {
+			return nil
+		}
+		if err := applyUpdates(&invite, updates); err != nil {
+			return err
+		}
+		d.userInvites[id] = invite
+		return nil
+	})
+}
+
+func (a *MemoryUserInviteStore) GetInviteByUserId(ctx context.Context, userId uuid.UUID) (*models.UserInvites, error) {
+	var invite models.UserInvites
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, found := range d.userInvites {
+			if found.UserId == userId && !found.DeletedAt.Valid {
+				invite = found
+				return nil
+			}
+		}
+		return ErrInviteNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (u *MemoryUserStore) ListUsers(ctx context.Context, p ListParams) ([]models.User, PageInfo, error) {
+	var rows []models.User
+	err := u.db.do(ctx, func(d *memData) error {
+		for _, user := range d.users {
+			if user.DeletedAt.Valid {
+				continue
+			}
+			status, role := user.Status, user.Role
+			if p.OrganizationID != uuid.Nil {
+				membership, ok := d.liveMembership(user.ID, p.OrganizationID)
+				if !ok {
+					continue
+				}
+				status, role = membership.Status, membership.Role
+			}
+			if p.Status != "" && status != p.Status {
+				continue
+			}
+			if p.Role != "" && role != p.Role {
+				continue
+			}
+			rows = append(rows, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return memPage(rows, p, userListSpec,
+		func(user models.User) uuid.UUID { return user.ID },
+		func(user models.User) string { return user.Name + " " + user.Email },
+	)
+}
+
+func (a *MemoryUserInviteStore) ListUserInvites(ctx context.Context, p ListParams) ([]models.UserInvites, PageInfo, error) {
+	if err := validInviteState(p.Status); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	var rows []models.UserInvites
+	now := time.Now()
+	err := a.db.do(ctx, func(d *memData) error {
+		for _, invite := range d.userInvites {
+			if invite.DeletedAt.Valid {
+				continue
+			}
+			if p.OrganizationID != uuid.Nil {
+				if _, ok := d.liveMembership(invite.UserId, p.OrganizationID); !ok {
+					continue
+				}
+			}
+			if p.Status != "" && inviteState(invite.UsedAt, invite.ExpiresAt, now) != p.Status {
+				continue
+			}
+			rows = append(rows, invite)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	return memPage(rows, p, inviteListSpec,
+		func(invite models.UserInvites) uuid.UUID { return invite.ID },
+		nil,
+	)
+}
+
+func (u *MemoryUserStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	at := deletedAt(deletionTime())
+	return u.db.do(ctx, func(d *memData) error {
+		user, ok := d.users[id]
+		if !ok || user.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		user.DeletedAt = at
+		d.users[id] = user
+
+		for membershipID, membership := range d.memberships {
+			if membership.UserID == id && !membership.DeletedAt.Valid {
+				membership.DeletedAt = at
+				d.memberships[membershipID] = membership
+			}
+		}
+		for inviteID, invite := range d.userInvites {
+			if invite.UserId == id && !invite.DeletedAt.Valid {
+				invite.DeletedAt = at
+				d.userInvites[inviteID] = invite
+			}
+		}
+		return nil
+	})
+}
+
+func (u *MemoryUserStore) GetDeletedUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := u.db.do(ctx, func(d *memData) error {
+		found, ok := d.users[id]
+		if !ok || !found.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		user = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *MemoryUserStore) RestoreUser(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	return u.db.do(ctx, func(d *memData) error {
+		user, ok := d.users[id]
+		if !ok || !user.DeletedAt.Valid {
+			return ErrUserNotFound
+		}
+		if err := checkRestorable(user.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+		at := user.DeletedAt
+		user.DeletedAt = gorm.DeletedAt{}
+		if err := d.checkUser(&user); err != nil {
+			return err
+		}
+		d.users[id] = user
+
+		for membershipID, membership := range d.memberships {
+			if membership.UserID != id || membership.DeletedAt != at {
+				continue
+			}
+			if org, ok := d.organizations[membership.OrganizationID]; !ok || org.DeletedAt.Valid {
+				continue
+			}
+			membership.DeletedAt = gorm.DeletedAt{}
+			if err := d.checkMembership(&membership); err != nil {
+				return err
+			}
+			d.memberships[membershipID] = membership
+		}
+		for inviteID, invite := range d.userInvites {
+			if invite.UserId == id && invite.DeletedAt == at {
+				invite.DeletedAt = gorm.DeletedAt{}
+				d.userInvites[inviteID] = invite
+			}
+		}
+		return nil
+	})
+}
+
+func (u *MemoryUserStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := u.db.do(ctx, func(d *memData) error {
+		for id, user := range d.users {
+			if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) {
+				delete(d.users, id)
+				purged++
+
+				for membershipID, membership := range d.memberships {
+					if membership.UserID == id {
+						delete(d.memberships, membershipID)
+					}
+				}
+				for key := range d.groupMembers {
+					if key.userID == id {
+						delete(d.groupMembers, key)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (a *MemoryUserInviteStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := a.db.do(ctx, func(d *memData) error {
+		for id, invite := range d.userInvites {
+			if invite.DeletedAt.Valid && invite.DeletedAt.Time.Before(deletedBefore) {
+				delete(d.userInvites, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
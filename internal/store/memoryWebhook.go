@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// MemoryWebhookStore keeps each subscription's event types on the
+// subscription itself, sorted, instead of in a table of their own.
+type MemoryWebhookStore struct {
+	db *memDB
+}
+
+func (s *MemoryWebhookStore) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if sub.ID == uuid.Nil {
+			sub.ID = uuid.New()
+		}
+		if _, ok := d.webhooks[sub.ID]; ok {
+			return memConstraint(ErrUniqueViolation, "webhook_subscriptions", "webhook_subscriptions_pkey", nil, "id")
+		}
+		stampCreate(&sub.CreatedAt, &sub.UpdatedAt)
+		stored := *sub
+		stored.EventTypes = sortedEventTypes(sub.EventTypes)
+		d.webhooks[sub.ID] = stored
+		return nil
+	})
+}
+
+func (s *MemoryWebhookStore) GetSubscription(ctx context.Context, id uuid.UUID) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := s.db.do(ctx, func(d *memData) error {
+		found, ok := d.webhooks[id]
+		if !ok {
+			return ErrWebhookNotFound
+		}
+		sub = found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *MemoryWebhookStore) ListSubscriptions(ctx context.Context, orgID uuid.UUID) ([]models.WebhookSubscription, error) {
+	subs := []models.WebhookSubscription{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, sub := range d.webhooks {
+			if orgID == uuid.Nil || (sub.OrganizationID != nil && *sub.OrganizationID == orgID) {
+				subs = append(subs, sub)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(subs, func(a, b models.WebhookSubscription) int {
+		return compareKeys(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return subs, err
+}
+
+func (s *MemoryWebhookStore) UpdateSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+	eventTypes []string,
+) error {
+	return s.db.do(ctx, func(d *memData) error {
+		sub, ok := d.webhooks[id]
+		if !ok {
+			return ErrWebhookNotFound
+		}
+		if err := applyUpdates(&sub, updates); err != nil {
+			return err
+		}
+		if eventTypes != nil {
+			sub.EventTypes = sortedEventTypes(eventTypes)
+		}
+		d.webhooks[id] = sub
+		return nil
+	})
+}
+
+func (s *MemoryWebhookStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if _, ok := d.webhooks[id]; !ok {
+			return ErrWebhookNotFound
+		}
+		delete(d.webhooks, id)
+		for deliveryID, delivery := range d.webhookDeliveries {
+			if delivery.SubscriptionID == id {
+				delete(d.webhookDeliveries, deliveryID)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MemoryWebhookStore) MatchSubscriptions(ctx context.Context, orgIDs []uuid.UUID, eventType string) ([]models.WebhookSubscription, error) {
+	subs := []models.WebhookSubscription{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, sub := range d.webhooks {
+			switch {
+			case !sub.Active,
+				sub.OrganizationID != nil && !slices.Contains(orgIDs, *sub.OrganizationID),
+				len(sub.EventTypes) > 0 && !slices.Contains(sub.EventTypes, eventType):
+				continue
+			}
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	slices.SortFunc(subs, func(a, b models.WebhookSubscription) int {
+		return compareKeys(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+	return subs, err
+}
+
+func (s *MemoryWebhookStore) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return s.db.do(ctx, func(d *memData) error {
+		if _, ok := d.webhooks[delivery.SubscriptionID]; !ok {
+			return memConstraint(ErrForeignKeyViolation, "webhook_deliveries", "webhook_deliveries_subscription_id_fkey", nil, "subscription_id")
+		}
+		d.webhookDeliveries[delivery.ID] = *delivery
+		return nil
+	})
+}
+
+func (s *MemoryWebhookStore) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := s.db.do(ctx, func(d *memData) error {
+		for _, delivery := range d.webhookDeliveries {
+			if delivery.SubscriptionID == subscriptionID {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+func sortedEventTypes(eventTypes []string) []string {
+	sorted := slices.Clone(eventTypes)
+	if sorted == nil {
+		sorted = []string{}
+	}
+	slices.Sort(sorted)
+	return sorted
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+func TestMemoryTxRollsBack(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Name: "Rolled Back", Email: "rolled@example.com", Role: "user", Status: "active"}
+
+	errAbort := errors.New("abort")
+	err := s.WithTx(ctx, func(tx TxStorage) error {
+		if err := tx.User.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		if _, err := tx.User.GetUser(ctx, user.ID); err != nil {
+			t.Errorf("the transaction does not see its own write: %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx returned %v, want the callback's error", err)
+	}
+
+	if _, err := s.User.GetUser(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("a rolled back write is visible: %v", err)
+	}
+}
+
+// Outside a transaction the store waits for it to finish, and then sees
+// what it committed.
+func TestMemoryTxIsolated(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Name: "Committed", Email: "committed@example.com", Role: "user", Status: "active"}
+
+	inTx, read := make(chan struct{}), make(chan error)
+	go func() {
+		<-inTx
+		_, err := s.User.GetUser(ctx, user.ID)
+		read <- err
+	}()
+
+	err := s.WithTx(ctx, func(tx TxStorage) error {
+		if err := tx.User.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		close(inTx)
+		select {
+		case err := <-read:
+			t.Errorf("read %v while the transaction was running", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-read; err != nil {
+		t.Errorf("the committed write is not visible: %v", err)
+	}
+}
+
+// Counting and creating in one transaction is atomic, as CountLinks makes it
+// with Postgres, so a limit checked that way holds under concurrency.
+func TestMemoryTxCountThenCreate(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New(), Name: "Linked", Email: "linked@example.com", Role: "user", Status: "active"}
+	admin := &models.Admin{ID: uuid.New(), Name: "Owner", Email: "owner@example.com", Role: "admin", Status: "active"}
+	org := &models.Organization{ID: uuid.New(), Name: "Linked Org", Email: "org@example.com", AdminID: admin.ID}
+	if err := s.Admin.CreateAdmin(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.User.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Organization.CreateOrganization(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+
+	const limit = 2
+	since := time.Now().Add(-time.Hour)
+	var wg sync.WaitGroup
+	for range 4 * limit {
+		wg.Go(func() {
+			err := s.WithTx(ctx, func(tx TxStorage) error {
+				sent, err := tx.MagicLink.CountLinks(ctx, user.Email, since)
+				if err != nil || sent >= limit {
+					return err
+				}
+				// give the other requests every chance to count too
+				time.Sleep(10 * time.Millisecond)
+				return tx.MagicLink.CreateLink(ctx, &models.MagicLink{
+					ID:             uuid.New(),
+					TokenHash:      uuid.NewString(),
+					UserID:         user.ID,
+					OrganizationID: org.ID,
+					Email:          user.Email,
+					ExpiresAt:      time.Now().Add(time.Hour),
+				})
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if sent, err := s.MagicLink.CountLinks(ctx, user.Email, since); err != nil || sent != limit {
+		t.Errorf("created %d links (%v), want the limit of %d", sent, err, limit)
+	}
+}
+
+func TestMemoryUpdateMissingUser(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+
+	err := s.User.UpdateUser(ctx, uuid.New(), map[string]interface{}{"status": "active"})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("updating a missing user returned %v, want %v", err, ErrUserNotFound)
+	}
+}
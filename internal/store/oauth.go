@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type OAuthStore struct {
+	db *gorm.DB
+}
+
+func (o *OAuthStore) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	return dbError(o.db.WithContext(ctx).Create(client).Error, nil)
+}
+
+func (o *OAuthStore) GetClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := o.db.WithContext(ctx).Where("id = ?", id).First(&client).Error
+	if err := dbError(err, ErrOAuthClientNotFound); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients returns every client, oldest first.
+func (o *OAuthStore) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+	err := o.db.WithContext(ctx).Order("created_at, id").Find(&clients).Error
+	return clients, dbError(err, nil)
+}
+
+// UpdateClient stores the client's settings and secret.
+func (o *OAuthStore) UpdateClient(ctx context.Context, client *models.OAuthClient) error {
+	result := o.db.WithContext(ctx).
+		Model(client).
+		Select("name", "secret_hash", "public", "redirect_uris", "grant_types", "scopes", "updated_at").
+		Updates(client)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// DeleteClient deletes the client along with its codes and tokens.
+func (o *OAuthStore) DeleteClient(ctx context.Context, id uuid.UUID) error {
+	result := o.db.WithContext(ctx).Where("id = ?", id).Delete(&models.OAuthClient{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (o *OAuthStore) CreateCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return dbError(o.db.WithContext(ctx).Create(code).Error, nil)
+}
+
+// ConsumeCode deletes the authorization code with the hash and returns it, so
+// it can only be exchanged once. Expired codes are not returned.
+func (o *OAuthStore) ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("code_hash = ?", codeHash).First(&code).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", code.ID).Delete(&models.OAuthAuthorizationCode{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	if !code.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &code, nil
+}
+
+func (o *OAuthStore) CreateToken(ctx context.Context, token *models.OAuthToken) error {
+	return dbError(o.db.WithContext(ctx).Create(token).Error, nil)
+}
+
+// GetTokenByHash returns the token with the hash, whether it is still valid
+// or not.
+func (o *OAuthStore) GetTokenByHash(ctx context.Context, tokenHash string) (*models.OAuthToken, error) {
+	var token models.OAuthToken
+	err := o.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeToken revokes a token that has not been revoked yet. Of two requests
+// revoking the same token, only one succeeds.
+func (o *OAuthStore) RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := o.db.WithContext(ctx).
+		Model(&models.OAuthToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RevokeFamily revokes every token issued from one authorization.
+func (o *OAuthStore) RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	err := o.db.WithContext(ctx).
+		Model(&models.OAuthToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).
+		Error
+	return dbError(err, nil)
+}
+
+// DeleteExpired removes the codes and tokens that expired before before.
+func (o *OAuthStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("expires_at <= ?", before).Delete(&models.OAuthAuthorizationCode{})
+		if result.Error != nil {
+			return result.Error
+		}
+		n = result.RowsAffected
+		result = tx.Where("expires_at <= ?", before).Delete(&models.OAuthToken{})
+		n += result.RowsAffected
+		return result.Error
+	})
+	return n, dbError(err, nil)
+}
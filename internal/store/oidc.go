@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OIDCStore struct {
+	db *gorm.DB
+}
+
+// SaveProvider creates the organization's provider or replaces its settings.
+func (o *OIDCStore) SaveProvider(ctx context.Context, provider *models.OIDCProvider) error {
+	err := o.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"issuer", "client_id", "client_secret", "scopes", "email_claim", "name_claim", "groups_claim",
+			"role_mappings", "default_role", "jit_provisioning", "sso_only", "updated_by", "updated_at",
+		}),
+	}).Create(provider).Error
+	return dbError(err, nil)
+}
+
+func (o *OIDCStore) GetProvider(ctx context.Context, orgID uuid.UUID) (*models.OIDCProvider, error) {
+	var provider models.OIDCProvider
+	err := o.db.WithContext(ctx).Where("organization_id = ?", orgID).First(&provider).Error
+	if err := dbError(err, ErrOIDCProviderNotFound); err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (o *OIDCStore) DeleteProvider(ctx context.Context, orgID uuid.UUID) error {
+	result := o.db.WithContext(ctx).Where("organization_id = ?", orgID).Delete(&models.OIDCProvider{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOIDCProviderNotFound
+	}
+	return nil
+}
+
+func (o *OIDCStore) CreateLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	return dbError(o.db.WithContext(ctx).Create(state).Error, nil)
+}
+
+// ConsumeLoginState deletes the login state with the hash and returns it, so
+// it can only be used once. Expired states are not returned.
+func (o *OIDCStore) ConsumeLoginState(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ?", stateHash).First(&state).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", state.ID).Delete(&models.OIDCLoginState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	if !state.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &state, nil
+}
+
+// DeleteExpiredLoginStates removes the sign-ins abandoned before before.
+func (o *OIDCStore) DeleteExpiredLoginStates(ctx context.Context, before time.Time) (int64, error) {
+	result := o.db.WithContext(ctx).Where("expires_at <= ?", before).Delete(&models.OIDCLoginState{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
@@ -2,8 +2,7 @@ package store
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -15,38 +14,310 @@ type OrganizationStore struct {
 }
 
 func (o *OrganizationStore) CreateOrganization(ctx context.Context, org *models.Organization) error {
-	err := o.db.WithContext(ctx).Create(org).Error
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "Duplicate entry") {
-			return ErrDuplicateOrgEmail
-		}
+	err := dbError(o.db.WithContext(ctx).Create(org).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_organizations_email", ErrDuplicateOrgEmail)
+}
+
+func (o *OrganizationStore) GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var organization models.Organization
+	err := o.db.WithContext(ctx).Where("id = ?", id).First(&organization).Error
+	if err := dbError(err, ErrOrgNotFound); err != nil {
+		return nil, err
 	}
+	return &organization, nil
+}
 
-	return nil
+// DeleteOrganization soft-deletes the organization together with its
+// memberships. Members left without any other organization are deleted too,
+// with their invites. Organizations with live children can't be deleted.
+// Every row gets the same deleted_at, which is how RestoreOrganization tells
+// the cascaded rows apart from ones deleted earlier.
+func (o *OrganizationStore) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
+	at := deletionTime()
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Organization{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrOrgHasChildren
+		}
 
+		result := tx.Model(&models.Organization{}).Where("id = ?", id).Update("deleted_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrgNotFound
+		}
+
+		var orphans []uuid.UUID
+		err := tx.Model(&models.Membership{}).
+			Where("organization_id = ?", id).
+			Where(`NOT EXISTS (SELECT 1 FROM memberships other WHERE other.user_id = memberships.user_id
+				AND other.organization_id <> ? AND other.deleted_at IS NULL)`, id).
+			Pluck("user_id", &orphans).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.Membership{}).Where("organization_id = ?", id).Update("deleted_at", at).Error
+		if err != nil || len(orphans) == 0 {
+			return err
+		}
+		err = tx.Model(&models.UserInvites{}).Where("user_id IN ?", orphans).Update("deleted_at", at).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id IN ?", orphans).Update("deleted_at", at).Error
+	})
+	return dbError(err, nil)
 }
 
-func (o *OrganizationStore) GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+func (o *OrganizationStore) GetDeletedOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
 	var organization models.Organization
-	err := o.db.WithContext(ctx).Where("id = ?", id).First(&organization).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrOrgNotFound
+	err := o.db.WithContext(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&organization).Error
+	if err := dbError(err, ErrOrgNotFound); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// RestoreOrganization undoes DeleteOrganization if it happened at or after
+// deletedSince. Memberships and users deleted on their own before the
+// organization stay deleted.
+func (o *OrganizationStore) RestoreOrganization(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var org models.Organization
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&org).Error
+		if err != nil {
+			return dbError(err, ErrOrgNotFound)
+		}
+		if err := checkRestorable(org.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", org.AdminID).First(&models.Admin{}).Error; err != nil {
+			return dbError(err, ErrOrgOwnerDeleted)
 		}
+
+		at := org.DeletedAt.Time
+		err = tx.Unscoped().Model(&models.Organization{}).Where("id = ?", id).Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		members := tx.Unscoped().Model(&models.Membership{}).Select("user_id").Where("organization_id = ? AND deleted_at = ?", id, at)
+		err = tx.Unscoped().Model(&models.UserInvites{}).
+			Where("deleted_at = ? AND user_id IN (?)", at, members).
+			Update("deleted_at", nil).
+			Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.User{}).
+			Where("deleted_at = ? AND id IN (?)", at, members).
+			Update("deleted_at", nil).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Membership{}).
+			Where("organization_id = ? AND deleted_at = ?", id, at).
+			Update("deleted_at", nil).
+			Error
+	})
+
+	err = withDomain(dbError(err, nil), ErrUniqueViolation, "idx_organizations_email", ErrDuplicateOrgEmail)
+	err = withDomain(err, ErrUniqueViolation, "idx_users_email", ErrDuplicateEmail)
+	return withDomain(err, ErrUniqueViolation, "idx_memberships_user_org", ErrDuplicateMembership)
+}
+
+// ReassignOrganizations hands every organization owned by fromAdminID over to
+// toAdminID, which must be an active admin. Deleted organizations move too so
+// they are restored to the new owner.
+func (o *OrganizationStore) ReassignOrganizations(ctx context.Context, fromAdminID, toAdminID uuid.UUID) (int64, error) {
+	var target models.Admin
+	err := o.db.WithContext(ctx).Where("id = ?", toAdminID).First(&target).Error
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return 0, err
 	}
-	return &organization, err
+	if target.Status != "active" {
+		return 0, ErrAdminNotActive
+	}
+
+	result := o.db.WithContext(ctx).Unscoped().
+		Model(&models.Organization{}).
+		Where("admin_id = ?", fromAdminID).
+		Update("admin_id", toAdminID)
+	return result.RowsAffected, dbError(result.Error, nil)
 }
 
-func (o *OrganizationStore) DeleteOrganization(ctx context.Context, id uuid.UUID) error {
-	result := o.db.Where("id = ?", id).Delete(&models.Organization{})
-	if result.Error != nil {
-		o.db.Rollback()
-		return result.Error
+// PurgeDeleted permanently removes organizations deleted before
+// deletedBefore, along with their memberships.
+func (o *OrganizationStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := o.db.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", deletedBefore).
+		Delete(&models.Organization{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
+
+func (o *OrganizationStore) UpdateOrganization(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+) error {
+	err := o.db.WithContext(ctx).
+		Model(&models.Organization{}).
+		Where("id = ?", id).
+		Updates(updates).
+		Error
+	return withDomain(dbError(err, nil), ErrUniqueViolation, "idx_organizations_email", ErrDuplicateOrgEmail)
+}
+
+func (o *OrganizationStore) RecordSuspension(ctx context.Context, event *models.OrganizationSuspension) error {
+	return dbError(o.db.WithContext(ctx).Create(event).Error, nil)
+}
+
+// ListSuspensions returns the suspension history of an organization, newest
+// first.
+func (o *OrganizationStore) ListSuspensions(ctx context.Context, orgID uuid.UUID) ([]models.OrganizationSuspension, error) {
+	events := []models.OrganizationSuspension{}
+	err := o.db.WithContext(ctx).
+		Where("organization_id = ?", orgID).
+		Order("created_at DESC").
+		Find(&events).
+		Error
+	return events, dbError(err, nil)
+}
+
+var organizationListSpec = listSpec{
+	sortable:    []string{"created_at", "name", "email"},
+	defaultSort: "created_at",
+	search:      searchExpr("organizations"),
+}
+
+// ListOrganizations honours Status, Search, CreatedFrom/CreatedTo and AdminID,
+// the owning admin.
+func (o *OrganizationStore) ListOrganizations(ctx context.Context, p ListParams) ([]models.Organization, PageInfo, error) {
+	q := o.db.WithContext(ctx).Model(&models.Organization{})
+	if p.AdminID != uuid.Nil {
+		q = q.Where("organizations.admin_id = ?", p.AdminID)
 	}
-	if result.RowsAffected == 0 {
-		o.db.Rollback()
-		return ErrOrgNotFound
+	if p.Status != "" {
+		q = q.Where("organizations.status = ?", p.Status)
 	}
+	return gormPage(q, "organizations", p, organizationListSpec, func(org models.Organization) uuid.UUID {
+		return org.ID
+	})
+}
 
-	return o.db.Commit().Error
+// OrganizationNode is an organization inside a subtree, Depth levels below its
+// root.
+type OrganizationNode struct {
+	models.Organization
+	Depth int `json:"depth"`
+}
+
+// orgTreeGuard bounds the recursive tree queries. Moves keep trees far
+// shallower; it only stops a corrupt parent cycle from recursing forever.
+const orgTreeGuard = 100
+
+// ListAncestors returns the live ancestors of the organization, nearest first.
+// The chain stops at a deleted ancestor.
+func (o *OrganizationStore) ListAncestors(ctx context.Context, id uuid.UUID) ([]models.Organization, error) {
+	ancestors := []models.Organization{}
+	err := o.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT parent.*, 1 AS depth
+			FROM organizations parent
+			JOIN organizations child ON child.parent_id = parent.id
+			WHERE child.id = ? AND parent.deleted_at IS NULL
+			UNION ALL
+			SELECT parent.*, ancestors.depth + 1
+			FROM organizations parent
+			JOIN ancestors ON ancestors.parent_id = parent.id
+			WHERE parent.deleted_at IS NULL AND ancestors.depth < ?
+		)
+		SELECT * FROM ancestors ORDER BY depth`, id, orgTreeGuard).
+		Scan(&ancestors).
+		Error
+	return ancestors, dbError(err, nil)
+}
+
+// ListSubtree returns the organization and its live descendants, by depth
+// and then name. The organization itself has depth 0.
+func (o *OrganizationStore) ListSubtree(ctx context.Context, id uuid.UUID) ([]OrganizationNode, error) {
+	nodes := []OrganizationNode{}
+	err := o.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT organizations.*, 0 AS depth
+			FROM organizations
+			WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT child.*, subtree.depth + 1
+			FROM organizations child
+			JOIN subtree ON child.parent_id = subtree.id
+			WHERE child.deleted_at IS NULL AND subtree.depth < ?
+		)
+		SELECT * FROM subtree ORDER BY depth, name, id`, id, orgTreeGuard).
+		Scan(&nodes).
+		Error
+	if err != nil {
+		return nil, dbError(err, nil)
+	}
+	if len(nodes) == 0 {
+		return nil, ErrOrgNotFound
+	}
+	return nodes, nil
+}
+
+// MoveOrganization puts the organization, with its whole subtree, under
+// parentID, or at the top level when parentID is nil. The new parent must not
+// be inside the subtree and the tree must stay within maxDepth levels.
+func (o *OrganizationStore) MoveOrganization(ctx context.Context, id uuid.UUID, parentID *uuid.UUID, maxDepth int) error {
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent moves could otherwise each pass the cycle check and
+		// together close a loop.
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('organization_tree'))").Error; err != nil {
+			return err
+		}
+
+		store := &OrganizationStore{db: tx}
+		subtree, err := store.ListSubtree(ctx, id)
+		if err != nil {
+			return err
+		}
+		if parentID != nil {
+			if _, err := store.GetOrganization(ctx, *parentID); err != nil {
+				return err
+			}
+			ancestors, err := store.ListAncestors(ctx, *parentID)
+			if err != nil {
+				return err
+			}
+			if err := checkOrgMove(subtree, *parentID, len(ancestors)+1, maxDepth); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Organization{}).Where("id = ?", id).Update("parent_id", parentID).Error
+	})
+	return dbError(err, nil)
+}
+
+// checkOrgMove checks that subtree can hang under parentID, which sits
+// parentDepth levels deep.
+func checkOrgMove(subtree []OrganizationNode, parentID uuid.UUID, parentDepth, maxDepth int) error {
+	height := 0
+	for _, node := range subtree {
+		if node.ID == parentID {
+			return ErrOrgCycle
+		}
+		height = max(height, node.Depth+1)
+	}
+	if parentDepth+height > maxDepth {
+		return ErrOrgTooDeep
+	}
+	return nil
 }
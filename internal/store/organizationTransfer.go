@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+)
+
+// TransferFilter narrows ListTransfers. Zero fields match everything;
+// AdminID matches transfers from or to that admin.
+type TransferFilter struct {
+	OrganizationID uuid.UUID
+	AdminID        uuid.UUID
+	Status         string
+}
+
+func (o *OrganizationStore) CreateTransfer(ctx context.Context, transfer *models.OrganizationTransfer) error {
+	err := dbError(o.db.WithContext(ctx).Create(transfer).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_organization_transfers_pending", ErrTransferPending)
+}
+
+func (o *OrganizationStore) GetTransfer(ctx context.Context, id uuid.UUID) (*models.OrganizationTransfer, error) {
+	var transfer models.OrganizationTransfer
+	err := o.db.WithContext(ctx).Where("id = ?", id).First(&transfer).Error
+	if err := dbError(err, ErrTransferNotFound); err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (o *OrganizationStore) GetTransferByToken(ctx context.Context, tokenHash string) (*models.OrganizationTransfer, error) {
+	var transfer models.OrganizationTransfer
+	err := o.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&transfer).Error
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// ListTransfers returns the matching transfers, newest first.
+func (o *OrganizationStore) ListTransfers(ctx context.Context, f TransferFilter) ([]models.OrganizationTransfer, error) {
+	q := o.db.WithContext(ctx).Model(&models.OrganizationTransfer{})
+	if f.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", f.OrganizationID)
+	}
+	if f.AdminID != uuid.Nil {
+		q = q.Where("from_admin_id = ? OR to_admin_id = ?", f.AdminID, f.AdminID)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+
+	transfers := []models.OrganizationTransfer{}
+	err := q.Order("created_at DESC, id").Find(&transfers).Error
+	return transfers, dbError(err, nil)
+}
+
+// ResolveTransfer moves a pending transfer to status, recording by as the
+// admin who resolved it; uuid.Nil records none, as when it expires. It fails
+// with ErrTransferNotPending if the transfer was resolved in the meantime.
+func (o *OrganizationStore) ResolveTransfer(
+	ctx context.Context,
+	id uuid.UUID,
+	status string,
+	by uuid.UUID,
+	at time.Time,
+) error {
+	result := o.db.WithContext(ctx).
+		Model(&models.OrganizationTransfer{}).
+		Where("id = ? AND status = ?", id, models.TransferStatusPending).
+		Updates(resolveTransferUpdates(status, by, at))
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTransferNotPending
+	}
+	return nil
+}
+
+func (o *OrganizationStore) RotateTransferToken(ctx context.Context, id uuid.UUID, tokenHash string) error {
+	result := o.db.WithContext(ctx).
+		Model(&models.OrganizationTransfer{}).
+		Where("id = ? AND status = ?", id, models.TransferStatusPending).
+		Update("token_hash", tokenHash)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTransferNotPending
+	}
+	return nil
+}
+
+func resolveTransferUpdates(status string, by uuid.UUID, at time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"status":      status,
+		"resolved_by": nil,
+		"resolved_at": at,
+	}
+	if by != uuid.Nil {
+		updates["resolved_by"] = by
+	}
+	return updates
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxStore struct {
+	db *gorm.DB
+}
+
+func (o *OutboxStore) Enqueue(ctx context.Context, msg *models.OutboxMessage) error {
+	return dbError(o.db.WithContext(ctx).Create(msg).Error, nil)
+}
+
+// ClaimDue locks up to limit pending messages whose next attempt is due and
+// leases them to the caller until now+lease, so concurrent dispatchers never
+// pick up the same message twice.
+func (o *OutboxStore) ClaimDue(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+	lease time.Duration,
+) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+			Where("locked_until IS NULL OR locked_until < ?", now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&msgs).Error
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+
+		ids := make([]uuid.UUID, len(msgs))
+		for i := range msgs {
+			ids[i] = msgs[i].ID
+		}
+		return tx.Model(&models.OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("locked_until", now.Add(lease)).
+			Error
+	})
+	return msgs, dbError(err, nil)
+}
+
+func (o *OutboxStore) MarkDelivered(ctx context.Context, id uuid.UUID, at time.Time) error {
+	err := o.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       models.OutboxStatusDelivered,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"delivered_at": at,
+			"locked_until": nil,
+			"last_error":   "",
+		}).
+		Error
+	return dbError(err, nil)
+}
+
+// MarkFailed records a failed attempt. The message is retried at nextAttemptAt
+// unless dead is set, in which case it is parked until someone replays it.
+func (o *OutboxStore) MarkFailed(
+	ctx context.Context,
+	id uuid.UUID,
+	lastErr string,
+	nextAttemptAt time.Time,
+	dead bool,
+) error {
+	status := models.OutboxStatusPending
+	if dead {
+		status = models.OutboxStatusDead
+	}
+
+	err := o.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          status,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": nextAttemptAt,
+			"locked_until":    nil,
+			"last_error":      lastErr,
+		}).
+		Error
+	return dbError(err, nil)
+}
+
+func (o *OutboxStore) GetMessage(ctx context.Context, id uuid.UUID) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := o.db.WithContext(ctx).Where("id = ?", id).First(&msg).Error
+	if err := dbError(err, ErrOutboxMessageNotFound); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (o *OutboxStore) ListMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	q := o.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Find(&msgs).Error
+	return msgs, dbError(err, nil)
+}
+
+// Replay puts a dead-lettered message back in the queue with a fresh attempt
+// budget. Pending messages are already queued and delivered ones are done,
+// so both are refused with ErrOutboxMessageNotDead.
+func (o *OutboxStore) Replay(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := o.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, models.OutboxStatusDead).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": at,
+			"locked_until":    nil,
+		})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := o.GetMessage(ctx, id); err != nil {
+			return err
+		}
+		return ErrOutboxMessageNotDead
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidListParams = errors.New("invalid list parameters")
+
+// ListParams selects one page of a list. Not every filter applies to every
+// list; each List method documents the ones it honours.
+type ListParams struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Desc   bool
+
+	// Search is matched against the name and email of the row.
+	Search string
+	// Status filters on the status column. For invites it is the derived
+	// state: pending, used or expired.
+	Status      string
+	Role        string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	OrganizationID uuid.UUID
+	AdminID        uuid.UUID
+}
+
+// PageInfo describes where a page sits in the full list. Pass NextCursor back
+// as ListParams.Cursor to fetch the following page.
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// listSpec describes how a table can be listed.
+type listSpec struct {
+	sortable    []string
+	defaultSort string
+	// search is the tsvector expression backing full-text search. It must
+	// match the expression of the table's GIN index.
+	search string
+}
+
+// cursor is the keyset position after the last row of a page. Sort and Desc
+// are kept so a cursor can't be replayed against a different ordering.
+type cursor struct {
+	Sort  string    `json:"s"`
+	Desc  bool      `json:"d"`
+	Value string    `json:"v"`
+	Time  bool      `json:"t,omitempty"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func invalidParams(format string, args ...any) error {
+	return newKindError(ErrInvalidListParams, fmt.Sprintf(format, args...))
+}
+
+// resolve applies defaults and validates p against spec.
+func (p ListParams) resolve(spec listSpec) (ListParams, *cursor, error) {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	if p.Sort == "" {
+		p.Sort = spec.defaultSort
+	}
+	if !slices.Contains(spec.sortable, p.Sort) {
+		return p, nil, invalidParams("sort must be one of [%s]", strings.Join(spec.sortable, " "))
+	}
+	if p.Search != "" && spec.search == "" {
+		return p, nil, invalidParams("search is not supported on this list")
+	}
+	if p.Cursor == "" {
+		return p, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return p, nil, invalidParams("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return p, nil, invalidParams("invalid cursor")
+	}
+	if c.Sort != p.Sort || c.Desc != p.Desc {
+		return p, nil, invalidParams("cursor was issued for a different sort order")
+	}
+	return p, &c, nil
+}
+
+func (c *cursor) value() (any, error) {
+	if !c.Time {
+		return c.Value, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return nil, invalidParams("invalid cursor")
+	}
+	return t, nil
+}
+
+// columnValue reads a column from a model by its database name.
+func columnValue(row any, column string) (any, error) {
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	sch, err := schema.Parse(rv.Addr().Interface(), &modelSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	field := sch.LookUpField(column)
+	if field == nil {
+		return nil, fmt.Errorf("unknown column %q on %s", column, sch.Table)
+	}
+	value, _ := field.ValueOf(context.Background(), rv)
+	return value, nil
+}
+
+func encodeCursor(p ListParams, row any, id uuid.UUID) (string, error) {
+	value, err := columnValue(row, p.Sort)
+	if err != nil {
+		return "", err
+	}
+
+	c := cursor{Sort: p.Sort, Desc: p.Desc, ID: id}
+	switch v := value.(type) {
+	case time.Time:
+		c.Value = v.UTC().Format(time.RFC3339Nano)
+		c.Time = true
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+var searchWordRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// searchWords splits free text into lowercase words, dropping punctuation so
+// an email address searches as its parts.
+func searchWords(text string) []string {
+	return searchWordRe.FindAllString(strings.ToLower(text), -1)
+}
+
+// tsQuery turns a search into a prefix query, so "acm cor" matches
+// "Acme Corp".
+func tsQuery(search string) string {
+	words := searchWords(search)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchExpr is the tsvector expression over name and email used by search
+// and by the GIN indexes created in the migrations.
+func searchExpr(table string) string {
+	return fmt.Sprintf(
+		`to_tsvector('simple', coalesce(%[1]s.name, '') || ' ' || regexp_replace(coalesce(%[1]s.email, ''), '[@.]', ' ', 'g'))`,
+		table,
+	)
+}
+
+// gormPage runs q as one page of a keyset-paginated list. getID returns the
+// primary key of a row.
+func gormPage[T any](
+	q *gorm.DB,
+	table string,
+	p ListParams,
+	spec listSpec,
+	getID func(T) uuid.UUID,
+) ([]T, PageInfo, error) {
+	p, cur, err := p.resolve(spec)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	if p.Search != "" {
+		if query := tsQuery(p.Search); query != "" {
+			q = q.Where(spec.search+" @@ to_tsquery('simple', ?)", query)
+		}
+	}
+	if p.CreatedFrom != nil {
+		q = q.Where(table+".created_at >= ?", *p.CreatedFrom)
+	}
+	if p.CreatedTo != nil {
+		q = q.Where(table+".created_at < ?", *p.CreatedTo)
+	}
+
+	dir, op := "ASC", ">"
+	if p.Desc {
+		dir, op = "DESC", "<"
+	}
+	if cur != nil {
+		value, err := cur.value()
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		q = q.Where(fmt.Sprintf("(%[1]s.%[2]s, %[1]s.id) %[3]s (?, ?)", table, p.Sort, op), value, cur.ID)
+	}
+
+	var rows []T
+	err = q.Order(fmt.Sprintf("%[1]s.%[2]s %[3]s, %[1]s.id %[3]s", table, p.Sort, dir)).
+		Limit(p.Limit + 1).
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, PageInfo{}, dbError(err, nil)
+	}
+
+	return finishPage(rows, p, getID)
+}
+
+func finishPage[T any](rows []T, p ListParams, getID func(T) uuid.UUID) ([]T, PageInfo, error) {
+	info := PageInfo{Limit: p.Limit}
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) <= p.Limit {
+		return rows, info, nil
+	}
+
+	rows = rows[:p.Limit]
+	last := rows[len(rows)-1]
+	next, err := encodeCursor(p, &last, getID(last))
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	info.HasMore = true
+	info.NextCursor = next
+	return rows, info, nil
+}
+
+// memPage is the in-memory counterpart of gormPage. rows must already be
+// filtered on everything except search, created range and the cursor;
+// searchText returns the text a row is searched by.
+func memPage[T any](
+	rows []T,
+	p ListParams,
+	spec listSpec,
+	getID func(T) uuid.UUID,
+	searchText func(T) string,
+) ([]T, PageInfo, error) {
+	p, cur, err := p.resolve(spec)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	var curValue any
+	if cur != nil {
+		if curValue, err = cur.value(); err != nil {
+			return nil, PageInfo{}, err
+		}
+	}
+
+	words := searchWords(p.Search)
+	filtered := rows[:0:0]
+	for _, row := range rows {
+		if len(words) > 0 && !memMatches(searchText(row), words) {
+			continue
+		}
+		created, _ := columnValue(&row, "created_at")
+		if createdAt, ok := created.(time.Time); ok {
+			if p.CreatedFrom != nil && createdAt.Before(*p.CreatedFrom) {
+				continue
+			}
+			if p.CreatedTo != nil && !createdAt.Before(*p.CreatedTo) {
+				continue
+			}
+		}
+		if cur != nil {
+			value, err := columnValue(&row, p.Sort)
+			if err != nil {
+				return nil, PageInfo{}, err
+			}
+			c := compareKeys(value, getID(row), curValue, cur.ID)
+			if (!p.Desc && c <= 0) || (p.Desc && c >= 0) {
+				continue
+			}
+		}
+		filtered = append(filtered, row)
+	}
+
+	var sortErr error
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, err := columnValue(&filtered[i], p.Sort)
+		if err != nil {
+			sortErr = err
+		}
+		b, _ := columnValue(&filtered[j], p.Sort)
+		c := compareKeys(a, getID(filtered[i]), b, getID(filtered[j]))
+		if p.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if sortErr != nil {
+		return nil, PageInfo{}, sortErr
+	}
+
+	if len(filtered) > p.Limit+1 {
+		filtered = filtered[:p.Limit+1]
+	}
+	return finishPage(filtered, p, getID)
+}
+
+// compareKeys orders (value, id) pairs the way Postgres compares row values.
+func compareKeys(a any, aID uuid.UUID, b any, bID uuid.UUID) int {
+	c := 0
+	switch av := a.(type) {
+	case time.Time:
+		bv, _ := b.(time.Time)
+		c = av.Compare(bv)
+	default:
+		c = strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(aID.String(), bID.String())
+}
+
+// memMatches reports whether every search word prefixes a word of text.
+func memMatches(text string, words []string) bool {
+	have := searchWords(text)
+	for _, w := range words {
+		if !slices.ContainsFunc(have, func(h string) bool { return strings.HasPrefix(h, w) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Invite states accepted by ListParams.Status on the invite lists.
+const (
+	InviteStatePending = "pending"
+	InviteStateUsed    = "used"
+	InviteStateExpired = "expired"
+)
+
+// inviteStateQuery filters invites on their derived state. Unused invites keep
+// a zero used_at rather than NULL.
+func inviteStateQuery(q *gorm.DB, table, state string, now time.Time) (*gorm.DB, error) {
+	if err := validInviteState(state); err != nil {
+		return nil, err
+	}
+
+	unused := fmt.Sprintf("(%[1]s.used_at IS NULL OR %[1]s.used_at <= ?)", table)
+	switch state {
+	case InviteStatePending:
+		return q.Where(unused+" AND "+table+".expires_at > ?", time.Time{}, now), nil
+	case InviteStateUsed:
+		return q.Where(table+".used_at > ?", time.Time{}), nil
+	case InviteStateExpired:
+		return q.Where(unused+" AND "+table+".expires_at <= ?", time.Time{}, now), nil
+	default:
+		return q, nil
+	}
+}
+
+func validInviteState(state string) error {
+	switch state {
+	case "", InviteStatePending, InviteStateUsed, InviteStateExpired:
+		return nil
+	default:
+		return invalidParams("status must be one of [pending used expired]")
+	}
+}
+
+func inviteState(usedAt, expiresAt, now time.Time) string {
+	switch {
+	case !usedAt.IsZero():
+		return InviteStateUsed
+	case !expiresAt.After(now):
+		return InviteStateExpired
+	default:
+		return InviteStatePending
+	}
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type ReviewStore struct {
+	db *gorm.DB
+}
+
+// ReviewScope says which access CollectEntitlements captures. With
+// OrganizationID set it is every membership and live grant in that
+// organization. Otherwise it is every admin, membership and live grant that
+// gives one of Roles, plus the grants of the single Permission.
+type ReviewScope struct {
+	OrganizationID uuid.UUID
+	Roles          []string
+	Permission     string
+}
+
+// ReviewFilter narrows ListReviews. Zero fields match everything.
+type ReviewFilter struct {
+	Status     string
+	ReviewerID uuid.UUID
+}
+
+// CollectEntitlements snapshots the access in scope at at as unsaved review
+// items, ordered by account.
+func (s *ReviewStore) CollectEntitlements(ctx context.Context, scope ReviewScope, at time.Time) ([]models.AccessReviewItem, error) {
+	db := s.db.WithContext(ctx)
+	items := []models.AccessReviewItem{}
+
+	if scope.OrganizationID == uuid.Nil && len(scope.Roles) > 0 {
+		admins := []models.Admin{}
+		if err := db.Where("role IN ?", scope.Roles).Order("id").Find(&admins).Error; err != nil {
+			return nil, dbError(err, nil)
+		}
+		for _, admin := range admins {
+			items = append(items, adminReviewItem(admin))
+		}
+	}
+
+	memberships := []models.Membership{}
+	q := db.Model(&models.Membership{})
+	if scope.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", scope.OrganizationID)
+	} else {
+		q = q.Where("role IN ?", scope.Roles)
+	}
+	if err := q.Order("user_id, organization_id").Find(&memberships).Error; err != nil {
+		return nil, dbError(err, nil)
+	}
+	for _, membership := range memberships {
+		items = append(items, membershipReviewItem(membership))
+	}
+
+	grants := []models.RoleGrant{}
+	q = db.Model(&models.RoleGrant{}).Where("revoked_at IS NULL AND valid_until > ?", at)
+	if scope.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", scope.OrganizationID)
+	} else {
+		q = q.Where("(role <> '' AND role IN ?) OR (permission <> '' AND permission = ?)", scope.Roles, scope.Permission)
+	}
+	if err := q.Order("account_id, valid_from").Find(&grants).Error; err != nil {
+		return nil, dbError(err, nil)
+	}
+	for _, grant := range grants {
+		items = append(items, grantReviewItem(grant))
+	}
+
+	return items, s.fillReviewEmails(ctx, items)
+}
+
+// fillReviewEmails copies the current email of each item's account onto it,
+// so the evidence still names the account after it is gone.
+func (s *ReviewStore) fillReviewEmails(ctx context.Context, items []models.AccessReviewItem) error {
+	ids := map[string][]uuid.UUID{}
+	for _, item := range items {
+		ids[item.AccountType] = append(ids[item.AccountType], item.AccountID)
+	}
+
+	emails := map[uuid.UUID]string{}
+	if len(ids[models.GrantAccountAdmin]) > 0 {
+		admins := []models.Admin{}
+		err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", ids[models.GrantAccountAdmin]).Find(&admins).Error
+		if err != nil {
+			return dbError(err, nil)
+		}
+		for _, admin := range admins {
+			emails[admin.ID] = admin.Email
+		}
+	}
+	if len(ids[models.GrantAccountUser]) > 0 {
+		users := []models.User{}
+		err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", ids[models.GrantAccountUser]).Find(&users).Error
+		if err != nil {
+			return dbError(err, nil)
+		}
+		for _, user := range users {
+			emails[user.ID] = user.Email
+		}
+	}
+
+	for i := range items {
+		items[i].AccountEmail = emails[items[i].AccountID]
+	}
+	return nil
+}
+
+// CreateReview saves a review with its reviewers and items.
+func (s *ReviewStore) CreateReview(
+	ctx context.Context,
+	review *models.AccessReview,
+	reviewers []models.AccessReviewer,
+	items []models.AccessReviewItem,
+) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		for i := range reviewers {
+			reviewers[i].ReviewID = review.ID
+		}
+		if err := tx.Create(&reviewers).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for i := range items {
+			items[i].ReviewID = review.ID
+		}
+		return tx.CreateInBatches(&items, 500).Error
+	})
+	return dbError(err, nil)
+}
+
+func (s *ReviewStore) GetReview(ctx context.Context, id uuid.UUID) (*models.AccessReview, error) {
+	var review models.AccessReview
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&review).Error
+	if err := dbError(err, ErrReviewNotFound); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ListReviews returns the matching reviews, newest first.
+func (s *ReviewStore) ListReviews(ctx context.Context, f ReviewFilter) ([]models.AccessReview, error) {
+	db := s.db.WithContext(ctx)
+	q := db.Model(&models.AccessReview{})
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.ReviewerID != uuid.Nil {
+		q = q.Where("id IN (?)", db.Model(&models.AccessReviewer{}).Select("review_id").Where("admin_id = ?", f.ReviewerID))
+	}
+
+	reviews := []models.AccessReview{}
+	err := q.Order("created_at DESC, id").Find(&reviews).Error
+	return reviews, dbError(err, nil)
+}
+
+func (s *ReviewStore) ListReviewers(ctx context.Context, reviewID uuid.UUID) ([]models.AccessReviewer, error) {
+	reviewers := []models.AccessReviewer{}
+	err := s.db.WithContext(ctx).
+		Where("review_id = ?", reviewID).
+		Order("created_at, admin_id").
+		Find(&reviewers).
+		Error
+	return reviewers, dbError(err, nil)
+}
+
+func (s *ReviewStore) GetItem(ctx context.Context, id uuid.UUID) (*models.AccessReviewItem, error) {
+	var item models.AccessReviewItem
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&item).Error
+	if err := dbError(err, ErrReviewItemNotFound); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListItems returns the items of a review by account, optionally only those
+// with decision.
+func (s *ReviewStore) ListItems(ctx context.Context, reviewID uuid.UUID, decision string) ([]models.AccessReviewItem, error) {
+	q := s.db.WithContext(ctx).Where("review_id = ?", reviewID)
+	if decision != "" {
+		q = q.Where("decision = ?", decision)
+	}
+
+	items := []models.AccessReviewItem{}
+	err := q.Order("account_id, source, source_id").Find(&items).Error
+	return items, dbError(err, nil)
+}
+
+// DecideItem records a reviewer's decision. Decisions can change until the
+// review closes; after that it fails with ErrReviewClosed.
+func (s *ReviewStore) DecideItem(
+	ctx context.Context,
+	id uuid.UUID,
+	decision, comment string,
+	by uuid.UUID,
+	at time.Time,
+) error {
+	db := s.db.WithContext(ctx)
+	openReviews := db.Model(&models.AccessReview{}).Select("id").Where("status = ?", models.ReviewStatusOpen)
+	result := db.
+		Model(&models.AccessReviewItem{}).
+		Where("id = ? AND review_id IN (?)", id, openReviews).
+		Updates(map[string]interface{}{
+			"decision":    decision,
+			"comment":     comment,
+			"reviewed_by": by,
+			"reviewed_at": at,
+		})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetItem(ctx, id); err != nil {
+			return err
+		}
+		return ErrReviewClosed
+	}
+	return nil
+}
+
+// MarkItemApplied records that a revocation was carried out, with a note when
+// there was nothing left to revoke.
+func (s *ReviewStore) MarkItemApplied(ctx context.Context, id uuid.UUID, note string, at time.Time) error {
+	err := s.db.WithContext(ctx).
+		Model(&models.AccessReviewItem{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"applied_at": at, "apply_note": note}).
+		Error
+	return dbError(err, nil)
+}
+
+// CloseReview signs a review off. Closed reviews fail with ErrReviewClosed.
+func (s *ReviewStore) CloseReview(ctx context.Context, id, by uuid.UUID, at time.Time) error {
+	result := s.db.WithContext(ctx).
+		Model(&models.AccessReview{}).
+		Where("id = ? AND status = ?", id, models.ReviewStatusOpen).
+		Updates(map[string]interface{}{
+			"status":    models.ReviewStatusClosed,
+			"closed_by": by,
+			"closed_at": at,
+		})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetReview(ctx, id); err != nil {
+			return err
+		}
+		return ErrReviewClosed
+	}
+	return nil
+}
+
+func adminReviewItem(admin models.Admin) models.AccessReviewItem {
+	return models.AccessReviewItem{
+		AccountType: models.GrantAccountAdmin,
+		AccountID:   admin.ID,
+		Source:      models.ReviewSourceAdmin,
+		SourceID:    admin.ID,
+		Role:        admin.Role,
+	}
+}
+
+func membershipReviewItem(membership models.Membership) models.AccessReviewItem {
+	orgID := membership.OrganizationID
+	return models.AccessReviewItem{
+		AccountType:    models.GrantAccountUser,
+		AccountID:      membership.UserID,
+		Source:         models.ReviewSourceMembership,
+		SourceID:       membership.ID,
+		OrganizationID: &orgID,
+		Role:           membership.Role,
+	}
+}
+
+func grantReviewItem(grant models.RoleGrant) models.AccessReviewItem {
+	validUntil := grant.ValidUntil
+	return models.AccessReviewItem{
+		AccountType:    grant.AccountType,
+		AccountID:      grant.AccountID,
+		Source:         models.ReviewSourceGrant,
+		SourceID:       grant.ID,
+		OrganizationID: grant.OrganizationID,
+		Role:           grant.Role,
+		Permission:     grant.Permission,
+		ValidUntil:     &validUntil,
+	}
+}
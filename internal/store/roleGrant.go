@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type RoleGrantStore struct {
+	db *gorm.DB
+}
+
+// GrantFilter narrows ListGrants. Zero fields match everything; Status is
+// one of the models.GrantStatus values, judged at the time of the call.
+type GrantFilter struct {
+	AccountID      uuid.UUID
+	OrganizationID uuid.UUID
+	Kind           string
+	Status         string
+}
+
+// GrantStatus tells where grant stands at at.
+func GrantStatus(grant models.RoleGrant, at time.Time) string {
+	switch {
+	case grant.RevokedAt != nil:
+		return models.GrantStatusRevoked
+	case !grant.ValidUntil.After(at):
+		return models.GrantStatusExpired
+	case grant.ValidFrom.After(at):
+		return models.GrantStatusScheduled
+	default:
+		return models.GrantStatusActive
+	}
+}
+
+func (g *RoleGrantStore) CreateGrant(ctx context.Context, grant *models.RoleGrant) error {
+	err := dbError(g.db.WithContext(ctx).Create(grant).Error, nil)
+	err = withDomain(err, ErrCheckViolation, "chk_role_grants_window", ErrGrantWindow)
+	err = withDomain(err, ErrCheckViolation, "chk_role_grants_target", ErrGrantTarget)
+	return withDomain(err, ErrCheckViolation, "chk_role_grants_scope", ErrGrantScope)
+}
+
+func (g *RoleGrantStore) GetGrant(ctx context.Context, id uuid.UUID) (*models.RoleGrant, error) {
+	var grant models.RoleGrant
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&grant).Error
+	if err := dbError(err, ErrGrantNotFound); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// ListGrants returns the matching grants, newest first.
+func (g *RoleGrantStore) ListGrants(ctx context.Context, f GrantFilter) ([]models.RoleGrant, error) {
+	q := g.db.WithContext(ctx).Model(&models.RoleGrant{})
+	if f.AccountID != uuid.Nil {
+		q = q.Where("account_id = ?", f.AccountID)
+	}
+	if f.OrganizationID != uuid.Nil {
+		q = q.Where("organization_id = ?", f.OrganizationID)
+	}
+	if f.Kind != "" {
+		q = q.Where("kind = ?", f.Kind)
+	}
+
+	now := time.Now()
+	switch f.Status {
+	case models.GrantStatusRevoked:
+		q = q.Where("revoked_at IS NOT NULL")
+	case models.GrantStatusExpired:
+		q = q.Where("revoked_at IS NULL AND valid_until <= ?", now)
+	case models.GrantStatusScheduled:
+		q = q.Where("revoked_at IS NULL AND valid_from > ? AND valid_until > ?", now, now)
+	case models.GrantStatusActive:
+		q = q.Where("revoked_at IS NULL AND valid_from <= ? AND valid_until > ?", now, now)
+	}
+
+	grants := []models.RoleGrant{}
+	err := q.Order("created_at DESC, id").Find(&grants).Error
+	return grants, dbError(err, nil)
+}
+
+// ActiveGrants returns the account's assigned and elevated grants that are in
+// force at at. orgID scopes a user's grants to the organization they are
+// acting in; admins pass nil.
+func (g *RoleGrantStore) ActiveGrants(ctx context.Context, accountID uuid.UUID, orgID *uuid.UUID, at time.Time) ([]models.RoleGrant, error) {
+	q := g.db.WithContext(ctx).
+		Model(&models.RoleGrant{}).
+		Where("account_id = ? AND kind IN ?", accountID, []string{models.GrantKindAssigned, models.GrantKindElevated}).
+		Where("revoked_at IS NULL AND valid_from <= ? AND valid_until > ?", at, at)
+	if orgID == nil {
+		q = q.Where("organization_id IS NULL")
+	} else {
+		q = q.Where("organization_id = ?", *orgID)
+	}
+
+	grants := []models.RoleGrant{}
+	err := q.Order("valid_from, id").Find(&grants).Error
+	return grants, dbError(err, nil)
+}
+
+// RevokeGrant ends a grant early. Grants that have already expired or been
+// revoked fail with ErrGrantEnded.
+func (g *RoleGrantStore) RevokeGrant(ctx context.Context, id, by uuid.UUID, at time.Time) error {
+	result := g.db.WithContext(ctx).
+		Model(&models.RoleGrant{}).
+		Where("id = ? AND revoked_at IS NULL AND valid_until > ?", id, at).
+		Updates(map[string]interface{}{
+			"revoked_at": at,
+			"revoked_by": by,
+		})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := g.GetGrant(ctx, id); err != nil {
+			return err
+		}
+		return ErrGrantEnded
+	}
+	return nil
+}
+
+// ExpireGrants stamps expired_at on every grant whose window closed by at.
+// Permissions never depend on it; it records when the expiry was noticed.
+func (g *RoleGrantStore) ExpireGrants(ctx context.Context, at time.Time) (int64, error) {
+	result := g.db.WithContext(ctx).
+		Model(&models.RoleGrant{}).
+		Where("revoked_at IS NULL AND expired_at IS NULL AND valid_until <= ?", at).
+		Update("expired_at", at)
+	return result.RowsAffected, dbError(result.Error, nil)
+}
+
+// ListExpiringGrants returns live grants that end before before and whose
+// holder has not been told yet, soonest first.
+func (g *RoleGrantStore) ListExpiringGrants(ctx context.Context, before time.Time) ([]models.RoleGrant, error) {
+	grants := []models.RoleGrant{}
+	err := g.db.WithContext(ctx).
+		Where("revoked_at IS NULL AND expired_at IS NULL AND notified_at IS NULL").
+		Where("valid_until > ? AND valid_until <= ?", time.Now(), before).
+		Order("valid_until, id").
+		Find(&grants).
+		Error
+	return grants, dbError(err, nil)
+}
+
+// MarkGrantNotified records that the holder was told about the coming
+// expiry. It reports false if someone else already did.
+func (g *RoleGrantStore) MarkGrantNotified(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	result := g.db.WithContext(ctx).
+		Model(&models.RoleGrant{}).
+		Where("id = ? AND notified_at IS NULL", id).
+		Update("notified_at", at)
+	return result.RowsAffected == 1, dbError(result.Error, nil)
+}
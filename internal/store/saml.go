@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SAMLStore struct {
+	db *gorm.DB
+}
+
+// SaveProvider creates the organization's provider or replaces its settings.
+func (s *SAMLStore) SaveProvider(ctx context.Context, provider *models.SAMLProvider) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"entity_id", "sso_url", "certificates", "metadata_url", "email_attribute", "name_attribute",
+			"groups_attribute", "role_mappings", "default_role", "jit_provisioning", "sso_only", "updated_by", "updated_at",
+		}),
+	}).Create(provider).Error
+	return dbError(err, nil)
+}
+
+func (s *SAMLStore) GetProvider(ctx context.Context, orgID uuid.UUID) (*models.SAMLProvider, error) {
+	var provider models.SAMLProvider
+	err := s.db.WithContext(ctx).Where("organization_id = ?", orgID).First(&provider).Error
+	if err := dbError(err, ErrSAMLProviderNotFound); err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (s *SAMLStore) DeleteProvider(ctx context.Context, orgID uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("organization_id = ?", orgID).Delete(&models.SAMLProvider{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSAMLProviderNotFound
+	}
+	return nil
+}
+
+func (s *SAMLStore) CreateRequest(ctx context.Context, request *models.SAMLRequest) error {
+	return dbError(s.db.WithContext(ctx).Create(request).Error, nil)
+}
+
+// ConsumeRequest deletes the organization's request with the id and returns
+// it, so it can only be answered once. Expired requests are not returned.
+func (s *SAMLStore) ConsumeRequest(ctx context.Context, orgID uuid.UUID, id string, now time.Time) (*models.SAMLRequest, error) {
+	var request models.SAMLRequest
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND organization_id = ?", id, orgID).First(&request).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", request.ID).Delete(&models.SAMLRequest{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	if !request.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	return &request, nil
+}
+
+// RecordAssertion remembers an accepted assertion, failing with
+// ErrSAMLAssertionReplayed if it was accepted before.
+func (s *SAMLStore) RecordAssertion(ctx context.Context, assertion *models.SAMLAssertion) error {
+	err := dbError(s.db.WithContext(ctx).Create(assertion).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "saml_assertions_pkey", ErrSAMLAssertionReplayed)
+}
+
+// DeleteExpired removes requests and assertions that expired before before.
+func (s *SAMLStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("expires_at <= ?", before).Delete(&models.SAMLRequest{})
+		if result.Error != nil {
+			return result.Error
+		}
+		n = result.RowsAffected
+		result = tx.Where("expires_at <= ?", before).Delete(&models.SAMLAssertion{})
+		n += result.RowsAffected
+		return result.Error
+	})
+	return n, dbError(err, nil)
+}
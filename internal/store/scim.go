@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type ScimStore struct {
+	db *gorm.DB
+}
+
+func (s *ScimStore) CreateToken(ctx context.Context, token *models.ScimToken) error {
+	return dbError(s.db.WithContext(ctx).Create(token).Error, nil)
+}
+
+func (s *ScimStore) GetToken(ctx context.Context, id uuid.UUID) (*models.ScimToken, error) {
+	var token models.ScimToken
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&token).Error
+	if err := dbError(err, ErrScimTokenNotFound); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetTokenByHash returns the token with the hash, revoked or not.
+func (s *ScimStore) GetTokenByHash(ctx context.Context, tokenHash string) (*models.ScimToken, error) {
+	var token models.ScimToken
+	err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListTokens returns the organization's tokens, newest first.
+func (s *ScimStore) ListTokens(ctx context.Context, orgID uuid.UUID) ([]models.ScimToken, error) {
+	tokens := []models.ScimToken{}
+	err := s.db.WithContext(ctx).
+		Where("organization_id = ?", orgID).
+		Order("created_at DESC, id").
+		Find(&tokens).
+		Error
+	return tokens, dbError(err, nil)
+}
+
+// RevokeToken revokes a token that has not been revoked yet.
+func (s *ScimStore) RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := s.db.WithContext(ctx).
+		Model(&models.ScimToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrScimTokenNotFound
+	}
+	return nil
+}
+
+// TouchToken records that the token was used at at.
+func (s *ScimStore) TouchToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	err := s.db.WithContext(ctx).
+		Model(&models.ScimToken{}).
+		Where("id = ?", id).
+		UpdateColumn("last_used_at", at).
+		Error
+	return dbError(err, nil)
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deletionTime is the deleted_at stamped on a row and on everything deleted
+// along with it. It is truncated to the precision Postgres stores, so a
+// restore can find the cascaded rows by comparing deleted_at for equality.
+func deletionTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// checkRestorable rejects restoring a row deleted before since, the start of
+// the restore window.
+func checkRestorable(deletedAt gorm.DeletedAt, since time.Time) error {
+	if deletedAt.Time.Before(since) {
+		return ErrRestoreExpired
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -10,12 +11,69 @@ import (
 )
 
 var (
-	ErrUserNotFound      = errors.New("user does not exist")
-	ErrDuplicateEmail    = errors.New("user with email already exists")
-	ErrDuplicateOrgEmail = errors.New("organization with email already exists")
-	ErrInvalidToken      = errors.New("invalid token ")
-	ErrInviteNotFound    = errors.New("User does not have an invite ")
-	ErrOrgNotFound       = errors.New("Organization not found")
+	ErrUserNotFound       = newKindError(ErrNotFound, "user does not exist")
+	ErrDuplicateEmail     = newKindError(ErrUniqueViolation, "user with email already exists")
+	ErrDuplicateOrgEmail  = newKindError(ErrUniqueViolation, "organization with email already exists")
+	ErrInvalidToken       = newKindError(ErrNotFound, "invalid token ")
+	ErrInviteNotFound     = newKindError(ErrNotFound, "User does not have an invite ")
+	ErrOrgNotFound        = newKindError(ErrNotFound, "Organization not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	ErrOutboxMessageNotFound = newKindError(ErrNotFound, "outbox message not found")
+	ErrOutboxMessageNotDead  = errors.New("only dead-lettered outbox messages can be replayed")
+
+	ErrRestoreExpired  = errors.New("the restore window for this record has passed")
+	ErrAdminOwnsOrgs   = newKindError(ErrForeignKeyViolation, "admin still owns organizations")
+	ErrOrgOwnerDeleted = newKindError(ErrForeignKeyViolation, "the organization's admin has been deleted")
+	ErrAdminNotActive  = newKindError(ErrCheckViolation, "organizations can only be assigned to an active admin")
+	ErrOrgDeleted      = newKindError(ErrForeignKeyViolation, "the organization has been deleted; restore it first")
+
+	ErrOrgHasChildren = newKindError(ErrForeignKeyViolation, "organization still has child organizations; move or delete them first")
+	ErrOrgCycle       = newKindError(ErrCheckViolation, "an organization cannot be moved under itself or one of its descendants")
+	ErrOrgTooDeep     = newKindError(ErrCheckViolation, "the organization tree would exceed the maximum depth")
+
+	ErrTransferNotFound   = newKindError(ErrNotFound, "transfer not found")
+	ErrTransferPending    = newKindError(ErrUniqueViolation, "organization already has a pending transfer")
+	ErrTransferNotPending = errors.New("transfer is no longer pending")
+
+	ErrGrantNotFound = newKindError(ErrNotFound, "role grant not found")
+	ErrGrantWindow   = newKindError(ErrCheckViolation, "validUntil must be after validFrom")
+	ErrGrantScope    = newKindError(ErrCheckViolation, "user grants need an organization and admin grants cannot have one")
+	ErrGrantTarget   = newKindError(ErrCheckViolation, "a grant gives either a role or a permission")
+	ErrGrantEnded    = errors.New("role grant has already expired or been revoked")
+
+	ErrAccessRequestNotFound   = newKindError(ErrNotFound, "access request not found")
+	ErrDuplicateAccessRequest  = newKindError(ErrUniqueViolation, "you already have a pending request for this access")
+	ErrDuplicateDecision       = newKindError(ErrUniqueViolation, "you have already decided on this request")
+	ErrAccessQuorum            = newKindError(ErrCheckViolation, "quorum must be at least 1")
+	ErrAccessRequestNotPending = errors.New("access request is no longer pending")
+
+	ErrReviewNotFound     = newKindError(ErrNotFound, "access review not found")
+	ErrReviewItemNotFound = newKindError(ErrNotFound, "access review item not found")
+	ErrReviewClosed       = errors.New("access review is closed")
+
+	ErrMembershipNotFound  = newKindError(ErrNotFound, "membership not found")
+	ErrDuplicateMembership = newKindError(ErrUniqueViolation, "user is already a member of this organization")
+
+	ErrGroupNotFound        = newKindError(ErrNotFound, "group not found")
+	ErrGroupMemberNotFound  = newKindError(ErrNotFound, "user is not in this group")
+	ErrGroupRoleNotFound    = newKindError(ErrNotFound, "role is not bound to this group")
+	ErrDuplicateGroup       = newKindError(ErrUniqueViolation, "a group with this name already exists in the organization")
+	ErrDuplicateGroupMember = newKindError(ErrUniqueViolation, "user is already in this group")
+	ErrDuplicateGroupRole   = newKindError(ErrUniqueViolation, "role is already bound to this group")
+	ErrGroupParentOrg       = newKindError(ErrCheckViolation, "a parent group must belong to the same organization")
+	ErrGroupCycle           = newKindError(ErrCheckViolation, "a group cannot be nested under itself or one of its subgroups")
+
+	ErrWebhookNotFound = newKindError(ErrNotFound, "webhook subscription not found")
+
+	ErrScimTokenNotFound = newKindError(ErrNotFound, "SCIM token not found")
+
+	ErrOIDCProviderNotFound = newKindError(ErrNotFound, "organization has no OIDC provider")
+
+	ErrSAMLProviderNotFound  = newKindError(ErrNotFound, "organization has no SAML identity provider")
+	ErrSAMLAssertionReplayed = newKindError(ErrUniqueViolation, "this SAML assertion was already used")
+
+	ErrOAuthClientNotFound = newKindError(ErrNotFound, "OAuth client not found")
 )
 
 type AdminStoreInterface interface {
@@ -28,6 +86,10 @@ type AdminStoreInterface interface {
 		adminID uuid.UUID,
 		updates map[string]interface{},
 	) error
+	ListAdmins(ctx context.Context, p ListParams) ([]models.Admin, PageInfo, error)
+	DeleteAdmin(ctx context.Context, id uuid.UUID) error
+	RestoreAdmin(ctx context.Context, id uuid.UUID, deletedSince time.Time) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type AdminInviteStoreInterface interface {
@@ -39,22 +101,214 @@ type AdminInviteStoreInterface interface {
 		updates map[string]interface{},
 	) error
 	GetInviteByAdminId(ctx context.Context, adminID uuid.UUID) (*models.AdminInvites, error)
+	ListAdminInvites(ctx context.Context, p ListParams) ([]models.AdminInvites, PageInfo, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type OrganizationStoreInterface interface {
 	CreateOrganization(ctx context.Context, org *models.Organization) error
 	GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error)
 	DeleteOrganization(ctx context.Context, id uuid.UUID) error
+	ListOrganizations(ctx context.Context, p ListParams) ([]models.Organization, PageInfo, error)
+	GetDeletedOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	RestoreOrganization(ctx context.Context, id uuid.UUID, deletedSince time.Time) error
+	ReassignOrganizations(ctx context.Context, fromAdminID, toAdminID uuid.UUID) (int64, error)
+	ListAncestors(ctx context.Context, id uuid.UUID) ([]models.Organization, error)
+	ListSubtree(ctx context.Context, id uuid.UUID) ([]OrganizationNode, error)
+	MoveOrganization(ctx context.Context, id uuid.UUID, parentID *uuid.UUID, maxDepth int) error
+	UpdateOrganization(
+		ctx context.Context,
+		id uuid.UUID,
+		updates map[string]interface{},
+	) error
+	RecordSuspension(ctx context.Context, event *models.OrganizationSuspension) error
+	ListSuspensions(ctx context.Context, orgID uuid.UUID) ([]models.OrganizationSuspension, error)
+	CreateTransfer(ctx context.Context, transfer *models.OrganizationTransfer) error
+	GetTransfer(ctx context.Context, id uuid.UUID) (*models.OrganizationTransfer, error)
+	GetTransferByToken(ctx context.Context, tokenHash string) (*models.OrganizationTransfer, error)
+	ListTransfers(ctx context.Context, f TransferFilter) ([]models.OrganizationTransfer, error)
+	ResolveTransfer(ctx context.Context, id uuid.UUID, status string, by uuid.UUID, at time.Time) error
+	// RotateTransferToken replaces the token of a pending transfer, or
+	// returns ErrTransferNotPending.
+	RotateTransferToken(ctx context.Context, id uuid.UUID, tokenHash string) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type UserStoreInterface interface {
-	AddUserToOrganization(ctx context.Context, user *models.User) error
+	CreateUser(ctx context.Context, user *models.User) error
 	UpdateUser(
 		ctx context.Context,
 		userId uuid.UUID,
 		updates map[string]interface{},
 	) error
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	LoginUser(ctx context.Context, email, password string) (*models.User, error)
+	ListUsers(ctx context.Context, p ListParams) ([]models.User, PageInfo, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	GetDeletedUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	RestoreUser(ctx context.Context, id uuid.UUID, deletedSince time.Time) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+type MembershipStoreInterface interface {
+	CreateMembership(ctx context.Context, membership *models.Membership) error
+	GetMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error)
+	GetDeletedMembership(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error)
+	ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]models.Membership, error)
+	ListOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]OrganizationMember, error)
+	UpdateMembership(
+		ctx context.Context,
+		id uuid.UUID,
+		updates map[string]interface{},
+	) error
+	DeleteMembership(ctx context.Context, id uuid.UUID) error
+	RestoreMembership(ctx context.Context, id uuid.UUID, deletedSince time.Time) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+type GroupStoreInterface interface {
+	CreateGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error)
+	ListGroups(ctx context.Context, orgID uuid.UUID) ([]models.Group, error)
+	UpdateGroup(
+		ctx context.Context,
+		id uuid.UUID,
+		updates map[string]interface{},
+	) error
+	DeleteGroup(ctx context.Context, id uuid.UUID) error
+	AddMember(ctx context.Context, member *models.GroupMember) error
+	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error
+	ListMembers(ctx context.Context, groupID uuid.UUID) ([]models.User, error)
+	AddRole(ctx context.Context, role *models.GroupRole) error
+	RemoveRole(ctx context.Context, groupID uuid.UUID, role string) error
+	ListRoles(ctx context.Context, groupID uuid.UUID) ([]models.GroupRole, error)
+	UserRoles(ctx context.Context, userID, orgID uuid.UUID) ([]string, error)
+	RoleHolders(ctx context.Context, orgID uuid.UUID, roles []string) ([]GroupRoleHolder, error)
+}
+
+type RoleGrantStoreInterface interface {
+	CreateGrant(ctx context.Context, grant *models.RoleGrant) error
+	GetGrant(ctx context.Context, id uuid.UUID) (*models.RoleGrant, error)
+	ListGrants(ctx context.Context, f GrantFilter) ([]models.RoleGrant, error)
+	ActiveGrants(ctx context.Context, accountID uuid.UUID, orgID *uuid.UUID, at time.Time) ([]models.RoleGrant, error)
+	RevokeGrant(ctx context.Context, id, by uuid.UUID, at time.Time) error
+	ExpireGrants(ctx context.Context, at time.Time) (int64, error)
+	ListExpiringGrants(ctx context.Context, before time.Time) ([]models.RoleGrant, error)
+	MarkGrantNotified(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+}
+
+type AccessStoreInterface interface {
+	GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.AccessPolicy, error)
+	SetPolicy(ctx context.Context, policy *models.AccessPolicy, approvers []models.AccessApprover) error
+	ListApprovers(ctx context.Context, orgID uuid.UUID) ([]models.AccessApprover, error)
+	CreateRequest(ctx context.Context, req *models.AccessRequest) error
+	GetRequest(ctx context.Context, id uuid.UUID) (*models.AccessRequest, error)
+	ListRequests(ctx context.Context, f AccessRequestFilter) ([]models.AccessRequest, error)
+	ListExpiredRequests(ctx context.Context, at time.Time) ([]models.AccessRequest, error)
+	ResolveRequest(ctx context.Context, id uuid.UUID, status string, grantID *uuid.UUID, at time.Time) error
+	RecordDecision(ctx context.Context, decision *models.AccessDecision) error
+	ListDecisions(ctx context.Context, requestID uuid.UUID) ([]models.AccessDecision, error)
+}
+
+type ReviewStoreInterface interface {
+	CollectEntitlements(ctx context.Context, scope ReviewScope, at time.Time) ([]models.AccessReviewItem, error)
+	CreateReview(
+		ctx context.Context,
+		review *models.AccessReview,
+		reviewers []models.AccessReviewer,
+		items []models.AccessReviewItem,
+	) error
+	GetReview(ctx context.Context, id uuid.UUID) (*models.AccessReview, error)
+	ListReviews(ctx context.Context, f ReviewFilter) ([]models.AccessReview, error)
+	ListReviewers(ctx context.Context, reviewID uuid.UUID) ([]models.AccessReviewer, error)
+	GetItem(ctx context.Context, id uuid.UUID) (*models.AccessReviewItem, error)
+	ListItems(ctx context.Context, reviewID uuid.UUID, decision string) ([]models.AccessReviewItem, error)
+	DecideItem(ctx context.Context, id uuid.UUID, decision, comment string, by uuid.UUID, at time.Time) error
+	MarkItemApplied(ctx context.Context, id uuid.UUID, note string, at time.Time) error
+	CloseReview(ctx context.Context, id, by uuid.UUID, at time.Time) error
+}
+
+type AuditStoreInterface interface {
+	Append(ctx context.Context, event *models.AuditEvent) error
+	ListEvents(ctx context.Context, f AuditFilter, p ListParams) ([]models.AuditEvent, PageInfo, error)
+	ChainEvents(ctx context.Context, afterSeq int64, limit int) ([]models.AuditEvent, error)
+}
+
+type AuthzStoreInterface interface {
+	AppendDecisions(ctx context.Context, decisions []models.AuthzDecision) error
+	ListDecisions(ctx context.Context, f AuthzFilter, limit int) ([]models.AuthzDecision, error)
+	PurgeDecisions(ctx context.Context, before time.Time) (int64, error)
+}
+
+type WebhookStoreInterface interface {
+	CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context, orgID uuid.UUID) ([]models.WebhookSubscription, error)
+	UpdateSubscription(
+		ctx context.Context,
+		id uuid.UUID,
+		updates map[string]interface{},
+		eventTypes []string,
+	) error
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	MatchSubscriptions(ctx context.Context, orgIDs []uuid.UUID, eventType string) ([]models.WebhookSubscription, error)
+	RecordDelivery(ctx context.Context, d *models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]models.WebhookDelivery, error)
+}
+
+type ScimStoreInterface interface {
+	CreateToken(ctx context.Context, token *models.ScimToken) error
+	GetToken(ctx context.Context, id uuid.UUID) (*models.ScimToken, error)
+	GetTokenByHash(ctx context.Context, tokenHash string) (*models.ScimToken, error)
+	ListTokens(ctx context.Context, orgID uuid.UUID) ([]models.ScimToken, error)
+	RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error
+	TouchToken(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+type OIDCStoreInterface interface {
+	SaveProvider(ctx context.Context, provider *models.OIDCProvider) error
+	GetProvider(ctx context.Context, orgID uuid.UUID) (*models.OIDCProvider, error)
+	DeleteProvider(ctx context.Context, orgID uuid.UUID) error
+	CreateLoginState(ctx context.Context, state *models.OIDCLoginState) error
+	ConsumeLoginState(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLoginState, error)
+	DeleteExpiredLoginStates(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SAMLStoreInterface interface {
+	SaveProvider(ctx context.Context, provider *models.SAMLProvider) error
+	GetProvider(ctx context.Context, orgID uuid.UUID) (*models.SAMLProvider, error)
+	DeleteProvider(ctx context.Context, orgID uuid.UUID) error
+	CreateRequest(ctx context.Context, request *models.SAMLRequest) error
+	ConsumeRequest(ctx context.Context, orgID uuid.UUID, id string, now time.Time) (*models.SAMLRequest, error)
+	RecordAssertion(ctx context.Context, assertion *models.SAMLAssertion) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type MagicLinkStoreInterface interface {
+	GetPolicy(ctx context.Context, orgID uuid.UUID) (*models.MagicLinkPolicy, error)
+	SetPolicy(ctx context.Context, policy *models.MagicLinkPolicy) error
+	CreateLink(ctx context.Context, link *models.MagicLink) error
+	CountLinks(ctx context.Context, email string, since time.Time) (int64, error)
+	GetLink(ctx context.Context, tokenHash string, now time.Time) (*models.MagicLink, error)
+	UseLink(ctx context.Context, id uuid.UUID, now time.Time) error
+	RotateLink(ctx context.Context, id uuid.UUID, tokenHash string, now time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OAuthStoreInterface interface {
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	GetClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error)
+	ListClients(ctx context.Context) ([]models.OAuthClient, error)
+	UpdateClient(ctx context.Context, client *models.OAuthClient) error
+	DeleteClient(ctx context.Context, id uuid.UUID) error
+	CreateCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	ConsumeCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error)
+	CreateToken(ctx context.Context, token *models.OAuthToken) error
+	GetTokenByHash(ctx context.Context, tokenHash string) (*models.OAuthToken, error)
+	RevokeToken(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
 }
 
 type UserInviteStoreInterface interface {
@@ -66,6 +320,29 @@ type UserInviteStoreInterface interface {
 		updates map[string]interface{},
 	) error
 	GetInviteByUserId(ctx context.Context, userId uuid.UUID) (*models.UserInvites, error)
+	ListUserInvites(ctx context.Context, p ListParams) ([]models.UserInvites, PageInfo, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+type OutboxStoreInterface interface {
+	Enqueue(ctx context.Context, msg *models.OutboxMessage) error
+	ClaimDue(
+		ctx context.Context,
+		now time.Time,
+		limit int,
+		lease time.Duration,
+	) ([]models.OutboxMessage, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID, at time.Time) error
+	MarkFailed(
+		ctx context.Context,
+		id uuid.UUID,
+		lastErr string,
+		nextAttemptAt time.Time,
+		dead bool,
+	) error
+	GetMessage(ctx context.Context, id uuid.UUID) (*models.OutboxMessage, error)
+	ListMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error)
+	Replay(ctx context.Context, id uuid.UUID, at time.Time) error
 }
 
 type Storage struct {
@@ -74,6 +351,22 @@ type Storage struct {
 	Organization OrganizationStoreInterface
 	User         UserStoreInterface
 	UserInvite   UserInviteStoreInterface
+	Membership   MembershipStoreInterface
+	Group        GroupStoreInterface
+	Grant        RoleGrantStoreInterface
+	Access       AccessStoreInterface
+	Review       ReviewStoreInterface
+	Audit        AuditStoreInterface
+	Authz        AuthzStoreInterface
+	Webhook      WebhookStoreInterface
+	Scim         ScimStoreInterface
+	OIDC         OIDCStoreInterface
+	SAML         SAMLStoreInterface
+	MagicLink    MagicLinkStoreInterface
+	OAuth        OAuthStoreInterface
+	Outbox       OutboxStoreInterface
+
+	runTx func(ctx context.Context, fn func(tx TxStorage) error) error
 }
 
 func NewStorage(db *gorm.DB) Storage {
@@ -83,6 +376,24 @@ func NewStorage(db *gorm.DB) Storage {
 		Organization: &OrganizationStore{db: db},
 		User:         &UserStore{db: db},
 		UserInvite:   &UserInviteStore{db: db},
+		Membership:   &MembershipStore{db: db},
+		Group:        &GroupStore{db: db},
+		Grant:        &RoleGrantStore{db: db},
+		Access:       &AccessStore{db: db},
+		Review:       &ReviewStore{db: db},
+		Audit:        &AuditStore{db: db},
+		Authz:        &AuthzStore{db: db},
+		Webhook:      &WebhookStore{db: db},
+		Scim:         &ScimStore{db: db},
+		OIDC:         &OIDCStore{db: db},
+		SAML:         &SAMLStore{db: db},
+		MagicLink:    &MagicLinkStore{db: db},
+		OAuth:        &OAuthStore{db: db},
+		Outbox:       &OutboxStore{db: db},
+
+		runTx: func(ctx context.Context, fn func(tx TxStorage) error) error {
+			return gormTx(ctx, db, fn)
+		},
 	}
 }
 
@@ -92,10 +403,30 @@ type TxStorage struct {
 	Organization OrganizationStoreInterface
 	User         UserStoreInterface
 	UserInvite   UserInviteStoreInterface
+	Membership   MembershipStoreInterface
+	Group        GroupStoreInterface
+	Grant        RoleGrantStoreInterface
+	Access       AccessStoreInterface
+	Review       ReviewStoreInterface
+	Audit        AuditStoreInterface
+	Authz        AuthzStoreInterface
+	Webhook      WebhookStoreInterface
+	Scim         ScimStoreInterface
+	OIDC         OIDCStoreInterface
+	SAML         SAMLStoreInterface
+	MagicLink    MagicLinkStoreInterface
+	OAuth        OAuthStoreInterface
+	Outbox       OutboxStoreInterface
 }
 
+// WithTx runs fn with stores bound to a single transaction. The transaction
+// is committed if fn returns nil and rolled back otherwise.
 func (s Storage) WithTx(ctx context.Context, fn func(tx TxStorage) error) error {
-	tx := s.Admin.(*AdminStore).db.WithContext(ctx).Begin()
+	return s.runTx(ctx, fn)
+}
+
+func gormTx(ctx context.Context, db *gorm.DB, fn func(tx TxStorage) error) error {
+	tx := db.WithContext(ctx).Begin()
 	if tx.Error != nil {
 		return tx.Error
 	}
@@ -106,6 +437,20 @@ func (s Storage) WithTx(ctx context.Context, fn func(tx TxStorage) error) error
 		Organization: &OrganizationStore{db: tx},
 		User:         &UserStore{db: tx},
 		UserInvite:   &UserInviteStore{db: tx},
+		Membership:   &MembershipStore{db: tx},
+		Group:        &GroupStore{db: tx},
+		Grant:        &RoleGrantStore{db: tx},
+		Access:       &AccessStore{db: tx},
+		Review:       &ReviewStore{db: tx},
+		Audit:        &AuditStore{db: tx},
+		Authz:        &AuthzStore{db: tx},
+		Webhook:      &WebhookStore{db: tx},
+		Scim:         &ScimStore{db: tx},
+		OIDC:         &OIDCStore{db: tx},
+		SAML:         &SAMLStore{db: tx},
+		MagicLink:    &MagicLinkStore{db: tx},
+		OAuth:        &OAuthStore{db: tx},
+		Outbox:       &OutboxStore{db: tx},
 	}
 
 	err := fn(txs)
@@ -2,8 +2,7 @@ package store
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -14,14 +13,9 @@ type UserStore struct {
 	db *gorm.DB
 }
 
-func (u *UserStore) AddUserToOrganization(ctx context.Context, user *models.User) error {
-	err := u.db.WithContext(ctx).Create(user).Error
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "Duplicate entry") {
-			return ErrDuplicateEmail
-		}
-	}
-	return err
+func (u *UserStore) CreateUser(ctx context.Context, user *models.User) error {
+	err := dbError(u.db.WithContext(ctx).Create(user).Error, nil)
+	return withDomain(err, ErrUniqueViolation, "idx_users_email", ErrDuplicateEmail)
 
 }
 
@@ -30,30 +24,152 @@ func (a *UserStore) UpdateUser(
 	userId uuid.UUID,
 	updates map[string]interface{},
 ) error {
-	return a.db.WithContext(ctx).
+	result := a.db.WithContext(ctx).
 		Model(&models.User{}).
 		Where("id = ?", userId).
-		Updates(updates).
-		Error
+		Updates(updates)
+	if result.Error != nil {
+		return withDomain(dbError(result.Error, nil), ErrUniqueViolation, "idx_users_email", ErrDuplicateEmail)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
 
-func (u *UserStore) LoginUser(ctx context.Context, email, password string) (*models.User, error) {
+func (u *UserStore) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := u.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *UserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := u.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
-	if err != nil {
-		switch {
-		case err.Error() == "record not found":
-			return nil, ErrUserNotFound
-		default:
-			return nil, err
-		}
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 
+func (u *UserStore) LoginUser(ctx context.Context, email, password string) (*models.User, error) {
+	var user models.User
+	err := u.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
 	}
 
 	if !CheckPassword(password, user.Password) {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	return &user, nil
 
 }
+
+var userListSpec = listSpec{
+	sortable:    []string{"created_at", "name", "email"},
+	defaultSort: "created_at",
+	search:      searchExpr("users"),
+}
+
+// ListUsers honours OrganizationID, Status, Role, Search and
+// CreatedFrom/CreatedTo. With OrganizationID set, only members of that
+// organization are listed and Status and Role match their membership rather
+// than the account.
+func (u *UserStore) ListUsers(ctx context.Context, p ListParams) ([]models.User, PageInfo, error) {
+	q := u.db.WithContext(ctx).Model(&models.User{})
+	if p.OrganizationID != uuid.Nil {
+		members := u.db.Model(&models.Membership{}).Select("user_id").Where("organization_id = ?", p.OrganizationID)
+		if p.Status != "" {
+			members = members.Where("status = ?", p.Status)
+		}
+		if p.Role != "" {
+			members = members.Where("role = ?", p.Role)
+		}
+		q = q.Where("users.id IN (?)", members)
+	} else {
+		if p.Status != "" {
+			q = q.Where("users.status = ?", p.Status)
+		}
+		if p.Role != "" {
+			q = q.Where("users.role = ?", p.Role)
+		}
+	}
+	return gormPage(q, "users", p, userListSpec, func(user models.User) uuid.UUID {
+		return user.ID
+	})
+}
+
+// DeleteUser soft-deletes the user with their memberships and invites.
+func (u *UserStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	at := deletionTime()
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ?", id).Update("deleted_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		err := tx.Model(&models.Membership{}).Where("user_id = ?", id).Update("deleted_at", at).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.UserInvites{}).Where("user_id = ?", id).Update("deleted_at", at).Error
+	})
+	return dbError(err, nil)
+}
+
+func (u *UserStore) GetDeletedUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := u.db.WithContext(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error
+	if err := dbError(err, ErrUserNotFound); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RestoreUser undoes DeleteUser if it happened at or after deletedSince.
+// Memberships in organizations that have since been deleted stay deleted and
+// come back with their organization.
+func (u *UserStore) RestoreUser(ctx context.Context, id uuid.UUID, deletedSince time.Time) error {
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error
+		if err != nil {
+			return dbError(err, ErrUserNotFound)
+		}
+		if err := checkRestorable(user.DeletedAt, deletedSince); err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Model(&models.User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.Membership{}).
+			Where("user_id = ? AND deleted_at = ?", id, user.DeletedAt.Time).
+			Where("organization_id IN (?)", tx.Model(&models.Organization{}).Select("id")).
+			Update("deleted_at", nil).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.UserInvites{}).
+			Where("user_id = ? AND deleted_at = ?", id, user.DeletedAt.Time).
+			Update("deleted_at", nil).
+			Error
+	})
+	err = withDomain(dbError(err, nil), ErrUniqueViolation, "idx_users_email", ErrDuplicateEmail)
+	return withDomain(err, ErrUniqueViolation, "idx_memberships_user_org", ErrDuplicateMembership)
+}
+
+// PurgeDeleted permanently removes users deleted before deletedBefore.
+func (u *UserStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := u.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&models.User{})
+	return result.RowsAffected, dbError(result.Error, nil)
+}
@@ -2,8 +2,7 @@ package store
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mightyfzeus/rbac/internal/models"
@@ -15,24 +14,16 @@ type UserInviteStore struct {
 }
 
 func (a *UserInviteStore) CreateUserInvites(ctx context.Context, invite *models.UserInvites) error {
-	err := a.db.WithContext(ctx).Create(invite).Error
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "Duplicate entry") {
-			return ErrDuplicateEmail
-		}
-	}
-	return err
+	return dbError(a.db.WithContext(ctx).Create(invite).Error, nil)
 }
 
 func (a *UserInviteStore) ValidateUserToken(ctx context.Context, token string) (*models.UserInvites, error) {
 	var invite models.UserInvites
 	err := a.db.WithContext(ctx).Where("token_hash = ?", token).First(&invite).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrInvalidToken
-		}
+	if err := dbError(err, ErrInvalidToken); err != nil {
+		return nil, err
 	}
-	return &invite, err
+	return &invite, nil
 }
 
 func (a *UserInviteStore) UpdateUserInvite(
@@ -40,20 +31,43 @@ func (a *UserInviteStore) UpdateUserInvite(
 	id uuid.UUID,
 	updates map[string]interface{},
 ) error {
-	return a.db.WithContext(ctx).
+	err := a.db.WithContext(ctx).
 		Model(&models.UserInvites{}).
 		Where("id = ?", id).
 		Updates(updates).
 		Error
+	return dbError(err, nil)
 }
 
 func (a *UserInviteStore) GetInviteByUserId(ctx context.Context, userId uuid.UUID) (*models.UserInvites, error) {
 	var invite models.UserInvites
 	err := a.db.WithContext(ctx).Where("user_id = ?", userId).First(&invite).Error
+	if err := dbError(err, ErrInviteNotFound); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ListUserInvites honours OrganizationID (one the invited user is a member
+// of), Status (the invite state) and CreatedFrom/CreatedTo.
+func (a *UserInviteStore) ListUserInvites(ctx context.Context, p ListParams) ([]models.UserInvites, PageInfo, error) {
+	q := a.db.WithContext(ctx).Model(&models.UserInvites{})
+	if p.OrganizationID != uuid.Nil {
+		q = q.Where("user_invites.user_id IN (?)",
+			a.db.Model(&models.Membership{}).Select("user_id").Where("organization_id = ?", p.OrganizationID),
+		)
+	}
+	q, err := inviteStateQuery(q, "user_invites", p.Status, time.Now())
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrInviteNotFound
-		}
+		return nil, PageInfo{}, err
 	}
-	return &invite, err
+	return gormPage(q, "user_invites", p, inviteListSpec, func(invite models.UserInvites) uuid.UUID {
+		return invite.ID
+	})
+}
+
+// PurgeDeleted permanently removes invites deleted before deletedBefore.
+func (a *UserInviteStore) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := a.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&models.UserInvites{})
+	return result.RowsAffected, dbError(result.Error, nil)
 }
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/mightyfzeus/rbac/internal/models"
+	"gorm.io/gorm"
+)
+
+type WebhookStore struct {
+	db *gorm.DB
+}
+
+func (s *WebhookStore) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sub).Error; err != nil {
+			return err
+		}
+		return setWebhookEventTypes(tx, sub.ID, sub.EventTypes)
+	})
+	return dbError(err, nil)
+}
+
+func (s *WebhookStore) GetSubscription(ctx context.Context, id uuid.UUID) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&sub).Error
+	if err := dbError(err, ErrWebhookNotFound); err != nil {
+		return nil, err
+	}
+	subs := []models.WebhookSubscription{sub}
+	if err := loadWebhookEventTypes(s.db.WithContext(ctx), subs); err != nil {
+		return nil, err
+	}
+	return &subs[0], nil
+}
+
+// ListSubscriptions returns the subscriptions of the organization, or every
+// subscription when orgID is uuid.Nil, oldest first.
+func (s *WebhookStore) ListSubscriptions(ctx context.Context, orgID uuid.UUID) ([]models.WebhookSubscription, error) {
+	subs := []models.WebhookSubscription{}
+	q := s.db.WithContext(ctx).Order("created_at, id")
+	if orgID != uuid.Nil {
+		q = q.Where("organization_id = ?", orgID)
+	}
+	if err := q.Find(&subs).Error; err != nil {
+		return nil, dbError(err, nil)
+	}
+	return subs, loadWebhookEventTypes(s.db.WithContext(ctx), subs)
+}
+
+// UpdateSubscription applies updates and, unless eventTypes is nil, replaces
+// the event types.
+func (s *WebhookStore) UpdateSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+	updates map[string]interface{},
+	eventTypes []string,
+) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.WebhookSubscription{}).Where("id = ?", id).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		if eventTypes == nil {
+			return nil
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.WebhookEventType{}).Error; err != nil {
+			return err
+		}
+		return setWebhookEventTypes(tx, id, eventTypes)
+	})
+	return dbError(err, nil)
+}
+
+// DeleteSubscription removes the subscription with its event types and
+// delivery log.
+func (s *WebhookStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&models.WebhookSubscription{})
+	if result.Error != nil {
+		return dbError(result.Error, nil)
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// MatchSubscriptions returns the active subscriptions that receive
+// eventType from any of the organizations orgIDs: theirs and the global
+// ones.
+func (s *WebhookStore) MatchSubscriptions(ctx context.Context, orgIDs []uuid.UUID, eventType string) ([]models.WebhookSubscription, error) {
+	subs := []models.WebhookSubscription{}
+	err := s.db.WithContext(ctx).
+		Where("active").
+		Where("organization_id IN ? OR organization_id IS NULL", orgIDs).
+		Where(`NOT EXISTS (SELECT 1 FROM webhook_event_types t WHERE t.subscription_id = webhook_subscriptions.id)
+			OR EXISTS (SELECT 1 FROM webhook_event_types t WHERE t.subscription_id = webhook_subscriptions.id AND t.event_type = ?)`, eventType).
+		Order("created_at, id").
+		Find(&subs).
+		Error
+	return subs, dbError(err, nil)
+}
+
+func (s *WebhookStore) RecordDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	return dbError(s.db.WithContext(ctx).Create(d).Error, nil)
+}
+
+// ListDeliveries returns up to limit deliveries of the subscription, newest
+// first.
+func (s *WebhookStore) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := s.db.WithContext(ctx).
+		Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+	return deliveries, dbError(err, nil)
+}
+
+func setWebhookEventTypes(tx *gorm.DB, id uuid.UUID, eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return nil
+	}
+	rows := make([]models.WebhookEventType, len(eventTypes))
+	for i, eventType := range eventTypes {
+		rows[i] = models.WebhookEventType{SubscriptionID: id, EventType: eventType}
+	}
+	return tx.Create(&rows).Error
+}
+
+func loadWebhookEventTypes(db *gorm.DB, subs []models.WebhookSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(subs))
+	for i := range subs {
+		ids[i] = subs[i].ID
+		subs[i].EventTypes = []string{}
+	}
+	var rows []models.WebhookEventType
+	if err := db.Where("subscription_id IN ?", ids).Order("event_type").Find(&rows).Error; err != nil {
+		return dbError(err, nil)
+	}
+	for _, row := range rows {
+		i := slices.Index(ids, row.SubscriptionID)
+		subs[i].EventTypes = append(subs[i].EventTypes, row.EventType)
+	}
+	return nil
+}